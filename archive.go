@@ -0,0 +1,238 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unknownOwner names the user/group of archive entries without ownership
+// information (zip files).
+const unknownOwner = "(unknown)"
+
+// ScanArchive builds a Result from the entry headers of a .tar, gzip-compressed
+// .tar or .zip file, as if its contents had been extracted and scanned. The
+// format is detected from the file's magic bytes. Tar entries carry their own
+// uid/gid and owner names; zip entries are attributed to "(unknown)". strip
+// drops that many leading components of every entry name, as
+// -strip-components does.
+func ScanArchive(archivePath string, strip int) (*Result, error) {
+	abs, err := filepath.Abs(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(abs)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	res := newArchiveResult(abs)
+	ownerless := false
+	err = readArchive(f, func(e archiveEntry) error {
+		name := stripComponents(e.Name, strip)
+		if name == "" {
+			return nil
+		}
+		if e.Dir {
+			res.addArchiveDir(name)
+			if e.HasOwner {
+				res.DirOwners[name] = ownerOr(e.Uname, e.UID)
+				res.DirGroups[name] = ownerOr(e.Gname, e.GID)
+			}
+			return nil
+		}
+		res.addFile(path.Dir(name), e.Size, e.UID, e.GID)
+		res.FilesScanned++
+		if !e.HasOwner {
+			ownerless = true
+			return nil
+		}
+		if us := res.UserStats[strconv.FormatUint(uint64(e.UID), 10)]; us != nil && e.Uname != "" {
+			us.Name = e.Uname
+		}
+		if gs := res.GroupStats[strconv.FormatUint(uint64(e.GID), 10)]; gs != nil && e.Gname != "" {
+			gs.Name = e.Gname
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ownerless {
+		if us := res.UserStats["0"]; us != nil {
+			us.Name = unknownOwner
+		}
+		if gs := res.GroupStats["0"]; gs != nil {
+			gs.Name = unknownOwner
+		}
+	}
+	res.DirsScanned = int64(len(res.DirStats))
+	res.EndedAt = time.Now()
+	return res, nil
+}
+
+func newArchiveResult(root string) *Result {
+	res := &Result{
+		Root:       root,
+		DirStats:   map[string]*DirStat{".": {}},
+		UserStats:  make(map[string]*UserStat),
+		GroupStats: make(map[string]*GroupStat),
+		// owners come from the archive headers, never from the disk
+		DirOwners: make(map[string]string),
+		DirGroups: make(map[string]string),
+		StartedAt: time.Now(),
+	}
+	runtime.ReadMemStats(&res.MemStart)
+	return res
+}
+
+// archiveEntry is one regular file or directory of an archive.
+type archiveEntry struct {
+	Name     string // clean slash-separated path, see archiveRel
+	Size     int64
+	Dir      bool
+	UID, GID uint32
+	// Uname/Gname are the owner names the entry carries, if any; HasOwner
+	// is false for formats without ownership (zip).
+	Uname, Gname string
+	HasOwner     bool
+}
+
+// readArchive passes the regular files and directories of a .tar,
+// gzip-compressed .tar or .zip file to visit, in archive order, detecting the
+// format from the file's magic bytes. Tar entries are streamed one header at
+// a time; zip entries come from the central directory. Entries naming the
+// archive root are left out.
+func readArchive(f *os.File, visit func(archiveEntry) error) error {
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")) || bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if err := readZipEntries(f, info.Size(), visit); err != nil {
+			return fmt.Errorf("zip: %w", err)
+		}
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("gzip: %w", err)
+		}
+		if err := readTarEntries(zr, visit); err != nil {
+			return fmt.Errorf("tar: %w", err)
+		}
+	default:
+		if err := readTarEntries(br, visit); err != nil {
+			return fmt.Errorf("tar: %w", err)
+		}
+	}
+	return nil
+}
+
+// readTarEntries passes the regular files and directories of a tar stream to visit.
+func readTarEntries(r io.Reader, visit func(archiveEntry) error) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := archiveRel(hdr.Name)
+		if name == "" {
+			continue
+		}
+		e := archiveEntry{Name: name, UID: uint32(hdr.Uid), GID: uint32(hdr.Gid), Uname: hdr.Uname, Gname: hdr.Gname, HasOwner: true}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			e.Dir = true
+		case tar.TypeReg, tar.TypeGNUSparse:
+			e.Size = hdr.Size
+		default:
+			continue
+		}
+		if err := visit(e); err != nil {
+			return err
+		}
+	}
+}
+
+// readZipEntries passes the files and directories of a zip archive to visit.
+func readZipEntries(r io.ReaderAt, size int64, visit func(archiveEntry) error) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		name := archiveRel(zf.Name)
+		if name == "" {
+			continue
+		}
+		e := archiveEntry{Name: name, Dir: zf.FileInfo().IsDir()}
+		if !e.Dir {
+			e.Size = int64(zf.UncompressedSize64)
+		}
+		if err := visit(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addArchiveDir records rel and its ancestors as (possibly empty) directories.
+func (r *Result) addArchiveDir(rel string) {
+	for p := rel; ; p = path.Dir(p) {
+		if _, ok := r.DirStats[p]; ok {
+			return
+		}
+		r.DirStats[p] = &DirStat{}
+		if p == "." {
+			return
+		}
+	}
+}
+
+// archiveRel turns an archive entry name into a clean rel path ("" for the
+// archive root); leading "/", "./" and ".." elements cannot escape the root.
+func archiveRel(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// stripComponents drops the first n components of rel, a clean slash-separated
+// relative path. Like tar --strip-components, a path of n components or fewer
+// has nothing left and yields "", so its entry is skipped; a directory with
+// exactly n components becomes the root.
+func stripComponents(rel string, n int) string {
+	for ; n > 0 && rel != ""; n-- {
+		_, rest, found := strings.Cut(rel, "/")
+		if !found {
+			return ""
+		}
+		rel = rest
+	}
+	return rel
+}
+
+// ownerOr returns name, or the numeric id when the header carries no name.
+func ownerOr(name string, id uint32) string {
+	if name != "" {
+		return name
+	}
+	return strconv.FormatUint(uint64(id), 10)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestTar(t *testing.T, compress bool) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var tw *tar.Writer
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(zw)
+	} else {
+		tw = tar.NewWriter(&buf)
+	}
+	entries := []tar.Header{
+		{Name: "./proj/", Typeflag: tar.TypeDir, Mode: 0755, Uid: 1001, Uname: "alice", Gid: 100, Gname: "staff"},
+		{Name: "./proj/src/main.go", Typeflag: tar.TypeReg, Mode: 0644, Size: 300, Uid: 1001, Uname: "alice", Gid: 100, Gname: "staff"},
+		{Name: "./proj/data.bin", Typeflag: tar.TypeReg, Mode: 0644, Size: 700, Uid: 1002, Uname: "bob", Gid: 100, Gname: "staff"},
+		{Name: "./empty/", Typeflag: tar.TypeDir, Mode: 0755},
+	}
+	for _, h := range entries {
+		if err := tw.WriteHeader(&h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(make([]byte, h.Size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := filepath.Join(t.TempDir(), "test.tar")
+	if err := os.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestScanArchiveTar(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		res, err := ScanArchive(writeTestTar(t, compress), 0)
+		if err != nil {
+			t.Fatalf("ScanArchive(gzip=%v): %v", compress, err)
+		}
+		want := map[string]DirStat{".": {Size: 1000, Files: 2}, "proj": {Size: 1000, Files: 2}, "proj/src": {Size: 300, Files: 1}, "empty": {}}
+		for rel, w := range want {
+			if ds := res.DirStats[rel]; ds == nil || *ds != w {
+				t.Fatalf("gzip=%v: dir %q = %+v, want %+v", compress, rel, ds, w)
+			}
+		}
+		if us := res.UserStats["1001"]; us == nil || us.Name != "alice" || us.Size != 300 {
+			t.Fatalf("unexpected alice stats: %+v", us)
+		}
+		if us := res.UserStats["1002"]; us == nil || us.Name != "bob" || us.Size != 700 {
+			t.Fatalf("unexpected bob stats: %+v", us)
+		}
+		if gs := res.GroupStats["100"]; gs == nil || gs.Name != "staff" || gs.Files != 2 {
+			t.Fatalf("unexpected group stats: %+v", gs)
+		}
+		if res.FilesScanned != 2 {
+			t.Fatalf("files scanned = %d", res.FilesScanned)
+		}
+
+		// the tree takes directory owners from the headers
+		var out bytes.Buffer
+		printTree(&out, res, TreeOptions{Levels: 2, ShowUser: true, Format: FormatOptions{Bytes: true}})
+		if !strings.Contains(out.String(), "alice") || !strings.Contains(out.String(), "└── src") {
+			t.Fatalf("unexpected tree:\n%s", out.String())
+		}
+	}
+}
+
+func TestScanArchiveZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, size := range map[string]int{"a/x.txt": 10, "b.txt": 5} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(make([]byte, size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(t.TempDir(), "test.zip")
+	if err := os.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ScanArchive(p, 0)
+	if err != nil {
+		t.Fatalf("ScanArchive: %v", err)
+	}
+	if ds := res.DirStats["."]; ds.Size != 15 || ds.Files != 2 || res.DirStats["a"].Size != 10 {
+		t.Fatalf("unexpected totals: %+v %+v", ds, res.DirStats["a"])
+	}
+	if us := res.UserStats["0"]; us == nil || us.Name != unknownOwner {
+		t.Fatalf("zip entries should belong to %s: %+v", unknownOwner, us)
+	}
+}
+
+func TestArchiveRel(t *testing.T) {
+	cases := map[string]string{"./a/b": "a/b", "/abs/x": "abs/x", "../../etc/passwd": "etc/passwd", "./": "", "dir/": "dir"}
+	for in, want := range cases {
+		if got := archiveRel(in); got != want {
+			t.Errorf("archiveRel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestStripComponents(t *testing.T) {
+	for _, tc := range []struct {
+		rel  string
+		n    int
+		want string
+	}{
+		{"a/b/c/f", 0, "a/b/c/f"},
+		{"a/b/c/f", 2, "c/f"},
+		{"a/b", 2, ""},
+		{"a", 2, ""},
+		{"", 1, ""},
+	} {
+		if got := stripComponents(tc.rel, tc.n); got != tc.want {
+			t.Errorf("stripComponents(%q, %d) = %q; want %q", tc.rel, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestScanArchiveStripComponents(t *testing.T) {
+	// stripping "proj" makes it the root; "empty" has nothing left
+	res, err := ScanArchive(writeTestTar(t, false), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]DirStat{".": {Size: 1000, Files: 2}, "src": {Size: 300, Files: 1}}
+	if len(res.DirStats) != len(want) {
+		t.Fatalf("dirs = %v; want %v", res.DirStats, want)
+	}
+	for rel, w := range want {
+		if ds := res.DirStats[rel]; ds == nil || *ds != w {
+			t.Fatalf("dir %q = %+v; want %+v", rel, ds, w)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// benchFanout is the number of subdirectories per directory of a
+	// synthetic benchmark tree, benchFilesPerDir the files in each.
+	benchFanout      = 4
+	benchFilesPerDir = 16
+)
+
+// generateTree creates files files below dir, benchFilesPerDir to a
+// directory, spread over directories depth levels deep with benchFanout
+// subdirectories each (the deepest levels fill up first and are reused once
+// all are taken). The files are sparse, 1 to 8 KiB of apparent size, so
+// even large trees are quick to create and take no disk space. It returns
+// the total apparent size.
+func generateTree(dir string, files, depth int) (int64, error) {
+	var total int64
+	made := make(map[string]bool)
+	for i := 0; i < files; i++ {
+		sub := dir
+		for k, l := i/benchFilesPerDir, 0; l < depth; k, l = k/benchFanout, l+1 {
+			sub = filepath.Join(sub, "d"+strconv.Itoa(k%benchFanout))
+		}
+		if !made[sub] {
+			if err := os.MkdirAll(sub, 0o755); err != nil {
+				return total, err
+			}
+			made[sub] = true
+		}
+		f, err := os.Create(filepath.Join(sub, "f"+strconv.Itoa(i)))
+		if err != nil {
+			return total, err
+		}
+		size := int64(i%8+1) * 1024
+		err = f.Truncate(size)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return total, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// benchmarkResult is what -benchmark reports of one scan of a synthetic tree.
+type benchmarkResult struct {
+	Files, Dirs, Bytes int64
+	Elapsed            time.Duration
+}
+
+// FilesPerSec returns the scan's throughput in files per second.
+func (b benchmarkResult) FilesPerSec() float64 {
+	if b.Elapsed <= 0 {
+		return 0
+	}
+	return float64(b.Files) / b.Elapsed.Seconds()
+}
+
+// MBPerSec returns the scan's throughput in apparent megabytes (2^20 bytes)
+// per second.
+func (b benchmarkResult) MBPerSec() float64 {
+	if b.Elapsed <= 0 {
+		return 0
+	}
+	return float64(b.Bytes) / (1 << 20) / b.Elapsed.Seconds()
+}
+
+// runBenchmark generates a synthetic tree of files files depth levels deep in
+// a temporary directory, scans it with opts and removes it again (-benchmark).
+// The time taken to generate the tree is not measured.
+func runBenchmark(ctx context.Context, files, depth int, opts ScanOptions) (benchmarkResult, error) {
+	dir, err := os.MkdirTemp("", "diskusage-benchmark-")
+	if err != nil {
+		return benchmarkResult{}, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	if _, err := generateTree(dir, files, depth); err != nil {
+		return benchmarkResult{}, fmt.Errorf("generating the tree: %w", err)
+	}
+	res := Scan(ctx, dir, opts)
+	b := benchmarkResult{Files: res.FilesScanned, Dirs: res.DirsScanned, Elapsed: res.EndedAt.Sub(res.StartedAt)}
+	if ds := res.DirStats["."]; ds != nil {
+		b.Bytes = ds.Size
+	}
+	return b, nil
+}
+
+// printBenchmark writes the -benchmark report.
+func printBenchmark(w io.Writer, b benchmarkResult, concurrency int) {
+	_, _ = fmt.Fprintf(w, "Scanned %d files in %d directories (%s) in %s with concurrency %d\n",
+		b.Files, b.Dirs, humanizeBytes(b.Bytes), b.Elapsed.Round(time.Microsecond), concurrency)
+	_, _ = fmt.Fprintf(w, "Throughput: %.0f files/sec, %.1f MB/sec\n", b.FilesPerSec(), b.MBPerSec())
+}
+
+// hiddenFlags are left out of the -help listing: -benchmark is a tool for
+// evaluating hardware and tuning, not for everyday use.
+var hiddenFlags = map[string]bool{"benchmark": true}
+
+// printVisibleDefaults writes the flags of fs like PrintDefaults does, less
+// the hiddenFlags.
+func printVisibleDefaults(w io.Writer, fs *flag.FlagSet) {
+	visible := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	visible.SetOutput(w)
+	fs.VisitAll(func(f *flag.Flag) {
+		if hiddenFlags[f.Name] {
+			return
+		}
+		visible.Var(f.Value, f.Name, f.Usage)
+		// Var takes the current value as the default; keep the real one
+		visible.Lookup(f.Name).DefValue = f.DefValue
+	})
+	visible.PrintDefaults()
+}
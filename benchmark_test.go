@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGenerateTree(t *testing.T) {
+	root := t.TempDir()
+	size, err := generateTree(root, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2})
+	if res.FilesScanned != 100 || res.DirStats["."].Size != size {
+		t.Fatalf("scanned %d files, %d bytes; want 100 files, %d bytes", res.FilesScanned, res.DirStats["."].Size, size)
+	}
+	// 100 files at 16 a directory fill 7 leaves two levels down
+	leaves := 0
+	for rel := range res.DirStats {
+		if relDepth(rel) == 2 {
+			leaves++
+		}
+	}
+	if leaves != 7 {
+		t.Fatalf("%d leaf directories; want 7: %v", leaves, res.DirStats)
+	}
+}
+
+func TestRunBenchmarkReportsThroughput(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	b, err := runBenchmark(context.Background(), 200, 3, ScanOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Files != 200 || b.Bytes <= 0 || b.Elapsed <= 0 || b.FilesPerSec() <= 0 || b.MBPerSec() <= 0 {
+		t.Fatalf("benchmark = %+v (%.0f files/sec, %.1f MB/sec)", b, b.FilesPerSec(), b.MBPerSec())
+	}
+	if left, _ := os.ReadDir(tmp); len(left) != 0 {
+		t.Fatalf("synthetic tree left behind: %v", left)
+	}
+
+	var out bytes.Buffer
+	printBenchmark(&out, b, 2)
+	if !strings.Contains(out.String(), "Scanned 200 files") || !strings.Contains(out.String(), " files/sec, ") {
+		t.Fatalf("report = %q", out.String())
+	}
+}
+
+func TestPrintVisibleDefaultsHidesBenchmark(t *testing.T) {
+	fs := flag.NewFlagSet("diskusage", flag.ContinueOnError)
+	fs.Int("benchmark", 0, "hidden")
+	fs.Int("levels", 2, "shown")
+	if err := fs.Parse([]string{"-levels", "5"}); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	printVisibleDefaults(&out, fs)
+	if strings.Contains(out.String(), "benchmark") || !strings.Contains(out.String(), "shown (default 2)") {
+		t.Fatalf("usage = %q", out.String())
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// parseChangedSince parses a -changed-since value: an RFC 3339 timestamp, a
+// local date "YYYY-MM-DD" (its midnight), or a duration such as "36h"
+// meaning that long before now.
+func parseChangedSince(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, now.Location()); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (want RFC3339, YYYY-MM-DD or a duration like 24h)", s)
+}
+
+// referenceMtime returns the modification time of path for -older-than-file;
+// symbolic links are followed, so a link stands for its target.
+func referenceMtime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseChangedSince(t *testing.T) {
+	now := time.Date(2024, 3, 10, 15, 30, 0, 0, time.UTC)
+	for in, want := range map[string]time.Time{
+		"2024-03-01T08:00:00Z": time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC),
+		"2024-03-09":           time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC),
+		"36h":                  time.Date(2024, 3, 9, 3, 30, 0, 0, time.UTC),
+	} {
+		got, err := parseChangedSince(in, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseChangedSince(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "yesterday", "-5h", "2024-13-01"} {
+		if _, err := parseChangedSince(bad, now); err == nil {
+			t.Errorf("parseChangedSince(%q) should fail", bad)
+		}
+	}
+}
+
+// ctimeOf returns the inode change time of path.
+func ctimeOf(t *testing.T, path string) time.Time {
+	t.Helper()
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		t.Skip("no stat_t on this platform")
+	}
+	return statCtime(st)
+}
+
+func TestScanChangedSince(t *testing.T) {
+	root := t.TempDir()
+	old := filepath.Join(root, "etc", "passwd")
+	touched := filepath.Join(root, "etc", "shadow")
+	rewritten := filepath.Join(root, "bin", "ls")
+	writeFile(t, old, 100)
+	writeFile(t, touched, 200)
+	writeFile(t, rewritten, 300)
+	before := ctimeOf(t, rewritten)
+	for _, p := range []string{old, touched} {
+		if c := ctimeOf(t, p); c.After(before) {
+			before = c
+		}
+	}
+
+	// a metadata-only change (chmod) moves the ctime, not the mtime; retry
+	// until the filesystem clock has visibly advanced past the older files
+	var cut time.Time
+	for i := 0; i < 100 && !cut.After(before); i++ {
+		time.Sleep(10 * time.Millisecond)
+		if err := os.Chmod(touched, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(rewritten, make([]byte, 300), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cut = ctimeOf(t, touched)
+	}
+	if !cut.After(before) {
+		t.Skip("filesystem ctime did not advance")
+	}
+	if c := ctimeOf(t, rewritten); c.Before(cut) {
+		cut = c
+	}
+
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, ChangedSince: cut})
+	if got := res.DirStats["."]; got.Size != 500 || got.Files != 2 {
+		t.Fatalf("root = %+v, want only the 2 changed files (500 bytes)", got)
+	}
+	if got := res.DirStats["etc"]; got.Size != 200 || got.Files != 1 {
+		t.Fatalf("etc = %+v, want only the chmod-ed file", got)
+	}
+	if res.FilesScanned != 2 || res.CtimeFilteredFiles != 1 {
+		t.Fatalf("scanned %d, ctime-filtered %d; want 2 and 1", res.FilesScanned, res.CtimeFilteredFiles)
+	}
+	jo := summaryFor(res, SummaryOptions{})
+	if jo.Stats.ChangedSince != cut.Format(time.RFC3339) || jo.Stats.CtimeFilteredFiles != 1 {
+		t.Fatalf("stats = %+v, want the filter recorded", jo.Stats)
+	}
+	if back := resultFromSummary(jo); back.CtimeFilteredFiles != 1 || back.ChangedSince.IsZero() {
+		t.Fatalf("filter not restored from JSON: %v %d", back.ChangedSince, back.CtimeFilteredFiles)
+	}
+
+	// without the filter every file counts
+	res = Scan(context.Background(), root, ScanOptions{Concurrency: 2})
+	if got := res.DirStats["."]; got.Files != 3 || res.CtimeFilteredFiles != 0 {
+		t.Fatalf("unfiltered root = %+v (filtered %d)", got, res.CtimeFilteredFiles)
+	}
+}
+
+func TestScanOlderThanFile(t *testing.T) {
+	root := t.TempDir()
+	ref := filepath.Join(t.TempDir(), "deployed")
+	writeFile(t, ref, 0)
+	writeFile(t, filepath.Join(root, "old", "a"), 100)
+	writeFile(t, filepath.Join(root, "old", "b"), 20)
+	writeFile(t, filepath.Join(root, "new", "c"), 3)
+	writeFile(t, filepath.Join(root, "old", "d"), 4000)
+
+	deploy := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for path, mtime := range map[string]time.Time{
+		ref:                             deploy,
+		filepath.Join(root, "old", "a"): deploy.Add(-48 * time.Hour),
+		filepath.Join(root, "old", "b"): deploy, // as old as the reference
+		filepath.Join(root, "new", "c"): deploy.Add(time.Second),
+		filepath.Join(root, "old", "d"): deploy.Add(time.Hour),
+	} {
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cut, err := referenceMtime(ref)
+	if err != nil || !cut.Equal(deploy) {
+		t.Fatalf("referenceMtime = %v, %v; want %v", cut, err, deploy)
+	}
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, ModifiedBefore: cut})
+	if got := res.DirStats["."]; got.Size != 120 || got.Files != 2 {
+		t.Fatalf("root = %+v, want only the 2 older files (120 bytes)", got)
+	}
+	if got := res.DirStats["new"]; got.Files != 0 {
+		t.Fatalf("new = %+v, want it empty", got)
+	}
+	if res.FilesScanned != 2 || res.MtimeFilteredFiles != 2 {
+		t.Fatalf("scanned %d, mtime-filtered %d; want 2 and 2", res.FilesScanned, res.MtimeFilteredFiles)
+	}
+	jo := summaryFor(res, SummaryOptions{})
+	if jo.Stats.ModifiedBefore != "2024-05-01T12:00:00Z" || jo.Stats.MtimeFilteredFiles != 2 {
+		t.Fatalf("stats = %+v, want the filter recorded", jo.Stats)
+	}
+	if back := resultFromSummary(jo); back.MtimeFilteredFiles != 2 || !back.ModifiedBefore.Equal(deploy) {
+		t.Fatalf("filter not restored from JSON: %v %d", back.ModifiedBefore, back.MtimeFilteredFiles)
+	}
+
+	if _, err := referenceMtime(filepath.Join(root, "missing")); err == nil {
+		t.Fatalf("expected an error for a missing reference file")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// chunkPath returns the name of the i-th (1-based) chunk of a summary written
+// to path: "out.json" becomes "out.001.json", "out.002.json", ... and, with a
+// compressor, "out.json.gz" becomes "out.001.json.gz".
+func chunkPath(path string, i int, c *compressor) string {
+	cext := ""
+	if c != nil && strings.HasSuffix(path, c.ext) {
+		cext = c.ext
+		path = strings.TrimSuffix(path, cext)
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.%03d%s%s", strings.TrimSuffix(path, ext), i, ext, cext)
+}
+
+// WriteChunkedSummary writes the summary of res split into chunk files of at
+// most chunkSize directory entries each, plus a manifest at path. The manifest
+// is a regular summary (root, stats, users, groups, ...) whose dirs array is
+// replaced by a "chunks" list of the chunk file names, relative to the
+// manifest; each chunk holds root and its slice of dirs. Every file is written
+// atomically (and compressed with c, if non-nil), the manifest last, so a
+// manifest never lists missing chunks.
+func WriteChunkedSummary(path string, res *Result, opts SummaryOptions, chunkSize int, c *compressor) error {
+	if chunkSize <= 0 {
+		return fmt.Errorf("chunk size must be positive, got %d", chunkSize)
+	}
+	jo := summaryFor(res, opts)
+	if opts.Strict {
+		if err := jo.strictErr(); err != nil {
+			return err
+		}
+	}
+	manifest := jo
+	manifest.Dirs = nil
+	manifest.Chunks = []string{}
+	for i, start := 1, 0; start < len(jo.Dirs) || i == 1; i, start = i+1, start+chunkSize {
+		dirs := jo.Dirs[start:min(start+chunkSize, len(jo.Dirs))]
+		name := chunkPath(path, i, c)
+		if err := writeFileAtomic(name, compressWrite(c, func(w io.Writer) error { return writeChunk(w, jo.Root, dirs, opts.CompactArrays) })); err != nil {
+			return err
+		}
+		manifest.Chunks = append(manifest.Chunks, filepath.Base(name))
+	}
+	return writeFileAtomic(path, compressWrite(c, func(w io.Writer) error { return writeSummaryJSON(w, manifest, false, opts.CompactArrays) }))
+}
+
+// writeChunk writes one chunk document: the root and a slice of dirs.
+func writeChunk(w io.Writer, root string, dirs []JsonDir, compact bool) error {
+	bw := bufio.NewWriter(w)
+	rootB, err := json.Marshal(root)
+	if err != nil {
+		return fmt.Errorf("marshal root: %w", err)
+	}
+	_, _ = fmt.Fprintf(bw, "{\n  \"root\": %s,\n", rootB)
+	if err := streamArray(bw, "dirs", dirs, true, compact); err != nil {
+		return err
+	}
+	_, _ = bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// loadChunks appends the dirs of every chunk listed in a manifest to jo.Dirs
+// and clears jo.Chunks. Chunk names are resolved relative to dir; strict
+// decodes them as parseSummary does.
+func loadChunks(jo *JsonOut, dir string, strict bool) error {
+	for _, name := range jo.Chunks {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("chunk: %w", err)
+		}
+		if b, err = decompress(b); err != nil {
+			return fmt.Errorf("chunk %s: %w", name, err)
+		}
+		var chunk struct {
+			Root string    `json:"root"`
+			Dirs []JsonDir `json:"dirs"`
+		}
+		if err := unmarshalSummary(b, &chunk, strict); err != nil {
+			return fmt.Errorf("chunk %s: %w", name, err)
+		}
+		jo.Dirs = append(jo.Dirs, chunk.Dirs...)
+	}
+	jo.Chunks = nil
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestChunkPath(t *testing.T) {
+	gz, err := lookupCompressor("gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		path string
+		c    *compressor
+		want string
+	}{
+		{"out.json", nil, "out.001.json"},
+		{"dir/out", nil, "dir/out.001"},
+		{"out.json.gz", gz, "out.001.json.gz"},
+	}
+	for _, c := range cases {
+		if got := chunkPath(c.path, 1, c.c); got != c.want {
+			t.Errorf("chunkPath(%q) = %q, want %q", c.path, got, c.want)
+		}
+	}
+}
+
+func TestWriteChunkedSummaryRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"a", "b", "c", "d", "e"} {
+		writeFile(t, filepath.Join(root, d, "f"), 10)
+	}
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 1})
+	want := summaryFor(res, SummaryOptions{})
+	gz, err := lookupCompressor("gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []*compressor{nil, gz} {
+		out := addCompressExt(filepath.Join(t.TempDir(), "out.json"), c)
+		if err := WriteChunkedSummary(out, res, SummaryOptions{}, 2, c); err != nil {
+			t.Fatalf("WriteChunkedSummary: %v", err)
+		}
+
+		// the manifest lists the chunks instead of carrying dirs
+		b, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatalf("read manifest: %v", err)
+		}
+		if b, err = decompress(b); err != nil {
+			t.Fatalf("decompress manifest: %v", err)
+		}
+		var manifest JsonOut
+		if err := json.Unmarshal(b, &manifest); err != nil {
+			t.Fatalf("unmarshal manifest: %v", err)
+		}
+		if manifest.Dirs != nil || len(manifest.Chunks) != 3 {
+			t.Fatalf("manifest: dirs=%v chunks=%v, want no dirs and 3 chunks", manifest.Dirs, manifest.Chunks)
+		}
+
+		jo, err := LoadSummaryStrict(out)
+		if err != nil {
+			t.Fatalf("LoadSummaryStrict: %v", err)
+		}
+		if jo.Chunks != nil {
+			t.Fatalf("loaded summary should not list chunks, got %v", jo.Chunks)
+		}
+		if !reflect.DeepEqual(jo.Dirs, want.Dirs) {
+			t.Fatalf("reassembled dirs = %+v, want %+v", jo.Dirs, want.Dirs)
+		}
+	}
+}
+
+func TestWriteChunkedSummaryRejectsBadSize(t *testing.T) {
+	res := Scan(context.Background(), t.TempDir(), ScanOptions{Concurrency: 1})
+	if err := WriteChunkedSummary(filepath.Join(t.TempDir(), "out.json"), res, SummaryOptions{}, 0, nil); err == nil {
+		t.Fatal("expected an error for chunk size 0")
+	}
+}
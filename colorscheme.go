@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// colorSchemeDefaults are the -color-thresholds each -color-scheme uses when
+// none are given.
+var colorSchemeDefaults = map[string]string{
+	"magnitude": "1G,10G",
+	"percent":   "25,50",
+	"age":       "30d,365d",
+}
+
+// parseColorThresholds parses the two ascending -color-thresholds of scheme,
+// "low,high", into the unit its values are measured in: bytes for magnitude
+// (sizes like 10G), percent of the parent for percent (50 or 50%), seconds
+// for age (durations like 36h, or days like 30d). An empty s selects the
+// scheme's defaults.
+func parseColorThresholds(scheme, s string) ([2]float64, error) {
+	var out [2]float64
+	def, ok := colorSchemeDefaults[scheme]
+	if !ok {
+		return out, fmt.Errorf("unknown color scheme %q (want magnitude, percent or age)", scheme)
+	}
+	if s == "" {
+		s = def
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return out, fmt.Errorf("want two thresholds \"low,high\", got %q", s)
+	}
+	for i, p := range parts {
+		p = strings.TrimSpace(p)
+		var err error
+		switch scheme {
+		case "magnitude":
+			var n int64
+			n, err = parseSize(p)
+			out[i] = float64(n)
+		case "percent":
+			out[i], err = strconv.ParseFloat(strings.TrimSuffix(p, "%"), 64)
+		case "age":
+			out[i], err = parseAgeSeconds(p)
+		}
+		if err != nil {
+			return out, fmt.Errorf("threshold %q: %v", p, err)
+		}
+		if out[i] < 0 {
+			return out, fmt.Errorf("threshold %q is negative", p)
+		}
+	}
+	if out[0] > out[1] {
+		return out, fmt.Errorf("thresholds %q are not ascending", s)
+	}
+	return out, nil
+}
+
+// parseAgeSeconds parses an age as a Go duration (36h) or in days (30d, 1.5d).
+func parseAgeSeconds(s string) (float64, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return n * 24 * 3600, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q (want a duration like 36h or days like 30d)", s)
+	}
+	return d.Seconds(), nil
+}
+
+// colorCode maps value onto the green/yellow/red gradient of -color-scheme:
+// green below the low threshold, yellow from it up to the high one, red from
+// the high one on.
+func colorCode(value float64, thresholds [2]float64) string {
+	switch {
+	case value >= thresholds[1]:
+		return ansiRed
+	case value >= thresholds[0]:
+		return ansiYellow
+	}
+	return ansiGreen
+}
+
+// schemeValue returns what drives the -color-scheme color of directory rel
+// of the given subtree size: the size itself, its percent of the parent's
+// size (not for the root) or the age of its newest file at the end of the
+// scan (only for directories holding files). ok is false for directories
+// the scheme does not color.
+func (o TreeOptions) schemeValue(res *Result, dirSizes map[string]int64, rel string, size int64) (value float64, ok bool) {
+	switch o.ColorScheme {
+	case "magnitude":
+		return float64(size), true
+	case "percent":
+		if rel == "." {
+			return 0, false
+		}
+		parent := dirSizes[filepath.Dir(rel)]
+		if parent <= 0 {
+			return 0, false
+		}
+		return float64(size) * 100 / float64(parent), true
+	case "age":
+		newest, found := res.DirNewest[rel]
+		if !found {
+			return 0, false
+		}
+		return res.EndedAt.Sub(newest).Seconds(), true
+	}
+	return 0, false
+}
+
+// noteNewest records mtime as the newest file time of directory rel and its
+// ancestors where it is newer (-color-scheme age). Callers must hold the
+// mutex guarding the maps.
+func (r *Result) noteNewest(rel string, mtime time.Time) {
+	for p := rel; ; p = filepath.Dir(p) {
+		// an ancestor is never older than its descendants, so stop at the
+		// first directory already as new
+		if cur, ok := r.DirNewest[p]; ok && !cur.Before(mtime) {
+			return
+		}
+		r.DirNewest[p] = mtime
+		if p == "." {
+			return
+		}
+	}
+}
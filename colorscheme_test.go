@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestColorSchemeBuckets(t *testing.T) {
+	for _, tc := range []struct {
+		scheme, thresholds string
+		value              float64
+		want               string
+	}{
+		// magnitude: bytes against 1G,10G by default
+		{"magnitude", "", 1<<30 - 1, ansiGreen},
+		{"magnitude", "", 1 << 30, ansiYellow},
+		{"magnitude", "", 10<<30 - 1, ansiYellow},
+		{"magnitude", "", 10 << 30, ansiRed},
+		{"magnitude", "100,200", 99, ansiGreen},
+		{"magnitude", "100,200", 200, ansiRed},
+		// percent of the parent
+		{"percent", "", 24.9, ansiGreen},
+		{"percent", "", 25, ansiYellow},
+		{"percent", "", 50, ansiRed},
+		{"percent", "10%,90%", 89, ansiYellow},
+		// age in seconds
+		{"age", "", 30*24*3600 - 1, ansiGreen},
+		{"age", "", 30 * 24 * 3600, ansiYellow},
+		{"age", "", 365 * 24 * 3600, ansiRed},
+		{"age", "1h,36h", 3599, ansiGreen},
+		{"age", "1h,36h", 36 * 3600, ansiRed},
+	} {
+		th, err := parseColorThresholds(tc.scheme, tc.thresholds)
+		if err != nil {
+			t.Fatalf("parseColorThresholds(%q, %q): %v", tc.scheme, tc.thresholds, err)
+		}
+		if got := colorCode(tc.value, th); got != tc.want {
+			t.Errorf("%s %q: colorCode(%v) = %q; want %q", tc.scheme, tc.thresholds, tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestParseColorThresholdsErrors(t *testing.T) {
+	for _, tc := range []struct{ scheme, thresholds string }{
+		{"rainbow", ""},
+		{"magnitude", "1G"},
+		{"magnitude", "10G,1G"},
+		{"percent", "a,b"},
+		{"percent", "-5,50"},
+		{"age", "30x,60d"},
+	} {
+		if _, err := parseColorThresholds(tc.scheme, tc.thresholds); err == nil {
+			t.Errorf("parseColorThresholds(%q, %q) should fail", tc.scheme, tc.thresholds)
+		}
+	}
+}
+
+func TestNoteNewestKeepsAncestorsNewest(t *testing.T) {
+	res := newTestResult()
+	res.DirNewest = make(map[string]time.Time)
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	res.noteNewest("a/b", t0)
+	res.noteNewest("a/c", t0.Add(time.Hour))
+	res.noteNewest("a/b", t0.Add(-time.Hour))
+	for rel, want := range map[string]time.Time{".": t0.Add(time.Hour), "a": t0.Add(time.Hour), "a/b": t0, "a/c": t0.Add(time.Hour)} {
+		if got := res.DirNewest[rel]; !got.Equal(want) {
+			t.Errorf("DirNewest[%q] = %v; want %v", rel, got, want)
+		}
+	}
+}
+
+func TestPrintTreePercentScheme(t *testing.T) {
+	res := newTestResult()
+	res.DirStats = map[string]*DirStat{
+		".":     {Size: 1000, Files: 2},
+		"big":   {Size: 800, Files: 1},
+		"small": {Size: 200, Files: 1},
+	}
+	var out bytes.Buffer
+	printTree(&out, res, TreeOptions{Levels: 1, Format: FormatOptions{Bytes: true}, ColorScheme: "percent", ColorThresholds: [2]float64{25, 50}})
+	for _, want := range []string{ansiRed + "big" + ansiReset, ansiGreen + "small" + ansiReset} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("tree lacks %q:\n%q", want, out.String())
+		}
+	}
+	// the root has no parent to be a percent of
+	if first := strings.SplitN(out.String(), "\n", 3)[1]; strings.Contains(first, "\033[") {
+		t.Fatalf("root line colored: %q", first)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// compareRow is one directory line of printCompareTree.
+type compareRow struct {
+	old, cur, delta string
+	lead, name      string
+}
+
+// printCompareTree renders the directories of two snapshots as one tree
+// (-compare), matched by their path relative to the root, with the old and
+// new size side by side and the change between them. Directories only in
+// old are marked "[gone]", those only in cur "[new]". Children are ordered
+// by their new size, like printTree orders them.
+func printCompareTree(w io.Writer, old, cur *Result, opts TreeOptions) {
+	fo := opts.Format
+	conn := utf8Connectors
+	if fo.ASCII {
+		conn = asciiConnectors
+	}
+
+	union := make(map[string]*DirStat, len(cur.DirStats))
+	for rel, ds := range old.DirStats {
+		union[rel] = &DirStat{Size: ds.Size}
+	}
+	for rel, ds := range cur.DirStats {
+		union[rel] = &DirStat{Size: ds.Size}
+	}
+	if _, ok := union["."]; !ok {
+		union["."] = &DirStat{}
+	}
+	children, dirSizes := buildChildrenAndSizes(union)
+	sortChildren(children, dirSizes, sortSize)
+	largest := largestSize(dirSizes, nil, nil)
+	for _, ds := range old.DirStats {
+		largest = max(largest, ds.Size)
+	}
+	fo = fo.fixUnit(largest)
+
+	var rows []compareRow
+	var collect func(rel string, level int, prefix string, isLast bool)
+	collect = func(rel string, level int, prefix string, isLast bool) {
+		r := compareRow{old: "-", cur: "-"}
+		var oldSize, curSize int64
+		o, inOld := old.DirStats[rel]
+		if inOld {
+			oldSize = o.Size
+			r.old = fo.size(oldSize)
+		}
+		c, inCur := cur.DirStats[rel]
+		if inCur {
+			curSize = c.Size
+			r.cur = fo.size(curSize)
+		}
+		r.delta = sizeDelta(fo, curSize-oldSize)
+
+		if level == 0 {
+			r.name = cur.Root
+			if opts.RootLabel != "" {
+				r.name = opts.RootLabel
+			}
+		} else {
+			connector := conn.tee
+			if isLast {
+				connector = conn.last
+			}
+			r.lead = prefix + connector
+			r.name = filepath.Base(rel)
+		}
+		r.name = fo.path(r.name)
+		switch {
+		case !inOld:
+			r.name += " [new]"
+		case !inCur:
+			r.name += " [gone]"
+		}
+		rows = append(rows, r)
+
+		if level >= opts.Levels {
+			return
+		}
+		childPrefix := prefix + conn.pipe
+		if isLast {
+			childPrefix = prefix + "    "
+		}
+		kids := children[rel]
+		for i, k := range kids {
+			collect(k, level+1, childPrefix, i == len(kids)-1)
+		}
+	}
+	collect(".", 0, "", true)
+
+	oldWidth, curWidth, deltaWidth := len("Old"), len("New"), len("Delta")
+	for _, r := range rows {
+		oldWidth = max(oldWidth, len(r.old))
+		curWidth = max(curWidth, len(r.cur))
+		deltaWidth = max(deltaWidth, len(r.delta))
+	}
+	_, _ = fmt.Fprintf(w, "%*s %*s %*s %s\n", oldWidth, "Old", curWidth, "New", deltaWidth, "Delta", "Path")
+	for _, r := range rows {
+		_, _ = fmt.Fprintf(w, "%*s %*s %*s %s%s\n", oldWidth, r.old, curWidth, r.cur, deltaWidth, r.delta, r.lead, r.name)
+	}
+
+	// where the two snapshots came from, when they say
+	oldLabel, curLabel := snapshotLabel(old.SnapshotName, old.Hostname), snapshotLabel(cur.SnapshotName, cur.Hostname)
+	if oldLabel != "" || curLabel != "" {
+		_, _ = fmt.Fprintln(w)
+		for _, l := range [][2]string{{"Old", oldLabel}, {"New", curLabel}} {
+			if l[1] == "" {
+				l[1] = "-"
+			}
+			_, _ = fmt.Fprintf(w, "%s: %s\n", l[0], l[1])
+		}
+	}
+}
+
+// sizeDelta formats a change in size with its sign: "+1.5KB", "-200", "0".
+func sizeDelta(fo FormatOptions, d int64) string {
+	return signedSize(d, fo.size)
+}
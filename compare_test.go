@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPrintCompareTreeGolden(t *testing.T) {
+	old := resultFromSummary(JsonOut{Root: "/data", Dirs: []JsonDir{
+		{Rel: ".", Size: 4000, Files: 40},
+		{Rel: "projects", Size: 3000, Files: 30},
+		{Rel: "projects/web", Size: 1000, Files: 10},
+		{Rel: "old", Size: 1000, Files: 10},
+	}})
+	cur := resultFromSummary(JsonOut{Root: "/data", Dirs: []JsonDir{
+		{Rel: ".", Size: 6500, Files: 60},
+		{Rel: "projects", Size: 5000, Files: 45},
+		{Rel: "projects/web", Size: 1000, Files: 10},
+		{Rel: "scratch", Size: 1500, Files: 15},
+	}})
+
+	var out bytes.Buffer
+	printCompareTree(&out, old, cur, TreeOptions{Levels: 2, Format: FormatOptions{Bytes: true}})
+	want := "" +
+		" Old  New Delta Path\n" +
+		"4000 6500 +2500 /data\n" +
+		"3000 5000 +2000     ├── projects\n" +
+		"1000 1000     0     │   └── web\n" +
+		"   - 1500 +1500     ├── scratch [new]\n" +
+		"1000    - -1000     └── old [gone]\n"
+	if out.String() != want {
+		t.Fatalf("compare tree:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	printCompareTree(&out, old, cur, TreeOptions{Levels: 0, RootLabel: "host:/data", Format: FormatOptions{Bytes: true, ASCII: true}})
+	if want := " Old  New Delta Path\n4000 6500 +2500 host:/data\n"; out.String() != want {
+		t.Fatalf("root only:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestPrintCompareTreeHumanDeltas(t *testing.T) {
+	old := resultFromSummary(JsonOut{Root: "/data", Dirs: []JsonDir{
+		{Rel: ".", Size: 3 * 1024 * 1024, Files: 3},
+		{Rel: "a", Size: 3 * 1024 * 1024, Files: 3},
+	}})
+	cur := resultFromSummary(JsonOut{Root: "/data", Dirs: []JsonDir{
+		{Rel: ".", Size: 1536, Files: 1},
+		{Rel: "a", Size: 1536, Files: 1},
+	}})
+
+	var out bytes.Buffer
+	printCompareTree(&out, old, cur, TreeOptions{Levels: 1, Format: FormatOptions{ASCII: true}})
+	want := "" +
+		"  Old   New  Delta Path\n" +
+		"3.0MB 1.5KB -3.0MB /data\n" +
+		"3.0MB 1.5KB -3.0MB     `-- a\n"
+	if out.String() != want {
+		t.Fatalf("compare tree:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestDiffResultsJSON(t *testing.T) {
+	old := resultFromSummary(JsonOut{Root: "/data",
+		Dirs: []JsonDir{
+			{Rel: ".", Size: 4000, Files: 40},
+			{Rel: "projects", Size: 3000, Files: 30},
+			{Rel: "old", Size: 1000, Files: 10},
+		},
+		Users: []JsonUser{{Name: "alice", Size: 3000, Files: 30}, {Name: "bob", Size: 1000, Files: 10}},
+		Grps:  []JsonGroup{{Name: "staff", Size: 4000, Files: 40}},
+	})
+	cur := resultFromSummary(JsonOut{Root: "/data",
+		Stats: JsonStats{Hostname: "nas", SnapshotName: "monday"},
+		Dirs: []JsonDir{
+			{Rel: ".", Size: 6500, Files: 60},
+			{Rel: "projects", Size: 5000, Files: 45},
+			{Rel: "scratch", Size: 1500, Files: 15},
+		},
+		Users: []JsonUser{{Name: "alice", Size: 5000, Files: 45}, {Name: "carol", Size: 1500, Files: 15}},
+		Grps:  []JsonGroup{{Name: "staff", Size: 6500, Files: 60}},
+	})
+
+	var out bytes.Buffer
+	if err := writeDiffJSON(&out, diffResults(old, cur), true); err != nil {
+		t.Fatal(err)
+	}
+	var got DiffResult
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("diff is not valid JSON: %v\n%s", err, out.String())
+	}
+	want := DiffResult{
+		Root: "/data",
+		New:  "monday (host nas)",
+		Dirs: []DirDelta{
+			{Rel: ".", OldSize: 4000, NewSize: 6500, SizeDelta: 2500, OldFiles: 40, NewFiles: 60, FilesDelta: 20},
+			{Rel: "old", OldSize: 1000, SizeDelta: -1000, OldFiles: 10, FilesDelta: -10},
+			{Rel: "projects", OldSize: 3000, NewSize: 5000, SizeDelta: 2000, OldFiles: 30, NewFiles: 45, FilesDelta: 15},
+			{Rel: "scratch", NewSize: 1500, SizeDelta: 1500, NewFiles: 15, FilesDelta: 15},
+		},
+		Users: []OwnerDelta{
+			{Name: "alice", OldSize: 3000, NewSize: 5000, SizeDelta: 2000, OldFiles: 30, NewFiles: 45, FilesDelta: 15},
+			{Name: "bob", OldSize: 1000, SizeDelta: -1000, OldFiles: 10, FilesDelta: -10},
+			{Name: "carol", NewSize: 1500, SizeDelta: 1500, NewFiles: 15, FilesDelta: 15},
+		},
+		Groups: []OwnerDelta{
+			{Name: "staff", OldSize: 4000, NewSize: 6500, SizeDelta: 2500, OldFiles: 40, NewFiles: 60, FilesDelta: 20},
+		},
+		Added:   DiffNames{Dirs: []string{"scratch"}, Users: []string{"carol"}, Groups: []string{}},
+		Removed: DiffNames{Dirs: []string{"old"}, Users: []string{"bob"}, Groups: []string{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("diff:\n%+v\nwant:\n%+v", got, want)
+	}
+	// compact entries stay one per line, so the arrays remain greppable
+	if !strings.Contains(out.String(), "\n    {\"rel\":\"scratch\",\"old_size\":0,\"new_size\":1500,\"size_delta\":1500,") {
+		t.Fatalf("compact dirs entry missing:\n%s", out.String())
+	}
+}
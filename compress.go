@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// compressor describes one -compress algorithm: the extension appended to
+// output file names, the magic bytes that identify its streams, and how to
+// wrap writers and readers.
+type compressor struct {
+	ext       string
+	magic     []byte
+	newWriter func(w io.Writer) (io.WriteCloser, error)
+	newReader func(r io.Reader) (io.Reader, error)
+}
+
+// zstdMagic starts every zstd frame; it is recognized even in builds without
+// zstd support so such input gets a helpful error.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+var compressors = map[string]compressor{
+	"gzip": {
+		ext:       ".gz",
+		magic:     []byte{0x1f, 0x8b},
+		newWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+		newReader: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	},
+}
+
+// compressorNames lists the available -compress values in sorted order.
+func compressorNames() []string {
+	names := make([]string, 0, len(compressors))
+	for n := range compressors {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupCompressor returns the compressor for a -compress value; "" means none.
+func lookupCompressor(name string) (*compressor, error) {
+	if name == "" {
+		return nil, nil
+	}
+	c, ok := compressors[name]
+	if !ok {
+		if name == "zstd" {
+			return nil, fmt.Errorf("zstd support is not built in (rebuild with -tags zstd)")
+		}
+		return nil, fmt.Errorf("unknown compression %q (available: %s)", name, strings.Join(compressorNames(), ", "))
+	}
+	return &c, nil
+}
+
+// addCompressExt appends the compressor's extension to path unless it is
+// already there or path is "-" (stdout).
+func addCompressExt(path string, c *compressor) string {
+	if c == nil || path == "-" || strings.HasSuffix(path, c.ext) {
+		return path
+	}
+	return path + c.ext
+}
+
+// compressWrite wraps fn so that its output is compressed with c; a nil c
+// returns fn unchanged.
+func compressWrite(c *compressor, fn func(w io.Writer) error) func(w io.Writer) error {
+	if c == nil {
+		return fn
+	}
+	return func(w io.Writer) error {
+		cw, err := c.newWriter(w)
+		if err != nil {
+			return err
+		}
+		if err := fn(cw); err != nil {
+			_ = cw.Close()
+			return err
+		}
+		return cw.Close()
+	}
+}
+
+// decompress returns the decompressed content of b when it starts with the
+// magic bytes of a known compressor, and b itself otherwise.
+func decompress(b []byte) ([]byte, error) {
+	for _, name := range compressorNames() {
+		c := compressors[name]
+		if !bytes.HasPrefix(b, c.magic) {
+			continue
+		}
+		r, err := c.newReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		out, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return out, nil
+	}
+	if bytes.HasPrefix(b, zstdMagic) {
+		return nil, fmt.Errorf("input is zstd-compressed, but zstd support is not built in (rebuild with -tags zstd)")
+	}
+	return b, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// roundTripSummary writes res compressed with name to a file and loads it back.
+func roundTripSummary(t *testing.T, name string) JsonOut {
+	t.Helper()
+	c, err := lookupCompressor(name)
+	if err != nil {
+		t.Fatalf("lookupCompressor(%q): %v", name, err)
+	}
+	res := testResult()
+	out := addCompressExt(filepath.Join(t.TempDir(), "scan.json"), c)
+	if filepath.Ext(out) != c.ext {
+		t.Fatalf("extension not appended: %s", out)
+	}
+	if err := writeFileAtomic(out, compressWrite(c, func(w io.Writer) error { return StreamSummary(w, res, SummaryOptions{}) })); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	raw, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) < len(c.magic) || string(raw[:len(c.magic)]) != string(c.magic) {
+		t.Fatalf("output does not start with the %s magic", name)
+	}
+	jo, err := LoadSummary(out)
+	if err != nil {
+		t.Fatalf("LoadSummary: %v", err)
+	}
+	if jo.Root != res.Root || len(jo.Dirs) != len(res.DirStats) {
+		t.Fatalf("round trip lost data: %+v", jo)
+	}
+	return jo
+}
+
+func TestGzipRoundTrip(t *testing.T) {
+	roundTripSummary(t, "gzip")
+}
+
+func TestGzipJSONOfScanIsAtomic(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "f"), 100)
+	writeFile(t, filepath.Join(root, "b", "g"), 50)
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2})
+	gz, err := lookupCompressor("gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the path main takes for -json out.json -compress gzip
+	dir := t.TempDir()
+	out := addCompressExt(filepath.Join(dir, "out.json"), gz)
+	write := compressWrite(gz, func(w io.Writer) error { return StreamSummary(w, res, SummaryOptions{}) })
+	if where, err := writeFileWithFallback(out, onWriteErrorFatal, io.Discard, write); err != nil || where != out {
+		t.Fatalf("write: where=%q err=%v", where, err)
+	}
+	jo, err := LoadSummary(out)
+	if err != nil {
+		t.Fatalf("LoadSummary: %v", err)
+	}
+	if jo.Root != root || len(jo.Dirs) != 3 || jo.Dirs[0].Size != 150 || jo.Stats.FilesScanned != 2 {
+		t.Fatalf("unexpected summary: %+v", jo)
+	}
+
+	// a failure halfway through leaves neither the target nor a temp file
+	failed := addCompressExt(filepath.Join(dir, "failed.json"), gz)
+	boom := errors.New("boom")
+	write = compressWrite(gz, func(w io.Writer) error {
+		_, _ = io.WriteString(w, `{"root":`)
+		return boom
+	})
+	if _, err := writeFileWithFallback(failed, onWriteErrorFatal, io.Discard, write); !errors.Is(err, boom) {
+		t.Fatalf("write error = %v, want %v", err, boom)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "out.json.gz" {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Fatalf("directory holds %v, want only out.json.gz", names)
+	}
+}
+
+func TestAddCompressExt(t *testing.T) {
+	gz := &compressor{ext: ".gz"}
+	cases := []struct {
+		in   string
+		c    *compressor
+		want string
+	}{
+		{"out.json", gz, "out.json.gz"},
+		{"out.json.gz", gz, "out.json.gz"},
+		{"-", gz, "-"},
+		{"out.json", nil, "out.json"},
+	}
+	for _, tc := range cases {
+		if got := addCompressExt(tc.in, tc.c); got != tc.want {
+			t.Errorf("addCompressExt(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+	if _, err := lookupCompressor("lz4"); err == nil {
+		t.Errorf("expected error for unknown compression")
+	}
+}
@@ -0,0 +1,26 @@
+//go:build zstd
+
+package main
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func init() {
+	compressors["zstd"] = compressor{
+		ext:   ".zst",
+		magic: zstdMagic,
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		},
+		newReader: func(r io.Reader) (io.Reader, error) {
+			zr, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return zr.IOReadCloser(), nil
+		},
+	}
+}
@@ -0,0 +1,9 @@
+//go:build zstd
+
+package main
+
+import "testing"
+
+func TestZstdRoundTrip(t *testing.T) {
+	roundTripSummary(t, "zstd")
+}
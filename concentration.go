@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// concentrationPercents are the top-N-percent user shares -concentration reports.
+var concentrationPercents = []int{1, 5, 10, 25}
+
+// TopShare is the part of all bytes held by the largest Percent% of users
+// (at least one user).
+type TopShare struct {
+	Percent int     `json:"percent"`
+	Users   int     `json:"users"`
+	Share   float64 `json:"share"`
+}
+
+// Concentration describes how unevenly the scanned bytes are spread over
+// users: the cumulative shares of the top users and the Gini coefficient
+// (0 = everyone holds the same, towards 1 = one user holds everything).
+type Concentration struct {
+	Users int        `json:"users"`
+	Top   []TopShare `json:"top"`
+	Gini  float64    `json:"gini"`
+}
+
+// sizeConcentration computes the Concentration of the given per-user sizes.
+func sizeConcentration(sizes []int64) Concentration {
+	s := append([]int64(nil), sizes...)
+	sort.Slice(s, func(i, j int) bool { return s[i] > s[j] })
+	n := len(s)
+	var total int64
+	for _, v := range s {
+		total += v
+	}
+	c := Concentration{Users: n, Top: make([]TopShare, 0, len(concentrationPercents))}
+	if n == 0 {
+		return c
+	}
+	for _, p := range concentrationPercents {
+		k := max((n*p+99)/100, 1)
+		var held int64
+		for _, v := range s[:k] {
+			held += v
+		}
+		ts := TopShare{Percent: p, Users: k}
+		if total > 0 {
+			ts.Share = float64(held) / float64(total)
+		}
+		c.Top = append(c.Top, ts)
+	}
+	if total > 0 {
+		// G = 2*sum(i*x_i) / (n*sum(x)) - (n+1)/n over ascending x, i from 1
+		var weighted float64
+		for i, v := range s {
+			weighted += float64(n-i) * float64(v)
+		}
+		c.Gini = 2*weighted/(float64(n)*float64(total)) - float64(n+1)/float64(n)
+	}
+	return c
+}
+
+// userConcentration computes the Concentration of userStats. The "(others)"
+// bucket of -max-users merges many users and is left out.
+func userConcentration(userStats map[string]*UserStat) Concentration {
+	sizes := make([]int64, 0, len(userStats))
+	for k, us := range userStats {
+		if k != othersKey {
+			sizes = append(sizes, us.Size)
+		}
+	}
+	return sizeConcentration(sizes)
+}
+
+// printConcentration writes the -concentration report of c.
+func printConcentration(w io.Writer, c Concentration) {
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintf(w, "User concentration (%d users):\n", c.Users)
+	for _, ts := range c.Top {
+		_, _ = fmt.Fprintf(w, "  top %2d%% (%d users) hold %5.1f%%\n", ts.Percent, ts.Users, ts.Share*100)
+	}
+	_, _ = fmt.Fprintf(w, "  Gini coefficient %.3f\n", c.Gini)
+}
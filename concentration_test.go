@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSizeConcentration(t *testing.T) {
+	oneHolder := make([]int64, 100)
+	oneHolder[42] = 100
+	even := make([]int64, 20)
+	for i := range even {
+		even[i] = 7
+	}
+
+	for _, tc := range []struct {
+		name   string
+		sizes  []int64
+		users  []int     // users counted per percent
+		shares []float64 // per percent
+		gini   float64
+	}{
+		{"small", []int64{10, 40, 20, 30}, []int{1, 1, 1, 1}, []float64{0.4, 0.4, 0.4, 0.4}, 0.25},
+		{"one holder", oneHolder, []int{1, 5, 10, 25}, []float64{1, 1, 1, 1}, 0.99},
+		{"even", even, []int{1, 1, 2, 5}, []float64{0.05, 0.05, 0.1, 0.25}, 0},
+		{"nothing stored", []int64{0, 0}, []int{1, 1, 1, 1}, []float64{0, 0, 0, 0}, 0},
+	} {
+		c := sizeConcentration(tc.sizes)
+		if c.Users != len(tc.sizes) || len(c.Top) != len(concentrationPercents) {
+			t.Fatalf("%s: unexpected concentration %+v", tc.name, c)
+		}
+		for i, ts := range c.Top {
+			if ts.Percent != concentrationPercents[i] || ts.Users != tc.users[i] || math.Abs(ts.Share-tc.shares[i]) > 1e-9 {
+				t.Errorf("%s: top %d%% = %+v, want %d users holding %v", tc.name, concentrationPercents[i], ts, tc.users[i], tc.shares[i])
+			}
+		}
+		if math.Abs(c.Gini-tc.gini) > 1e-9 {
+			t.Errorf("%s: gini = %v, want %v", tc.name, c.Gini, tc.gini)
+		}
+	}
+
+	if c := sizeConcentration(nil); c.Users != 0 || len(c.Top) != 0 || c.Gini != 0 {
+		t.Fatalf("no users: %+v", c)
+	}
+}
+
+func TestConcentrationReport(t *testing.T) {
+	stubOwnerNames(t, map[uint32]string{1: "a", 2: "b", 3: "c", 4: "d"}, map[uint32]string{})
+	res := newTestResult()
+	res.maxUsers = 4
+	for uid, size := range map[uint32]int64{1: 10, 2: 40, 3: 20, 4: 30} {
+		res.addFile(".", size, uid, 0)
+	}
+	res.UserStats[othersKey] = &UserStat{Name: othersKey, Size: 1000}
+
+	var tree bytes.Buffer
+	printTree(&tree, res, TreeOptions{Concentration: true})
+	for _, want := range []string{"User concentration (4 users):\n", "  top 25% (1 users) hold  40.0%\n", "  Gini coefficient 0.250\n"} {
+		if !strings.Contains(tree.String(), want) {
+			t.Fatalf("missing %q in:\n%s", want, tree.String())
+		}
+	}
+	if strings.Index(tree.String(), "User concentration") < strings.Index(tree.String(), "Per-user summary") {
+		t.Fatalf("concentration printed before the per-user summary:\n%s", tree.String())
+	}
+
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{Numeric: true, Concentration: true}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if c := jo.Concentration; c == nil || c.Users != 4 || math.Abs(c.Gini-0.25) > 1e-9 || c.Top[0].Share != 0.4 {
+		t.Fatalf("unexpected JSON concentration: %+v", jo.Concentration)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// WriteSummaryCSV writes the per-user and per-group totals of res as two CSV
+// sections separated by a blank line: "name,size,files,uid" for users and
+// "name,size,files,gid" for groups. Rows are ordered by size (largest first),
+// leave out those below opts.MinUserSize/MinGroupSize and are limited to
+// opts.TopN per section when it is > 0. Sizes follow opts.Format, so -bytes
+// gives raw byte counts.
+func WriteSummaryCSV(w io.Writer, res *Result, opts TreeOptions) error {
+	fo := opts.Format
+	cw := csv.NewWriter(w)
+
+	userKeys := sortedBySize(res.UserStats, func(us *UserStat) int64 { return us.Size }, opts.TopN, opts.MinUserSize)
+	_ = cw.Write([]string{"name", "size", "files", "uid"})
+	for _, k := range userKeys {
+		us := res.UserStats[k]
+		_ = cw.Write([]string{displayName(us.Name, k), fo.size(us.Size), strconv.FormatInt(us.Files, 10), strconv.FormatUint(uint64(us.UID), 10)})
+	}
+	cw.Flush()
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return err
+	}
+
+	groupKeys := sortedBySize(res.GroupStats, func(gs *GroupStat) int64 { return gs.Size }, opts.TopN, opts.MinGroupSize)
+	_ = cw.Write([]string{"name", "size", "files", "gid"})
+	for _, k := range groupKeys {
+		gs := res.GroupStats[k]
+		_ = cw.Write([]string{displayName(gs.Name, k), fo.size(gs.Size), strconv.FormatInt(gs.Files, 10), strconv.FormatUint(uint64(gs.GID), 10)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// summaryCSVWriter returns a write function producing WriteSummaryCSV's output
+// compressed with c (nil = uncompressed).
+func summaryCSVWriter(res *Result, opts TreeOptions, c *compressor) func(w io.Writer) error {
+	return compressWrite(c, func(w io.Writer) error { return WriteSummaryCSV(w, res, opts) })
+}
+
+// aboveMinSize returns m without the entries whose size is below minSize;
+// m itself when minSize <= 0.
+func aboveMinSize[T any](m map[string]T, size func(T) int64, minSize int64) map[string]T {
+	if minSize <= 0 || m == nil {
+		return m
+	}
+	kept := make(map[string]T, len(m))
+	for k, v := range m {
+		if size(v) >= minSize {
+			kept[k] = v
+		}
+	}
+	return kept
+}
+
+// sortedBySize returns the keys of m whose size is at least minSize, ordered
+// by descending size (ties by key) and truncated to topN when topN > 0.
+func sortedBySize[T any](m map[string]T, size func(T) int64, topN int, minSize int64) []string {
+	keys := make([]string, 0, len(m))
+	for k, v := range m {
+		if size(v) >= minSize {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		si, sj := size(m[keys[i]]), size(m[keys[j]])
+		if si == sj {
+			return keys[i] < keys[j]
+		}
+		return si > sj
+	})
+	if topN > 0 && topN < len(keys) {
+		keys = keys[:topN]
+	}
+	return keys
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteSummaryCSVGolden(t *testing.T) {
+	res := &Result{
+		UserStats: map[string]*UserStat{
+			"1001": {Size: 5000, Files: 3, UID: 1001, Name: "alice"},
+			"1002": {Size: 100, Files: 1, UID: 1002, Name: "bob, jr"},
+			"1003": {Size: 700, Files: 2, UID: 1003},
+		},
+		GroupStats: map[string]*GroupStat{
+			"100": {Size: 5100, Files: 4, GID: 100, Name: "staff"},
+			"200": {Size: 700, Files: 2, GID: 200, Name: "web"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSummaryCSV(&buf, res, TreeOptions{Format: FormatOptions{Bytes: true}}); err != nil {
+		t.Fatalf("WriteSummaryCSV: %v", err)
+	}
+	want := `name,size,files,uid
+alice,5000,3,1001
+1003,700,2,1003
+"bob, jr",100,1,1002
+
+name,size,files,gid
+staff,5100,4,100
+web,700,2,200
+`
+	if buf.String() != want {
+		t.Fatalf("unexpected CSV:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	// -top limits each section; sizes are human-readable without -bytes
+	buf.Reset()
+	if err := WriteSummaryCSV(&buf, res, TreeOptions{TopN: 1}); err != nil {
+		t.Fatalf("WriteSummaryCSV: %v", err)
+	}
+	want = `name,size,files,uid
+alice,` + humanizeBytes(5000) + `,3,1001
+
+name,size,files,gid
+staff,` + humanizeBytes(5100) + `,4,100
+`
+	if buf.String() != want {
+		t.Fatalf("unexpected top-1 CSV:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
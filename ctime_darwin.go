@@ -0,0 +1,11 @@
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+// statCtime returns the inode change time of st.
+func statCtime(st *syscall.Stat_t) time.Time {
+	return time.Unix(st.Ctimespec.Sec, st.Ctimespec.Nsec)
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+// statCtime returns the inode change time of st. Sec and Nsec are int32 on
+// 32-bit platforms, hence the conversions.
+func statCtime(st *syscall.Stat_t) time.Time {
+	return time.Unix(int64(st.Ctim.Sec), int64(st.Ctim.Nsec))
+}
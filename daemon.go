@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// DaemonConfig configures -daemon: keep the scan of Root up to date from
+// filesystem events and rewrite the JSON summary at Out as it changes.
+type DaemonConfig struct {
+	Root    string
+	Scan    ScanOptions
+	Out     string
+	Summary SummaryOptions
+	// Compress, when non-nil, compresses the summary (-compress).
+	Compress *compressor
+	// Interval debounces the events: changes are applied and the summary
+	// rewritten at most once per Interval.
+	Interval time.Duration
+	// Rescan is how often subtrees that could not be watched (e.g. the
+	// inotify watch limit was reached) are scanned again in full.
+	Rescan time.Duration
+}
+
+// runDaemon runs -daemon until ctx is done. It is set by daemon_watch.go in
+// builds with -tags daemon, which pull in the fsnotify dependency; it is nil
+// otherwise.
+var runDaemon func(ctx context.Context, cfg DaemonConfig) error
@@ -0,0 +1,318 @@
+//go:build daemon
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func init() {
+	runDaemon = watchDaemon
+}
+
+// liveScan is a scan kept up to date from filesystem events. It remembers
+// the files directly inside every directory (own), so a directory that
+// changed is read again on its own and only the difference is applied to
+// the aggregates. It is not safe for concurrent use; watchDaemon drives it
+// from a single goroutine.
+type liveScan struct {
+	root      string
+	opts      ScanOptions
+	filtering bool
+	res       *Result
+	own       map[string]dirTotals
+	// watch starts watching a directory for events, unwatch stops it.
+	watch   func(dir string) error
+	unwatch func(dir string)
+	// unwatched holds the directories that could not be watched; they and
+	// everything below them are left to rescanUnwatched.
+	unwatched map[string]bool
+	// warned is set once the first failed watch has been logged.
+	warned bool
+	// dirty holds the directories with events not applied yet.
+	dirty map[string]bool
+}
+
+func newLiveScan(root string, opts ScanOptions, watch func(string) error, unwatch func(string)) *liveScan {
+	l := &liveScan{
+		root:      root,
+		opts:      opts,
+		filtering: opts.Filter.active(),
+		res:       newResult(root, opts),
+		own:       make(map[string]dirTotals),
+		watch:     watch,
+		unwatch:   unwatch,
+		unwatched: make(map[string]bool),
+		dirty:     make(map[string]bool),
+	}
+	if opts.DirOwners {
+		l.res.DirUsers = make(map[string]map[string]*UserStat)
+	}
+	return l
+}
+
+func (l *liveScan) abs(rel string) string {
+	if rel == "." {
+		return l.root
+	}
+	return filepath.Join(l.root, rel)
+}
+
+// addTree reads directory rel and everything below it into the aggregates,
+// watching each directory when watch is set. Once a watch cannot be added
+// (typically because the inotify watch limit was reached), that directory
+// is recorded in unwatched and nothing below it is watched.
+func (l *liveScan) addTree(rel string, watch bool) {
+	info, err := os.Lstat(l.abs(rel))
+	if err != nil || !info.IsDir() {
+		return
+	}
+	st, _ := info.Sys().(*syscall.Stat_t)
+	l.res.recordDir(dirOwner{rel: rel, st: st})
+
+	type pending struct {
+		rel   string
+		watch bool
+	}
+	stack := []pending{{rel, watch}}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		dir := l.abs(p.rel)
+		// watch before reading, so no change in between goes unnoticed
+		if p.watch {
+			if err := l.watch(dir); err != nil {
+				if !l.warned {
+					l.warned = true
+					log.Printf("daemon: cannot watch %s: %v; such subtrees are rescanned periodically instead", dir, err)
+				}
+				l.unwatched[p.rel] = true
+				p.watch = false
+			}
+		}
+		t, _, err := l.res.readDir(dir, p.rel, &l.opts, l.filtering, nil)
+		if err != nil && l.opts.OnError != nil {
+			l.opts.OnError(dir, err)
+		}
+		l.res.DirsScanned++
+		for _, d := range t.subdirs {
+			l.res.recordDir(d)
+			stack = append(stack, pending{d.rel, p.watch})
+		}
+		l.res.addDirFiles(p.rel, t, 1)
+		l.own[p.rel] = t
+	}
+}
+
+// removeTree takes directory rel and everything below it back out of the
+// aggregates.
+func (l *liveScan) removeTree(rel string) {
+	t, ok := l.own[rel]
+	if !ok {
+		return
+	}
+	for _, d := range t.subdirs {
+		l.removeTree(d.rel)
+	}
+	l.res.addDirFiles(rel, t, -1)
+	l.res.FilesScanned -= t.files
+	l.res.DirsScanned--
+	delete(l.own, rel)
+	delete(l.unwatched, rel)
+	if rel != "." {
+		delete(l.res.DirStats, rel)
+		if l.res.DirUsers != nil {
+			delete(l.res.DirUsers, rel)
+		}
+	}
+	l.unwatch(l.abs(rel))
+}
+
+// refresh reads directory rel again after events in it: the change in its
+// own files is applied, and subdirectories that appeared or went away are
+// added or removed as a whole.
+func (l *liveScan) refresh(rel string) {
+	old, ok := l.own[rel]
+	if !ok {
+		// not tracked (anymore), e.g. removed along with its parent
+		return
+	}
+	dir := l.abs(rel)
+	info, err := os.Lstat(dir)
+	if err != nil || !info.IsDir() {
+		l.removeTree(rel)
+		return
+	}
+	t, _, err := l.res.readDir(dir, rel, &l.opts, l.filtering, nil)
+	if err != nil {
+		if l.opts.OnError != nil {
+			l.opts.OnError(dir, err)
+		}
+		return
+	}
+	l.res.addDirFiles(rel, old, -1)
+	l.res.FilesScanned -= old.files
+	l.res.addDirFiles(rel, t, 1)
+	st, _ := info.Sys().(*syscall.Stat_t)
+	l.res.recordDir(dirOwner{rel: rel, st: st})
+	l.own[rel] = t
+
+	present := make(map[string]bool, len(t.subdirs))
+	for _, d := range t.subdirs {
+		present[d.rel] = true
+		if _, known := l.own[d.rel]; known {
+			l.res.recordDir(d)
+		} else {
+			l.addTree(d.rel, true)
+		}
+	}
+	for _, d := range old.subdirs {
+		if !present[d.rel] {
+			l.removeTree(d.rel)
+		}
+	}
+}
+
+// handle records the directory an event happened in for the next flush.
+func (l *liveScan) handle(ev fsnotify.Event) {
+	rel, err := filepath.Rel(l.root, filepath.Dir(ev.Name))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return
+	}
+	l.dirty[rel] = true
+}
+
+// flush refreshes the directories with pending events, parents first, and
+// reports whether there were any.
+func (l *liveScan) flush() bool {
+	if len(l.dirty) == 0 {
+		return false
+	}
+	rels := make([]string, 0, len(l.dirty))
+	for rel := range l.dirty {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	clear(l.dirty)
+	for _, rel := range rels {
+		l.refresh(rel)
+	}
+	l.prune()
+	return true
+}
+
+// rescan replaces everything below rel by a fresh read.
+func (l *liveScan) rescan(rel string) {
+	l.removeTree(rel)
+	l.addTree(rel, true)
+	l.prune()
+}
+
+// rescanUnwatched rescans the subtrees that could not be watched, trying to
+// watch them again.
+func (l *liveScan) rescanUnwatched() {
+	rels := make([]string, 0, len(l.unwatched))
+	for rel := range l.unwatched {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	for _, rel := range rels {
+		if l.unwatched[rel] {
+			l.rescan(rel)
+		}
+	}
+}
+
+// prune drops the users and groups (and per-directory users) whose last
+// file went away.
+func (l *liveScan) prune() {
+	for k, us := range l.res.UserStats {
+		if us.Size == 0 && us.Files == 0 {
+			delete(l.res.UserStats, k)
+		}
+	}
+	for k, gs := range l.res.GroupStats {
+		if gs.Size == 0 && gs.Files == 0 {
+			delete(l.res.GroupStats, k)
+		}
+	}
+	for _, byUser := range l.res.DirUsers {
+		for k, du := range byUser {
+			if du.Size == 0 && du.Files == 0 {
+				delete(byUser, k)
+			}
+		}
+	}
+}
+
+// emit rewrites the JSON summary atomically.
+func (l *liveScan) emit(cfg DaemonConfig) {
+	l.res.EndedAt = time.Now()
+	write := func(w io.Writer) error { return StreamSummary(w, l.res, cfg.Summary) }
+	if err := writeFileAtomic(cfg.Out, compressWrite(cfg.Compress, write)); err != nil {
+		log.Printf("daemon: failed to write %s: %v", cfg.Out, err)
+	}
+}
+
+// watchDaemon scans cfg.Root, writes the summary, and then keeps it up to
+// date from fsnotify events until ctx is done.
+func watchDaemon(ctx context.Context, cfg DaemonConfig) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	l := newLiveScan(cfg.Root, cfg.Scan, w.Add, func(dir string) { _ = w.Remove(dir) })
+	l.addTree(".", true)
+	l.emit(cfg)
+
+	debounce := time.NewTicker(cfg.Interval)
+	defer debounce.Stop()
+	rescan := time.NewTicker(cfg.Rescan)
+	defer rescan.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			l.handle(ev)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			if !errors.Is(err, fsnotify.ErrEventOverflow) {
+				log.Printf("daemon: %v", err)
+				continue
+			}
+			// events were lost; nothing but a full rescan is reliable
+			log.Printf("daemon: %v; rescanning %s", err, cfg.Root)
+			clear(l.dirty)
+			l.rescan(".")
+			l.emit(cfg)
+		case <-debounce.C:
+			if l.flush() {
+				l.emit(cfg)
+			}
+		case <-rescan.C:
+			if len(l.unwatched) > 0 {
+				l.rescanUnwatched()
+				l.emit(cfg)
+			}
+		}
+	}
+}
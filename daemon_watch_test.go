@@ -0,0 +1,158 @@
+//go:build daemon
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// newTestLiveScan scans root with watches that always succeed unless their
+// directory is in refuse.
+func newTestLiveScan(t *testing.T, root string, refuse map[string]bool) *liveScan {
+	t.Helper()
+	watch := func(dir string) error {
+		if refuse[dir] {
+			return errors.New("no space left on device")
+		}
+		return nil
+	}
+	l := newLiveScan(root, ScanOptions{}, watch, func(string) {})
+	l.addTree(".", true)
+	return l
+}
+
+// assertMatchesScan compares l's aggregates with a fresh full scan.
+func assertMatchesScan(t *testing.T, l *liveScan) {
+	t.Helper()
+	want := Scan(context.Background(), l.root, ScanOptions{Concurrency: 2})
+	if !reflect.DeepEqual(l.res.DirStats, want.DirStats) {
+		t.Fatalf("dir stats:\n got %v\nwant %v", l.res.DirStats, want.DirStats)
+	}
+	if !reflect.DeepEqual(l.res.UserStats, want.UserStats) || !reflect.DeepEqual(l.res.GroupStats, want.GroupStats) {
+		t.Fatalf("owner stats: got %v %v, want %v %v", l.res.UserStats, l.res.GroupStats, want.UserStats, want.GroupStats)
+	}
+	if l.res.FilesScanned != want.FilesScanned || l.res.DirsScanned != want.DirsScanned {
+		t.Fatalf("counters: got files=%d dirs=%d, want files=%d dirs=%d", l.res.FilesScanned, l.res.DirsScanned, want.FilesScanned, want.DirsScanned)
+	}
+}
+
+func TestLiveScanCreateEvent(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a"), 10)
+	writeFile(t, filepath.Join(root, "sub", "b"), 20)
+	l := newTestLiveScan(t, root, nil)
+	assertMatchesScan(t, l)
+
+	created := filepath.Join(root, "sub", "c")
+	writeFile(t, created, 300)
+	l.handle(fsnotify.Event{Name: created, Op: fsnotify.Create})
+	if !l.flush() {
+		t.Fatalf("flush found nothing to apply")
+	}
+	if ds := l.res.DirStats["sub"]; ds.Size != 320 || ds.Files != 2 {
+		t.Fatalf("sub = %+v after the create, want 320 bytes in 2 files", ds)
+	}
+	if ds := l.res.DirStats["."]; ds.Size != 330 || ds.Files != 3 {
+		t.Fatalf("root = %+v after the create, want 330 bytes in 3 files", ds)
+	}
+	assertMatchesScan(t, l)
+	if l.flush() {
+		t.Fatalf("second flush without events applied something")
+	}
+}
+
+func TestLiveScanDirectoryEvents(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "keep", "x"), 5)
+	writeFile(t, filepath.Join(root, "gone", "deep", "y"), 50)
+	l := newTestLiveScan(t, root, nil)
+
+	// a new subtree and a removed one, reported on their parent
+	writeFile(t, filepath.Join(root, "new", "inner", "z"), 500)
+	if err := os.RemoveAll(filepath.Join(root, "gone")); err != nil {
+		t.Fatal(err)
+	}
+	l.handle(fsnotify.Event{Name: filepath.Join(root, "new"), Op: fsnotify.Create})
+	l.handle(fsnotify.Event{Name: filepath.Join(root, "gone"), Op: fsnotify.Remove})
+	l.flush()
+	assertMatchesScan(t, l)
+	if _, ok := l.own["gone/deep"]; ok {
+		t.Fatalf("removed directory still tracked")
+	}
+	if _, ok := l.own["new/inner"]; !ok {
+		t.Fatalf("created directory not tracked")
+	}
+
+	// shrinking a file
+	if err := os.WriteFile(filepath.Join(root, "new", "inner", "z"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	l.handle(fsnotify.Event{Name: filepath.Join(root, "new", "inner", "z"), Op: fsnotify.Write})
+	l.flush()
+	assertMatchesScan(t, l)
+}
+
+func TestLiveScanUnwatchedSubtreeRescan(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "big", "a"), 1)
+	writeFile(t, filepath.Join(root, "big", "sub", "b"), 2)
+	l := newTestLiveScan(t, root, map[string]bool{filepath.Join(root, "big"): true})
+	if !reflect.DeepEqual(l.unwatched, map[string]bool{"big": true}) {
+		t.Fatalf("unwatched = %v, want just big", l.unwatched)
+	}
+
+	// no events arrive from an unwatched subtree; the rescan picks it up
+	writeFile(t, filepath.Join(root, "big", "sub", "c"), 40)
+	l.rescanUnwatched()
+	assertMatchesScan(t, l)
+	if !l.unwatched["big"] {
+		t.Fatalf("big should stay unwatched while watches are refused")
+	}
+}
+
+func TestWatchDaemonRewritesSummary(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "sub", "a"), 10)
+	out := filepath.Join(t.TempDir(), "du.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- watchDaemon(ctx, DaemonConfig{Root: root, Out: out, Interval: 10 * time.Millisecond, Rescan: time.Hour})
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("watchDaemon: %v", err)
+		}
+	}()
+
+	rootSize := func() int64 {
+		jo, err := LoadSummary(out)
+		if err != nil {
+			return -1
+		}
+		return resultFromSummary(jo).DirStats["."].Size
+	}
+	waitFor := func(want int64) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for rootSize() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("root size in %s = %d, want %d", out, rootSize(), want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor(10)
+	writeFile(t, filepath.Join(root, "sub", "b"), 200)
+	waitFor(210)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDeadline(t *testing.T) {
+	now := time.Date(2024, 3, 10, 5, 30, 0, 0, time.Local)
+
+	if got, err := parseDeadline("06:00", now); err != nil || !got.Equal(time.Date(2024, 3, 10, 6, 0, 0, 0, time.Local)) {
+		t.Fatalf("06:00 later today: got %v, %v", got, err)
+	}
+	if got, err := parseDeadline("05:00", now); err != nil || !got.Equal(time.Date(2024, 3, 11, 5, 0, 0, 0, time.Local)) {
+		t.Fatalf("05:00 should roll over to tomorrow: got %v, %v", got, err)
+	}
+	if got, err := parseDeadline("2024-03-10T07:00:00Z", now); err != nil || !got.Equal(time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC)) {
+		t.Fatalf("RFC3339: got %v, %v", got, err)
+	}
+	for _, bad := range []string{"6am", "25:00", ""} {
+		if _, err := parseDeadline(bad, now); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestScanPastDeadline(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 50; i++ {
+		writeFile(t, filepath.Join(root, "d", string(rune('a'+i%26))+string(rune('a'+i/26))), 1)
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	start := time.Now()
+	res := Scan(ctx, root, ScanOptions{Concurrency: 2})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("scan took %v after the deadline", elapsed)
+	}
+	if !res.Incomplete || res.FilesScanned != 0 {
+		t.Fatalf("expected an incomplete, empty scan; incomplete=%v files=%d", res.Incomplete, res.FilesScanned)
+	}
+
+	var out bytes.Buffer
+	if err := (TreeFormatter{}).Write(&out, res); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "scan incomplete") {
+		t.Fatalf("missing incomplete marker:\n%s", out.String())
+	}
+}
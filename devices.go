@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+// DeviceStat aggregates the files found on one device (st_dev) for -by-device.
+type DeviceStat struct {
+	Size  int64
+	Files int64
+	// Mount and FSType name the mount the device is known by; empty until
+	// resolved from the mount table.
+	Mount  string
+	FSType string
+}
+
+// devKey formats a device number as "major:minor", the form mountinfo uses.
+func devKey(dev uint64) string {
+	maj, mnr := devMajorMinor(dev)
+	return fmt.Sprintf("%d:%d", maj, mnr)
+}
+
+// deviceMounts maps each device ("major:minor") of mounts to the mount it is
+// best known by: one that mounts the filesystem's own root rather than a bind
+// of a subdirectory, with the shortest mount point.
+func deviceMounts(mounts []Mount) map[string]Mount {
+	best := make(map[string]Mount)
+	for _, m := range mounts {
+		cur, ok := best[m.Dev]
+		if !ok {
+			best[m.Dev] = m
+			continue
+		}
+		curRoot, mRoot := cur.Root == "/", m.Root == "/"
+		if (mRoot && !curRoot) || (mRoot == curRoot && len(filepath.Clean(m.Point)) < len(filepath.Clean(cur.Point))) {
+			best[m.Dev] = m
+		}
+	}
+	return best
+}
+
+// resolveDevices fills in the mount point and filesystem type of every
+// device in r.Devices found in mounts.
+func (r *Result) resolveDevices(mounts []Mount) {
+	byDev := deviceMounts(mounts)
+	for key, ds := range r.Devices {
+		if m, ok := byDev[key]; ok {
+			ds.Mount, ds.FSType = m.Point, m.FSType
+		}
+	}
+}
+
+// sortedDevices returns the device keys by descending size (then key).
+func sortedDevices(devs map[string]*DeviceStat) []string {
+	keys := make([]string, 0, len(devs))
+	for k := range devs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := devs[keys[i]], devs[keys[j]]
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// printDevices writes the per-device summary below the tree.
+func printDevices(w io.Writer, devs map[string]*DeviceStat, fo FormatOptions) {
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, "Per-device summary:")
+	for _, k := range sortedDevices(devs) {
+		ds := devs[k]
+		where := "(unknown mount)"
+		if ds.Mount != "" {
+			where = fo.path(ds.Mount) + " (" + ds.FSType + ")"
+		}
+		_, _ = fmt.Fprintf(w, "%-10s %10s %10s files  %s\n", k, fo.size(ds.Size), fo.files(ds.Files), where)
+	}
+}
+
+// jsonDevices converts the -by-device totals to their JSON form, largest first.
+func jsonDevices(devs map[string]*DeviceStat) []JsonDevice {
+	out := make([]JsonDevice, 0, len(devs))
+	for _, k := range sortedDevices(devs) {
+		ds := devs[k]
+		out = append(out, JsonDevice{Dev: k, Mount: ds.Mount, FSType: ds.FSType, Size: ds.Size, Files: ds.Files})
+	}
+	return out
+}
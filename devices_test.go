@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+const devicesMountInfo = `22 1 8:1 / / rw,relatime - ext4 /dev/sda1 rw
+23 22 0:5 / /proc rw - proc proc rw
+24 22 8:17 /exports /srv/data rw - xfs /dev/sdb1 rw
+25 22 8:17 / /mnt/big rw - xfs /dev/sdb1 rw
+26 22 8:1 /home /home-bind rw - ext4 /dev/sda1 rw
+`
+
+func TestDeviceMounts(t *testing.T) {
+	mounts, err := ParseMountInfo(devicesMountInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := deviceMounts(mounts)
+	for dev, point := range map[string]string{"8:1": "/", "8:17": "/mnt/big", "0:5": "/proc"} {
+		if got[dev].Point != point {
+			t.Errorf("device %s resolved to %q, want %q", dev, got[dev].Point, point)
+		}
+	}
+
+	res := &Result{Devices: map[string]*DeviceStat{"8:17": {Size: 10}, "9:9": {Size: 1}}}
+	res.resolveDevices(mounts)
+	if d := res.Devices["8:17"]; d.Mount != "/mnt/big" || d.FSType != "xfs" {
+		t.Fatalf("8:17 = %+v", d)
+	}
+	if d := res.Devices["9:9"]; d.Mount != "" {
+		t.Fatalf("unknown device resolved: %+v", d)
+	}
+}
+
+func TestDevKey(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("devNumber uses the Linux encoding")
+	}
+	for _, mm := range []string{"8:1", "259:65537", "4095:255", "4096:256"} {
+		dev, err := devNumber(mm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := devKey(dev); got != mm {
+			t.Errorf("devKey(devNumber(%q)) = %q", mm, got)
+		}
+	}
+}
+
+// devFileInfo reports a different st_dev than the file it wraps.
+type devFileInfo struct {
+	os.FileInfo
+	st syscall.Stat_t
+}
+
+func (fi devFileInfo) Sys() any { return &fi.st }
+
+func TestScanByDevice(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "local", "a"), 100)
+	writeFile(t, filepath.Join(root, "local", "b"), 50)
+	writeFile(t, filepath.Join(root, "nfs", "c"), 300)
+
+	// files below nfs/ appear to live on the next device number
+	info, err := os.Lstat(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := *info.Sys().(*syscall.Stat_t)
+	st.Dev++
+	nfsKey := devKey(uint64(st.Dev))
+	oldLstat := lstat
+	t.Cleanup(func() { lstat = oldLstat })
+	lstat = func(path string) (os.FileInfo, error) {
+		info, err := os.Lstat(path)
+		if err != nil || !strings.Contains(path, "/nfs/") {
+			return info, err
+		}
+		fi := devFileInfo{FileInfo: info, st: *info.Sys().(*syscall.Stat_t)}
+		fi.st.Dev = st.Dev
+		return fi, nil
+	}
+
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, ByDevice: true})
+	if len(res.Devices) != 2 {
+		t.Fatalf("expected 2 device buckets, got %v", res.Devices)
+	}
+	if d := res.Devices[nfsKey]; d == nil || d.Size != 300 || d.Files != 1 {
+		t.Fatalf("nfs device = %+v", d)
+	}
+	for k, d := range res.Devices {
+		if k != nfsKey && (d.Size != 150 || d.Files != 2) {
+			t.Fatalf("local device %s = %+v", k, d)
+		}
+	}
+	mounts, _ := ParseMountInfo("30 1 " + nfsKey + " / " + root + "/nfs rw - nfs4 srv:/export rw\n")
+	res.resolveDevices(mounts)
+
+	var out bytes.Buffer
+	printDevices(&out, res.Devices, FormatOptions{Bytes: true})
+	if !strings.Contains(out.String(), nfsKey) || !strings.Contains(out.String(), root+"/nfs (nfs4)") {
+		t.Fatalf("device summary:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := StreamSummary(&out, res, SummaryOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(out.Bytes(), &jo); err != nil {
+		t.Fatal(err)
+	}
+	if len(jo.Devices) != 2 || jo.Devices[0].Dev != nfsKey || jo.Devices[0].FSType != "nfs4" || jo.Devices[0].Size != 300 {
+		t.Fatalf("json devices = %+v", jo.Devices)
+	}
+	if back := resultFromSummary(jo); back.Devices[nfsKey].Mount != root+"/nfs" {
+		t.Fatalf("devices not restored from JSON: %v", back.Devices)
+	}
+}
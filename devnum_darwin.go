@@ -0,0 +1,8 @@
+package main
+
+// devMajorMinor splits a Darwin st_dev (a 32-bit value with the major number
+// in the top byte) into its major and minor numbers.
+func devMajorMinor(dev uint64) (uint64, uint64) {
+	dev &= 0xffffffff
+	return dev >> 24, dev & 0xffffff
+}
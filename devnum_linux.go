@@ -0,0 +1,9 @@
+package main
+
+// devMajorMinor splits a Linux st_dev into its major and minor numbers (the
+// glibc encoding, the inverse of devNumber).
+func devMajorMinor(dev uint64) (uint64, uint64) {
+	maj := (dev>>8)&0xfff | (dev>>32)&0xfffff000
+	mnr := dev&0xff | (dev>>12)&0xffffff00
+	return maj, mnr
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// DiffResult is the machine-readable form of -compare, written with -json:
+// the change of every directory, user and group between two snapshots, and
+// which of them appeared or disappeared.
+type DiffResult struct {
+	Root string `json:"root"`
+	// Old and New label the snapshots by their snapshot name and host, when
+	// they record them.
+	Old  string     `json:"old,omitempty"`
+	New  string     `json:"new,omitempty"`
+	Dirs []DirDelta `json:"dirs"`
+	// Users and Groups are matched by name, so snapshots of hosts whose ids
+	// differ still line up.
+	Users   []OwnerDelta `json:"users"`
+	Groups  []OwnerDelta `json:"groups"`
+	Added   DiffNames    `json:"added"`
+	Removed DiffNames    `json:"removed"`
+}
+
+// DirDelta is the change of one directory's subtree, matched by its path
+// relative to the root. A side the directory is missing from counts as 0.
+type DirDelta struct {
+	Rel        string `json:"rel"`
+	OldSize    int64  `json:"old_size"`
+	NewSize    int64  `json:"new_size"`
+	SizeDelta  int64  `json:"size_delta"`
+	OldFiles   int64  `json:"old_files"`
+	NewFiles   int64  `json:"new_files"`
+	FilesDelta int64  `json:"files_delta"`
+}
+
+// OwnerDelta is the change of one user's or group's totals.
+type OwnerDelta struct {
+	Name       string `json:"name"`
+	OldSize    int64  `json:"old_size"`
+	NewSize    int64  `json:"new_size"`
+	SizeDelta  int64  `json:"size_delta"`
+	OldFiles   int64  `json:"old_files"`
+	NewFiles   int64  `json:"new_files"`
+	FilesDelta int64  `json:"files_delta"`
+}
+
+// DiffNames lists the directories (by rel), users and groups only found in
+// one of the snapshots, sorted.
+type DiffNames struct {
+	Dirs   []string `json:"dirs"`
+	Users  []string `json:"users"`
+	Groups []string `json:"groups"`
+}
+
+// ownerTotals is one side of an owner diff: the size and files per name.
+type ownerTotals map[string][2]int64
+
+func (t ownerTotals) add(name string, size, files int64) {
+	v := t[name]
+	t[name] = [2]int64{v[0] + size, v[1] + files}
+}
+
+// diffResults compares two snapshots like printCompareTree does, for every
+// directory regardless of depth. Directories are ordered by rel with the
+// root first, users and groups by name.
+func diffResults(old, cur *Result) DiffResult {
+	d := DiffResult{
+		Root:    cur.Root,
+		Old:     snapshotLabel(old.SnapshotName, old.Hostname),
+		New:     snapshotLabel(cur.SnapshotName, cur.Hostname),
+		Dirs:    []DirDelta{},
+		Added:   DiffNames{Dirs: []string{}, Users: []string{}, Groups: []string{}},
+		Removed: DiffNames{Dirs: []string{}, Users: []string{}, Groups: []string{}},
+	}
+
+	rels := make([]string, 0, len(cur.DirStats))
+	for rel := range cur.DirStats {
+		rels = append(rels, rel)
+	}
+	for rel := range old.DirStats {
+		if _, ok := cur.DirStats[rel]; !ok {
+			rels = append(rels, rel)
+		}
+	}
+	sort.Slice(rels, func(i, j int) bool {
+		if (rels[i] == ".") != (rels[j] == ".") {
+			return rels[i] == "."
+		}
+		return rels[i] < rels[j]
+	})
+	for _, rel := range rels {
+		dd := DirDelta{Rel: rel}
+		o, inOld := old.DirStats[rel]
+		if inOld {
+			dd.OldSize, dd.OldFiles = o.Size, o.Files
+		}
+		c, inCur := cur.DirStats[rel]
+		if inCur {
+			dd.NewSize, dd.NewFiles = c.Size, c.Files
+		}
+		dd.SizeDelta, dd.FilesDelta = dd.NewSize-dd.OldSize, dd.NewFiles-dd.OldFiles
+		d.Dirs = append(d.Dirs, dd)
+		switch {
+		case !inOld:
+			d.Added.Dirs = append(d.Added.Dirs, rel)
+		case !inCur:
+			d.Removed.Dirs = append(d.Removed.Dirs, rel)
+		}
+	}
+
+	users := func(r *Result) ownerTotals {
+		t := make(ownerTotals, len(r.UserStats))
+		for key, us := range r.UserStats {
+			t.add(displayName(us.Name, key), us.Size, us.Files)
+		}
+		return t
+	}
+	groups := func(r *Result) ownerTotals {
+		t := make(ownerTotals, len(r.GroupStats))
+		for key, gs := range r.GroupStats {
+			t.add(displayName(gs.Name, key), gs.Size, gs.Files)
+		}
+		return t
+	}
+	d.Users = diffOwners(users(old), users(cur), &d.Added.Users, &d.Removed.Users)
+	d.Groups = diffOwners(groups(old), groups(cur), &d.Added.Groups, &d.Removed.Groups)
+	return d
+}
+
+// diffOwners returns the deltas of the owners of either side by name,
+// appending those only in cur to added and those only in old to removed.
+func diffOwners(old, cur ownerTotals, added, removed *[]string) []OwnerDelta {
+	names := make([]string, 0, len(cur))
+	for name := range cur {
+		names = append(names, name)
+	}
+	for name := range old {
+		if _, ok := cur[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	out := make([]OwnerDelta, 0, len(names))
+	for _, name := range names {
+		o, inOld := old[name]
+		c, inCur := cur[name]
+		out = append(out, OwnerDelta{
+			Name:    name,
+			OldSize: o[0], NewSize: c[0], SizeDelta: c[0] - o[0],
+			OldFiles: o[1], NewFiles: c[1], FilesDelta: c[1] - o[1],
+		})
+		switch {
+		case !inOld:
+			*added = append(*added, name)
+		case !inCur:
+			*removed = append(*removed, name)
+		}
+	}
+	return out
+}
+
+// writeDiffJSON writes d as one JSON object laid out like the summary
+// (writeSummaryJSON): the arrays are streamed an entry at a time, each on a
+// single line when compact.
+func writeDiffJSON(w io.Writer, d DiffResult, compact bool) error {
+	bw := bufio.NewWriter(w)
+	rootB, err := json.Marshal(d.Root)
+	if err != nil {
+		return fmt.Errorf("marshal root: %w", err)
+	}
+	_, _ = fmt.Fprintf(bw, "{\n  \"root\": %s,\n", rootB)
+	var members []func(last bool) error
+	if d.Old != "" {
+		members = append(members, func(last bool) error { return writeMember(bw, "old", d.Old, last) })
+	}
+	if d.New != "" {
+		members = append(members, func(last bool) error { return writeMember(bw, "new", d.New, last) })
+	}
+	members = append(members,
+		func(last bool) error { return streamArray(bw, "dirs", d.Dirs, last, compact) },
+		func(last bool) error { return streamArray(bw, "users", d.Users, last, compact) },
+		func(last bool) error { return streamArray(bw, "groups", d.Groups, last, compact) },
+		func(last bool) error { return writeMember(bw, "added", d.Added, last) },
+		func(last bool) error { return writeMember(bw, "removed", d.Removed, last) },
+	)
+	for i, m := range members {
+		if err := m(i == len(members)-1); err != nil {
+			return err
+		}
+	}
+	_, _ = bw.WriteString("}\n")
+	return bw.Flush()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// dirTracker tells when the subtree of a directory is final during a scan,
+// for ScanOptions.OnDirDone. A directory stays pending while the walk is
+// inside it, while files of it are queued but not yet aggregated, and while
+// any of its subdirectories is pending; the moment none of that holds, done
+// is called with its rel, so children always finish before their parent.
+// It is not safe for concurrent use; Scan calls it under its mutex.
+type dirTracker struct {
+	pending map[string]int
+	done    func(rel string)
+}
+
+func newDirTracker(done func(rel string)) *dirTracker {
+	return &dirTracker{pending: make(map[string]int), done: done}
+}
+
+// enter records that the walk entered directory rel.
+func (t *dirTracker) enter(rel string) {
+	t.pending[rel]++
+	if rel != "." {
+		t.pending[filepath.Dir(rel)]++
+	}
+}
+
+// queue records a file of directory rel handed to the workers.
+func (t *dirTracker) queue(rel string) {
+	t.pending[rel]++
+}
+
+// release undoes one enter (when the walk leaves rel) or queue (when a
+// worker is done with a file of rel), finishing rel and, in turn, the
+// parents it was the last pending part of.
+func (t *dirTracker) release(rel string) {
+	for {
+		n, ok := t.pending[rel]
+		if !ok {
+			return
+		}
+		if n > 1 {
+			t.pending[rel] = n - 1
+			return
+		}
+		delete(t.pending, rel)
+		t.done(rel)
+		if rel == "." {
+			return
+		}
+		rel = filepath.Dir(rel)
+	}
+}
+
+// walkPosition follows a depth-first walk for a dirTracker: the directories
+// the walk is inside, innermost last. It is only used by the walking
+// goroutine.
+type walkPosition struct {
+	open []string
+}
+
+// leave pops the directories that the entry about to be visited, whose
+// parent is rel, is not inside of; the walk is done with them.
+func (p *walkPosition) leave(rel string, release func(rel string)) {
+	for len(p.open) > 0 {
+		top := p.open[len(p.open)-1]
+		if top == "." || rel == top || strings.HasPrefix(rel, top+string(filepath.Separator)) {
+			return
+		}
+		p.open = p.open[:len(p.open)-1]
+		release(top)
+	}
+}
+
+// leaveAll pops every directory once the walk has ended.
+func (p *walkPosition) leaveAll(release func(rel string)) {
+	for len(p.open) > 0 {
+		top := p.open[len(p.open)-1]
+		p.open = p.open[:len(p.open)-1]
+		release(top)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDirTrackerFinishesChildrenFirst(t *testing.T) {
+	var done []string
+	tr := newDirTracker(func(rel string) { done = append(done, rel) })
+	var pos walkPosition
+	enter := func(rel, parent string) {
+		if rel != "." {
+			pos.leave(parent, tr.release)
+		}
+		tr.enter(rel)
+		pos.open = append(pos.open, rel)
+	}
+	file := func(rel string) {
+		pos.leave(rel, tr.release)
+		tr.queue(rel)
+	}
+
+	enter(".", "")
+	file(".")
+	enter("a", ".")
+	file("a")
+	enter("a/b", "a")
+	file("a/b")
+	enter("c", ".") // leaves a/b and a, whose files are still queued
+	if len(done) != 0 {
+		t.Fatalf("finished %v with files still queued", done)
+	}
+	tr.release("a/b") // the worker is done with the file of a/b
+	if !reflect.DeepEqual(done, []string{"a/b"}) {
+		t.Fatalf("done = %v, want a/b", done)
+	}
+	tr.release(".")
+	pos.leaveAll(tr.release) // c is empty and finishes with the walk
+	tr.release("a")
+	if want := []string{"a/b", "c", "a", "."}; !reflect.DeepEqual(done, want) {
+		t.Fatalf("done = %v, want %v", done, want)
+	}
+	if len(tr.pending) != 0 {
+		t.Fatalf("still pending: %v", tr.pending)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// dirQueue is the work list of the -dirs-only scan: directories still to be
+// read. It is a stack, so workers go depth-first and tend to stay within
+// the subtree they just read. pop blocks until a directory is available and
+// reports false once every pushed directory is done or the queue is stopped.
+type dirQueue struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	dirs []string
+	// pending counts the directories pushed but not yet done.
+	pending int
+	stopped bool
+}
+
+func newDirQueue() *dirQueue {
+	q := &dirQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *dirQueue) push(dir string) {
+	q.mu.Lock()
+	q.dirs = append(q.dirs, dir)
+	q.pending++
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+func (q *dirQueue) pop() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.dirs) == 0 && q.pending > 0 && !q.stopped {
+		q.cond.Wait()
+	}
+	if q.stopped || len(q.dirs) == 0 {
+		return "", false
+	}
+	dir := q.dirs[len(q.dirs)-1]
+	q.dirs = q.dirs[:len(q.dirs)-1]
+	return dir, true
+}
+
+// done marks a popped directory as finished.
+func (q *dirQueue) done() {
+	q.mu.Lock()
+	q.pending--
+	if q.pending == 0 {
+		q.cond.Broadcast()
+	}
+	q.mu.Unlock()
+}
+
+// stop makes every pop return false, abandoning the queued directories.
+func (q *dirQueue) stop() {
+	q.mu.Lock()
+	q.stopped = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// ownerIDs is the uid/gid pair a directory's files are totalled under.
+type ownerIDs struct {
+	uid, gid uint32
+}
+
+// dirOwner is a directory found while reading its parent, with its owner
+// when it could be statted.
+type dirOwner struct {
+	rel string
+	st  *syscall.Stat_t
+}
+
+// scanDirs is the -dirs-only walk: concurrency workers each read a whole
+// directory, stat its files and add their totals under mu in one go, rather
+// than the walker handing single files to the workers. Subdirectories are
+// pushed back onto the shared queue.
+func (r *Result) scanDirs(ctx context.Context, rootAbs string, opts *ScanOptions, mu *sync.Mutex, concurrency int, limiter *RateLimiter) error {
+	rootInfo, err := os.Lstat(rootAbs)
+	if err != nil {
+		return err
+	}
+	st, _ := rootInfo.Sys().(*syscall.Stat_t)
+	mu.Lock()
+	r.recordDir(dirOwner{rel: ".", st: st})
+	mu.Unlock()
+	atomic.AddInt64(&r.DirsScanned, 1)
+
+	filtering := opts.Filter.active()
+	q := newDirQueue()
+	q.push(rootAbs)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				dir, ok := q.pop()
+				if !ok {
+					return
+				}
+				if ctx.Err() != nil {
+					r.setIncomplete(mu)
+					q.stop()
+				} else if !r.scanDir(dir, rootAbs, opts, filtering, mu, limiter, q) {
+					r.setIncomplete(mu)
+					q.stop()
+				}
+				q.done()
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// scanDir reads one directory for scanDirs. It reports false when the file
+// cap was reached.
+func (r *Result) scanDir(dir, rootAbs string, opts *ScanOptions, filtering bool, mu *sync.Mutex, limiter *RateLimiter, q *dirQueue) bool {
+	rel, err := filepath.Rel(rootAbs, dir)
+	if err != nil {
+		rel = dir
+	}
+	t, complete, err := r.readDir(dir, rel, opts, filtering, limiter)
+	if err != nil {
+		// skip unreadable directories
+		if opts.OnError != nil {
+			opts.OnError(dir, err)
+		}
+		return true
+	}
+	for _, d := range t.subdirs {
+		atomic.AddInt64(&r.DirsScanned, 1)
+		q.push(filepath.Join(dir, filepath.Base(d.rel)))
+	}
+
+	mu.Lock()
+	for _, d := range t.subdirs {
+		r.recordDir(d)
+	}
+	r.addDirFiles(rel, t, 1)
+	mu.Unlock()
+	return complete
+}
+
+// dirTotals are the files directly inside one directory, as read by readDir.
+type dirTotals struct {
+	size, files int64
+	owners      map[ownerIDs]*DirStat
+	// subdirs are the directories found inside, with their owners.
+	subdirs []dirOwner
+}
+
+// readDir reads dir, found at rel below the root, and stats its files,
+// leaving out the SkipDirs and the files rejected by the filters. It reports
+// false when the file cap was reached; the totals then cover the files
+// statted so far.
+func (r *Result) readDir(dir, rel string, opts *ScanOptions, filtering bool, limiter *RateLimiter) (dirTotals, bool, error) {
+	var t dirTotals
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return t, true, err
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if e.IsDir() {
+			if opts.SkipDirs[path] {
+				continue
+			}
+			d := dirOwner{rel: filepath.Join(rel, e.Name())}
+			if info, err := e.Info(); err == nil {
+				d.st, _ = info.Sys().(*syscall.Stat_t)
+			}
+			t.subdirs = append(t.subdirs, d)
+			continue
+		}
+		if filtering && !opts.Filter.Match(path) {
+			continue
+		}
+		if opts.SkipRootFiles && rel == "." {
+			continue
+		}
+		if n := atomic.AddInt64(&r.FilesScanned, 1); opts.MaxFiles > 0 && n > opts.MaxFiles {
+			atomic.AddInt64(&r.FilesScanned, -1)
+			return t, false, nil
+		}
+		f, ok := r.statFile(path, opts, limiter)
+		if !ok {
+			continue
+		}
+		t.size += f.size
+		t.files++
+		if t.owners == nil {
+			t.owners = make(map[ownerIDs]*DirStat)
+		}
+		o := ownerIDs{uid: f.uid, gid: f.gid}
+		ot, ok := t.owners[o]
+		if !ok {
+			ot = &DirStat{}
+			t.owners[o] = ot
+		}
+		ot.Size += f.size
+		ot.Files++
+	}
+	return t, true, nil
+}
+
+// addDirFiles adds the files of t to rel, its ancestors and their owners;
+// with sign -1 it takes them back out. Callers must hold the mutex guarding
+// the maps.
+func (r *Result) addDirFiles(rel string, t dirTotals, sign int64) {
+	if t.files == 0 {
+		return
+	}
+	r.addDirTotals(rel, sign*t.size, sign*t.files)
+	for o, ot := range t.owners {
+		r.addOwnerTotals(rel, sign*ot.Size, sign*ot.Files, o.uid, o.gid)
+	}
+}
+
+// recordDir makes sure d has a DirStat, so empty directories show up with
+// zero totals, and sets its owner. Callers must hold the mutex guarding the
+// maps.
+func (r *Result) recordDir(d dirOwner) {
+	ds, ok := r.DirStats[d.rel]
+	if !ok {
+		ds = &DirStat{}
+		r.DirStats[d.rel] = ds
+	}
+	if d.st != nil {
+		// each directory counts once, however often it is recorded
+		if r.countDirs && !ds.HasOwner {
+			r.addOwnerDir(d.st.Uid, d.st.Gid)
+		}
+		ds.UID, ds.GID, ds.HasOwner = d.st.Uid, d.st.Gid, true
+	}
+}
+
+func (r *Result) setIncomplete(mu *sync.Mutex) {
+	mu.Lock()
+	r.Incomplete = true
+	mu.Unlock()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScanDirsOnlyMatchesFileScan(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a.txt"), 100)
+	writeFile(t, filepath.Join(root, "sub", "b.txt"), 200)
+	writeFile(t, filepath.Join(root, "sub", "c.txt"), 50)
+	writeFile(t, filepath.Join(root, "sub", "deep", "d.txt"), 300)
+	writeFile(t, filepath.Join(root, "skip.log"), 7)
+	if err := os.MkdirAll(filepath.Join(root, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := ScanOptions{Concurrency: 3, Filter: PathFilter{NotContains: []string{".log"}}, DirOwners: true}
+	files := Scan(context.Background(), root, opts)
+	opts.DirsOnly = true
+	dirs := Scan(context.Background(), root, opts)
+
+	if dirs.Incomplete {
+		t.Fatalf("unexpected incomplete scan")
+	}
+	if dirs.FilesScanned != files.FilesScanned || dirs.DirsScanned != files.DirsScanned {
+		t.Fatalf("counters: dirs-only files=%d dirs=%d, file scan files=%d dirs=%d",
+			dirs.FilesScanned, dirs.DirsScanned, files.FilesScanned, files.DirsScanned)
+	}
+	if !reflect.DeepEqual(dirs.DirStats, files.DirStats) {
+		t.Fatalf("dir stats differ:\ndirs-only: %v\nfile scan: %v", dirs.DirStats, files.DirStats)
+	}
+	if !reflect.DeepEqual(dirs.UserStats, files.UserStats) || !reflect.DeepEqual(dirs.GroupStats, files.GroupStats) {
+		t.Fatalf("owner stats differ: %v %v vs %v %v", dirs.UserStats, dirs.GroupStats, files.UserStats, files.GroupStats)
+	}
+	if !reflect.DeepEqual(dirs.DirUsers, files.DirUsers) {
+		t.Fatalf("per-directory owners differ: %v vs %v", dirs.DirUsers, files.DirUsers)
+	}
+	if ds := dirs.DirStats["sub"]; ds.Size != 550 || ds.Files != 3 {
+		t.Fatalf("unexpected sub totals: %+v", ds)
+	}
+}
+
+func TestScanDirsOnlyMaxFiles(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 10; i++ {
+		writeFile(t, filepath.Join(root, fmt.Sprintf("d%d", i%3), fmt.Sprintf("f%d", i)), 10)
+	}
+
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, MaxFiles: 4, DirsOnly: true})
+	if !res.Incomplete {
+		t.Fatalf("expected an incomplete scan")
+	}
+	if res.FilesScanned != 4 || res.DirStats["."].Files != 4 {
+		t.Fatalf("expected 4 files, got scanned=%d root=%+v", res.FilesScanned, res.DirStats["."])
+	}
+}
+
+func TestScanDirsOnlyCancelled(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "sub", "a"), 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res := Scan(ctx, root, ScanOptions{Concurrency: 2, DirsOnly: true})
+	if !res.Incomplete || res.FilesScanned != 0 {
+		t.Fatalf("expected an empty incomplete scan, got incomplete=%v files=%d", res.Incomplete, res.FilesScanned)
+	}
+}
+
+// BenchmarkScanDeepNarrow compares the default file channel with -dirs-only
+// on a tree 200 directories deep holding a few files per level.
+func BenchmarkScanDeepNarrow(b *testing.B) {
+	root := b.TempDir()
+	dir := root
+	for depth := 0; depth < 200; depth++ {
+		dir = filepath.Join(dir, "d")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			b.Fatal(err)
+		}
+		for i := 0; i < 5; i++ {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d", i)), make([]byte, 100), 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	for _, bc := range []struct {
+		name     string
+		dirsOnly bool
+	}{{"files", false}, {"dirs-only", true}} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Scan(context.Background(), root, ScanOptions{Concurrency: 4, DirsOnly: bc.dirsOnly})
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// statFilters lists the filters of opts that need a file's stat, which a
+// -dry-run skips: the files they would leave out are still counted.
+func statFilters(opts ScanOptions) []string {
+	var out []string
+	if opts.FileMinSize > 0 || opts.FileMaxSize > 0 {
+		out = append(out, "-file-min-size/-file-max-size")
+	}
+	if !opts.ChangedSince.IsZero() {
+		out = append(out, "-changed-since")
+	}
+	if !opts.ModifiedBefore.IsZero() {
+		out = append(out, "-older-than-file")
+	}
+	return out
+}
+
+// printDryRun writes the -dry-run report: what the walk found, the time it
+// took and cfg, the effective configuration the scan would run with.
+func printDryRun(w io.Writer, res *Result, cfg RunConfig, opts ScanOptions) {
+	_, _ = fmt.Fprintf(w, "Would scan %d directories and %d files (walked in %s)\n",
+		res.DirsScanned, res.FilesScanned, res.EndedAt.Sub(res.StartedAt).Round(time.Millisecond))
+	if res.Incomplete {
+		_, _ = fmt.Fprintln(w, "The walk stopped early (-max-files, -timeout or -deadline); the counts are partial.")
+	}
+	if sf := statFilters(opts); len(sf) > 0 {
+		_, _ = fmt.Fprintf(w, "Not applied without a stat: %s; the scan may count fewer files.\n", strings.Join(sf, ", "))
+	}
+	_, _ = fmt.Fprint(w, cfg)
+}
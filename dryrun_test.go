@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDryRunCountsMatchScan(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "top"), 10)
+	writeFile(t, filepath.Join(root, "a", "x"), 10)
+	writeFile(t, filepath.Join(root, "a", "b", "y"), 10)
+	writeFile(t, filepath.Join(root, "a", "b", "skipme"), 10)
+	writeFile(t, filepath.Join(root, "mnt", "z"), 10)
+	writeFile(t, filepath.Join(root, "empty", "deeper", "w"), 10)
+
+	for _, tc := range []struct {
+		name string
+		opts ScanOptions
+	}{
+		{"plain", ScanOptions{}},
+		{"filtered", ScanOptions{
+			Filter:        PathFilter{NotContains: []string{"skip"}},
+			SkipRootFiles: true,
+			SkipDirs:      map[string]bool{filepath.Join(root, "mnt"): true},
+		}},
+		{"dirs-only", ScanOptions{DirsOnly: true}},
+	} {
+		tc.opts.Concurrency = 2
+		full := Scan(context.Background(), root, tc.opts)
+		dry := tc.opts
+		dry.DryRun = true
+		got := Scan(context.Background(), root, dry)
+		if got.DirsScanned != full.DirsScanned || got.FilesScanned != full.FilesScanned {
+			t.Errorf("%s: dry run counted %d dirs / %d files, the scan %d / %d", tc.name, got.DirsScanned, got.FilesScanned, full.DirsScanned, full.FilesScanned)
+		}
+		// nothing is aggregated
+		if len(got.DirStats) != 0 || len(got.UserStats) != 0 {
+			t.Errorf("%s: dry run aggregated %d dirs, %d users", tc.name, len(got.DirStats), len(got.UserStats))
+		}
+	}
+}
+
+func TestPrintDryRunNotesStatFilters(t *testing.T) {
+	res := &Result{DirsScanned: 3, FilesScanned: 7}
+	opts := ScanOptions{FileMinSize: 100}
+	var out bytes.Buffer
+	printDryRun(&out, res, newRunConfig("/data", opts, FormatOptions{}, nil), opts)
+	for _, want := range []string{"Would scan 3 directories and 7 files", "Not applied without a stat: -file-min-size/-file-max-size", "root:        /data"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report lacks %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// defaultHash is the -hash algorithm used when none is given.
+const defaultHash = "xxhash"
+
+// hashAlgorithms maps -hash names to constructors of the content hash used by
+// -dupes: xxhash is fast, sha256 collision-safe, md5 matches existing manifests.
+var hashAlgorithms = map[string]func() hash.Hash{
+	"xxhash": func() hash.Hash { return xxhash.New() },
+	"sha256": sha256.New,
+	"md5":    md5.New,
+}
+
+// hashNames lists the available -hash values in sorted order.
+func hashNames() []string {
+	names := make([]string, 0, len(hashAlgorithms))
+	for n := range hashAlgorithms {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupHash returns the constructor for a -hash value.
+func lookupHash(name string) (func() hash.Hash, error) {
+	h, ok := hashAlgorithms[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown hash %q (available: %s)", name, strings.Join(hashNames(), ", "))
+	}
+	return h, nil
+}
+
+// hashFile returns the hex digest of the file at path.
+func hashFile(path string, newHash func() hash.Hash) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	h := newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// DupGroup is a set of files with identical content; Paths are relative to
+// the root and sorted.
+type DupGroup struct {
+	Size  int64
+	Hash  string
+	Paths []string
+}
+
+// Wasted is the space the copies beyond the first take up.
+func (g DupGroup) Wasted() int64 { return g.Size * int64(len(g.Paths)-1) }
+
+// Duplicates is the outcome of -dupes: the groups found with Algorithm.
+type Duplicates struct {
+	Algorithm string
+	Groups    []DupGroup
+}
+
+// dupCandidates collects the files a scan saw, by size, for -dupes. Paths
+// reaching an already collected inode (hard links) are not copies and are
+// left out. Callers must hold the mutex guarding the scan's maps.
+type dupCandidates struct {
+	bySize map[int64][]string
+	seen   map[devIno]struct{}
+}
+
+func newDupCandidates() *dupCandidates {
+	return &dupCandidates{bySize: make(map[int64][]string), seen: make(map[devIno]struct{})}
+}
+
+func (c *dupCandidates) add(rel string, size int64, id devIno) {
+	if size == 0 {
+		return
+	}
+	if id != (devIno{}) {
+		if _, ok := c.seen[id]; ok {
+			return
+		}
+		c.seen[id] = struct{}{}
+	}
+	c.bySize[size] = append(c.bySize[size], rel)
+}
+
+// findDuplicates hashes the files of every size shared by more than one file
+// and returns the groups of identical content, most wasted space first (ties
+// by hash). Files that cannot be read are skipped.
+func findDuplicates(root string, c *dupCandidates, algorithm string, newHash func() hash.Hash) *Duplicates {
+	d := &Duplicates{Algorithm: algorithm, Groups: []DupGroup{}}
+	for size, paths := range c.bySize {
+		if len(paths) < 2 {
+			continue
+		}
+		byHash := make(map[string][]string)
+		for _, rel := range paths {
+			sum, err := hashFile(filepath.Join(root, rel), newHash)
+			if err != nil {
+				continue
+			}
+			byHash[sum] = append(byHash[sum], rel)
+		}
+		for sum, same := range byHash {
+			if len(same) < 2 {
+				continue
+			}
+			sort.Strings(same)
+			d.Groups = append(d.Groups, DupGroup{Size: size, Hash: sum, Paths: same})
+		}
+	}
+	sort.Slice(d.Groups, func(i, j int) bool {
+		wi, wj := d.Groups[i].Wasted(), d.Groups[j].Wasted()
+		if wi == wj {
+			return d.Groups[i].Hash < d.Groups[j].Hash
+		}
+		return wi > wj
+	})
+	return d
+}
+
+// printDuplicates writes the duplicate groups below the tree.
+func printDuplicates(w io.Writer, d *Duplicates, fo FormatOptions) {
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintf(w, "Duplicate files (%s):\n", d.Algorithm)
+	if len(d.Groups) == 0 {
+		_, _ = fmt.Fprintln(w, "  none")
+		return
+	}
+	for _, g := range d.Groups {
+		_, _ = fmt.Fprintf(w, "%s x %d (%s wasted)\n", fo.size(g.Size), len(g.Paths), fo.size(g.Wasted()))
+		for _, p := range g.Paths {
+			_, _ = fmt.Fprintf(w, "  %s\n", fo.path(p))
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeContent creates path (and its parents) holding data.
+func writeContent(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestDupesUnderEachHash(t *testing.T) {
+	root := t.TempDir()
+	writeContent(t, filepath.Join(root, "a", "x"), "hello world")
+	writeContent(t, filepath.Join(root, "b", "y"), "hello world")
+	writeContent(t, filepath.Join(root, "b", "z"), "hello earth") // same size, other content
+	writeContent(t, filepath.Join(root, "c"), "another file")
+	writeContent(t, filepath.Join(root, "d", "c-copy"), "another file")
+	writeContent(t, filepath.Join(root, "empty1"), "")
+	writeContent(t, filepath.Join(root, "empty2"), "")
+	if err := os.Link(filepath.Join(root, "c"), filepath.Join(root, "c-link")); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+
+	// "another file" (12 bytes) wastes more than "hello world" (11 bytes); the
+	// empty files are not reported, and c and c-link are one inode, so whichever
+	// the scan reaches first stands for it
+	want := [][]string{{"c", "d/c-copy"}, {"a/x", "b/y"}}
+	wantLink := [][]string{{"c-link", "d/c-copy"}, {"a/x", "b/y"}}
+	for _, algo := range hashNames() {
+		res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, DupesHash: algo})
+		d := res.Duplicates
+		if d == nil || d.Algorithm != algo {
+			t.Fatalf("%s: duplicates = %+v", algo, d)
+		}
+		var got [][]string
+		for _, g := range d.Groups {
+			got = append(got, g.Paths)
+		}
+		if !reflect.DeepEqual(got, want) && !reflect.DeepEqual(got, wantLink) {
+			t.Fatalf("%s: groups = %v, want %v", algo, got, want)
+		}
+	}
+}
+
+func TestDupesHashMatchesAlgorithm(t *testing.T) {
+	root := t.TempDir()
+	writeContent(t, filepath.Join(root, "a"), "same")
+	writeContent(t, filepath.Join(root, "b"), "same")
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 1, DupesHash: "md5"})
+	sum := md5.Sum([]byte("same"))
+	if g := res.Duplicates.Groups; len(g) != 1 || g[0].Hash != hex.EncodeToString(sum[:]) || g[0].Size != 4 {
+		t.Fatalf("groups = %+v, want the md5 of the content", g)
+	}
+
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+		t.Fatalf("unmarshal: %v\n%s", err, buf.String())
+	}
+	if jo.Duplicates == nil || jo.Duplicates.Algorithm != "md5" || len(jo.Duplicates.Groups) != 1 {
+		t.Fatalf("json duplicates = %+v", jo.Duplicates)
+	}
+	marshalled, err := marshalSummary(jo)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !bytes.Equal(append(marshalled, '\n'), buf.Bytes()) {
+		t.Fatalf("streamed output differs from MarshalIndent:\n%s\nvs\n%s", buf.String(), marshalled)
+	}
+
+	var out bytes.Buffer
+	printDuplicates(&out, resultFromSummary(jo).Duplicates, FormatOptions{Bytes: true})
+	if !strings.Contains(out.String(), "Duplicate files (md5):") || !strings.Contains(out.String(), "4 x 2 (4 wasted)") {
+		t.Fatalf("unexpected listing:\n%s", out.String())
+	}
+}
+
+func TestLookupHash(t *testing.T) {
+	if _, err := lookupHash("crc32"); err == nil || !strings.Contains(err.Error(), "xxhash") {
+		t.Fatalf("expected an error listing the algorithms, got %v", err)
+	}
+	for _, name := range []string{"xxhash", "sha256", "md5"} {
+		if _, err := lookupHash(name); err != nil {
+			t.Fatalf("lookupHash(%q): %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Display encodings for -encoding.
+const (
+	encodingUTF8  = "utf-8"
+	encodingASCII = "ascii"
+)
+
+// parseEncoding validates an -encoding value and reports whether it selects
+// ASCII-only output.
+func parseEncoding(s string) (ascii bool, err error) {
+	switch strings.ToLower(s) {
+	case encodingUTF8, "utf8":
+		return false, nil
+	case encodingASCII:
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown encoding %q (want %s or %s)", s, encodingUTF8, encodingASCII)
+}
+
+// escapeNonASCII makes s printable on a 7-bit terminal: every byte outside
+// printable ASCII becomes \xNN (so a UTF-8 "é" shows as \xc3\xa9) and a
+// backslash is doubled, keeping the form unambiguous and pasteable into a
+// shell's $'...' quoting.
+func escapeNonASCII(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= 0x20 && s[i] < 0x7f && s[i] != '\\' {
+		i++
+	}
+	if i == len(s) {
+		return s
+	}
+	var b strings.Builder
+	b.WriteString(s[:i])
+	for ; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			b.WriteString(`\\`)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestEscapeNonASCII(t *testing.T) {
+	for in, want := range map[string]string{
+		"plain/name.txt": "plain/name.txt",
+		"café":           `caf\xc3\xa9`,
+		"bad\xffbyte":    `bad\xffbyte`,
+		`back\slash`:     `back\\slash`,
+		"tab\there":      `tab\x09here`,
+	} {
+		if got := escapeNonASCII(in); got != want {
+			t.Errorf("escapeNonASCII(%q) = %q, want %q", in, got, want)
+		}
+	}
+	for _, s := range []string{"utf-8", "UTF8", "ascii"} {
+		if _, err := parseEncoding(s); err != nil {
+			t.Errorf("parseEncoding(%q): %v", s, err)
+		}
+	}
+	if _, err := parseEncoding("latin1"); err == nil {
+		t.Error("parseEncoding should reject unknown encodings")
+	}
+}
+
+func TestASCIIEncodingTreeAndJSON(t *testing.T) {
+	root := t.TempDir()
+	const name = "café"
+	if err := os.Mkdir(filepath.Join(root, name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, name, "f"), 10)
+	writeFile(t, filepath.Join(root, "plain", "f"), 5)
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 1})
+
+	var out bytes.Buffer
+	printTree(&out, res, TreeOptions{Levels: 1, Format: FormatOptions{Bytes: true, ASCII: true}})
+	tree := out.String()
+	if !strings.Contains(tree, "|-- caf\\xc3\\xa9") || !strings.Contains(tree, "`-- plain") {
+		t.Fatalf("tree lacks the escaped name or ASCII connectors:\n%s", tree)
+	}
+	for i := 0; i < len(tree); i++ {
+		if tree[i] >= 0x80 {
+			t.Fatalf("non-ASCII byte %#x in ascii output:\n%s", tree[i], tree)
+		}
+	}
+
+	// JSON keeps the real UTF-8 name regardless of the display encoding
+	out.Reset()
+	if err := (JSONFormatter{}).Write(&out, res); err != nil {
+		t.Fatal(err)
+	}
+	if !utf8.Valid(out.Bytes()) {
+		t.Fatal("JSON output is not valid UTF-8")
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(out.Bytes(), &jo); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, d := range jo.Dirs {
+		found = found || d.Rel == name
+	}
+	if !found {
+		t.Fatalf("JSON dirs lack %q: %+v", name, jo.Dirs)
+	}
+}
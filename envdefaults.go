@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+)
+
+// envDefaults are the environment variables that preset flags, for
+// deployments (containers, CI) where passing the same flags every time is
+// awkward. Each maps its value to the flags it sets.
+var envDefaults = []struct {
+	name  string
+	flags func(v string) (map[string]string, error)
+}{
+	// DISKUSAGE_JSON_COMPACT=1 writes one compact entry per line, like
+	// -json-indent-arrays=false
+	{"DISKUSAGE_JSON_COMPACT", func(v string) (map[string]string, error) {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("want a boolean")
+		}
+		return map[string]string{"json-indent-arrays": strconv.FormatBool(!b)}, nil
+	}},
+	{"DISKUSAGE_COLOR", func(v string) (map[string]string, error) {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("want a boolean")
+		}
+		return map[string]string{"color": strconv.FormatBool(b)}, nil
+	}},
+	{"DISKUSAGE_UNITS", func(v string) (map[string]string, error) {
+		switch v {
+		case "human":
+			return map[string]string{}, nil
+		case "bytes":
+			return map[string]string{"bytes": "true"}, nil
+		case "bits":
+			return map[string]string{"bits": "true"}, nil
+		case "fixed":
+			return map[string]string{"fixed-unit": "true"}, nil
+		}
+		return nil, fmt.Errorf("want human, bytes, bits or fixed")
+	}},
+}
+
+// applyEnvDefaults presets the flags of fs from the envDefaults found by
+// lookup, before fs is parsed, so flags given on the command line still
+// override them. The values are set as if they were the defaults: the flags
+// do not count as set.
+func applyEnvDefaults(fs *flag.FlagSet, lookup func(string) (string, bool)) error {
+	for _, e := range envDefaults {
+		v, ok := lookup(e.name)
+		if !ok || v == "" {
+			continue
+		}
+		flags, err := e.flags(v)
+		if err != nil {
+			return fmt.Errorf("$%s=%q: %v", e.name, v, err)
+		}
+		for name, val := range flags {
+			f := fs.Lookup(name)
+			if f == nil {
+				return fmt.Errorf("$%s: no flag -%s", e.name, name)
+			}
+			if err := f.Value.Set(val); err != nil {
+				return fmt.Errorf("$%s: -%s: %v", e.name, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// unitFlags are the flags choosing how sizes are printed. They make up one
+// choice: DISKUSAGE_UNITS presets one of them and any given on the command
+// line replaces it.
+var unitFlags = []string{"bytes", "bits", "fixed-unit"}
+
+// resetEnvUnits runs once fs is parsed: when one of the unitFlags was given on
+// the command line, the others are reset to their defaults, so -bytes is not
+// left combined with the -bits DISKUSAGE_UNITS=bits preset.
+func resetEnvUnits(fs *flag.FlagSet) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	explicit := false
+	for _, name := range unitFlags {
+		explicit = explicit || given[name]
+	}
+	if !explicit {
+		return nil
+	}
+	for _, name := range unitFlags {
+		f := fs.Lookup(name)
+		if f == nil || given[name] {
+			continue
+		}
+		if err := f.Value.Set(f.DefValue); err != nil {
+			return fmt.Errorf("-%s: %v", name, err)
+		}
+	}
+	return nil
+}
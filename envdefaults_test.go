@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// envFlagSet defines the flags envDefaults preset, with main's defaults.
+func envFlagSet() (*flag.FlagSet, map[string]*bool) {
+	fs := flag.NewFlagSet("diskusage", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	vals := map[string]*bool{
+		"json-indent-arrays": fs.Bool("json-indent-arrays", true, ""),
+		"color":              fs.Bool("color", false, ""),
+		"bytes":              fs.Bool("bytes", false, ""),
+		"bits":               fs.Bool("bits", false, ""),
+		"fixed-unit":         fs.Bool("fixed-unit", false, ""),
+	}
+	return fs, vals
+}
+
+func TestEnvCompactJSONAndFlagOverride(t *testing.T) {
+	t.Setenv("DISKUSAGE_JSON_COMPACT", "1")
+	res := &Result{
+		Root:       "/data",
+		DirStats:   map[string]*DirStat{".": {Size: 10, Files: 1}},
+		UserStats:  map[string]*UserStat{"1": {Size: 10, Files: 1, UID: 1, Name: "u"}},
+		GroupStats: map[string]*GroupStat{"1": {Size: 10, Files: 1, GID: 1, Name: "g"}},
+	}
+	for _, c := range []struct {
+		args    []string
+		compact bool
+	}{
+		{nil, true},
+		{[]string{"-json-indent-arrays=true"}, false},
+	} {
+		fs, vals := envFlagSet()
+		if err := applyEnvDefaults(fs, os.LookupEnv); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Parse(c.args); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := StreamSummary(&buf, res, SummaryOptions{CompactArrays: !*vals["json-indent-arrays"], Numeric: true}); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(buf.String(), `    {"path":"/data","rel":".","size":10,"files":1`); got != c.compact {
+			t.Fatalf("args %v: compact = %v; want %v\n%s", c.args, got, c.compact, buf.String())
+		}
+		// an env default does not count as a flag given
+		n := 0
+		fs.Visit(func(*flag.Flag) { n++ })
+		if n != len(c.args) {
+			t.Fatalf("args %v: %d flags set", c.args, n)
+		}
+	}
+}
+
+func TestEnvDefaultsColorAndUnits(t *testing.T) {
+	env := map[string]string{"DISKUSAGE_COLOR": "true", "DISKUSAGE_UNITS": "fixed"}
+	lookup := func(k string) (string, bool) { v, ok := env[k]; return v, ok }
+	fs, vals := envFlagSet()
+	if err := applyEnvDefaults(fs, lookup); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Parse([]string{"-color=false", "-bytes"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := resetEnvUnits(fs); err != nil {
+		t.Fatal(err)
+	}
+	// -bytes replaces the preset unit rather than adding to it
+	if *vals["color"] || *vals["fixed-unit"] || !*vals["bytes"] || !*vals["json-indent-arrays"] {
+		t.Fatalf("flags = color %v, fixed-unit %v, bytes %v, json-indent-arrays %v", *vals["color"], *vals["fixed-unit"], *vals["bytes"], *vals["json-indent-arrays"])
+	}
+
+	env["DISKUSAGE_UNITS"] = "kilo"
+	fs, _ = envFlagSet()
+	if err := applyEnvDefaults(fs, lookup); err == nil || !strings.Contains(err.Error(), "$DISKUSAGE_UNITS") {
+		t.Fatalf("err = %v; want the bad variable named", err)
+	}
+}
+
+func TestEnvUnitsOverriddenByFlag(t *testing.T) {
+	lookup := func(k string) (string, bool) {
+		if k == "DISKUSAGE_UNITS" {
+			return "bits", true
+		}
+		return "", false
+	}
+	for _, c := range []struct {
+		args               []string
+		bytes, bits, fixed bool
+	}{
+		{nil, false, true, false},
+		{[]string{"-bytes"}, true, false, false},
+		{[]string{"-fixed-unit"}, false, false, true},
+		{[]string{"-bits", "-fixed-unit"}, false, true, true},
+		{[]string{"-color"}, false, true, false},
+	} {
+		fs, vals := envFlagSet()
+		if err := applyEnvDefaults(fs, lookup); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Parse(c.args); err != nil {
+			t.Fatal(err)
+		}
+		if err := resetEnvUnits(fs); err != nil {
+			t.Fatal(err)
+		}
+		if *vals["bytes"] != c.bytes || *vals["bits"] != c.bits || *vals["fixed-unit"] != c.fixed {
+			t.Fatalf("args %v: bytes %v, bits %v, fixed-unit %v; want %v, %v, %v", c.args,
+				*vals["bytes"], *vals["bits"], *vals["fixed-unit"], c.bytes, c.bits, c.fixed)
+		}
+	}
+}
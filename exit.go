@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+var (
+	atExitMu sync.Mutex
+	atExit   []func()
+)
+
+// exit ends the process; tests replace it to observe a fatal path.
+var exit = os.Exit
+
+// onExit registers fn to run before main exits, through exitWith and fatalf
+// as well as at its normal end, e.g. to remove the on-disk spill of a
+// -max-memory scan, which can be large, when an output cannot be written.
+func onExit(fn func()) {
+	atExitMu.Lock()
+	defer atExitMu.Unlock()
+	atExit = append(atExit, fn)
+}
+
+// runAtExit runs the functions registered with onExit, the last registered
+// first, and forgets them, so running it twice is harmless.
+func runAtExit() {
+	atExitMu.Lock()
+	fns := atExit
+	atExit = nil
+	atExitMu.Unlock()
+	for i := len(fns) - 1; i >= 0; i-- {
+		fns[i]()
+	}
+}
+
+// exitWith is os.Exit after runAtExit.
+func exitWith(code int) {
+	runAtExit()
+	exit(code)
+}
+
+// fatalf is log.Fatalf after runAtExit.
+func fatalf(format string, args ...any) {
+	log.Printf(format, args...)
+	exitWith(1)
+}
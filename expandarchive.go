@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// expandSuffixes are the file names -expand-archives reads as archives.
+var expandSuffixes = []string{".tar", ".tar.gz", ".tgz", ".zip"}
+
+// isExpandable reports whether -expand-archives reads the file name as an
+// archive.
+func isExpandable(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range expandSuffixes {
+		if strings.HasSuffix(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveTotals holds what -expand-archives attributes to one archive: the
+// bytes and files directly in each directory inside it, keyed by its
+// slash-separated path ("." for the archive's top level), and the sums.
+// Only the directories are kept, not the entries, so an archive of many
+// files costs no more memory than its directory structure.
+type archiveTotals struct {
+	dirs        map[string]*DirStat
+	size, files int64
+}
+
+// readArchiveTotals reads the archive at p and totals its entries per
+// directory.
+func readArchiveTotals(p string) (*archiveTotals, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	t := &archiveTotals{dirs: map[string]*DirStat{".": {}}}
+	dir := func(rel string) *DirStat {
+		ds := t.dirs[rel]
+		if ds == nil {
+			ds = &DirStat{}
+			t.dirs[rel] = ds
+		}
+		return ds
+	}
+	err = readArchive(f, func(e archiveEntry) error {
+		if e.Dir {
+			dir(e.Name)
+			return nil
+		}
+		ds := dir(path.Dir(e.Name))
+		ds.Size += e.Size
+		ds.Files++
+		t.size += e.Size
+		t.files++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// addArchiveTotals adds the entries of an archive in place of the archive
+// file: rel, the archive's path below the root, becomes a directory holding
+// them. All of it is attributed to uid and gid, the owner of the archive
+// file, who also owns the synthetic directories, so exporting them needs no
+// stat of paths that do not exist. Callers must hold the mutex guarding the
+// maps.
+func (r *Result) addArchiveTotals(rel string, t *archiveTotals, uid, gid uint32) {
+	for inner, ds := range t.dirs {
+		d := filepath.Join(rel, filepath.FromSlash(inner))
+		r.addDirTotals(d, ds.Size, ds.Files)
+		if ds.Files > 0 {
+			r.addOwnerTotals(d, ds.Size, ds.Files, uid, gid)
+		}
+		for p := d; ; p = filepath.Dir(p) {
+			own := r.DirStats[p]
+			if own.HasOwner {
+				break
+			}
+			own.UID, own.GID, own.HasOwner = uid, gid, true
+			if p == rel {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestScanExpandArchives(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "docs", "readme"), 5)
+	tarball, err := os.ReadFile(writeTestTar(t, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "backups"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "backups", "test.tar.gz"), tarball, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// not an archive after all: counted as the file it is
+	writeFile(t, filepath.Join(root, "backups", "broken.zip"), 50)
+
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, ExpandArchives: true})
+	arc := filepath.Join("backups", "test.tar.gz")
+	for rel, want := range map[string]DirStat{
+		".":                               {Size: 1055, Files: 4},
+		"backups":                         {Size: 1050, Files: 3},
+		arc:                               {Size: 1000, Files: 2},
+		filepath.Join(arc, "proj"):        {Size: 1000, Files: 2},
+		filepath.Join(arc, "proj", "src"): {Size: 300, Files: 1},
+		filepath.Join(arc, "empty"):       {},
+	} {
+		ds := res.DirStats[rel]
+		if ds == nil || ds.Size != want.Size || ds.Files != want.Files {
+			t.Fatalf("dir %q = %+v; want %+v", rel, ds, want)
+		}
+		if !ds.HasOwner {
+			t.Fatalf("dir %q has no owner recorded", rel)
+		}
+	}
+	if res.FilesScanned != 4 {
+		t.Fatalf("FilesScanned = %d; want 4", res.FilesScanned)
+	}
+	// the archive's entries belong to whoever owns the archive
+	uid := strconv.Itoa(os.Getuid())
+	if us := res.UserStats[uid]; us == nil || us.Size != 1055 || len(res.UserStats) != 1 {
+		t.Fatalf("user stats = %v; want all 1055 bytes for uid %s", res.UserStats, uid)
+	}
+
+	var tree bytes.Buffer
+	printTree(&tree, res, TreeOptions{Levels: 5, Format: FormatOptions{Bytes: true}})
+	for _, row := range []string{"1000 ", "test.tar.gz\n", "300 ", "src\n"} {
+		if !strings.Contains(tree.String(), row) {
+			t.Fatalf("tree lacks %q:\n%s", row, tree.String())
+		}
+	}
+
+	// the synthetic directories export without a stat of their paths
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{Strict: true}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+
+	plain := Scan(context.Background(), root, ScanOptions{Concurrency: 2})
+	if _, ok := plain.DirStats[arc]; ok || plain.FilesScanned != 3 || plain.DirStats["."].Size != int64(len(tarball))+55 {
+		t.Fatalf("without -expand-archives: %d files, %d bytes", plain.FilesScanned, plain.DirStats["."].Size)
+	}
+}
+
+func TestIsExpandable(t *testing.T) {
+	for name, want := range map[string]bool{
+		"a.tar": true, "a.tar.gz": true, "A.TGZ": true, "a.zip": true,
+		"a.gz": false, "a.tar.bz2": false, "tar": false,
+	} {
+		if got := isExpandable(name); got != want {
+			t.Errorf("isExpandable(%q) = %v; want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// noExtKey is the -ext-by-user row of the files without an extension.
+const noExtKey = "(none)"
+
+// ExtUserStat is one cell of the -ext-by-user cross-tab: the bytes and files
+// of one extension owned by one user.
+type ExtUserStat struct {
+	Size  int64 `json:"size"`
+	Files int64 `json:"files"`
+}
+
+// fileExt returns the lower-cased extension of a file name, ".mp4", or
+// noExtKey. A leading dot alone (".bashrc") does not make an extension.
+func fileExt(name string) string {
+	ext := filepath.Ext(name)
+	if ext == "" || ext == name || ext == "." {
+		return noExtKey
+	}
+	return strings.ToLower(ext)
+}
+
+// extUserTally collects the -ext-by-user cross-tab during a scan, keyed by
+// extension and uid; names are only attached once the scan is done.
+// Callers must hold the scan's mutex.
+type extUserTally map[string]map[uint32]*ExtUserStat
+
+func (t extUserTally) add(name string, uid uint32, size int64) {
+	ext := fileExt(name)
+	byUID := t[ext]
+	if byUID == nil {
+		byUID = make(map[uint32]*ExtUserStat)
+		t[ext] = byUID
+	}
+	c := byUID[uid]
+	if c == nil {
+		c = &ExtUserStat{}
+		byUID[uid] = c
+	}
+	c.Size += size
+	c.Files++
+}
+
+// byName returns the tally keyed by extension and user name, naming each uid
+// as r's per-user summary does; uids sharing a name are summed.
+func (t extUserTally) byName(r *Result) map[string]map[string]*ExtUserStat {
+	names := make(map[uint32]string)
+	nameOf := func(uid uint32) string {
+		if n, ok := names[uid]; ok {
+			return n
+		}
+		id := strconv.FormatUint(uint64(uid), 10)
+		n := ""
+		if us := r.UserStats[id]; us != nil {
+			n = us.Name
+		} else if r.userMap != nil {
+			n = r.userMap.owner(uid).name
+		}
+		if n == "" {
+			n = displayName(lookupUserName(uid), id)
+		}
+		names[uid] = n
+		return n
+	}
+	out := make(map[string]map[string]*ExtUserStat, len(t))
+	for ext, byUID := range t {
+		byUser := make(map[string]*ExtUserStat, len(byUID))
+		for uid, c := range byUID {
+			n := nameOf(uid)
+			cur := byUser[n]
+			if cur == nil {
+				cur = &ExtUserStat{}
+				byUser[n] = cur
+			}
+			cur.Size += c.Size
+			cur.Files += c.Files
+		}
+		out[ext] = byUser
+	}
+	return out
+}
+
+// rankedKeys returns the keys of totals by descending size (then key),
+// cut to the first n when n > 0.
+func rankedKeys(totals map[string]int64, n int) []string {
+	keys := make([]string, 0, len(totals))
+	for k := range totals {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if totals[keys[i]] != totals[keys[j]] {
+			return totals[keys[i]] > totals[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if n > 0 && len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// printExtByUser writes the -ext-by-user cross-tab below the tree: the
+// largest extensions as rows and the users owning the most of them as
+// columns, top of each (0 = all), with every row's total over all users.
+func printExtByUser(w io.Writer, tab map[string]map[string]*ExtUserStat, top int, fo FormatOptions) {
+	extTotals := make(map[string]int64, len(tab))
+	userTotals := make(map[string]int64)
+	for ext, byUser := range tab {
+		for u, c := range byUser {
+			extTotals[ext] += c.Size
+			userTotals[u] += c.Size
+		}
+	}
+	exts, users := rankedKeys(extTotals, top), rankedKeys(userTotals, top)
+
+	header := append(append([]string{"Extension"}, users...), "Total")
+	rows := [][]string{header}
+	for _, ext := range exts {
+		row := []string{fo.path(ext)}
+		for _, u := range users {
+			cell := "-"
+			if c := tab[ext][u]; c != nil {
+				cell = fo.size(c.Size)
+			}
+			row = append(row, cell)
+		}
+		rows = append(rows, append(row, fo.size(extTotals[ext])))
+	}
+	widths := make([]int, len(header))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, "Extensions by user:")
+	for _, row := range rows {
+		line := fmt.Sprintf("%-*s", widths[0], row[0])
+		for i, cell := range row[1:] {
+			line += fmt.Sprintf(" %*s", widths[i+1], cell)
+		}
+		_, _ = fmt.Fprintln(w, line)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFileExt(t *testing.T) {
+	for name, want := range map[string]string{
+		"movie.MP4":   ".mp4",
+		"a.tar.gz":    ".gz",
+		"Makefile":    noExtKey,
+		".bashrc":     noExtKey,
+		"trailing.":   noExtKey,
+		".config.yml": ".yml",
+	} {
+		if got := fileExt(name); got != want {
+			t.Errorf("fileExt(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestExtByUserCrossTab(t *testing.T) {
+	stubOwnerNames(t, map[uint32]string{1001: "alice", 1002: "bob"}, nil)
+	res := newResult("/r", ScanOptions{})
+	tally := make(extUserTally)
+	for _, f := range []struct {
+		name string
+		uid  uint32
+		size int64
+	}{
+		{"a.mp4", 1001, 3000},
+		{"b.MP4", 1001, 1000},
+		{"c.txt", 1002, 20},
+		{"d.txt", 1002, 10},
+		{"e.mp4", 1002, 500},
+		{"README", 1001, 1},
+	} {
+		res.addFile(".", f.size, f.uid, 0)
+		tally.add(f.name, f.uid, f.size)
+	}
+	res.ExtByUser = tally.byName(res)
+
+	cells := map[[2]string]ExtUserStat{
+		{".mp4", "alice"}:   {Size: 4000, Files: 2},
+		{".mp4", "bob"}:     {Size: 500, Files: 1},
+		{".txt", "bob"}:     {Size: 30, Files: 2},
+		{noExtKey, "alice"}: {Size: 1, Files: 1},
+	}
+	n := 0
+	for ext, byUser := range res.ExtByUser {
+		for u, c := range byUser {
+			n++
+			if want, ok := cells[[2]string{ext, u}]; !ok || *c != want {
+				t.Errorf("cell (%s, %s) = %+v, want %+v", ext, u, *c, want)
+			}
+		}
+	}
+	if n != len(cells) {
+		t.Fatalf("cross-tab has %d cells, want %d: %v", n, len(cells), res.ExtByUser)
+	}
+
+	var out bytes.Buffer
+	printExtByUser(&out, res.ExtByUser, 2, FormatOptions{Bytes: true})
+	want := "\nExtensions by user:\n" +
+		"Extension alice bob Total\n" +
+		".mp4       4000 500  4500\n" +
+		".txt          -  30    30\n"
+	if out.String() != want {
+		t.Fatalf("cross-tab:\n%q\nwant:\n%q", out.String(), want)
+	}
+
+	// JSON nests extension, then user, and reads back
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if c := jo.ExtByUser[".mp4"]["bob"]; c == nil || c.Size != 500 || c.Files != 1 {
+		t.Fatalf("json ext_by_user = %v", jo.ExtByUser)
+	}
+	if !strings.Contains(buf.String(), `"ext_by_user": {`) {
+		t.Fatalf("ext_by_user not written as an object:\n%s", buf.String())
+	}
+	if back := resultFromSummary(jo); back.ExtByUser["(none)"]["alice"].Size != 1 {
+		t.Fatalf("read back: %v", back.ExtByUser)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import "fmt"
+
+// Exit codes of -fail-over: the total exceeded -fail-over, or, when
+// -warn-over is given as well, only -warn-over. 1 stays the code of errors.
+const (
+	exitWarnOver = 2
+	exitFailOver = 3
+)
+
+// totalAlarm checks the root's total size against -fail-over and -warn-over
+// (0 = off) and returns the exit code and message it calls for; code 0 when
+// the total is within both limits. -warn-over alone never changes the exit
+// code, only alongside -fail-over.
+func totalAlarm(res *Result, failOver, warnOver int64, fo FormatOptions) (code int, msg string) {
+	if failOver <= 0 {
+		return 0, ""
+	}
+	var total int64
+	if ds := res.DirStats["."]; ds != nil {
+		total = ds.Size
+	}
+	switch {
+	case total > failOver:
+		return exitFailOver, fmt.Sprintf("total %s of %s exceeds -fail-over %s", fo.size(total), res.Root, fo.size(failOver))
+	case warnOver > 0 && total > warnOver:
+		return exitWarnOver, fmt.Sprintf("total %s of %s exceeds -warn-over %s", fo.size(total), res.Root, fo.size(warnOver))
+	}
+	return 0, ""
+}
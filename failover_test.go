@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTotalAlarmExitCodes(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a"), 600)
+	writeFile(t, filepath.Join(root, "sub", "b"), 400)
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2})
+	fo := FormatOptions{Bytes: true}
+
+	cases := []struct {
+		name               string
+		failOver, warnOver int64
+		want               int
+		msg                string
+	}{
+		{"under", 2000, 0, 0, ""},
+		{"at the limit", 1000, 0, 0, ""},
+		{"over", 999, 0, exitFailOver, "exceeds -fail-over 999"},
+		{"over both", 999, 500, exitFailOver, "exceeds -fail-over"},
+		{"over warn only", 2000, 500, exitWarnOver, "exceeds -warn-over 500"},
+		{"under both", 2000, 1500, 0, ""},
+		{"warn without fail", 0, 500, 0, ""},
+	}
+	for _, c := range cases {
+		code, msg := totalAlarm(res, c.failOver, c.warnOver, fo)
+		if code != c.want {
+			t.Errorf("%s: code = %d; want %d", c.name, code, c.want)
+		}
+		if c.msg == "" && msg != "" || !strings.Contains(msg, c.msg) {
+			t.Errorf("%s: msg = %q; want it to contain %q", c.name, msg, c.msg)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+// JsonDirFile is one file directly inside a directory, as -json-files
+// records it in the directory's file_list.
+type JsonDirFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// sortFileList orders a directory's file list by name, so summaries of the
+// same tree come out the same whatever order the workers finished in.
+func sortFileList(files []JsonDirFile) {
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+}
+
+// fileGrowth is one file of the -report-largest-growth listing; Path is
+// relative to the root.
+type fileGrowth struct {
+	Path     string
+	Old, New int64
+	Added    bool
+}
+
+// largestGrowth returns the files of cur that are bigger than in old or not
+// in old at all, by descending growth (then path), cut to the first n when
+// n > 0. Both results need the per-file lists of -json-files.
+func largestGrowth(old, cur *Result, n int) ([]fileGrowth, error) {
+	for _, s := range []struct {
+		name string
+		r    *Result
+	}{{"old", old}, {"new", cur}} {
+		if s.r.DirFiles == nil {
+			return nil, fmt.Errorf("the %s summary has no per-file data (write it with -json-files)", s.name)
+		}
+	}
+	var out []fileGrowth
+	for rel, files := range cur.DirFiles {
+		before := make(map[string]int64, len(old.DirFiles[rel]))
+		for _, f := range old.DirFiles[rel] {
+			before[f.Name] = f.Size
+		}
+		for _, f := range files {
+			g := fileGrowth{Path: filepath.Join(rel, f.Name), New: f.Size}
+			size, ok := before[f.Name]
+			g.Old, g.Added = size, !ok
+			if g.Added || g.New > g.Old {
+				out = append(out, g)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		di, dj := out[i].New-out[i].Old, out[j].New-out[j].Old
+		if di != dj {
+			return di > dj
+		}
+		return out[i].Path < out[j].Path
+	})
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+	return out, nil
+}
+
+// printLargestGrowth writes the -report-largest-growth listing: the growth,
+// old and new size of each file, files that appeared marked "[new]".
+func printLargestGrowth(w io.Writer, rows []fileGrowth, fo FormatOptions) {
+	largest := int64(0)
+	for _, g := range rows {
+		largest = max(largest, g.New)
+	}
+	fo = fo.fixUnit(largest)
+
+	cells := make([][3]string, len(rows))
+	deltaWidth, oldWidth, curWidth := len("Delta"), len("Old"), len("New")
+	for i, g := range rows {
+		old := fo.size(g.Old)
+		if g.Added {
+			old = "-"
+		}
+		cells[i] = [3]string{sizeDelta(fo, g.New-g.Old), old, fo.size(g.New)}
+		deltaWidth = max(deltaWidth, len(cells[i][0]))
+		oldWidth = max(oldWidth, len(cells[i][1]))
+		curWidth = max(curWidth, len(cells[i][2]))
+	}
+
+	_, _ = fmt.Fprintln(w, "Largest growth:")
+	if len(rows) == 0 {
+		_, _ = fmt.Fprintln(w, "  no file grew or appeared")
+		return
+	}
+	_, _ = fmt.Fprintf(w, "%*s %*s %*s %s\n", deltaWidth, "Delta", oldWidth, "Old", curWidth, "New", "Path")
+	for i, g := range rows {
+		name := fo.path(g.Path)
+		if g.Added {
+			name += " [new]"
+		}
+		_, _ = fmt.Fprintf(w, "%*s %*s %*s %s\n", deltaWidth, cells[i][0], oldWidth, cells[i][1], curWidth, cells[i][2], name)
+	}
+}
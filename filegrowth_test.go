@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fileListSnapshot scans root with -json-files and reads the summary back
+// like -report-largest-growth does.
+func fileListSnapshot(t *testing.T, root string) *Result {
+	t.Helper()
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, FileLists: true})
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !jo.Stats.FileLists {
+		t.Fatalf("stats.file_lists not set")
+	}
+	return resultFromSummary(jo)
+}
+
+func TestLargestGrowthReportsGrownAndAddedFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "logs", "app.log"), 100)
+	writeFile(t, filepath.Join(root, "logs", "old.log"), 50)
+	writeFile(t, filepath.Join(root, "keep.txt"), 10)
+	before := fileListSnapshot(t, root)
+
+	writeFile(t, filepath.Join(root, "logs", "app.log"), 400) // grows by 300
+	writeFile(t, filepath.Join(root, "logs", "old.log"), 20)  // shrinks
+	writeFile(t, filepath.Join(root, "data", "dump.bin"), 1000)
+	after := fileListSnapshot(t, root)
+
+	rows, err := largestGrowth(before, after, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []fileGrowth{
+		{Path: filepath.Join("data", "dump.bin"), Old: 0, New: 1000, Added: true},
+		{Path: filepath.Join("logs", "app.log"), Old: 100, New: 400},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("growth = %+v; want %+v", rows, want)
+	}
+
+	if top, _ := largestGrowth(before, after, 1); len(top) != 1 || top[0].Path != want[0].Path {
+		t.Fatalf("top 1 = %+v; want only %s", top, want[0].Path)
+	}
+
+	var out bytes.Buffer
+	printLargestGrowth(&out, rows, FormatOptions{Bytes: true})
+	for _, line := range []string{
+		"Delta Old  New Path",
+		"+1000   - 1000 data/dump.bin [new]",
+		" +300 100  400 logs/app.log",
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Fatalf("report lacks %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestLargestGrowthNeedsFileLists(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "f"), 10)
+	withLists := fileListSnapshot(t, root)
+	// a summary written without -json-files loads without file lists
+	var jo JsonOut
+	if err := json.Unmarshal([]byte(`{"root":"/x","stats":{},"dirs":[{"path":"/x","rel":".","size":10,"files":1}]}`), &jo); err != nil {
+		t.Fatal(err)
+	}
+	without := resultFromSummary(jo)
+	if without.DirFiles != nil {
+		t.Fatalf("DirFiles = %v; want nil without stats.file_lists", without.DirFiles)
+	}
+	if _, err := largestGrowth(without, withLists, 0); err == nil || !strings.Contains(err.Error(), "old summary") {
+		t.Fatalf("err = %v; want the old summary named", err)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import "strings"
+
+// stringList is a repeatable string flag: every occurrence appends a value.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// PathFilter selects files by plain substrings of their full path.
+type PathFilter struct {
+	Contains    []string // keep only paths containing at least one of these (empty = keep all)
+	NotContains []string // drop paths containing any of these
+	IgnoreCase  bool     // compare with both sides case-folded (-ignore-case)
+}
+
+// Match reports whether path passes the filter.
+func (f PathFilter) Match(path string) bool {
+	if f.IgnoreCase {
+		path = strings.ToLower(path)
+	}
+	for _, s := range f.NotContains {
+		if f.contains(path, s) {
+			return false
+		}
+	}
+	if len(f.Contains) == 0 {
+		return true
+	}
+	for _, s := range f.Contains {
+		if f.contains(path, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether path, already folded for IgnoreCase, contains s.
+func (f PathFilter) contains(path, s string) bool {
+	if f.IgnoreCase {
+		s = strings.ToLower(s)
+	}
+	return strings.Contains(path, s)
+}
+
+// active reports whether the filter would drop anything.
+func (f PathFilter) active() bool {
+	return len(f.Contains) > 0 || len(f.NotContains) > 0
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathFilterMatch(t *testing.T) {
+	f := PathFilter{Contains: []string{"/logs/", ".log"}, NotContains: []string{"keep"}}
+	cases := map[string]bool{
+		"/data/logs/a.txt":   true,
+		"/data/app.log":      true,
+		"/data/app.txt":      false,
+		"/data/logs/keep.gz": false,
+	}
+	for p, want := range cases {
+		if got := f.Match(p); got != want {
+			t.Errorf("Match(%q) = %v, want %v", p, got, want)
+		}
+	}
+	if !(PathFilter{}).Match("/anything") {
+		t.Errorf("empty filter should match everything")
+	}
+}
+
+func TestScanPathContains(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "cache", "a.tmp"), 100)
+	writeFile(t, filepath.Join(root, "cache", "b.dat"), 10)
+	writeFile(t, filepath.Join(root, "src", "c.tmp"), 1)
+	writeFile(t, filepath.Join(root, "src", "d.go"), 1000)
+
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, Filter: PathFilter{Contains: []string{".tmp"}}})
+	if got := res.DirStats["."]; got.Size != 101 || got.Files != 2 || res.FilesScanned != 2 {
+		t.Fatalf("root = %+v (scanned %d), want only the .tmp files", got, res.FilesScanned)
+	}
+	if got := res.DirStats["src"].Size; got != 1 {
+		t.Fatalf("src size = %d, want 1", got)
+	}
+
+	res = Scan(context.Background(), root, ScanOptions{Concurrency: 2, Filter: PathFilter{NotContains: []string{"/cache/"}}})
+	if got := res.DirStats["."].Size; got != 1001 {
+		t.Fatalf("root size = %d, want 1001 without cache", got)
+	}
+	if got := res.DirStats["cache"]; got == nil || got.Size != 0 {
+		t.Fatalf("cache should be listed but empty: %+v", got)
+	}
+}
+
+func TestPathFilterIgnoreCase(t *testing.T) {
+	path := "/src/app/NODE_MODULES/lib.js"
+	f := PathFilter{NotContains: []string{"node_modules"}}
+	if !f.Match(path) {
+		t.Fatalf("case-sensitive filter dropped %q", path)
+	}
+	f.IgnoreCase = true
+	if f.Match(path) {
+		t.Fatalf("-ignore-case filter kept %q", path)
+	}
+	f = PathFilter{Contains: []string{"Node_Modules"}, IgnoreCase: true}
+	if !f.Match(path) || f.Match("/src/app/main.js") {
+		t.Fatalf("-ignore-case include filter did not fold the pattern")
+	}
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "NODE_MODULES", "a.js"), 100)
+	writeFile(t, filepath.Join(root, "src", "b.js"), 10)
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, Filter: PathFilter{NotContains: []string{"/node_modules/"}, IgnoreCase: true}})
+	if got := res.DirStats["."].Size; got != 10 {
+		t.Fatalf("root size = %d, want 10 without NODE_MODULES", got)
+	}
+}
+
+func TestScanSkipRootFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "README"), 1000)
+	writeFile(t, filepath.Join(root, "config"), 200)
+	writeFile(t, filepath.Join(root, "sub", "a"), 30)
+	writeFile(t, filepath.Join(root, "sub", "deep", "b"), 4)
+
+	for _, dirsOnly := range []bool{false, true} {
+		res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, SkipRootFiles: true, DirsOnly: dirsOnly})
+		if got := res.DirStats["."]; got.Size != 34 || got.Files != 2 || res.FilesScanned != 2 {
+			t.Fatalf("dirs-only=%v: root = %+v (scanned %d), want only the sub files", dirsOnly, got, res.FilesScanned)
+		}
+		if got := res.DirStats["sub"]; got.Size != 34 {
+			t.Fatalf("dirs-only=%v: sub = %+v, want 34 bytes", dirsOnly, got)
+		}
+	}
+	if got := Scan(context.Background(), root, ScanOptions{Concurrency: 2}).DirStats["."].Size; got != 1234 {
+		t.Fatalf("root size without the flag = %d, want 1234", got)
+	}
+}
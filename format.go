@@ -1,27 +1,257 @@
 package main
 
-import "strconv"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// FormatOptions selects how sizes, file counts and paths are rendered in the tree and summaries.
+type FormatOptions struct {
+	Bytes      bool // print raw numbers instead of humanized units
+	Bits       bool // report sizes in bits (size*8) with decimal bit suffixes
+	HumanFiles bool // humanize file counts (e.g. 1.2M instead of 1234567)
+	// BlockSize, when > 0, prints sizes as a count of blocks of that many
+	// bytes, like du -B (sizes are then whole multiples of it, see ScanOptions.BlockSize).
+	BlockSize int64
+	// ASCII escapes non-ASCII bytes in displayed paths and draws the tree
+	// with ASCII connectors (-encoding ascii).
+	ASCII bool
+	// FixedUnit prints all sizes of the tree and summaries in the one unit
+	// humanized sizes would use for the largest of them (-fixed-unit).
+	FixedUnit bool
+	// Location is the zone times are shown in (-timezone); nil = local.
+	Location *time.Location
+	// unit is the unit fixUnit chose for FixedUnit; zero until then.
+	unit sizeUnit
+}
+
+// localTime returns t in the display zone: Location, or the local zone.
+func (o FormatOptions) localTime(t time.Time) time.Time {
+	if o.Location == nil {
+		return t.Local()
+	}
+	return t.In(o.Location)
+}
+
+// sizeUnit is a fixed display unit: sizes are divided by div and suffixed.
+type sizeUnit struct {
+	div    int64
+	suffix string
+}
+
+// fixUnit returns o with the FixedUnit unit chosen for sizes up to largest:
+// the unit humanizeBytes (or humanizeBits) would print largest in. It is a
+// no-op without FixedUnit, for raw numbers and blocks, and once a unit is
+// chosen.
+func (o FormatOptions) fixUnit(largest int64) FormatOptions {
+	if !o.FixedUnit || o.unit.div != 0 || o.Bytes || o.BlockSize > 0 {
+		return o
+	}
+	base, suffixes, v := int64(1024), []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}, largest
+	if o.Bits {
+		base, suffixes, v = 1000, []string{"b", "Kb", "Mb", "Gb", "Tb", "Pb", "Eb"}, largest*8
+	}
+	o.unit = sizeUnit{div: 1, suffix: suffixes[0]}
+	for _, suffix := range suffixes[1:] {
+		if v < o.unit.div*base {
+			break
+		}
+		o.unit = sizeUnit{div: o.unit.div * base, suffix: suffix}
+	}
+	return o
+}
+
+// largestSize returns the largest of the directory, user and group sizes.
+func largestSize(dirSizes map[string]int64, userStats map[string]*UserStat, groupStats map[string]*GroupStat) int64 {
+	var m int64
+	for _, s := range dirSizes {
+		m = max(m, s)
+	}
+	for _, us := range userStats {
+		m = max(m, us.Size)
+	}
+	for _, gs := range groupStats {
+		m = max(m, gs.Size)
+	}
+	return m
+}
+
+// size renders a byte count according to the options.
+func (o FormatOptions) size(s int64) string {
+	switch {
+	case o.BlockSize > 0:
+		return strconv.FormatInt((s+o.BlockSize-1)/o.BlockSize, 10)
+	case o.Bits && o.Bytes:
+		return strconv.FormatInt(s*8, 10)
+	case o.unit.div == 1:
+		if o.Bits {
+			s *= 8
+		}
+		return strconv.FormatInt(s, 10) + o.unit.suffix
+	case o.unit.div > 1:
+		if o.Bits {
+			s *= 8
+		}
+		return fmt.Sprintf("%.1f%s", float64(s)/float64(o.unit.div), o.unit.suffix)
+	case o.Bits:
+		return humanizeBits(s * 8)
+	case o.Bytes:
+		return strconv.FormatInt(s, 10)
+	}
+	return humanizeBytes(s)
+}
+
+// path renders a path for display according to the options.
+func (o FormatOptions) path(p string) string {
+	if o.ASCII {
+		return escapeNonASCII(p)
+	}
+	return p
+}
+
+// avgFileSize returns the average size of files bytes spread over n files,
+// or false when there are no files.
+func avgFileSize(size, n int64) (int64, bool) {
+	if n <= 0 {
+		return 0, false
+	}
+	return size / n, true
+}
+
+// avg renders the average file size of a directory, "-" when it has no files.
+func (o FormatOptions) avg(size, n int64) string {
+	a, ok := avgFileSize(size, n)
+	if !ok {
+		return "-"
+	}
+	return o.size(a)
+}
+
+// sizeLabel is the size column header: "Size", or e.g. "4K-blocks" with BlockSize.
+func (o FormatOptions) sizeLabel() string {
+	switch {
+	case o.BlockSize <= 0:
+		return "Size"
+	case o.BlockSize%1024 == 0:
+		return fmt.Sprintf("%dK-blocks", o.BlockSize/1024)
+	}
+	return fmt.Sprintf("%dB-blocks", o.BlockSize)
+}
+
+// blockRoundUp rounds n up to a whole number of blocks of size bs.
+func blockRoundUp(n, bs int64) int64 {
+	return (n + bs - 1) / bs * bs
+}
+
+// parseSize parses a size such as "500M", "1.5G", "10GB" or "2048" into bytes.
+// Suffixes K, M, G, T, P and E (optionally followed by "B" or "iB", any case)
+// are powers of 1024, matching the units the tree prints.
+func parseSize(s string) (int64, error) {
+	num := strings.TrimSpace(s)
+	upper := strings.ToUpper(num)
+	upper = strings.TrimSuffix(strings.TrimSuffix(upper, "IB"), "B")
+	mult := int64(1)
+	if n := len(upper); n > 0 {
+		if i := strings.IndexByte("KMGTPE", upper[n-1]); i >= 0 {
+			mult = int64(1) << (10 * (i + 1))
+			upper = upper[:n-1]
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(upper), 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 500M, 1.5G or a byte count)", s)
+	}
+	return int64(v * float64(mult)), nil
+}
+
+// files renders a file count according to the options.
+func (o FormatOptions) files(n int64) string {
+	if o.HumanFiles {
+		return humanizeCount(n)
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// humanizeSignedBytes formats a change in bytes with its sign, "+2.0MB" or
+// "-1.5KB" ("0B" when unchanged), where humanizeBytes, which is meant for
+// absolute sizes, renders any negative value as "-".
+func humanizeSignedBytes(d int64) string {
+	return signedSize(d, humanizeBytes)
+}
+
+// signedSize renders the magnitude of d with render and prefixes its sign.
+func signedSize(d int64, render func(int64) string) string {
+	switch {
+	case d > 0:
+		return "+" + render(d)
+	case d < 0:
+		return "-" + render(-d)
+	}
+	return render(0)
+}
+
+// humanizeBits formats a bit count with decimal (1000-based) suffixes, as is
+// conventional for network rates and sizes.
+func humanizeBits(b int64) string {
+	if b < 0 {
+		return "-"
+	}
+	const unit = 1000
+	if b < unit {
+		return fmt.Sprintf("%db", b)
+	}
+	d := float64(b)
+	for _, suffix := range []string{"Kb", "Mb", "Gb", "Tb", "Pb", "Eb"} {
+		d = d / unit
+		if d < unit {
+			return fmt.Sprintf("%.1f%s", d, suffix)
+		}
+	}
+	return fmt.Sprintf("%db", b)
+}
+
+// humanizeCount formats a count with thousands-style suffixes (1.2K, 3.4M, ...).
+func humanizeCount(n int64) string {
+	if n < 0 {
+		return "-"
+	}
+	const unit = 1000
+	if n < unit {
+		return strconv.FormatInt(n, 10)
+	}
+	d := float64(n)
+	for _, suffix := range []string{"K", "M", "G", "T", "P", "E"} {
+		d = d / unit
+		if d < unit {
+			return fmt.Sprintf("%.1f%s", d, suffix)
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
 
 // ComputeSizeMapsAndWidths builds combined size strings (mantissa+unit or raw bytes)
 // for directories, users, and groups and returns maps plus auto-fit widths for
-// the size column and files column.
-func ComputeSizeMapsAndWidths(dirSizes map[string]int64, dirStats map[string]*DirStat, userStats map[string]*UserStat, groupStats map[string]*GroupStat, bytesFlag bool, sizeWidthOverride, filesWidthOverride int) (map[string]string, map[string]string, map[string]string, int, int) {
+// the size column and files column. A positive sizeWidthMax/filesWidthMax caps
+// the auto-fit width (size strings longer than the cap are ellipsized); explicit
+// overrides take precedence over the caps, and the minimum widths over both.
+func ComputeSizeMapsAndWidths(dirSizes map[string]int64, dirStats map[string]*DirStat, userStats map[string]*UserStat, groupStats map[string]*GroupStat, fo FormatOptions, sizeWidthOverride, filesWidthOverride, sizeWidthMax, filesWidthMax int) (map[string]string, map[string]string, map[string]string, int, int) {
+	fo = fo.fixUnit(largestSize(dirSizes, userStats, groupStats))
 	sizeStrMap := make(map[string]string, len(dirSizes))
 	maxSizeWidth := 0
 	maxFilesWidth := 0
 	for p, s := range dirSizes {
-		var combined string
-		if bytesFlag {
-			combined = strconv.FormatInt(s, 10)
-		} else {
-			combined = humanizeBytes(s)
-		}
+		combined := fo.size(s)
 		sizeStrMap[p] = combined
 		if w := len(combined); w > maxSizeWidth {
 			maxSizeWidth = w
 		}
 		if st, ok := dirStats[p]; ok {
-			fsStr := strconv.FormatInt(st.Files, 10)
+			fsStr := fo.files(st.Files)
 			if w := len(fsStr); w > maxFilesWidth {
 				maxFilesWidth = w
 			}
@@ -30,15 +260,11 @@ func ComputeSizeMapsAndWidths(dirSizes map[string]int64, dirStats map[string]*Di
 
 	userSizeStr := make(map[string]string, len(userStats))
 	for u, us := range userStats {
-		if bytesFlag {
-			userSizeStr[u] = strconv.FormatInt(us.Size, 10)
-		} else {
-			userSizeStr[u] = humanizeBytes(us.Size)
-		}
+		userSizeStr[u] = fo.size(us.Size)
 		if len(userSizeStr[u]) > maxSizeWidth {
 			maxSizeWidth = len(userSizeStr[u])
 		}
-		fsStr := strconv.FormatInt(us.Files, 10)
+		fsStr := fo.files(us.Files)
 		if len(fsStr) > maxFilesWidth {
 			maxFilesWidth = len(fsStr)
 		}
@@ -46,21 +272,23 @@ func ComputeSizeMapsAndWidths(dirSizes map[string]int64, dirStats map[string]*Di
 
 	groupSizeStr := make(map[string]string, len(groupStats))
 	for g, gs := range groupStats {
-		if bytesFlag {
-			groupSizeStr[g] = strconv.FormatInt(gs.Size, 10)
-		} else {
-			groupSizeStr[g] = humanizeBytes(gs.Size)
-		}
+		groupSizeStr[g] = fo.size(gs.Size)
 		if len(groupSizeStr[g]) > maxSizeWidth {
 			maxSizeWidth = len(groupSizeStr[g])
 		}
-		fsStr := strconv.FormatInt(gs.Files, 10)
+		fsStr := fo.files(gs.Files)
 		if len(fsStr) > maxFilesWidth {
 			maxFilesWidth = len(fsStr)
 		}
 	}
 
-	// apply overrides if provided
+	// apply caps, then overrides if provided
+	if sizeWidthMax > 0 && maxSizeWidth > sizeWidthMax {
+		maxSizeWidth = sizeWidthMax
+	}
+	if filesWidthMax > 0 && maxFilesWidth > filesWidthMax {
+		maxFilesWidth = filesWidthMax
+	}
 	if sizeWidthOverride > 0 {
 		maxSizeWidth = sizeWidthOverride
 	}
@@ -75,5 +303,92 @@ func ComputeSizeMapsAndWidths(dirSizes map[string]int64, dirStats map[string]*Di
 		maxFilesWidth = 3
 	}
 
+	// values wider than a capped column are cut to fit it
+	if sizeWidthMax > 0 && sizeWidthOverride <= 0 {
+		for _, m := range []map[string]string{sizeStrMap, userSizeStr, groupSizeStr} {
+			for k, v := range m {
+				m[k] = ellipsize(v, maxSizeWidth)
+			}
+		}
+	}
+
 	return sizeStrMap, userSizeStr, groupSizeStr, maxSizeWidth, maxFilesWidth
 }
+
+// ellipsize shortens s to at most w characters, replacing its tail with "…"
+// when it has to be cut.
+func ellipsize(s string, w int) string {
+	r := []rune(s)
+	if w <= 0 || len(r) <= w {
+		return s
+	}
+	if w == 1 {
+		return "…"
+	}
+	return string(r[:w-1]) + "…"
+}
+
+// ownerColumnWidth is the number of terminal columns of the tree's User and
+// Group columns.
+const ownerColumnWidth = 15
+
+// runeWidth returns the number of terminal columns r takes: two for wide and
+// fullwidth (e.g. CJK) characters, none for combining marks and format
+// characters, one otherwise.
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// displayWidth returns the number of terminal columns s takes.
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// padDisplay pads s with spaces to w terminal columns, like %-*s does for
+// ASCII but counting wide characters as two. A longer s is cut to w-1
+// columns and ends in "…" (plus a space when a wide character did not fit).
+func padDisplay(s string, w int) string {
+	n := displayWidth(s)
+	if n > w {
+		var b strings.Builder
+		n = 0
+		for _, r := range s {
+			rw := runeWidth(r)
+			if n+rw > w-1 {
+				break
+			}
+			b.WriteRune(r)
+			n += rw
+		}
+		b.WriteString("…")
+		s, n = b.String(), n+1
+	}
+	return s + strings.Repeat(" ", max(w-n, 0))
+}
+
+// ellipsizeMiddle shortens s to at most w runes by replacing its middle with
+// mark, keeping both ends (the start and the most specific part of a path).
+func ellipsizeMiddle(s string, w int, mark string) string {
+	r := []rune(s)
+	if w <= 0 || len(r) <= w {
+		return s
+	}
+	m := len([]rune(mark))
+	if w <= m {
+		return string([]rune(mark)[:w])
+	}
+	head := (w - m + 1) / 2
+	tail := w - m - head
+	return string(r[:head]) + mark + string(r[len(r)-tail:])
+}
@@ -1,7 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
 	"testing"
 )
 
@@ -52,3 +58,187 @@ func TestCombinedSizeString(t *testing.T) {
 		}
 	}
 }
+
+func TestHumanizeCount(t *testing.T) {
+	cases := []struct {
+		input  int64
+		expect string
+	}{
+		{0, "0"},
+		{999, "999"},
+		{1000, "1.0K"},
+		{1500, "1.5K"},
+		{1234567, "1.2M"},
+		{5000000000, "5.0G"},
+	}
+	for _, c := range cases {
+		got := humanizeCount(c.input)
+		if got != c.expect {
+			t.Fatalf("humanizeCount(%d) = %q; want %q", c.input, got, c.expect)
+		}
+	}
+}
+
+func TestHumanizeBits(t *testing.T) {
+	cases := []struct {
+		input  int64
+		expect string
+	}{
+		{0, "0b"},
+		{800, "800b"},
+		{8000, "8.0Kb"},
+		{1024 * 8, "8.2Kb"},
+		{1000 * 1000 * 8, "8.0Mb"},
+	}
+	for _, c := range cases {
+		got := humanizeBits(c.input)
+		if got != c.expect {
+			t.Fatalf("humanizeBits(%d) = %q; want %q", c.input, got, c.expect)
+		}
+	}
+}
+
+func TestFormatOptionsSizeAndFiles(t *testing.T) {
+	cases := []struct {
+		fo        FormatOptions
+		size      int64
+		files     int64
+		wantSize  string
+		wantFiles string
+	}{
+		{FormatOptions{}, 1536, 1234567, "1.5KB", "1234567"},
+		{FormatOptions{Bytes: true}, 1536, 12, "1536", "12"},
+		{FormatOptions{Bits: true}, 1000, 12, "8.0Kb", "12"},
+		{FormatOptions{Bits: true, Bytes: true}, 1000, 12, "8000", "12"},
+		{FormatOptions{HumanFiles: true}, 0, 1234567, "0B", "1.2M"},
+	}
+	for _, c := range cases {
+		if got := c.fo.size(c.size); got != c.wantSize {
+			t.Fatalf("%+v size(%d) = %q; want %q", c.fo, c.size, got, c.wantSize)
+		}
+		if got := c.fo.files(c.files); got != c.wantFiles {
+			t.Fatalf("%+v files(%d) = %q; want %q", c.fo, c.files, got, c.wantFiles)
+		}
+	}
+}
+
+func TestBlockSizeFormatting(t *testing.T) {
+	if got := blockRoundUp(100, 512); got != 512 {
+		t.Fatalf("blockRoundUp(100, 512) = %d", got)
+	}
+	if got := blockRoundUp(4096, 4096); got != 4096 {
+		t.Fatalf("blockRoundUp(4096, 4096) = %d", got)
+	}
+	if got := blockRoundUp(4097, 4096); got != 8192 {
+		t.Fatalf("blockRoundUp(4097, 4096) = %d", got)
+	}
+	fo := FormatOptions{BlockSize: 4096}
+	if got := fo.size(8192); got != "2" {
+		t.Fatalf("size(8192) = %q, want 2 blocks", got)
+	}
+	if got := fo.size(1); got != "1" {
+		t.Fatalf("size(1) = %q, want a partial block rounded up", got)
+	}
+	for bs, want := range map[int64]string{0: "Size", 512: "512B-blocks", 1024: "1K-blocks", 4096: "4K-blocks"} {
+		if got := (FormatOptions{BlockSize: bs}).sizeLabel(); got != want {
+			t.Errorf("sizeLabel(%d) = %q, want %q", bs, got, want)
+		}
+	}
+}
+
+func TestScanBlockSizeRoundsUp(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "small"), 100)
+	info, err := os.Lstat(filepath.Join(root, "small"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alloc := info.Sys().(*syscall.Stat_t).Blocks * 512
+	if alloc == 0 {
+		t.Skip("filesystem does not allocate blocks for small files")
+	}
+
+	const bs = 1024
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 1, BlockSize: bs})
+	want := (alloc + bs - 1) / bs * bs
+	if got := res.DirStats["."].Size; got != want || got%bs != 0 || got < bs {
+		t.Fatalf("root size = %d, want %d (allocation %d rounded up to %d-byte blocks)", got, want, alloc, bs)
+	}
+
+	var out bytes.Buffer
+	printTree(&out, res, TreeOptions{Format: FormatOptions{BlockSize: bs}})
+	if !strings.Contains(out.String(), "1K-blocks") || !strings.Contains(out.String(), strconv.FormatInt(want/bs, 10)+" "+root) {
+		t.Fatalf("unexpected tree:\n%s", out.String())
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for in, want := range map[string]int64{
+		"2048":  2048,
+		"1K":    1024,
+		"1kb":   1024,
+		"500M":  500 << 20,
+		"1.5G":  3 << 29,
+		"10GiB": 10 << 30,
+		"2T":    2 << 40,
+		"0":     0,
+	} {
+		got, err := parseSize(in)
+		if err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "G", "abc", "-1M", "1X"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) should fail", in)
+		}
+	}
+}
+
+func TestHumanizeSignedBytes(t *testing.T) {
+	cases := []struct {
+		input  int64
+		expect string
+	}{
+		{0, "0B"},
+		{512, "+512B"},
+		{-512, "-512B"},
+		{1536, "+1.5KB"},
+		{-1536, "-1.5KB"},
+		{2 * 1024 * 1024, "+2.0MB"},
+		{-5 * 1024 * 1024 * 1024, "-5.0GB"},
+	}
+	for _, c := range cases {
+		if got := humanizeSignedBytes(c.input); got != c.expect {
+			t.Fatalf("humanizeSignedBytes(%d) = %q; want %q", c.input, got, c.expect)
+		}
+	}
+	// absolute sizes keep their old rendering
+	if got := humanizeBytes(-1); got != "-" {
+		t.Fatalf("humanizeBytes(-1) = %q; want \"-\"", got)
+	}
+}
+
+func TestPadDisplay(t *testing.T) {
+	cases := []struct {
+		name, in, want string
+	}{
+		{"ascii", "alice", "alice          "},
+		{"wide", "山田太郎", "山田太郎       "}, // 8 columns plus 7 spaces
+		{"combining", "Jose\u0301", "Jose\u0301           "},
+		{"exact", "abcdefghijklmno", "abcdefghijklmno"},
+		{"ascii too long", "averyveryverylongname", "averyveryveryl…"},
+		{"wide too long", "山田太郎山田太郎", "山田太郎山田太…"},
+		// the eighth wide character would overrun the budget, so a space fills in
+		{"wide cut unevenly", "a山田太郎山田太郎", "a山田太郎山田… "},
+	}
+	for _, c := range cases {
+		got := padDisplay(c.in, 15)
+		if got != c.want {
+			t.Errorf("%s: padDisplay(%q) = %q; want %q", c.name, c.in, got, c.want)
+		}
+		if w := displayWidth(got); w != 15 {
+			t.Errorf("%s: %q is %d columns wide; want 15", c.name, got, w)
+		}
+	}
+}
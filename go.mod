@@ -1,3 +1,13 @@
 module diskusage
 
 go 1.25.3
+
+require (
+	github.com/cespare/xxhash/v2 v2.1.2
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/klauspost/compress v1.18.0
+	golang.org/x/term v0.36.0
+	golang.org/x/text v0.30.0
+)
+
+require golang.org/x/sys v0.37.0 // indirect
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// JsonHiddenSplit divides the scanned bytes and files between hidden files,
+// those with a name or a directory below the root starting with '.' (caches,
+// dotfiles), and visible ones (-hidden-report). It is kept in Result.Hidden
+// and written to the JSON stats as is.
+type JsonHiddenSplit struct {
+	VisibleSize  int64 `json:"visible_size"`
+	VisibleFiles int64 `json:"visible_files"`
+	HiddenSize   int64 `json:"hidden_size"`
+	HiddenFiles  int64 `json:"hidden_files"`
+}
+
+// isHidden reports whether the file name in the directory rel (relative to
+// the root) is hidden. The root's own name does not count, so scanning
+// ~/.config does not make everything hidden.
+func isHidden(rel, name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	for _, c := range strings.Split(filepath.ToSlash(rel), "/") {
+		if c != "." && strings.HasPrefix(c, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// add counts files files of size bytes as hidden or visible.
+func (h *JsonHiddenSplit) add(hidden bool, size, files int64) {
+	if hidden {
+		h.HiddenSize += size
+		h.HiddenFiles += files
+		return
+	}
+	h.VisibleSize += size
+	h.VisibleFiles += files
+}
+
+// merge adds the split of another summary (MergeSummaries).
+func (h *JsonHiddenSplit) merge(o JsonHiddenSplit) {
+	h.add(false, o.VisibleSize, o.VisibleFiles)
+	h.add(true, o.HiddenSize, o.HiddenFiles)
+}
+
+// hiddenReportLine renders the -hidden-report line, "Visible: X (p%),
+// Hidden: Y (q%)", the shares taken of the bytes of both.
+func hiddenReportLine(h JsonHiddenSplit, fo FormatOptions) string {
+	total := h.VisibleSize + h.HiddenSize
+	pct := func(n int64) float64 {
+		if total <= 0 {
+			return 0
+		}
+		return float64(n) * 100 / float64(total)
+	}
+	return fmt.Sprintf("Visible: %s (%.1f%%), Hidden: %s (%.1f%%)",
+		fo.size(h.VisibleSize), pct(h.VisibleSize), fo.size(h.HiddenSize), pct(h.HiddenSize))
+}
+
+// printHiddenReport writes the -hidden-report section after the summaries.
+func printHiddenReport(w io.Writer, h JsonHiddenSplit, fo FormatOptions) {
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, hiddenReportLine(h, fo))
+}
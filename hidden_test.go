@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsHidden(t *testing.T) {
+	for _, tc := range []struct {
+		rel, name string
+		want      bool
+	}{
+		{".", "a", false},
+		{".", ".bashrc", true},
+		{"src", "main.go", false},
+		{".cache", "x", true},
+		{"src/.git/objects", "pack", true},
+		{"src/a.b", "c", false},
+	} {
+		if got := isHidden(tc.rel, tc.name); got != tc.want {
+			t.Errorf("isHidden(%q, %q) = %v, want %v", tc.rel, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestScanHiddenReport(t *testing.T) {
+	// the root's own name is not a hidden component
+	root := filepath.Join(t.TempDir(), ".home")
+	writeFile(t, filepath.Join(root, ".cache", "pip", "wheel"), 100)
+	writeFile(t, filepath.Join(root, ".bashrc"), 5)
+	writeFile(t, filepath.Join(root, "src", ".git", "config"), 20)
+	writeFile(t, filepath.Join(root, "src", "main.go"), 10)
+	writeFile(t, filepath.Join(root, "notes"), 1)
+
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, HiddenReport: true})
+	want := JsonHiddenSplit{VisibleSize: 11, VisibleFiles: 2, HiddenSize: 125, HiddenFiles: 3}
+	if res.Hidden == nil || *res.Hidden != want {
+		t.Fatalf("Hidden = %+v, want %+v", res.Hidden, want)
+	}
+	if got, line := hiddenReportLine(*res.Hidden, FormatOptions{Bytes: true}), "Visible: 11 (8.1%), Hidden: 125 (91.9%)"; got != line {
+		t.Fatalf("report = %q, want %q", got, line)
+	}
+
+	// the split is part of the JSON stats and read back with them
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if jo.Stats.Hidden == nil || *jo.Stats.Hidden != want {
+		t.Fatalf("stats hidden_split = %+v, want %+v", jo.Stats.Hidden, want)
+	}
+	if got := resultFromSummary(jo).Hidden; got == nil || *got != want {
+		t.Fatalf("loaded Hidden = %+v, want %+v", got, want)
+	}
+
+	// without the option nothing is split
+	if res := Scan(context.Background(), root, ScanOptions{Concurrency: 2}); res.Hidden != nil {
+		t.Fatalf("Hidden = %+v without HiddenReport", res.Hidden)
+	}
+}
@@ -1,15 +1,18 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
-	"os/user"
 	"path/filepath"
 	"runtime"
 	"sort"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -20,62 +23,708 @@ type JsonDir struct {
 	Rel   string `json:"rel"`
 	Size  int64  `json:"size"`
 	Files int64  `json:"files"`
+	// AvgFileSize is Size/Files, only present with -avg for directories
+	// holding files.
+	AvgFileSize int64 `json:"avg_file_size,omitempty"`
+	// Rank is the 1-based position among its siblings in the tree's
+	// descending-size order, only present with -json-include-tree-order.
+	Rank  int    `json:"rank,omitempty"`
 	UID   uint32 `json:"uid,omitempty"`
 	User  string `json:"user,omitempty"`
 	GID   uint32 `json:"gid,omitempty"`
 	Group string `json:"group,omitempty"`
+	// Owners splits the directory's subtree totals by user name; only present
+	// with -json-owner-breakdown.
+	Owners map[string]JsonOwnerShare `json:"owners,omitempty"`
+	// FileList holds the files directly inside the directory, by name; only
+	// present with -json-files (stats.file_lists).
+	FileList []JsonDirFile `json:"file_list,omitempty"`
+}
+
+// JsonOwnerShare is one user's part of a directory's subtree totals.
+type JsonOwnerShare struct {
+	Size  int64  `json:"size"`
+	Files int64  `json:"files"`
+	UID   uint32 `json:"uid,omitempty"`
 }
 
 type JsonUser struct {
 	Name  string `json:"name"`
 	Size  int64  `json:"size"`
 	Files int64  `json:"files"`
-	UID   uint32 `json:"uid,omitempty"`
+	// Dirs counts the directories owned, only with -dir-count.
+	Dirs int64  `json:"dirs,omitempty"`
+	UID  uint32 `json:"uid,omitempty"`
 }
 
 type JsonGroup struct {
 	Name  string `json:"name"`
 	Size  int64  `json:"size"`
 	Files int64  `json:"files"`
+	Dirs  int64  `json:"dirs,omitempty"`
 	GID   uint32 `json:"gid,omitempty"`
 }
 
 type JsonStats struct {
-	StartedAt          string  `json:"started_at"`
-	EndedAt            string  `json:"ended_at"`
-	RuntimeSeconds     float64 `json:"runtime_seconds"`
-	Runtime            string  `json:"runtime"`
-	DirsScanned        int64   `json:"dirs_scanned"`
-	FilesScanned       int64   `json:"files_scanned"`
-	MemAlloc           uint64  `json:"mem_alloc_bytes"`
-	TotalAlloc         uint64  `json:"total_alloc_bytes"`
-	HeapAlloc          uint64  `json:"heap_alloc_bytes"`
-	HeapSys            uint64  `json:"heap_sys_bytes"`
-	NumGC              uint32  `json:"num_gc"`
-	PauseTotalNs       uint64  `json:"pause_total_ns"`
-	LastGC             string  `json:"last_gc,omitempty"`
-	GCCPUFraction      float64 `json:"gc_cpu_fraction"`
-	HeapInuse          uint64  `json:"heap_inuse_bytes"`
-	HeapIdle           uint64  `json:"heap_idle_bytes"`
-	HeapReleased       uint64  `json:"heap_released_bytes"`
-	NextGC             uint64  `json:"next_gc_bytes"`
-	LastPauseNs        uint64  `json:"last_pause_ns"`
-	MaxPauseNs         uint64  `json:"max_pause_ns"`
-	PeakAllocBytes     uint64  `json:"peak_alloc_bytes"`
-	PeakHeapAllocBytes uint64  `json:"peak_heap_alloc_bytes"`
-	Version            string  `json:"version"`
+	StartedAt            string  `json:"started_at"`
+	EndedAt              string  `json:"ended_at"`
+	RuntimeSeconds       float64 `json:"runtime_seconds"`
+	Runtime              string  `json:"runtime"`
+	DirsScanned          int64   `json:"dirs_scanned"`
+	FilesScanned         int64   `json:"files_scanned"`
+	MemAlloc             uint64  `json:"mem_alloc_bytes"`
+	TotalAlloc           uint64  `json:"total_alloc_bytes"`
+	HeapAlloc            uint64  `json:"heap_alloc_bytes"`
+	HeapSys              uint64  `json:"heap_sys_bytes"`
+	NumGC                uint32  `json:"num_gc"`
+	PauseTotalNs         uint64  `json:"pause_total_ns"`
+	LastGC               string  `json:"last_gc,omitempty"`
+	GCCPUFraction        float64 `json:"gc_cpu_fraction"`
+	HeapInuse            uint64  `json:"heap_inuse_bytes"`
+	HeapIdle             uint64  `json:"heap_idle_bytes"`
+	HeapReleased         uint64  `json:"heap_released_bytes"`
+	NextGC               uint64  `json:"next_gc_bytes"`
+	LastPauseNs          uint64  `json:"last_pause_ns"`
+	MaxPauseNs           uint64  `json:"max_pause_ns"`
+	PeakAllocBytes       uint64  `json:"peak_alloc_bytes"`
+	PeakHeapAllocBytes   uint64  `json:"peak_heap_alloc_bytes"`
+	Version              string  `json:"version"`
+	Incomplete           bool    `json:"incomplete,omitempty"`
+	InProgress           bool    `json:"in_progress,omitempty"`
+	ThrottleFilesPerSec  float64 `json:"throttle_files_per_sec,omitempty"`
+	EffectiveFilesPerSec float64 `json:"effective_files_per_sec,omitempty"`
+	FSTotalBytes         uint64  `json:"fs_total_bytes,omitempty"`
+	FSFreeBytes          uint64  `json:"fs_free_bytes,omitempty"`
+	FSUsedBytes          uint64  `json:"fs_used_bytes,omitempty"`
+	BlockSize            int64   `json:"block_size,omitempty"`
+	BindDedupFiles       int64   `json:"bind_dedup_files,omitempty"`
+	BindDedupBytes       int64   `json:"bind_dedup_bytes,omitempty"`
+	// per-file size filter (-file-min-size/-file-max-size) and the files it skipped
+	FileMinSize       int64 `json:"file_min_size,omitempty"`
+	FileMaxSize       int64 `json:"file_max_size,omitempty"`
+	SizeFilteredFiles int64 `json:"size_filtered_files,omitempty"`
+	// ctime filter (-changed-since, RFC 3339) and the files it skipped
+	ChangedSince       string `json:"changed_since,omitempty"`
+	CtimeFilteredFiles int64  `json:"ctime_filtered_files,omitempty"`
+	// mtime filter (-older-than-file, RFC 3339) and the files it skipped
+	ModifiedBefore     string `json:"modified_before,omitempty"`
+	MtimeFilteredFiles int64  `json:"mtime_filtered_files,omitempty"`
+	// files skipped because their stat failed, even after retries
+	StatFailedFiles int64 `json:"stat_failed_files,omitempty"`
+	// -min-user-size/-min-group-size: users and groups below them are left
+	// out, so the arrays no longer add up to the root
+	MinUserSize  int64 `json:"min_user_size,omitempty"`
+	MinGroupSize int64 `json:"min_group_size,omitempty"`
+	// where the snapshot was taken and its -snapshot-name; a merged summary
+	// lists its inputs as sources instead
+	Hostname     string       `json:"hostname,omitempty"`
+	SnapshotName string       `json:"snapshot_name,omitempty"`
+	Sources      []JsonSource `json:"sources,omitempty"`
+	// set when the dirs carry their file_list (-json-files), even where the
+	// list is empty
+	FileLists bool `json:"file_lists,omitempty"`
+	// name-resolution counters, only with -profile-lookups
+	LookupCalls       int64   `json:"lookup_calls,omitempty"`
+	LookupCacheHits   int64   `json:"lookup_cache_hits,omitempty"`
+	LookupCacheMisses int64   `json:"lookup_cache_misses,omitempty"`
+	LookupSeconds     float64 `json:"lookup_seconds,omitempty"`
+	// bytes and files in hidden and visible paths, only with -hidden-report
+	Hidden *JsonHiddenSplit `json:"hidden_split,omitempty"`
+}
+
+// JsonDuplicates records the -dupes groups and the -hash algorithm their
+// hashes were computed with, so consumers know how to verify them.
+type JsonDuplicates struct {
+	Algorithm string         `json:"algorithm"`
+	Groups    []JsonDupGroup `json:"groups"`
+}
+
+// JsonDupGroup is one set of identical files; paths are relative to the root.
+type JsonDupGroup struct {
+	Size  int64    `json:"size"`
+	Hash  string   `json:"hash"`
+	Paths []string `json:"paths"`
+}
+
+// JsonDevice is the -by-device total of one device ("major:minor") with the
+// mount point and filesystem type it was resolved to, if any.
+type JsonDevice struct {
+	Dev    string `json:"dev"`
+	Mount  string `json:"mount,omitempty"`
+	FSType string `json:"fstype,omitempty"`
+	Size   int64  `json:"size"`
+	Files  int64  `json:"files"`
+}
+
+// JsonFile is one entry of a file listing such as newest_files; Path is
+// relative to the root and MTime is RFC 3339.
+type JsonFile struct {
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	MTime string `json:"mtime"`
 }
 
 type JsonOut struct {
-	Root  string      `json:"root"`
-	Stats JsonStats   `json:"stats"`
-	Dirs  []JsonDir   `json:"dirs"`
-	Users []JsonUser  `json:"users"`
-	Grps  []JsonGroup `json:"groups"`
+	Root  string    `json:"root"`
+	Stats JsonStats `json:"stats"`
+	// RootTotal repeats the root directory's totals, so readers need not
+	// search dirs for rel ".".
+	RootTotal *JsonRootTotal `json:"root_total,omitempty"`
+	Dirs      []JsonDir      `json:"dirs"`
+	Users     []JsonUser     `json:"users"`
+	Grps      []JsonGroup    `json:"groups"`
+	// Concentration summarizes how the bytes are spread over the users
+	// (-concentration).
+	Concentration *Concentration `json:"concentration,omitempty"`
+	Newest        []JsonFile     `json:"newest_files,omitempty"`
+	Oldest        []JsonFile     `json:"oldest_files,omitempty"`
+	// Duplicates lists groups of identical files (-dupes).
+	Duplicates *JsonDuplicates `json:"duplicates,omitempty"`
+	// Devices splits the totals by backing device (-by-device).
+	Devices []JsonDevice `json:"devices,omitempty"`
+	// ExtByUser holds the bytes and files per extension, then user name
+	// (-ext-by-user).
+	ExtByUser map[string]map[string]*ExtUserStat `json:"ext_by_user,omitempty"`
+	// Chunks, in a chunked summary's manifest, lists the files holding the
+	// dirs array (relative to the manifest); LoadSummary reassembles them.
+	Chunks []string `json:"chunks,omitempty"`
+	// dirStream, when set, produces the dirs array in place of Dirs (a
+	// -max-memory scan streams it from its on-disk spill).
+	dirStream func(yield func(JsonDir) error) error
+	// problems lists the directories buildSummary could not stat and the
+	// owners it could not resolve to a name; -strict refuses to export them.
+	problems []string
+}
+
+// errStatsOnly is returned when a summary without its tree is loaded for a
+// tree (-read-json, a merge, -compare).
+var errStatsOnly = errors.New("summary was written with -json-stats-only and has no dirs, users or groups")
+
+// statsOnly reports whether jo was written with -json-stats-only: the dirs,
+// users and groups arrays are all absent. Every full summary lists at least
+// the root directory.
+func (jo JsonOut) statsOnly() bool {
+	return jo.Dirs == nil && jo.Users == nil && jo.Grps == nil
+}
+
+// JsonRootTotal is the root_total of a summary: the size and files below the
+// root, as in its "." entry of dirs, and the number of directories scanned.
+type JsonRootTotal struct {
+	Size  int64 `json:"size"`
+	Files int64 `json:"files"`
+	Dirs  int64 `json:"dirs"`
+}
+
+// rootTotal returns the root_total of res.
+func rootTotal(res *Result) *JsonRootTotal {
+	t := &JsonRootTotal{Dirs: res.DirsScanned}
+	if ds := res.DirStats["."]; ds != nil {
+		t.Size, t.Files = ds.Size, ds.Files
+	}
+	return t
+}
+
+// maxStrictProblems caps how many problems a strict export error spells out.
+const maxStrictProblems = 5
+
+// strictErr returns an error describing jo's problems, or nil if it has none.
+func (jo *JsonOut) strictErr() error {
+	if len(jo.problems) == 0 {
+		return nil
+	}
+	shown := jo.problems[:min(len(jo.problems), maxStrictProblems)]
+	msg := strings.Join(shown, "; ")
+	if more := len(jo.problems) - len(shown); more > 0 {
+		msg += fmt.Sprintf(" (and %d more)", more)
+	}
+	return fmt.Errorf("strict: %d unresolved entries: %s", len(jo.problems), msg)
 }
 
 // MarshalSummary builds a JsonOut from runtime data and returns pretty-printed JSON bytes.
 func MarshalSummary(rootAbs string, dirStats map[string]*DirStat, userStats map[string]*UserStat, groupStats map[string]*GroupStat, startedAt, endedAt time.Time, msStart runtime.MemStats, dirsScanned, filesScanned int64, version string) ([]byte, error) {
+	jo := buildSummary(rootAbs, dirStats, userStats, groupStats, startedAt, endedAt, msStart, dirsScanned, filesScanned, version, false, false)
+	return marshalSummary(jo)
+}
+
+// SummaryOptions tunes how StreamSummary renders a Result.
+type SummaryOptions struct {
+	Version string
+	// InProgress marks a periodic snapshot taken while the scan is still running.
+	InProgress bool
+	// OmitEmpty skips directories without any bytes or files in their subtree.
+	OmitEmpty bool
+	// MaxDepth, when positive, skips directories nested deeper than that
+	// below the root; the ones kept still carry their subtree's full totals.
+	MaxDepth int
+	// RootLabel, when set, is written as the summary's root instead of the scanned path.
+	RootLabel string
+	// StatsOnly writes just root and stats, skipping the dirs/users/groups arrays.
+	StatsOnly bool
+	// NormalizePaths writes root, directory and file paths in Unicode NFC.
+	NormalizePaths bool
+	// OwnerBreakdown attaches each directory's per-user totals (Result.DirUsers).
+	OwnerBreakdown bool
+	// Numeric skips name resolution: directories carry only uid/gid, and users
+	// and groups are named by their numeric ids.
+	Numeric bool
+	// SkipDirOwner leaves the owner fields (uid, user, gid, group) out of
+	// every directory entry, so directories the scan did not record an owner
+	// for are not statted and no names are looked up for them
+	// (-skip-dir-owner).
+	SkipDirOwner bool
+	// Location is the zone the timestamps are written in (-timezone); nil
+	// writes them as they are.
+	Location *time.Location
+	// UnknownOwner names the directory owners whose ids do not resolve, as
+	// ScanOptions.UnknownOwner does for the users and groups.
+	UnknownOwner string
+	// ProfileLookups records the name-resolution counters (including the
+	// export's own lookups) in the stats.
+	ProfileLookups bool
+	// CompactArrays writes each dirs/users/groups (and file list) entry on a
+	// single line, keeping the rest of the document indented.
+	CompactArrays bool
+	// AvgFileSize adds each directory's average file size.
+	AvgFileSize bool
+	// TreeOrder adds each directory's rank among its siblings as printTree
+	// orders them.
+	TreeOrder bool
+	// Concentration adds the user concentration metrics.
+	Concentration bool
+	// Strict fails the export when a directory cannot be statted or an owner
+	// cannot be resolved to a name, instead of writing zero ids or blanks.
+	Strict bool
+	// MinUserSize/MinGroupSize leave the users/groups holding fewer bytes
+	// out of the users/groups arrays (0 = off); the thresholds are recorded
+	// in the stats.
+	MinUserSize  int64
+	MinGroupSize int64
+}
+
+// StreamSummary writes the JSON summary of res to w. The output is identical to
+// MarshalSummary's, but directory/user/group entries are encoded one at a time
+// instead of marshalling the whole document into a single buffer.
+func StreamSummary(w io.Writer, res *Result, opts SummaryOptions) error {
+	jo := summaryFor(res, opts)
+	if opts.Strict {
+		if err := jo.strictErr(); err != nil {
+			return err
+		}
+	}
+	return writeSummaryJSON(w, jo, opts.StatsOnly, opts.CompactArrays)
+}
+
+// summaryFor builds the JsonOut of res with all of opts applied.
+func summaryFor(res *Result, opts SummaryOptions) JsonOut {
+	dirStats, userStats, groupStats := res.DirStats, res.UserStats, res.GroupStats
+	if opts.StatsOnly {
+		// the arrays are not written, so do not pay for building them
+		dirStats, userStats, groupStats = nil, nil, nil
+	}
+	spilled := res.spill != nil && !opts.StatsOnly
+	if spilled {
+		// res.DirStats only holds the shallow directories; stream them all
+		dirStats = nil
+	}
+	if opts.MaxDepth > 0 && dirStats != nil {
+		shallow := make(map[string]*DirStat)
+		for rel, ds := range dirStats {
+			if relDepth(rel) <= opts.MaxDepth {
+				shallow[rel] = ds
+			}
+		}
+		dirStats = shallow
+	}
+	userStats = aboveMinSize(userStats, func(us *UserStat) int64 { return us.Size }, opts.MinUserSize)
+	groupStats = aboveMinSize(groupStats, func(gs *GroupStat) int64 { return gs.Size }, opts.MinGroupSize)
+	// a loaded summary's paths need not exist here; its directories keep
+	// the owners it recorded
+	jo := buildSummary(res.Root, dirStats, userStats, groupStats, inZone(res.StartedAt, opts.Location), inZone(res.EndedAt, opts.Location), res.MemStart, res.DirsScanned, res.FilesScanned, opts.Version, opts.Numeric, opts.SkipDirOwner || res.loaded)
+	if res.loaded && !opts.SkipDirOwner {
+		for i, d := range jo.Dirs {
+			if ds := dirStats[d.Rel]; ds != nil {
+				jo.Dirs[i].UID, jo.Dirs[i].GID = ds.UID, ds.GID
+			}
+			if !opts.Numeric {
+				jo.Dirs[i].User, jo.Dirs[i].Group = res.DirOwners[d.Rel], res.DirGroups[d.Rel]
+			}
+		}
+	}
+	if spilled {
+		jo.dirStream = spilledDirs(res, opts)
+	}
+	if !opts.StatsOnly {
+		jo.RootTotal = rootTotal(res)
+	}
+	jo.Stats.Incomplete = res.Incomplete
+	jo.Stats.InProgress = opts.InProgress
+	jo.Stats.BlockSize = res.BlockSize
+	jo.Stats.BindDedupFiles = res.BindDupFiles
+	jo.Stats.BindDedupBytes = res.BindDupBytes
+	jo.Stats.FileMinSize = res.FileMinSize
+	jo.Stats.FileMaxSize = res.FileMaxSize
+	jo.Stats.SizeFilteredFiles = res.SizeFilteredFiles
+	jo.Stats.StatFailedFiles = res.StatFailedFiles
+	jo.Stats.MinUserSize = max(opts.MinUserSize, res.minUserSize)
+	jo.Stats.MinGroupSize = max(opts.MinGroupSize, res.minGroupSize)
+	jo.Stats.Hostname = res.Hostname
+	jo.Stats.SnapshotName = res.SnapshotName
+	jo.Stats.Sources = res.Sources
+	jo.Stats.Hidden = res.Hidden
+	if !res.ChangedSince.IsZero() {
+		jo.Stats.ChangedSince = inZone(res.ChangedSince, opts.Location).Format(time.RFC3339)
+		jo.Stats.CtimeFilteredFiles = res.CtimeFilteredFiles
+	}
+	if !res.ModifiedBefore.IsZero() {
+		jo.Stats.ModifiedBefore = inZone(res.ModifiedBefore, opts.Location).Format(time.RFC3339Nano)
+		jo.Stats.MtimeFilteredFiles = res.MtimeFilteredFiles
+	}
+	if policy := opts.UnknownOwner; policy != "" && !opts.Numeric && !opts.SkipDirOwner {
+		// only where the scan recorded the owner; others failed to stat
+		for i, d := range jo.Dirs {
+			if ds := dirStats[d.Rel]; ds != nil && ds.HasOwner {
+				if d.User == "" {
+					jo.Dirs[i].User = unknownOwnerName(policy, "uid", d.UID)
+				}
+				if d.Group == "" {
+					jo.Dirs[i].Group = unknownOwnerName(policy, "gid", d.GID)
+				}
+			}
+		}
+	}
+	if opts.OmitEmpty {
+		kept := jo.Dirs[:0]
+		for _, d := range jo.Dirs {
+			if d.Size != 0 || d.Files != 0 {
+				kept = append(kept, d)
+			}
+		}
+		jo.Dirs = kept
+	}
+	if opts.AvgFileSize {
+		for i := range jo.Dirs {
+			jo.Dirs[i].AvgFileSize, _ = avgFileSize(jo.Dirs[i].Size, jo.Dirs[i].Files)
+		}
+	}
+	if opts.TreeOrder && len(jo.Dirs) > 0 {
+		ranks := treeRanks(res.DirStats)
+		for i := range jo.Dirs {
+			jo.Dirs[i].Rank = ranks[jo.Dirs[i].Rel]
+		}
+	}
+	if opts.OwnerBreakdown && res.DirUsers != nil {
+		for i := range jo.Dirs {
+			jo.Dirs[i].Owners = ownerShares(res.DirUsers[jo.Dirs[i].Rel])
+		}
+	}
+	if res.DirFiles != nil && !opts.StatsOnly {
+		jo.Stats.FileLists = true
+		for i := range jo.Dirs {
+			jo.Dirs[i].FileList = res.DirFiles[jo.Dirs[i].Rel]
+		}
+	}
+	if res.ThrottleRate > 0 {
+		jo.Stats.ThrottleFilesPerSec = res.ThrottleRate
+		if secs := res.EndedAt.Sub(res.StartedAt).Seconds(); secs > 0 {
+			jo.Stats.EffectiveFilesPerSec = float64(res.FilesScanned) / secs
+		}
+	}
+	if res.Newest != nil {
+		jo.Newest = jsonFiles(res.Newest.Sorted(), opts.Location)
+	}
+	if res.Oldest != nil {
+		jo.Oldest = jsonFiles(res.Oldest.Sorted(), opts.Location)
+	}
+	if res.Duplicates != nil {
+		jo.Duplicates = jsonDuplicates(res.Duplicates)
+	}
+	jo.ExtByUser = res.ExtByUser
+	if res.Devices != nil {
+		jo.Devices = jsonDevices(res.Devices)
+	}
+	if opts.Concentration && !opts.StatsOnly {
+		c := userConcentration(res.UserStats)
+		jo.Concentration = &c
+	}
+	if res.FS != nil {
+		jo.Stats.FSTotalBytes = res.FS.Total
+		jo.Stats.FSFreeBytes = res.FS.Free
+		jo.Stats.FSUsedBytes = res.FS.Used
+	}
+	if opts.ProfileLookups {
+		ls := lookupStats()
+		jo.Stats.LookupCalls = ls.Calls
+		jo.Stats.LookupCacheHits = ls.CacheHits
+		jo.Stats.LookupCacheMisses = ls.CacheMisses
+		jo.Stats.LookupSeconds = ls.Duration.Seconds()
+	}
+	if opts.NormalizePaths {
+		normalizeSummaryPaths(&jo)
+	}
+	if opts.RootLabel != "" {
+		jo.Root = opts.RootLabel
+	}
+
+	return jo
+}
+
+// treeRanks returns the 1-based position of every directory among its
+// siblings in printTree's default order, by size; the root has rank 1.
+func treeRanks(dirStats map[string]*DirStat) map[string]int {
+	children, dirSizes := buildChildrenAndSizes(dirStats)
+	sortChildren(children, dirSizes, sortSize)
+	ranks := map[string]int{".": 1}
+	for _, kids := range children {
+		for i, k := range kids {
+			ranks[k] = i + 1
+		}
+	}
+	return ranks
+}
+
+// writeSummaryJSON writes jo in json.MarshalIndent's layout, encoding the array
+// entries one at a time. With statsOnly only root and stats are written; with
+// compact every array entry is written on a single line.
+func writeSummaryJSON(w io.Writer, jo JsonOut, statsOnly, compact bool) error {
+	bw := bufio.NewWriter(w)
+	rootB, err := json.Marshal(jo.Root)
+	if err != nil {
+		return fmt.Errorf("marshal root: %w", err)
+	}
+	statsB, err := json.MarshalIndent(jo.Stats, "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal stats: %w", err)
+	}
+	_, _ = fmt.Fprintf(bw, "{\n  \"root\": %s,\n  \"stats\": %s", rootB, statsB)
+	if jo.RootTotal != nil {
+		totalB, err := json.MarshalIndent(jo.RootTotal, "  ", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal root_total: %w", err)
+		}
+		_, _ = fmt.Fprintf(bw, ",\n  \"root_total\": %s", totalB)
+	}
+	if statsOnly {
+		_, _ = bw.WriteString("\n}\n")
+		return bw.Flush()
+	}
+	_, _ = bw.WriteString(",\n")
+
+	// the always-present arrays, then the optional (omitempty) ones
+	members := []func(last bool) error{
+		func(last bool) error {
+			if jo.dirStream != nil {
+				return streamDirs(bw, jo.dirStream, last, compact)
+			}
+			return streamArray(bw, "dirs", jo.Dirs, last, compact)
+		},
+		func(last bool) error { return streamArray(bw, "users", jo.Users, last, compact) },
+		func(last bool) error { return streamArray(bw, "groups", jo.Grps, last, compact) },
+	}
+	if jo.Concentration != nil {
+		members = append(members, func(last bool) error { return writeMember(bw, "concentration", jo.Concentration, last) })
+	}
+	if jo.Newest != nil {
+		members = append(members, func(last bool) error { return streamArray(bw, "newest_files", jo.Newest, last, compact) })
+	}
+	if jo.Oldest != nil {
+		members = append(members, func(last bool) error { return streamArray(bw, "oldest_files", jo.Oldest, last, compact) })
+	}
+	if jo.Duplicates != nil {
+		members = append(members, func(last bool) error { return writeMember(bw, "duplicates", jo.Duplicates, last) })
+	}
+	if jo.Devices != nil {
+		members = append(members, func(last bool) error { return streamArray(bw, "devices", jo.Devices, last, compact) })
+	}
+	if jo.ExtByUser != nil {
+		members = append(members, func(last bool) error { return writeMember(bw, "ext_by_user", jo.ExtByUser, last) })
+	}
+	if jo.Chunks != nil {
+		members = append(members, func(last bool) error { return streamArray(bw, "chunks", jo.Chunks, last, compact) })
+	}
+	for i, m := range members {
+		if err := m(i == len(members)-1); err != nil {
+			return err
+		}
+	}
+	_, _ = bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// normalizeSummaryPaths rewrites every path of jo in Unicode NFC.
+func normalizeSummaryPaths(jo *JsonOut) {
+	jo.Root = normalizePath(jo.Root)
+	for i := range jo.Dirs {
+		jo.Dirs[i].Path = normalizePath(jo.Dirs[i].Path)
+		jo.Dirs[i].Rel = normalizePath(jo.Dirs[i].Rel)
+		if files := jo.Dirs[i].FileList; files != nil {
+			// the list is shared with the result; rewrite a copy
+			jo.Dirs[i].FileList = make([]JsonDirFile, len(files))
+			for j, f := range files {
+				jo.Dirs[i].FileList[j] = JsonDirFile{Name: normalizePath(f.Name), Size: f.Size}
+			}
+		}
+	}
+	for _, files := range [][]JsonFile{jo.Newest, jo.Oldest} {
+		for i := range files {
+			files[i].Path = normalizePath(files[i].Path)
+		}
+	}
+}
+
+// jsonDuplicates converts -dupes results to their JSON form.
+func jsonDuplicates(d *Duplicates) *JsonDuplicates {
+	out := &JsonDuplicates{Algorithm: d.Algorithm, Groups: make([]JsonDupGroup, 0, len(d.Groups))}
+	for _, g := range d.Groups {
+		out.Groups = append(out.Groups, JsonDupGroup{Size: g.Size, Hash: g.Hash, Paths: g.Paths})
+	}
+	return out
+}
+
+// jsonFiles converts a file ranking to its JSON form (never nil, so a requested
+// but empty listing is still written), with the times in loc (nil = as they are).
+func jsonFiles(files []FileEntry, loc *time.Location) []JsonFile {
+	out := make([]JsonFile, 0, len(files))
+	for _, f := range files {
+		out = append(out, JsonFile{Path: f.Path, Size: f.Size, MTime: inZone(f.ModTime, loc).Format(time.RFC3339)})
+	}
+	return out
+}
+
+// topFilesFromJSON rebuilds a file ranking from a loaded listing; it returns
+// nil when the listing is absent.
+func topFilesFromJSON(files []JsonFile, better func(a, b FileEntry) bool) *TopFiles {
+	if files == nil {
+		return nil
+	}
+	t := NewTopFiles(len(files), better)
+	for _, f := range files {
+		mt, _ := time.Parse(time.RFC3339, f.MTime)
+		t.Add(FileEntry{Path: f.Path, Size: f.Size, ModTime: mt})
+	}
+	return t
+}
+
+// ownerShares converts one directory's per-user totals to the JSON owners map,
+// keyed by display name. Users sharing a name are summed under that name.
+func ownerShares(byUser map[string]*UserStat) map[string]JsonOwnerShare {
+	if len(byUser) == 0 {
+		return nil
+	}
+	out := make(map[string]JsonOwnerShare, len(byUser))
+	for k, us := range byUser {
+		name := displayName(us.Name, k)
+		sh := out[name]
+		sh.Size += us.Size
+		sh.Files += us.Files
+		sh.UID = us.UID
+		out[name] = sh
+	}
+	return out
+}
+
+// snapshotWriter returns a Scan snapshot callback that atomically replaces path
+// with the partial summary, marked as in progress and compressed with c (nil =
+// uncompressed). Write errors are logged so a failing snapshot never aborts the scan.
+func snapshotWriter(path string, opts SummaryOptions, c *compressor) func(*Result) {
+	opts.InProgress = true
+	return func(snap *Result) {
+		if err := writeFileAtomic(path, compressWrite(c, func(w io.Writer) error { return StreamSummary(w, snap, opts) })); err != nil {
+			log.Printf("failed to write json snapshot: %v", err)
+		}
+	}
+}
+
+// writeMember writes one `"name": value` member of the top-level object with
+// value indented like json.MarshalIndent would.
+func writeMember(bw *bufio.Writer, name string, v any, last bool) error {
+	b, err := json.MarshalIndent(v, "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", name, err)
+	}
+	_, _ = fmt.Fprintf(bw, "  %q: ", name)
+	_, _ = bw.Write(b)
+	if !last {
+		_ = bw.WriteByte(',')
+	}
+	return bw.WriteByte('\n')
+}
+
+// marshalEntry encodes one array entry of the top-level object: indented to
+// its nesting depth, or on a single line when compact.
+func marshalEntry(v any, compact bool) ([]byte, error) {
+	if compact {
+		return json.Marshal(v)
+	}
+	return json.MarshalIndent(v, "    ", "  ")
+}
+
+// streamArray writes one `"name": [...]` member of the top-level object, matching
+// json.MarshalIndent's layout (a nil slice is written as null); compact puts
+// each entry on one line.
+func streamArray[T any](bw *bufio.Writer, name string, items []T, last, compact bool) error {
+	_, _ = fmt.Fprintf(bw, "  %q: ", name)
+	switch {
+	case items == nil:
+		_, _ = bw.WriteString("null")
+	case len(items) == 0:
+		_, _ = bw.WriteString("[]")
+	default:
+		_, _ = bw.WriteString("[\n")
+		for i, it := range items {
+			b, err := marshalEntry(it, compact)
+			if err != nil {
+				return fmt.Errorf("marshal %s entry: %w", name, err)
+			}
+			_, _ = bw.WriteString("    ")
+			_, _ = bw.Write(b)
+			if i < len(items)-1 {
+				_ = bw.WriteByte(',')
+			}
+			_ = bw.WriteByte('\n')
+		}
+		_, _ = bw.WriteString("  ]")
+	}
+	if !last {
+		_ = bw.WriteByte(',')
+	}
+	return bw.WriteByte('\n')
+}
+
+// writeFileAtomic writes path through a temporary file in the same directory
+// that is renamed into place once fn succeeds, so readers never observe a
+// partially written file. The temporary file is removed on failure.
+func writeFileAtomic(path string, fn func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if err := fn(tmp); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, 0644); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// dirLstat stats the directories buildSummary needs the owner of; tests
+// replace it to count the calls.
+var dirLstat = os.Lstat
+
+// buildSummary assembles the JsonOut for the given stats maps, resolving owners of each directory.
+func buildSummary(rootAbs string, dirStats map[string]*DirStat, userStats map[string]*UserStat, groupStats map[string]*GroupStat, startedAt, endedAt time.Time, msStart runtime.MemStats, dirsScanned, filesScanned int64, version string, numeric, skipDirOwner bool) JsonOut {
 	// collect memory stats
 	var ms runtime.MemStats
 	runtime.ReadMemStats(&ms)
@@ -83,7 +732,8 @@ func MarshalSummary(rootAbs string, dirStats map[string]*DirStat, userStats map[
 	// format last GC
 	lastGC := ""
 	if ms.LastGC != 0 {
-		lastGC = time.Unix(0, int64(ms.LastGC)).Format(time.RFC3339)
+		// in the zone the caller chose for startedAt
+		lastGC = time.Unix(0, int64(ms.LastGC)).In(startedAt.Location()).Format(time.RFC3339)
 	}
 
 	// compute last and max pause
@@ -145,77 +795,140 @@ func MarshalSummary(rootAbs string, dirStats map[string]*DirStat, userStats map[
 		},
 	}
 
-	// collect directories (attempt to stat to get uid/gid)
+	// collect directories; scans recorded each directory's owner, other
+	// sources are statted here. Names are looked up once per id.
+	unames := make(map[uint32]string)
+	gnames := make(map[uint32]string)
 	for rel, ds := range dirStats {
 		abs := rootAbs
 		if rel != "." {
 			abs = filepath.Join(rootAbs, rel)
 		}
-		var uid uint32
-		var gid uint32
+		if skipDirOwner {
+			jo.Dirs = append(jo.Dirs, JsonDir{Path: abs, Rel: rel, Size: ds.Size, Files: ds.Files})
+			continue
+		}
+		uid, gid, known := ds.UID, ds.GID, ds.HasOwner
+		if !known {
+			if info, err := dirLstat(abs); err != nil {
+				jo.problems = append(jo.problems, err.Error())
+			} else if st, ok := info.Sys().(*syscall.Stat_t); ok {
+				uid, gid, known = st.Uid, st.Gid, true
+			}
+		}
 		var uname, gname string
-		if info, err := os.Lstat(abs); err == nil {
-			if st, ok := info.Sys().(*syscall.Stat_t); ok {
-				uid = st.Uid
-				gid = st.Gid
-				uidStr := strconv.FormatUint(uint64(uid), 10)
-				gidStr := strconv.FormatUint(uint64(gid), 10)
-				if uEnt, err := user.LookupId(uidStr); err == nil {
-					uname = uEnt.Username
-				}
-				if gEnt, err := user.LookupGroupId(gidStr); err == nil {
-					gname = gEnt.Name
-				}
+		if known && !numeric {
+			uname = cachedName(unames, uid, lookupUserName)
+			gname = cachedName(gnames, gid, lookupGroupName)
+			if uname == "" {
+				jo.problems = append(jo.problems, fmt.Sprintf("%s: unknown uid %d", abs, uid))
+			}
+			if gname == "" {
+				jo.problems = append(jo.problems, fmt.Sprintf("%s: unknown gid %d", abs, gid))
 			}
 		}
 		jo.Dirs = append(jo.Dirs, JsonDir{Path: abs, Rel: rel, Size: ds.Size, Files: ds.Files, UID: uid, User: uname, GID: gid, Group: gname})
 	}
 
-	// collect users
+	// collect users; scans carry the uid captured from the files and the
+	// resolved name, which are emitted as is. Only other sources (hand-built
+	// or name-keyed stats) are resolved from the key.
 	for u, us := range userStats {
-		resolvedName := u
-		var uidNum uint32
-		if ent, err := user.Lookup(u); err == nil {
-			resolvedName = ent.Username
-			if v, err := strconv.ParseUint(ent.Uid, 10, 32); err == nil {
-				uidNum = uint32(v)
-			}
-		} else if ent, err := user.LookupId(u); err == nil {
-			resolvedName = ent.Username
-			if v, err := strconv.ParseUint(ent.Uid, 10, 32); err == nil {
+		resolvedName := us.Name
+		uidNum := us.UID
+		if numeric || (resolvedName == "" && us.HasID) {
+			resolvedName = u
+		} else if resolvedName == "" {
+			resolvedName = u
+			if ent, err := lookupUser(u); err == nil {
+				resolvedName = ent.Username
+				if v, err := strconv.ParseUint(ent.Uid, 10, 32); err == nil {
+					uidNum = uint32(v)
+				}
+			} else if ent, err := lookupUserID(u); err == nil {
+				resolvedName = ent.Username
+				if v, err := strconv.ParseUint(ent.Uid, 10, 32); err == nil {
+					uidNum = uint32(v)
+				}
+			} else if v, err := strconv.ParseUint(u, 10, 32); err == nil {
 				uidNum = uint32(v)
 			}
-		} else if v, err := strconv.ParseUint(u, 10, 32); err == nil {
-			uidNum = uint32(v)
 		}
-		jo.Users = append(jo.Users, JsonUser{Name: resolvedName, Size: us.Size, Files: us.Files, UID: uidNum})
+		if !numeric && u != othersKey && unresolvedName(resolvedName, "uid", uidNum) {
+			jo.problems = append(jo.problems, fmt.Sprintf("user %s: unknown uid", u))
+		}
+		jo.Users = append(jo.Users, JsonUser{Name: resolvedName, Size: us.Size, Files: us.Files, Dirs: us.Dirs, UID: uidNum})
 	}
 
 	// collect groups
 	for g, gs := range groupStats {
-		resolved := g
-		var gidNum uint32
-		if ent, err := user.LookupGroup(g); err == nil {
-			resolved = ent.Name
-			if v, err := strconv.ParseUint(ent.Gid, 10, 32); err == nil {
-				gidNum = uint32(v)
-			}
-		} else if ent, err := user.LookupGroupId(g); err == nil {
-			resolved = ent.Name
-			if v, err := strconv.ParseUint(ent.Gid, 10, 32); err == nil {
+		resolved := gs.Name
+		gidNum := gs.GID
+		if numeric || (resolved == "" && gs.HasID) {
+			resolved = g
+		} else if resolved == "" {
+			resolved = g
+			if ent, err := lookupGroup(g); err == nil {
+				resolved = ent.Name
+				if v, err := strconv.ParseUint(ent.Gid, 10, 32); err == nil {
+					gidNum = uint32(v)
+				}
+			} else if ent, err := lookupGroupID(g); err == nil {
+				resolved = ent.Name
+				if v, err := strconv.ParseUint(ent.Gid, 10, 32); err == nil {
+					gidNum = uint32(v)
+				}
+			} else if v, err := strconv.ParseUint(g, 10, 32); err == nil {
 				gidNum = uint32(v)
 			}
-		} else if v, err := strconv.ParseUint(g, 10, 32); err == nil {
-			gidNum = uint32(v)
 		}
-		jo.Grps = append(jo.Grps, JsonGroup{Name: resolved, Size: gs.Size, Files: gs.Files, GID: gidNum})
+		if !numeric && g != othersKey && unresolvedName(resolved, "gid", gidNum) {
+			jo.problems = append(jo.problems, fmt.Sprintf("group %s: unknown gid", g))
+		}
+		jo.Grps = append(jo.Grps, JsonGroup{Name: resolved, Size: gs.Size, Files: gs.Files, Dirs: gs.Dirs, GID: gidNum})
 	}
 
 	// deterministic ordering
-	sort.Slice(jo.Dirs, func(i, j int) bool { return jo.Dirs[i].Path < jo.Dirs[j].Path })
-	sort.Slice(jo.Users, func(i, j int) bool { return jo.Users[i].Name < jo.Users[j].Name })
-	sort.Slice(jo.Grps, func(i, j int) bool { return jo.Grps[i].Name < jo.Grps[j].Name })
+	sortDirs(jo.Dirs)
+	sort.Slice(jo.Users, func(i, j int) bool {
+		if jo.Users[i].Name == jo.Users[j].Name {
+			return jo.Users[i].UID < jo.Users[j].UID
+		}
+		return jo.Users[i].Name < jo.Users[j].Name
+	})
+	sort.Slice(jo.Grps, func(i, j int) bool {
+		if jo.Grps[i].Name == jo.Grps[j].Name {
+			return jo.Grps[i].GID < jo.Grps[j].GID
+		}
+		return jo.Grps[i].Name < jo.Grps[j].Name
+	})
+
+	return jo
+}
 
+// sortDirs puts dirs entries in a total order: by rel, the root first and
+// the rest byte-wise (as spillLess), then by path. All entries of a summary
+// hang from its one root, so for a scan this is the order of their absolute
+// paths; unlike ordering by path alone it also holds when paths are empty
+// or repeat, as in merged snapshots of different roots, so two exports of
+// the same data diff line by line.
+func sortDirs(dirs []JsonDir) {
+	rel := func(d JsonDir) string {
+		if d.Rel == "" {
+			return "."
+		}
+		return d.Rel
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		a, b := rel(dirs[i]), rel(dirs[j])
+		if a != b {
+			return spillLess(a, b)
+		}
+		return dirs[i].Path < dirs[j].Path
+	})
+}
+
+func marshalSummary(jo JsonOut) ([]byte, error) {
 	b, err := json.MarshalIndent(jo, "", "  ")
 	if err != nil {
 		return nil, fmt.Errorf("marshal: %w", err)
@@ -223,8 +936,141 @@ func MarshalSummary(rootAbs string, dirStats map[string]*DirStat, userStats map[
 	return b, nil
 }
 
+// resultFromSummary rebuilds a Result from a loaded summary so it can be
+// rendered by any formatter. Directory owners are taken from the summary
+// instead of being looked up on disk.
+func resultFromSummary(jo JsonOut) *Result {
+	res := &Result{
+		Root:               ".",
+		DirStats:           make(map[string]*DirStat, len(jo.Dirs)),
+		UserStats:          make(map[string]*UserStat, len(jo.Users)),
+		GroupStats:         make(map[string]*GroupStat, len(jo.Grps)),
+		DirOwners:          make(map[string]string, len(jo.Dirs)),
+		DirGroups:          make(map[string]string, len(jo.Dirs)),
+		DirsScanned:        jo.Stats.DirsScanned,
+		FilesScanned:       jo.Stats.FilesScanned,
+		Incomplete:         jo.Stats.Incomplete,
+		BlockSize:          jo.Stats.BlockSize,
+		BindDupFiles:       jo.Stats.BindDedupFiles,
+		BindDupBytes:       jo.Stats.BindDedupBytes,
+		FileMinSize:        jo.Stats.FileMinSize,
+		FileMaxSize:        jo.Stats.FileMaxSize,
+		SizeFilteredFiles:  jo.Stats.SizeFilteredFiles,
+		CtimeFilteredFiles: jo.Stats.CtimeFilteredFiles,
+		MtimeFilteredFiles: jo.Stats.MtimeFilteredFiles,
+		StatFailedFiles:    jo.Stats.StatFailedFiles,
+		Hostname:           jo.Stats.Hostname,
+		SnapshotName:       jo.Stats.SnapshotName,
+		Sources:            jo.Stats.Sources,
+		Hidden:             jo.Stats.Hidden,
+		loaded:             true,
+		minUserSize:        jo.Stats.MinUserSize,
+		minGroupSize:       jo.Stats.MinGroupSize,
+	}
+	if t, err := time.Parse(time.RFC3339, jo.Stats.ChangedSince); err == nil {
+		res.ChangedSince = t
+	}
+	if t, err := time.Parse(time.RFC3339Nano, jo.Stats.ModifiedBefore); err == nil {
+		res.ModifiedBefore = t
+	}
+	if jo.Root != "" {
+		res.Root = filepath.Clean(jo.Root)
+	}
+	if t, err := time.Parse(time.RFC3339, jo.Stats.StartedAt); err == nil {
+		res.StartedAt = t
+	}
+	if t, err := time.Parse(time.RFC3339, jo.Stats.EndedAt); err == nil {
+		res.EndedAt = t
+	}
+	if jo.Stats.FileLists {
+		res.DirFiles = make(map[string][]JsonDirFile, len(jo.Dirs))
+	}
+	for _, d := range jo.Dirs {
+		rel := d.Rel
+		if rel == "" {
+			rel = "."
+		}
+		// the ids are kept for writing the summary again, but not marked
+		// HasOwner: the names come from DirOwners, not from this host
+		res.DirStats[rel] = &DirStat{Size: d.Size, Files: d.Files, UID: d.UID, GID: d.GID}
+		if res.DirFiles != nil && len(d.FileList) > 0 {
+			res.DirFiles[rel] = d.FileList
+		}
+		res.DirOwners[rel] = d.User
+		res.DirGroups[rel] = d.Group
+		if len(d.Owners) > 0 {
+			if res.DirUsers == nil {
+				res.DirUsers = make(map[string]map[string]*UserStat)
+			}
+			byUser := make(map[string]*UserStat, len(d.Owners))
+			for name, sh := range d.Owners {
+				byUser[summaryOwnerKey(name, sh.UID)] = &UserStat{Size: sh.Size, Files: sh.Files, UID: sh.UID, Name: name}
+			}
+			res.DirUsers[rel] = byUser
+		}
+	}
+	// recreate intermediate directories missing from the summary (e.g. omitted
+	// as empty) as zero-size entries so every directory has a parent to hang from
+	for rel := range res.DirStats {
+		for p := rel; p != "."; {
+			p = filepath.Dir(p)
+			if _, ok := res.DirStats[p]; ok {
+				break
+			}
+			res.DirStats[p] = &DirStat{}
+		}
+	}
+	res.ExtByUser = jo.ExtByUser
+	if jo.Devices != nil {
+		res.Devices = make(map[string]*DeviceStat, len(jo.Devices))
+		for _, d := range jo.Devices {
+			res.Devices[d.Dev] = &DeviceStat{Size: d.Size, Files: d.Files, Mount: d.Mount, FSType: d.FSType}
+		}
+	}
+	if jo.Duplicates != nil {
+		res.Duplicates = &Duplicates{Algorithm: jo.Duplicates.Algorithm}
+		for _, g := range jo.Duplicates.Groups {
+			res.Duplicates.Groups = append(res.Duplicates.Groups, DupGroup{Size: g.Size, Hash: g.Hash, Paths: g.Paths})
+		}
+	}
+	res.Newest = topFilesFromJSON(jo.Newest, newestFirst)
+	res.Oldest = topFilesFromJSON(jo.Oldest, oldestFirst)
+	for _, u := range jo.Users {
+		res.UserStats[summaryOwnerKey(u.Name, u.UID)] = &UserStat{Size: u.Size, Files: u.Files, Dirs: u.Dirs, UID: u.UID, Name: u.Name}
+	}
+	for _, g := range jo.Grps {
+		res.GroupStats[summaryOwnerKey(g.Name, g.GID)] = &GroupStat{Size: g.Size, Files: g.Files, Dirs: g.Dirs, GID: g.GID, Name: g.Name}
+	}
+	return res
+}
+
+// summaryOwnerKey keys a loaded user/group like a scan does (by numeric id)
+// when the summary carries one. Id 0 is indistinguishable from a missing id
+// (the field is omitempty), so those entries are keyed by name in a separate
+// "name:" namespace that cannot collide with numeric keys.
+func summaryOwnerKey(name string, id uint32) string {
+	if id != 0 {
+		return strconv.FormatUint(uint64(id), 10)
+	}
+	return "name:" + name
+}
+
 // LoadSummary reads JSON summary from path (use "-" for stdin) and returns the parsed JsonOut.
+// Compressed input (gzip, or zstd when built with -tags zstd) is detected by its
+// magic bytes and decompressed transparently, and the chunk files listed by a
+// chunked summary's manifest are read back into Dirs.
 func LoadSummary(path string) (JsonOut, error) {
+	return loadSummary(path, false)
+}
+
+// LoadSummaryStrict is LoadSummary for -strict-load: it fails on fields a
+// summary does not have and on a summary without root or stats, where
+// LoadSummary ignores the former and leaves the latter zero.
+func LoadSummaryStrict(path string) (JsonOut, error) {
+	return loadSummary(path, true)
+}
+
+func loadSummary(path string, strict bool) (JsonOut, error) {
 	var jo JsonOut
 	var jb []byte
 	var err error
@@ -239,8 +1085,39 @@ func LoadSummary(path string) (JsonOut, error) {
 			return jo, err
 		}
 	}
-	if err := json.Unmarshal(jb, &jo); err != nil {
+	jb, err = decompress(jb)
+	if err != nil {
+		return jo, err
+	}
+	if jo, err = parseSummary(jb, strict); err != nil {
 		return jo, err
 	}
+	if len(jo.Chunks) > 0 {
+		dir := "."
+		if path != "-" {
+			dir = filepath.Dir(path)
+		}
+		if err := loadChunks(&jo, dir, strict); err != nil {
+			return jo, err
+		}
+	}
 	return jo, nil
 }
+
+// LoadSummaries loads every path with LoadSummary (LoadSummaryStrict when
+// strict) and merges them with MergeSummaries. Stats-only summaries have no
+// tree to merge and are rejected.
+func LoadSummaries(paths []string, strict bool) (JsonOut, error) {
+	jos := make([]JsonOut, 0, len(paths))
+	for _, p := range paths {
+		jo, err := loadSummary(p, strict)
+		if err == nil && jo.statsOnly() {
+			err = errStatsOnly
+		}
+		if err != nil {
+			return JsonOut{}, fmt.Errorf("%s: %w", p, err)
+		}
+		jos = append(jos, jo)
+	}
+	return MergeSummaries(jos), nil
+}
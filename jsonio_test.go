@@ -1,10 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -128,3 +134,690 @@ func TestLoadSummaryFileAndStdin(t *testing.T) {
 		t.Fatalf("loaded stdin fixture mismatch: %+v", jo2)
 	}
 }
+
+func TestStreamSummaryMatchesMarshal(t *testing.T) {
+	root := t.TempDir()
+	res := &Result{
+		Root:       root,
+		DirStats:   map[string]*DirStat{".": {Size: 30, Files: 2}, "a": {Size: 20, Files: 1}},
+		UserStats:  map[string]*UserStat{"u": {Size: 30, Files: 2}},
+		GroupStats: map[string]*GroupStat{},
+		StartedAt:  time.Unix(0, 0),
+		EndedAt:    time.Unix(1, 0),
+	}
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{Version: "v"}); err != nil {
+		t.Fatalf("StreamSummary error: %v", err)
+	}
+	var streamed, marshalled JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &streamed); err != nil {
+		t.Fatalf("unmarshal streamed: %v\n%s", err, buf.String())
+	}
+	b, err := MarshalSummary(res.Root, res.DirStats, res.UserStats, res.GroupStats, res.StartedAt, res.EndedAt, res.MemStart, 0, 0, "v")
+	if err != nil {
+		t.Fatalf("MarshalSummary error: %v", err)
+	}
+	if err := json.Unmarshal(b, &marshalled); err != nil {
+		t.Fatalf("unmarshal marshalled: %v", err)
+	}
+	if len(streamed.Dirs) != 2 || streamed.Grps != nil || len(streamed.Users) != 1 {
+		t.Fatalf("unexpected streamed shape: %+v", streamed)
+	}
+	if !reflect.DeepEqual(streamed.Dirs, marshalled.Dirs) || streamed.Root != marshalled.Root {
+		t.Fatalf("streamed and marshalled summaries differ:\n%+v\n%+v", streamed, marshalled)
+	}
+	// the array layout matches MarshalIndent's (ignoring the memory stats, which differ between calls)
+	if !bytes.Contains(buf.Bytes(), []byte("  \"groups\": null\n}\n")) {
+		t.Fatalf("unexpected tail:\n%s", buf.String())
+	}
+}
+
+func TestScanJSONSnapshots(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 50; i++ {
+		writeFile(t, filepath.Join(root, "d", strconv.Itoa(i)), 10)
+	}
+	out := filepath.Join(t.TempDir(), "out.json")
+
+	write := snapshotWriter(out, SummaryOptions{Version: "v"}, nil)
+	var snapshots int
+	var sawInProgress bool
+	res := Scan(context.Background(), root, ScanOptions{
+		Concurrency:      2,
+		SnapshotInterval: time.Millisecond,
+		OnSnapshot: func(snap *Result) {
+			write(snap)
+			snapshots++
+			if jo, err := LoadSummary(out); err == nil && jo.Stats.InProgress {
+				sawInProgress = true
+			}
+		},
+	})
+	if snapshots < 1 || !sawInProgress {
+		t.Fatalf("expected at least one in-progress snapshot, got %d (in_progress seen: %v)", snapshots, sawInProgress)
+	}
+
+	if err := writeFileAtomic(out, func(w io.Writer) error { return StreamSummary(w, res, SummaryOptions{Version: "v"}) }); err != nil {
+		t.Fatalf("final write: %v", err)
+	}
+	jo, err := LoadSummary(out)
+	if err != nil {
+		t.Fatalf("load final: %v", err)
+	}
+	if jo.Stats.InProgress {
+		t.Fatalf("final summary must clear in_progress")
+	}
+	if jo.Stats.FilesScanned != 50 {
+		t.Fatalf("final summary files_scanned = %d; want 50", jo.Stats.FilesScanned)
+	}
+	// no temporary files left behind
+	entries, _ := os.ReadDir(filepath.Dir(out))
+	if len(entries) != 1 {
+		t.Fatalf("expected only the target file, got %d entries", len(entries))
+	}
+}
+
+func TestStreamSummaryOmitEmpty(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "full", "f"), 10)
+	if err := os.MkdirAll(filepath.Join(root, "empty", "nested"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 1})
+	if _, ok := res.DirStats["empty/nested"]; !ok {
+		t.Fatalf("scan should record empty directories, got %v", res.DirStats)
+	}
+
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{OmitEmpty: true}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	rels := map[string]bool{}
+	for _, d := range jo.Dirs {
+		rels[d.Rel] = true
+	}
+	if rels["empty"] || rels["empty/nested"] {
+		t.Fatalf("empty directories should be omitted, got %v", rels)
+	}
+	if !rels["."] || !rels["full"] {
+		t.Fatalf("non-empty directories missing, got %v", rels)
+	}
+
+	// rendering the trimmed summary still yields a coherent tree
+	var out bytes.Buffer
+	if err := (TreeFormatter{Opts: TreeOptions{Levels: 2}}).Write(&out, resultFromSummary(jo)); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if !strings.Contains(out.String(), "10B     └── full") || strings.Contains(out.String(), "empty") {
+		t.Fatalf("unexpected tree:\n%s", out.String())
+	}
+}
+
+func TestStreamSummaryMaxDepth(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "b", "c", "deep"), 30)
+	writeFile(t, filepath.Join(root, "a", "top"), 5)
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 1})
+
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{MaxDepth: 2}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	sizes := map[string]int64{}
+	for _, d := range jo.Dirs {
+		sizes[d.Rel] = d.Size
+	}
+	// the depth-3 directory is folded into its depth-2 ancestor
+	want := map[string]int64{".": 35, "a": 35, filepath.Join("a", "b"): 30}
+	if !reflect.DeepEqual(sizes, want) {
+		t.Fatalf("dirs = %v, want %v", sizes, want)
+	}
+	if jo.Stats.FilesScanned != 2 {
+		t.Fatalf("files_scanned = %d, want 2", jo.Stats.FilesScanned)
+	}
+}
+
+func TestResultFromSummaryRecreatesIntermediateDirs(t *testing.T) {
+	jo := JsonOut{Root: "/r", Dirs: []JsonDir{{Rel: ".", Size: 5, Files: 1}, {Rel: "a/b/c", Size: 5, Files: 1}}}
+	res := resultFromSummary(jo)
+	for _, rel := range []string{"a", "a/b"} {
+		if ds, ok := res.DirStats[rel]; !ok || ds.Size != 0 {
+			t.Fatalf("expected zero-size placeholder for %q, got %v", rel, res.DirStats)
+		}
+	}
+	var out bytes.Buffer
+	if err := (TreeFormatter{Opts: TreeOptions{Levels: 3}}).Write(&out, res); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if !strings.Contains(out.String(), "└── c") {
+		t.Fatalf("deep directory not reachable in tree:\n%s", out.String())
+	}
+}
+
+func TestStreamSummaryOwnerBreakdown(t *testing.T) {
+	stubOwnerNames(t, map[uint32]string{1001: "alice", 1002: "bob"}, map[uint32]string{})
+
+	res := newTestResult()
+	res.Root = t.TempDir()
+	res.DirUsers = map[string]map[string]*UserStat{}
+	res.addFile("shared", 700, 1001, 0)
+	res.addFile("shared", 200, 1002, 0)
+	res.addFile("shared", 100, 1002, 0)
+	res.FilesScanned = 3
+
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{OwnerBreakdown: true}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for _, d := range jo.Dirs {
+		var size, files int64
+		for _, sh := range d.Owners {
+			size += sh.Size
+			files += sh.Files
+		}
+		if size != d.Size || files != d.Files {
+			t.Fatalf("owners of %q sum to %d/%d, directory has %d/%d: %v", d.Rel, size, files, d.Size, d.Files, d.Owners)
+		}
+		if d.Rel == "shared" && (d.Owners["alice"].Size != 700 || d.Owners["bob"].Files != 2 || d.Owners["bob"].UID != 1002) {
+			t.Fatalf("unexpected breakdown: %v", d.Owners)
+		}
+	}
+	if vs := VerifySummary(jo); len(vs) != 0 {
+		t.Fatalf("breakdown summary fails verification: %v", vs)
+	}
+
+	// without the option the map is not emitted
+	buf.Reset()
+	if err := StreamSummary(&buf, res, SummaryOptions{}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+	if strings.Contains(buf.String(), "\"owners\"") {
+		t.Fatalf("owners emitted without OwnerBreakdown:\n%s", buf.String())
+	}
+
+	// -read-json keeps the breakdown for -dominant-owner
+	loaded := resultFromSummary(jo)
+	if got := dominantOwner(loaded, "shared"); got != "alice 70%" {
+		t.Fatalf("dominantOwner after reload = %q", got)
+	}
+}
+
+func TestStreamSummaryStatsOnly(t *testing.T) {
+	res := &Result{
+		Root:         "/data",
+		DirStats:     map[string]*DirStat{".": {Size: 30, Files: 2}, "a": {Size: 20, Files: 1}},
+		UserStats:    map[string]*UserStat{"1": {Size: 30, Files: 2, UID: 1, Name: "u"}},
+		GroupStats:   map[string]*GroupStat{"1": {Size: 30, Files: 2, GID: 1, Name: "g"}},
+		DirsScanned:  2,
+		FilesScanned: 2,
+		StartedAt:    time.Unix(0, 0),
+		EndedAt:      time.Unix(3, 0),
+	}
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{Version: "v1", StatsOnly: true}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+		t.Fatalf("unmarshal: %v\n%s", err, buf.String())
+	}
+	if jo.Root != "/data" || jo.Stats.FilesScanned != 2 || jo.Stats.DirsScanned != 2 || jo.Stats.Version != "v1" || jo.Stats.RuntimeSeconds != 3 {
+		t.Fatalf("unexpected stats: %+v", jo)
+	}
+	if jo.Dirs != nil || jo.Users != nil || jo.Grps != nil {
+		t.Fatalf("arrays should be absent: %+v", jo)
+	}
+	for _, key := range []string{`"dirs"`, `"users"`, `"groups"`} {
+		if strings.Contains(buf.String(), key) {
+			t.Fatalf("stats-only output contains %s:\n%s", key, buf.String())
+		}
+	}
+}
+
+func TestSummaryUsesRecordedDirOwners(t *testing.T) {
+	res := &Result{
+		// the root does not exist: owners must come from the scan, not from disk
+		Root: filepath.Join(t.TempDir(), "gone"),
+		DirStats: map[string]*DirStat{
+			".":   {Size: 10, Files: 1, UID: 4242, GID: 4343, HasOwner: true},
+			"sub": {Size: 10, Files: 1, UID: 4242, GID: 4343, HasOwner: true},
+		},
+		UserStats:  map[string]*UserStat{"4242": {Size: 10, Files: 1, UID: 4242, Name: "alice"}},
+		GroupStats: map[string]*GroupStat{"4343": {Size: 10, Files: 1, GID: 4343, Name: "staff"}},
+	}
+	jo := summaryFor(res, SummaryOptions{})
+	for _, d := range jo.Dirs {
+		if d.UID != 4242 || d.GID != 4343 {
+			t.Fatalf("dir %q: uid/gid = %d/%d, want the recorded 4242/4343", d.Rel, d.UID, d.GID)
+		}
+	}
+	if jo.Users[0].Name != "alice" || jo.Grps[0].Name != "staff" {
+		t.Fatalf("names should be kept without -json-numeric: %+v %+v", jo.Users, jo.Grps)
+	}
+
+	jo = summaryFor(res, SummaryOptions{Numeric: true})
+	for _, d := range jo.Dirs {
+		if d.UID != 4242 || d.User != "" || d.Group != "" {
+			t.Fatalf("numeric dir %q should carry ids only: %+v", d.Rel, d)
+		}
+	}
+	if jo.Users[0].Name != "4242" || jo.Users[0].UID != 4242 || jo.Grps[0].Name != "4343" {
+		t.Fatalf("numeric users/groups should be named by id: %+v %+v", jo.Users, jo.Grps)
+	}
+}
+
+// BenchmarkStreamSummary compares exporting a scan whose directory owners
+// were recorded during the walk with re-statting every directory on export.
+func BenchmarkStreamSummary(b *testing.B) {
+	root := b.TempDir()
+	for i := 0; i < 500; i++ {
+		if err := os.MkdirAll(filepath.Join(root, strconv.Itoa(i/25), strconv.Itoa(i)), 0755); err != nil {
+			b.Fatal(err)
+		}
+	}
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 4})
+	unrecorded := *res
+	unrecorded.DirStats = make(map[string]*DirStat, len(res.DirStats))
+	for k, v := range res.DirStats {
+		unrecorded.DirStats[k] = &DirStat{Size: v.Size, Files: v.Files}
+	}
+	for _, bc := range []struct {
+		name string
+		res  *Result
+		opts SummaryOptions
+	}{
+		{"recorded", res, SummaryOptions{}},
+		{"restat", &unrecorded, SummaryOptions{}},
+		{"numeric", res, SummaryOptions{Numeric: true}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := StreamSummary(io.Discard, bc.res, bc.opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamSummaryAvgFileSize(t *testing.T) {
+	res := &Result{
+		Root: "/data",
+		DirStats: map[string]*DirStat{
+			".":     {Size: 1000, Files: 4},
+			"a":     {Size: 1000, Files: 4},
+			"empty": {},
+		},
+		UserStats:  map[string]*UserStat{},
+		GroupStats: map[string]*GroupStat{},
+	}
+	decode := func(opts SummaryOptions) (JsonOut, string) {
+		var buf bytes.Buffer
+		if err := StreamSummary(&buf, res, opts); err != nil {
+			t.Fatal(err)
+		}
+		var jo JsonOut
+		if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+			t.Fatal(err)
+		}
+		return jo, buf.String()
+	}
+	jo, _ := decode(SummaryOptions{AvgFileSize: true})
+	for _, d := range jo.Dirs {
+		want := int64(250)
+		if d.Rel == "empty" {
+			want = 0
+		}
+		if d.AvgFileSize != want {
+			t.Fatalf("%s: avg_file_size = %d, want %d", d.Rel, d.AvgFileSize, want)
+		}
+	}
+	if _, out := decode(SummaryOptions{}); strings.Contains(out, "avg_file_size") {
+		t.Fatal("avg_file_size written without the option")
+	}
+}
+
+func TestStreamSummaryTreeOrderRanks(t *testing.T) {
+	res := &Result{
+		Root: "/data",
+		DirStats: map[string]*DirStat{
+			".":     {Size: 600},
+			"a":     {Size: 100},
+			"b":     {Size: 300},
+			"c":     {Size: 200},
+			"b/x":   {Size: 100},
+			"b/y":   {Size: 200},
+			"tie-1": {},
+			"tie-2": {},
+		},
+		UserStats:  map[string]*UserStat{},
+		GroupStats: map[string]*GroupStat{},
+	}
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{TreeOrder: true}); err != nil {
+		t.Fatal(err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int)
+	for _, d := range jo.Dirs {
+		got[d.Rel] = d.Rank
+	}
+	want := map[string]int{".": 1, "b": 1, "c": 2, "a": 3, "tie-1": 4, "tie-2": 5, "b/y": 1, "b/x": 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ranks = %v, want %v", got, want)
+	}
+
+	// the ranks follow printTree's order
+	var tree bytes.Buffer
+	printTree(&tree, res, TreeOptions{Levels: 1})
+	var shown []string
+	for _, l := range strings.Split(tree.String(), "\n") {
+		if i := strings.Index(l, "── "); i >= 0 {
+			shown = append(shown, l[i+len("── "):])
+		}
+	}
+	if strings.Join(shown, ",") != "b,c,a,tie-1,tie-2" {
+		t.Fatalf("tree order %v does not match the ranks", shown)
+	}
+
+	buf.Reset()
+	if err := StreamSummary(&buf, res, SummaryOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), `"rank"`) {
+		t.Fatal("rank written without the option")
+	}
+}
+
+func TestStreamSummaryCompactArrays(t *testing.T) {
+	res := &Result{
+		Root: "/data",
+		DirStats: map[string]*DirStat{
+			".": {Size: 300, Files: 3},
+			"a": {Size: 100, Files: 1},
+			"b": {Size: 200, Files: 2},
+		},
+		UserStats:  map[string]*UserStat{"1000": {Size: 300, Files: 3, UID: 1000, Name: "alice"}},
+		GroupStats: map[string]*GroupStat{"100": {Size: 300, Files: 3, GID: 100, Name: "staff"}},
+		DirOwners:  map[string]string{},
+		Newest:     NewTopFiles(2, newestFirst),
+	}
+	res.Newest.Add(FileEntry{Path: "a/f", Size: 100, ModTime: time.Unix(1700000000, 0)})
+
+	var compact, pretty bytes.Buffer
+	if err := StreamSummary(&compact, res, SummaryOptions{CompactArrays: true, Numeric: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := StreamSummary(&pretty, res, SummaryOptions{Numeric: true}); err != nil {
+		t.Fatal(err)
+	}
+	if compact.Len() >= pretty.Len() {
+		t.Fatalf("compact output (%d bytes) not smaller than indented (%d bytes)", compact.Len(), pretty.Len())
+	}
+
+	// every entry of the arrays is one line of its own
+	entries := map[string]int{}
+	for _, l := range strings.Split(compact.String(), "\n") {
+		for _, prefix := range []string{`    {"path":`, `    {"name":`} {
+			if strings.HasPrefix(l, prefix) {
+				if !strings.HasSuffix(l, "},") && !strings.HasSuffix(l, "}") {
+					t.Fatalf("entry spans several lines: %q", l)
+				}
+				entries[prefix]++
+			}
+		}
+	}
+	// 3 dirs + newest file share the "path" key; 1 user + 1 group the "name" key
+	if entries[`    {"path":`] != 4 || entries[`    {"name":`] != 2 {
+		t.Fatalf("one-line entries = %v\n%s", entries, compact.String())
+	}
+
+	// same document either way
+	var a, b JsonOut
+	if err := json.Unmarshal(compact.Bytes(), &a); err != nil {
+		t.Fatalf("compact output does not parse: %v\n%s", err, compact.String())
+	}
+	if err := json.Unmarshal(pretty.Bytes(), &b); err != nil {
+		t.Fatal(err)
+	}
+	a.Stats, b.Stats = JsonStats{}, JsonStats{} // memory figures differ between runs
+	if !reflect.DeepEqual(a, b) {
+		t.Fatalf("compact and indented summaries differ:\n%+v\n%+v", a, b)
+	}
+}
+
+func TestStreamSummaryStrictRemovedDir(t *testing.T) {
+	stubOwnerNames(t, map[uint32]string{1001: "alice"}, map[uint32]string{100: "staff"})
+	root := t.TempDir()
+	gone := filepath.Join(root, "gone")
+	if err := os.Mkdir(gone, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	res := newTestResult()
+	res.Root = root
+	res.addFile("gone", 10, 1001, 100)
+	// the directory vanishes between the scan and the export; no owner was
+	// captured for it, so the export has to stat it
+	if err := os.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+	res.DirStats["."].HasOwner = true
+
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{Numeric: true}); err != nil {
+		t.Fatalf("non-strict export failed: %v", err)
+	}
+	err := StreamSummary(&buf, res, SummaryOptions{Numeric: true, Strict: true})
+	if err == nil || !strings.Contains(err.Error(), gone) {
+		t.Fatalf("expected a strict error naming %s, got %v", gone, err)
+	}
+
+	// unresolvable owners fail too, but not when names are not wanted
+	res = newTestResult()
+	res.Root = root
+	res.DirStats["."] = &DirStat{HasOwner: true} // root, resolvable everywhere
+	res.addFile(".", 10, 4242, 100)
+	if err := StreamSummary(&buf, res, SummaryOptions{Strict: true, Numeric: true}); err != nil {
+		t.Fatalf("numeric strict export failed: %v", err)
+	}
+	err = StreamSummary(&buf, res, SummaryOptions{Strict: true})
+	if err == nil || !strings.Contains(err.Error(), "4242") {
+		t.Fatalf("expected a strict error for uid 4242, got %v", err)
+	}
+}
+
+func TestSortDirsTotalOrder(t *testing.T) {
+	// merged snapshots of two nodes can repeat a path under different rels,
+	// and relative-only entries have no path at all
+	want := []JsonDir{
+		{Path: "", Rel: "."},
+		{Path: "/data", Rel: "n1"},
+		{Path: "/data/a", Rel: "n1/a"},
+		{Path: "/data", Rel: "n2"},
+		{Path: "/data/a", Rel: "n2/a"},
+		{Path: "", Rel: "n3"},
+		{Path: "/x", Rel: "n3"},
+	}
+	for _, perm := range [][]int{{6, 5, 4, 3, 2, 1, 0}, {4, 2, 0, 6, 1, 3, 5}, {0, 1, 2, 3, 4, 5, 6}} {
+		dirs := make([]JsonDir, len(want))
+		for i, p := range perm {
+			dirs[i] = want[p]
+		}
+		sortDirs(dirs)
+		if !reflect.DeepEqual(dirs, want) {
+			t.Fatalf("sortDirs(%v) = %+v, want %+v", perm, dirs, want)
+		}
+	}
+}
+
+func TestSkipDirOwnerSkipsLstat(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "sub", "f"), 10)
+	res := newTestResult()
+	res.Root = root
+	// hand-built stats carry no owners, so the export would stat each directory
+	res.DirStats = map[string]*DirStat{".": {Size: 10, Files: 1}, "sub": {Size: 10, Files: 1}}
+
+	calls := 0
+	orig := dirLstat
+	dirLstat = func(name string) (os.FileInfo, error) {
+		calls++
+		return orig(name)
+	}
+	t.Cleanup(func() { dirLstat = orig })
+
+	for _, tc := range []struct {
+		skip  bool
+		calls int
+	}{{false, 2}, {true, 0}} {
+		calls = 0
+		var buf bytes.Buffer
+		if err := StreamSummary(&buf, res, SummaryOptions{SkipDirOwner: tc.skip}); err != nil {
+			t.Fatal(err)
+		}
+		if calls != tc.calls {
+			t.Fatalf("skip=%v: %d directory lstats; want %d", tc.skip, calls, tc.calls)
+		}
+		if !tc.skip {
+			continue
+		}
+		var raw struct {
+			Dirs []map[string]any `json:"dirs"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &raw); err != nil {
+			t.Fatal(err)
+		}
+		if len(raw.Dirs) != 2 {
+			t.Fatalf("dirs = %v; want 2 entries", raw.Dirs)
+		}
+		for _, d := range raw.Dirs {
+			for _, k := range []string{"uid", "user", "gid", "group"} {
+				if _, ok := d[k]; ok {
+					t.Fatalf("dir entry has %q: %v", k, d)
+				}
+			}
+		}
+	}
+}
+
+func TestRootTotalMatchesRootDir(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "x"), 10)
+	writeFile(t, filepath.Join(root, "a", "b", "y"), 100)
+	writeFile(t, filepath.Join(root, "z"), 1000)
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2})
+
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	var dot *JsonDir
+	for i := range jo.Dirs {
+		if jo.Dirs[i].Rel == "." {
+			dot = &jo.Dirs[i]
+		}
+	}
+	if dot == nil || jo.RootTotal == nil {
+		t.Fatalf("root_total = %+v, root dir = %+v", jo.RootTotal, dot)
+	}
+	want := JsonRootTotal{Size: 1110, Files: 3, Dirs: 3}
+	if *jo.RootTotal != want || jo.RootTotal.Size != dot.Size || jo.RootTotal.Files != dot.Files || jo.RootTotal.Dirs != jo.Stats.DirsScanned {
+		t.Fatalf("root_total = %+v; want %+v, matching the root dir %+v and dirs_scanned %d", *jo.RootTotal, want, *dot, jo.Stats.DirsScanned)
+	}
+
+	jo.RootTotal.Size++
+	if v := VerifySummary(jo); len(v) != 1 || v[0].Check != "root-total" {
+		t.Fatalf("violations = %v; want a root-total one", v)
+	}
+}
+
+func TestLoadSummaryStrict(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "x"), 10)
+	writeFile(t, filepath.Join(root, "y"), 100)
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2})
+	dir := t.TempDir()
+	write := func(name string, b []byte) string {
+		t.Helper()
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	// everything this version writes loads strictly
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{OwnerBreakdown: true, AvgFileSize: true, TreeOrder: true, Concentration: true}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+	full := buf.Bytes()
+	if _, err := LoadSummaryStrict(write("full.json", full)); err != nil {
+		t.Fatalf("LoadSummaryStrict(own summary): %v", err)
+	}
+	buf.Reset()
+	if err := StreamSummary(&buf, res, SummaryOptions{}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+	plain := buf.Bytes()
+
+	edit := func(change func(map[string]any)) []byte {
+		t.Helper()
+		var m map[string]any
+		if err := json.Unmarshal(plain, &m); err != nil {
+			t.Fatal(err)
+		}
+		change(m)
+		b, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	for _, tc := range []struct {
+		name    string
+		doc     []byte
+		wantErr string
+	}{
+		{"unknown top-level field", edit(func(m map[string]any) { m["extra"] = 1 }), `unknown field "extra"`},
+		{"unknown dir field", edit(func(m map[string]any) {
+			m["dirs"].([]any)[0].(map[string]any)["inodes"] = 3
+		}), `unknown field "inodes"`},
+		{"unknown stats field", edit(func(m map[string]any) {
+			m["stats"].(map[string]any)["scan_speed"] = 1.5
+		}), `unknown field "scan_speed"`},
+		{"missing stats", edit(func(m map[string]any) { delete(m, "stats") }), `missing required field "stats"`},
+		{"missing root", edit(func(m map[string]any) { delete(m, "root") }), `missing required field "root"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := write("drift.json", tc.doc)
+			if _, err := LoadSummary(p); err != nil {
+				t.Fatalf("LoadSummary: %v; lenient load should accept it", err)
+			}
+			if _, err := LoadSummaryStrict(p); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("LoadSummaryStrict error = %v; want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
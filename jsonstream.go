@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// streamedDir is a finished directory on its way to the dirStreamer.
+type streamedDir struct {
+	rel    string
+	ds     DirStat
+	byUser map[string]UserStat
+}
+
+// dirStreamer writes -json-stream-from-scan: one JSON line per directory,
+// in the order the scan finishes them (children before their parent, the
+// root last), then one line with the summary, which has an empty dirs
+// array. Lines are written by a goroutine of its own, so owner name lookups
+// and slow readers do not hold up the scan beyond the channel's buffer.
+type dirStreamer struct {
+	root string
+	opts SummaryOptions
+	ch   chan streamedDir
+	bw   *bufio.Writer
+	done chan error
+}
+
+// newDirStreamer starts streaming the directories of a scan of root to w.
+func newDirStreamer(w io.Writer, root string, opts SummaryOptions) *dirStreamer {
+	s := &dirStreamer{
+		root: root,
+		opts: opts,
+		ch:   make(chan streamedDir, 1024),
+		bw:   bufio.NewWriter(w),
+		done: make(chan error, 1),
+	}
+	go s.run()
+	return s
+}
+
+// dirDone hands a finished directory over; it is the scan's OnDirDone.
+// The per-user split is copied: a -parallel-lookup scan names the users
+// only after the walk, so the stream goroutine resolves them itself.
+func (s *dirStreamer) dirDone(rel string, ds DirStat, byUser map[string]*UserStat) {
+	d := streamedDir{rel: rel, ds: ds}
+	if s.opts.OwnerBreakdown && byUser != nil {
+		d.byUser = make(map[string]UserStat, len(byUser))
+		for k, us := range byUser {
+			d.byUser[k] = *us
+		}
+	}
+	s.ch <- d
+}
+
+func (s *dirStreamer) run() {
+	unames := make(map[uint32]string)
+	gnames := make(map[uint32]string)
+	onames := make(map[uint32]string)
+	var err error
+	for d := range s.ch {
+		if err != nil || (s.opts.OmitEmpty && d.ds.Size == 0 && d.ds.Files == 0) || (s.opts.MaxDepth > 0 && relDepth(d.rel) > s.opts.MaxDepth) {
+			continue
+		}
+		abs := s.root
+		if d.rel != "." {
+			abs = filepath.Join(s.root, d.rel)
+		}
+		jd := JsonDir{Path: abs, Rel: d.rel, Size: d.ds.Size, Files: d.ds.Files}
+		if d.byUser != nil {
+			jd.Owners = streamedOwnerShares(d.byUser, onames, s.opts.UnknownOwner)
+		}
+		if d.ds.HasOwner && !s.opts.SkipDirOwner {
+			jd.UID, jd.GID = d.ds.UID, d.ds.GID
+			if !s.opts.Numeric {
+				jd.User, jd.Group = dirOwnerNames(unames, gnames, d.ds.UID, d.ds.GID, s.opts.UnknownOwner)
+			}
+		}
+		if s.opts.AvgFileSize {
+			jd.AvgFileSize, _ = avgFileSize(jd.Size, jd.Files)
+		}
+		if s.opts.NormalizePaths {
+			jd.Path, jd.Rel = normalizePath(jd.Path), normalizePath(jd.Rel)
+		}
+		err = s.writeLine(jd)
+	}
+	s.done <- err
+}
+
+// streamedOwnerShares is ownerShares for a streamed directory. Owners left
+// unnamed by a -parallel-lookup scan are named here as resolveDeferredNames
+// names them after the walk (cached in names), so the owners maps use the
+// same names as the users of the summary line.
+func streamedOwnerShares(byUser map[string]UserStat, names map[uint32]string, policy string) map[string]JsonOwnerShare {
+	named := make(map[string]*UserStat, len(byUser))
+	for k, us := range byUser {
+		if us.HasID && us.Name == "" && k != othersKey {
+			us.Name = cachedName(names, us.UID, userName)
+			if policy == unknownOwnerPrefixed && us.Name == strconv.FormatUint(uint64(us.UID), 10) {
+				us.Name = unknownOwnerName(policy, "uid", us.UID)
+			}
+		}
+		named[k] = &us
+	}
+	return ownerShares(named)
+}
+
+func (s *dirStreamer) writeLine(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	_, err = s.bw.Write(b)
+	return err
+}
+
+// finish writes the summary line of res once the scan is over and flushes
+// the stream.
+func (s *dirStreamer) finish(res *Result) error {
+	close(s.ch)
+	if err := <-s.done; err != nil {
+		return err
+	}
+	// the directories are already out; summarize the rest
+	rest := *res
+	rest.DirStats = nil
+	jo := summaryFor(&rest, s.opts)
+	if jo.RootTotal != nil {
+		// rest has no directories to total
+		jo.RootTotal = rootTotal(res)
+	}
+	jo.Dirs = []JsonDir{}
+	if err := s.writeLine(jo); err != nil {
+		return err
+	}
+	return s.bw.Flush()
+}
+
+// parseSummary decodes a summary: one JSON object, or the NDJSON of
+// -json-stream-from-scan, whose directory lines are put back into its dirs.
+// strict (-strict-load) rejects fields a summary does not have and a
+// summary without root or stats.
+func parseSummary(b []byte, strict bool) (JsonOut, error) {
+	var jo JsonOut
+	dec := json.NewDecoder(bytes.NewReader(b))
+	var first json.RawMessage
+	if err := dec.Decode(&first); err != nil {
+		return jo, err
+	}
+	if !dec.More() {
+		if strict {
+			if err := requireSummaryFields(first); err != nil {
+				return jo, err
+			}
+		}
+		return jo, unmarshalSummary(first, &jo, strict)
+	}
+
+	lines := []json.RawMessage{first}
+	for dec.More() {
+		var line json.RawMessage
+		if err := dec.Decode(&line); err != nil {
+			return jo, err
+		}
+		lines = append(lines, line)
+	}
+	// the summary comes last; without it the stream was cut off
+	var probe struct {
+		Stats json.RawMessage `json:"stats"`
+	}
+	if err := json.Unmarshal(lines[len(lines)-1], &probe); err != nil {
+		return jo, err
+	}
+	if probe.Stats == nil {
+		return jo, fmt.Errorf("streamed summary ends without its summary line (%d directory lines)", len(lines))
+	}
+	if strict {
+		if err := requireSummaryFields(lines[len(lines)-1]); err != nil {
+			return jo, err
+		}
+	}
+	if err := unmarshalSummary(lines[len(lines)-1], &jo, strict); err != nil {
+		return jo, err
+	}
+	for i, line := range lines[:len(lines)-1] {
+		var d JsonDir
+		if err := unmarshalSummary(line, &d, strict); err != nil {
+			return jo, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		jo.Dirs = append(jo.Dirs, d)
+	}
+	sortDirs(jo.Dirs)
+	return jo, nil
+}
+
+// unmarshalSummary decodes b, part of a summary, into v like json.Unmarshal;
+// strict also rejects fields v has no place for, so a summary of another
+// version or a corrupted one is noticed instead of silently read in part.
+func unmarshalSummary(b []byte, v any, strict bool) error {
+	if !strict {
+		return json.Unmarshal(b, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("strict load: %w", err)
+	}
+	return nil
+}
+
+// requireSummaryFields checks that the summary object b has the fields every
+// summary is written with, root and stats (-strict-load).
+func requireSummaryFields(b []byte) error {
+	var probe struct {
+		Root  *string         `json:"root"`
+		Stats json.RawMessage `json:"stats"`
+	}
+	if err := json.Unmarshal(b, &probe); err != nil {
+		return err
+	}
+	switch {
+	case probe.Root == nil:
+		return fmt.Errorf("strict load: missing required field \"root\"")
+	case probe.Stats == nil || string(probe.Stats) == "null":
+		return fmt.Errorf("strict load: missing required field \"stats\"")
+	}
+	return nil
+}
+
+// createOutput opens path ('-' = stdout) for writing in place, compressed
+// with c (nil = uncompressed). The returned close function finishes the
+// compression and closes the file.
+func createOutput(path string, c *compressor) (io.Writer, func() error, error) {
+	var w io.Writer = os.Stdout
+	closeFile := func() error { return nil }
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		w, closeFile = f, f.Close
+	}
+	if c == nil {
+		return w, closeFile, nil
+	}
+	cw, err := c.newWriter(w)
+	if err != nil {
+		_ = closeFile()
+		return nil, nil, err
+	}
+	return cw, func() error {
+		if err := cw.Close(); err != nil {
+			_ = closeFile()
+			return err
+		}
+		return closeFile()
+	}, nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestJSONStreamFromScan(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "top"), 1)
+	writeFile(t, filepath.Join(root, "a", "x"), 10)
+	writeFile(t, filepath.Join(root, "a", "b", "y"), 100)
+	writeFile(t, filepath.Join(root, "a", "b", "c", "z"), 1000)
+	writeFile(t, filepath.Join(root, "d", "w"), 10000)
+	writeFile(t, filepath.Join(root, "e", "empty", ".keep"), 0)
+
+	var buf bytes.Buffer
+	s := newDirStreamer(&buf, root, SummaryOptions{Numeric: true})
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 4, OnDirDone: s.dirDone})
+	if err := s.finish(res); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+
+	sc := bufio.NewScanner(&buf)
+	var lines []string
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if len(lines) != len(res.DirStats)+1 {
+		t.Fatalf("got %d lines for %d directories:\n%s", len(lines), len(res.DirStats), strings.Join(lines, "\n"))
+	}
+	finished := map[string]bool{}
+	for i, line := range lines[:len(lines)-1] {
+		var d JsonDir
+		if err := json.Unmarshal([]byte(line), &d); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		for rel := range res.DirStats {
+			// every directory below d must have been reported before it
+			if d.Rel == "." && rel != "." || strings.HasPrefix(rel, d.Rel+"/") {
+				if !finished[rel] {
+					t.Fatalf("%s reported before its subdirectory %s", d.Rel, rel)
+				}
+			}
+		}
+		if want := res.DirStats[d.Rel]; want == nil || d.Size != want.Size || d.Files != want.Files {
+			t.Fatalf("record %+v does not match the final totals %+v", d, want)
+		}
+		finished[d.Rel] = true
+	}
+	if !strings.Contains(lines[len(lines)-2], `"rel":"."`) {
+		t.Fatalf("root is not the last directory: %s", lines[len(lines)-2])
+	}
+
+	var jo JsonOut
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &jo); err != nil {
+		t.Fatalf("summary line: %v", err)
+	}
+	if jo.Root != root || jo.Stats.FilesScanned != 6 || len(jo.Dirs) != 0 || len(jo.Users) == 0 {
+		t.Fatalf("summary line = %s", lines[len(lines)-1])
+	}
+}
+
+// pipeToReadJSON runs produce against the write end of a pipe standing in for
+// the producer's stdout, and loads the read end as -read-json - does.
+func pipeToReadJSON(t *testing.T, produce func(w io.Writer) error) (JsonOut, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		err := produce(w)
+		_ = w.Close()
+		done <- err
+	}()
+	oldStdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = oldStdin; _ = r.Close() }()
+	jo, err := LoadSummary("-")
+	if perr := <-done; perr != nil {
+		t.Fatalf("producer: %v", perr)
+	}
+	return jo, err
+}
+
+func TestJSONPipesIntoReadJSON(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "x"), 10)
+	writeFile(t, filepath.Join(root, "a", "b", "y"), 100)
+	writeFile(t, filepath.Join(root, "c", "z"), 1000)
+	gz, err := lookupCompressor("gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		comp   *compressor
+		stream bool
+	}{
+		{"json", nil, false},
+		{"json gzip", gz, false},
+		{"stream", nil, true},
+		{"stream gzip", gz, true},
+	} {
+		var res *Result
+		jo, err := pipeToReadJSON(t, func(w io.Writer) error {
+			if !tc.stream {
+				// what -json - [-compress gzip] does after the scan
+				res = Scan(context.Background(), root, ScanOptions{Concurrency: 2})
+				return compressWrite(tc.comp, func(w io.Writer) error { return StreamSummary(w, res, SummaryOptions{}) })(w)
+			}
+			// -json - -json-stream-from-scan [-compress gzip]
+			out := w
+			var cw io.WriteCloser
+			if tc.comp != nil {
+				c, err := tc.comp.newWriter(w)
+				if err != nil {
+					return err
+				}
+				cw, out = c, c
+			}
+			s := newDirStreamer(out, root, SummaryOptions{})
+			res = Scan(context.Background(), root, ScanOptions{Concurrency: 2, OnDirDone: s.dirDone})
+			if err := s.finish(res); err != nil {
+				return err
+			}
+			if cw != nil {
+				return cw.Close()
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: LoadSummary(-): %v", tc.name, err)
+		}
+		got := resultFromSummary(jo)
+		if len(got.DirStats) != len(res.DirStats) || got.FilesScanned != 3 {
+			t.Fatalf("%s: loaded %d dirs, %d files; want %d dirs, 3 files", tc.name, len(got.DirStats), got.FilesScanned, len(res.DirStats))
+		}
+		for rel, want := range res.DirStats {
+			if ds := got.DirStats[rel]; ds == nil || ds.Size != want.Size || ds.Files != want.Files {
+				t.Fatalf("%s: dir %q = %+v; want %+v", tc.name, rel, ds, want)
+			}
+		}
+		if v := VerifySummary(jo); jo.RootTotal == nil || len(v) != 0 {
+			t.Fatalf("%s: root_total = %+v, violations %v", tc.name, jo.RootTotal, v)
+		}
+	}
+}
+
+func TestParseSummaryRejectsCutStream(t *testing.T) {
+	cut := `{"path":"/r/a","rel":"a","size":1,"files":1}` + "\n" + `{"path":"/r","rel":".","size":1,"files":1}` + "\n"
+	if _, err := parseSummary([]byte(cut), false); err == nil || !strings.Contains(err.Error(), "without its summary line") {
+		t.Fatalf("err = %v; want a missing summary line", err)
+	}
+}
+
+func TestParseSummaryStrictStream(t *testing.T) {
+	summary := `{"root":"/r","stats":{"files_scanned":1}}` + "\n"
+	stream := `{"path":"/r","rel":".","size":1,"files":1}` + "\n" + summary
+	if _, err := parseSummary([]byte(stream), true); err != nil {
+		t.Fatalf("strict parse: %v", err)
+	}
+	drift := `{"path":"/r","rel":".","size":1,"files":1,"inodes":1}` + "\n" + summary
+	if _, err := parseSummary([]byte(drift), false); err != nil {
+		t.Fatalf("lenient parse: %v", err)
+	}
+	if _, err := parseSummary([]byte(drift), true); err == nil || !strings.Contains(err.Error(), `line 1: strict load: json: unknown field "inodes"`) {
+		t.Fatalf("err = %v; want the unknown field of line 1", err)
+	}
+}
+
+func TestJSONStreamFromScanParallelLookupOwners(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a"), 10)
+	writeFile(t, filepath.Join(root, "sub", "b"), 20)
+	stubOwnerNames(t, nil, nil)
+	userName = func(id uint32) string { return "user" + strconv.FormatUint(uint64(id), 10) }
+	groupName = func(id uint32) string { return "group" + strconv.FormatUint(uint64(id), 10) }
+
+	var buf bytes.Buffer
+	s := newDirStreamer(&buf, root, SummaryOptions{OwnerBreakdown: true, SkipDirOwner: true})
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 4, ParallelLookup: true, DirOwners: true, OnDirDone: s.dirDone})
+	if err := s.finish(res); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var jo JsonOut
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &jo); err != nil {
+		t.Fatalf("summary line: %v", err)
+	}
+	users := map[string]bool{}
+	for _, u := range jo.Users {
+		users[u.Name] = true
+	}
+	want := "user" + strconv.Itoa(os.Getuid())
+	if !users[want] {
+		t.Fatalf("summary users = %+v; want %s", jo.Users, want)
+	}
+	// the streamed owners use the summary's names, not the bare uids
+	for _, line := range lines[:len(lines)-1] {
+		var d JsonDir
+		if err := json.Unmarshal([]byte(line), &d); err != nil {
+			t.Fatal(err)
+		}
+		if len(d.Owners) == 0 {
+			t.Fatalf("%s: no owners streamed: %s", d.Rel, line)
+		}
+		for name := range d.Owners {
+			if !users[name] {
+				t.Fatalf("%s: owner %q is not a user of the summary %+v", d.Rel, name, jo.Users)
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+// largestLeaves returns the rel paths of the n largest leaf directories (those
+// without subdirectories) in dirStats, biggest first (ties by path). The root
+// only counts as a leaf when it is the sole directory.
+func largestLeaves(dirStats map[string]*DirStat, n int) []string {
+	// mark every ancestor, so gaps in the stats (e.g. from -json-omit-empty)
+	// do not turn an intermediate directory into a leaf
+	hasSubdirs := make(map[string]bool, len(dirStats))
+	for rel := range dirStats {
+		for p := rel; p != "."; {
+			p = filepath.Dir(p)
+			if hasSubdirs[p] {
+				break
+			}
+			hasSubdirs[p] = true
+		}
+	}
+	var leaves []string
+	for rel := range dirStats {
+		if !hasSubdirs[rel] {
+			leaves = append(leaves, rel)
+		}
+	}
+	sort.Slice(leaves, func(i, j int) bool {
+		si, sj := dirStats[leaves[i]].Size, dirStats[leaves[j]].Size
+		if si == sj {
+			return leaves[i] < leaves[j]
+		}
+		return si > sj
+	})
+	if n < len(leaves) {
+		leaves = leaves[:n]
+	}
+	return leaves
+}
+
+// printLargestLeaves writes the full paths of the n largest leaf directories
+// below the tree, so deep findings can be copied without reassembling them
+// from the indentation.
+func printLargestLeaves(w io.Writer, res *Result, n int, opts TreeOptions) {
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, "Largest leaf directories:")
+	for _, rel := range largestLeaves(res.DirStats, n) {
+		full := res.Root
+		if rel != "." {
+			full = filepath.Join(res.Root, rel)
+		}
+		if opts.NormalizePaths {
+			full = normalizePath(full)
+		}
+		var size int64
+		if ds := res.DirStats[rel]; ds != nil {
+			size = ds.Size
+		}
+		_, _ = fmt.Fprintf(w, "%10s  %s\n", opts.Format.size(size), opts.Format.path(full))
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLargestLeaves(t *testing.T) {
+	dirStats := map[string]*DirStat{
+		".":         {Size: 1000},
+		"a":         {Size: 900},
+		"a/b":       {Size: 800},
+		"a/b/c":     {Size: 700},
+		"a/b/d":     {Size: 100},
+		"e":         {Size: 100},
+		"e/f":       {Size: 50},
+		"e/f/g/h/i": {Size: 50},
+	}
+	got := largestLeaves(dirStats, 2)
+	if want := []string{"a/b/c", "a/b/d"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("largestLeaves = %v, want %v", got, want)
+	}
+	// intermediate directories missing from the stats still link the chain
+	if got := largestLeaves(dirStats, 10); len(got) != 3 || got[2] != "e/f/g/h/i" {
+		t.Fatalf("largestLeaves(10) = %v", got)
+	}
+	if got := largestLeaves(map[string]*DirStat{".": {}}, 3); !reflect.DeepEqual(got, []string{"."}) {
+		t.Fatalf("lone root should be its own leaf, got %v", got)
+	}
+}
+
+func TestPrintLargestLeavesFullPaths(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "x", "y", "deep", "big"), 3000)
+	writeFile(t, filepath.Join(root, "x", "small", "f"), 10)
+	writeFile(t, filepath.Join(root, "z", "f"), 500)
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2})
+
+	var out bytes.Buffer
+	printLargestLeaves(&out, res, 2, TreeOptions{Format: FormatOptions{Bytes: true}})
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{
+		"Largest leaf directories:",
+		"      3000  " + filepath.Join(root, "x", "y", "deep"),
+		"       500  " + filepath.Join(root, "z"),
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("unexpected listing:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
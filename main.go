@@ -1,18 +1,18 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"flag"
 	"fmt"
-	"io/fs"
+	"io"
 	"log"
 	"os"
-	"os/user"
+	"os/signal"
 	"path/filepath"
 	"runtime"
-	"sort"
 	"strconv"
-	"sync"
-	"sync/atomic"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -25,16 +25,35 @@ var date = "unknown"
 type DirStat struct {
 	Size  int64
 	Files int64
+	// UID/GID own the directory itself. Scans record them while walking (and
+	// set HasOwner), so exporting needs no second stat of every directory.
+	UID, GID uint32
+	HasOwner bool
 }
 
+// UserStat aggregates the files owned by one user. Scans key user stats by
+// numeric uid and carry the resolved name alongside.
 type UserStat struct {
 	Size  int64
 	Files int64
+	// Dirs counts the directories the user owns; only with -dir-count.
+	Dirs int64
+	UID  uint32
+	Name string // resolved user name; empty when unknown (the map key is shown instead)
+	// HasID is set when UID was captured from the files at scan time, so
+	// exports use it as is instead of resolving the map key.
+	HasID bool
 }
 
+// GroupStat aggregates the files owned by one group, keyed like UserStat.
 type GroupStat struct {
 	Size  int64
 	Files int64
+	Dirs  int64
+	GID   uint32
+	Name  string
+	// HasID is set when GID was captured at scan time, like UserStat.HasID.
+	HasID bool
 }
 
 func humanizeBytes(s int64) string {
@@ -56,311 +75,341 @@ func humanizeBytes(s int64) string {
 	return fmt.Sprintf("%dB", s)
 }
 
-// ComputeSizeMapsAndWidths is defined in format.go; helper removed here.
+func main() {
+	var (
+		levels           = flag.Int("levels", 2, "number of directory levels to display (0 means only root)")
+		showUser         = flag.Bool("user", false, "show directory owner user")
+		showGroup        = flag.Bool("group", false, "show directory owner group")
+		showFiles        = flag.Bool("files", false, "show number of files per directory")
+		concentration    = flag.Bool("concentration", false, "after the per-user summary, show the share of bytes held by the top 1/5/10/25% of users and the Gini coefficient, and add them to JSON as \"concentration\"")
+		showAvg          = flag.Bool("avg", false, "show the average file size per directory (size/files) in the tree and as avg_file_size in JSON")
+		root             = flag.String("root", ".", "root path to analyze (can also be specified as first positional argument)")
+		concurrency      = flag.Int("concurrency", runtime.NumCPU()*2, "number of concurrent directory readers")
+		bytesFlag        = flag.Bool("bytes", false, "print sizes in bytes instead of human-readable units")
+		maxMemory        = flag.String("max-memory", "", "soft cap on heap size (e.g. 2G): beyond it, per-directory totals are spilled to temporary files and merged at the end (empty = all in memory)")
+		inlineBelow      = flag.Int("inline-below", 1000, "stat the first N files in the walking goroutine and start the file workers only for the rest, so small trees skip them (0 = always use the workers)")
+		snapshotName     = flag.String("snapshot-name", "", "label recorded with the host name in the JSON stats (\"snapshot_name\", \"hostname\") to tell merged or compared snapshots apart")
+		hiddenReport     = flag.Bool("hidden-report", false, "split the scanned bytes between hidden files (a name or directory below the root starting with '.') and visible ones; print \"Visible: X, Hidden: Y\" with percentages after the summaries, and add both to the JSON stats as \"hidden_split\"")
+		extByUser        = flag.Bool("ext-by-user", false, "tally bytes per file extension and user and print them as a cross-tab (top -top extensions and users) after the summaries, and in JSON as \"ext_by_user\"")
+		dupes            = flag.Bool("dupes", false, "find files with identical content (same size, then same -hash) and list them after the summaries")
+		hashAlgo         = flag.String("hash", defaultHash, "content hash for -dupes and -manifest: "+strings.Join(hashNames(), ", "))
+		manifest         = flag.String("manifest", "", "write a '<hash>  <path>  <size>' line for every file, sorted by path and hashed with -hash, to file (or '-' for stdout)")
+		fileMinSize      = flag.String("file-min-size", "", "leave files smaller than this size (e.g. 4K) out of all totals (empty = no minimum)")
+		fileMaxSize      = flag.String("file-max-size", "", "leave files larger than this size (e.g. 2G) out of all totals (empty = no maximum)")
+		changedSince     = flag.String("changed-since", "", "count only files whose inode change time (ctime: content, permission or ownership changes) is at or after this time: RFC3339, YYYY-MM-DD or a duration ago like 24h")
+		olderThanFile    = flag.String("older-than-file", "", "count only files modified no later than this reference file (e.g. the root itself, or a deploy's marker file)")
+		blockSize        = flag.Int64("block-size", 0, "count sizes in blocks of N bytes (e.g. 512, 1024, 4096), rounding each file's allocated size up like du -B (0 = apparent bytes)")
+		bitsFlag         = flag.Bool("bits", false, "print sizes in bits (size*8) with decimal bit suffixes (Kb, Mb, ...)")
+		fixedUnit        = flag.Bool("fixed-unit", false, "print every size of the tree and summaries in one unit, the one the largest size needs (e.g. all in GB), so magnitudes line up")
+		humanFiles       = flag.Bool("human-files", false, "print file counts with thousands-style suffixes (e.g. 1.2M)")
+		sizeWidth        = flag.Int("size-width", 0, "override size column width (0 = auto-fit)")
+		width            = flag.Int("width", 0, "shorten tree names in the middle so lines fit in N columns (0 = the terminal width when stdout is a terminal, -1 = never shorten)")
+		filesWidth       = flag.Int("files-width", 0, "override files column width (0 = auto-fit)")
+		sizeWidthMax     = flag.Int("size-width-max", 0, "cap the auto-fit size column width; wider values are ellipsized (0 = no cap; -size-width wins)")
+		filesWidthMax    = flag.Int("files-width-max", 0, "cap the auto-fit files column width; wider values are ellipsized (0 = no cap; -files-width wins)")
+		minUserSize      = flag.String("min-user-size", "", "leave users holding less than this size (e.g. 1G) out of the per-user summary, its CSV and the JSON users; their bytes still count in every directory")
+		minGroupSize     = flag.String("min-group-size", "", "leave groups holding less than this size out of the per-group summary, its CSV and the JSON groups, like -min-user-size")
+		topN             = flag.Int("top", 0, "limit per-user/group lists to top N by size (0 = all)")
+		sortOrder        = flag.String("sort", sortSize, "order of each directory's children in the tree and of the per-user and per-group summaries: size (largest first), name, or natural (by name, numbers by value: item2 before item10)")
+		collapseChains   = flag.Bool("collapse-chains", false, "print chains of directories that hold nothing but one subdirectory on one line, as a/b/c with the innermost one's totals, branching only where a directory has files or several children")
+		topChildren      = flag.Int("top-children", 0, "show at most N largest children per directory in the tree, summing the rest into an (others) line (0 = all)")
+		parents          = flag.Int("parents", 0, "after the tree, list the full paths of the N largest leaf directories (0 = off)")
+		warnOver         = flag.String("warn-over", "", "mark directories larger than this size in the tree with '*' (e.g. 10G; empty = off)")
+		criticalOver     = flag.String("critical-over", "", "mark directories larger than this size in the tree with '!' (e.g. 100G; empty = off)")
+		quotaFile        = flag.String("quota", "", "file of quotas (\"user alice 100G\", \"group staff 1T\", \"user alice group proj 50G\") to check the totals against once the output is written; exceeded ones are reported on stderr and exit with code 4, or 5 when only user-in-group quotas are")
+		failOverFlag     = flag.String("fail-over", "", "exit with code 3 when the total size exceeds this size (e.g. 500G; empty = off); with -warn-over, exit with code 2 when only that is exceeded")
+		expandArchives   = flag.Bool("expand-archives", false, "count the entries of .tar, .tar.gz, .tgz and .zip files found during the scan in place of the archives, below a directory named after each archive (archive.tar/inner/file)")
+		dirCount         = flag.Bool("dir-count", false, "also count the directories each user and group owns, shown as a dirs column in the per-user and per-group summaries and as \"dirs\" in JSON")
+		timezone         = flag.String("timezone", "local", "zone for displayed and exported timestamps: 'local', 'utc' or an IANA name such as Europe/Copenhagen")
+		skipDirOwner     = flag.Bool("skip-dir-owner", false, "leave the owner fields (uid, user, gid, group) out of the JSON directory entries, skipping their stat and name lookups; the tree's -user/-group are unaffected")
+		colorScheme      = flag.String("color-scheme", "", "color every directory in the tree green/yellow/red by its size (magnitude), its percent of the parent (percent) or the age of its newest file (age); empty = off")
+		colorThresholds  = flag.String("color-thresholds", "", "the two breakpoints \"low,high\" of -color-scheme: sizes (1G,10G), percents (25,50) or ages (30d,365d); empty = the scheme's defaults")
+		color            = flag.Bool("color", false, "color -warn-over/-critical-over directories (yellow/red) instead of prefixing a marker")
+		print0           = flag.Bool("print0", false, "instead of the tree, write NUL-terminated full paths for xargs -0: the shown directories, or the -parents/-newest-files/-oldest-files listings (same as -format print0)")
+		outputDir        = flag.String("output-dir", "", "write every -format given (repeatable) to its own file summary.<ext> in this directory from one scan, instead of to stdout")
+		jsonOut          = flag.String("json", "", "write JSON summary to file (or '-' for stdout)")
+		jsonOwners       = flag.Bool("json-owner-breakdown", false, "attach each directory's per-user size/files split as an \"owners\" map in the JSON output (uses more memory)")
+		jsonStatsOnly    = flag.Bool("json-stats-only", false, "write only root and the stats block in JSON output (no dirs/users/groups arrays)")
+		jsonChunkSize    = flag.Int("json-chunk-size", 0, "split the JSON dirs array into files of at most N entries (out.001.json, ...) listed in a manifest written to the -json file (0 = one file)")
+		strict           = flag.Bool("strict", false, "fail the JSON export if a directory cannot be statted or an owner cannot be resolved to a name, instead of writing zero ids or blank names")
+		jsonNumeric      = flag.Bool("json-numeric", false, "skip user/group name resolution in JSON output: directories carry only uid/gid, users and groups are named by their ids")
+		jsonOmitEmpty    = flag.Bool("json-omit-empty", false, "leave directories with no bytes and no files out of the JSON dirs array")
+		jsonMaxDepth     = flag.Int("json-max-depth", 0, "leave directories nested deeper than N below the root out of the JSON dirs array; their bytes stay in their ancestors' totals (0 = all)")
+		jsonIndentArrays = flag.Bool("json-indent-arrays", true, "indent every field of the JSON dirs/users/groups entries; =false writes one compact entry per line (much smaller, still line-greppable)")
+		jsonTreeOrder    = flag.Bool("json-include-tree-order", false, "add each directory's \"rank\" among its siblings, in the tree's descending-size order, to the JSON output")
+		jsonStream       = flag.Bool("json-stream-from-scan", false, "write -json as NDJSON while scanning: one line per directory as soon as its subtree is complete (children before parents), then a summary line with stats, users and groups")
+		snapshotInterval = flag.Duration("json-snapshot-interval", 0, "periodically write the partial JSON summary to the -json file during the scan (0 = only at the end)")
+		readJSON         = flag.String("read-json", "", "read JSON summary from file and print human tree (skips scanning); further files given as arguments are merged")
+		recompute        = flag.Bool("recompute", false, "with -read-json, rebuild directory totals and the user/group summaries from the dirs array, ignoring the stored summaries")
+		subtree          = flag.String("subtree", "", "with -read-json, show only this directory (relative to the snapshot root) as the new root")
+		onlyUserFlag     = flag.String("only-user", "", "with -read-json, show only the bytes and files of this user (name or uid); needs a snapshot written with -json-owner-breakdown")
+		minSize          = flag.String("min-size", "", "with -read-json, leave directories smaller than this size (e.g. 1G) out of the tree (empty = all)")
+		jsonFileLists    = flag.Bool("json-files", false, "record every file's name and size in its directory's \"file_list\" in the JSON output, for -report-largest-growth (uses memory and output proportional to the number of files)")
+		largestGrowthN   = flag.Int("report-largest-growth", 0, "list the N files that grew or appeared the most between two JSON summaries written with -json-files, given as positional arguments (old.json new.json) (skips scanning)")
+		compare          = flag.Bool("compare", false, "render two JSON summaries, given as positional arguments (old.json new.json), as one tree with old, new and delta size columns, or with -json as a JSON diff of every directory, user and group (skips scanning)")
+		fromList         = flag.String("from-list", "", "read \"<size> <path>\" lines (e.g. from find -printf '%s\\t%p\\n') from a file ('-' = stdin) and print them as a tree (skips scanning)")
+		stripComps       = flag.Int("strip-components", 0, "with -archive or -from-list, drop the first N components of every path, like tar --strip-components; paths with no more than N components are skipped")
+		listDelimiter    = flag.String("list-delimiter", "", "with -from-list, the string between size and path (\\t for a tab; empty = any run of blanks)")
+		verbose          = flag.Bool("verbose", false, "print the effective configuration (root, concurrency, filters, size mode, units, outputs) to stderr before scanning")
+		verifyJSON       = flag.String("verify-json", "", "check a JSON summary's internal consistency and exit non-zero on violations (skips scanning)")
+		strictLoad       = flag.Bool("strict-load", false, "fail to load a JSON summary (-read-json, -verify-json, -compare, ...) that has fields this version does not know or lacks root or stats, instead of ignoring the unknown and zeroing the missing")
+		maxFiles         = flag.Int64("max-files", 0, "stop scanning after N files and report partial results (0 = unlimited)")
+		dryRun           = flag.Bool("dry-run", false, "only walk the tree: count the directories and the files the path filters, -skip-root-files and pruned mounts let through, without statting or aggregating them, and print the counts with the effective configuration")
+		benchmarkFiles   = flag.Int("benchmark", 0, "generate a synthetic tree of N files in a temporary directory, scan it and report the throughput; the tree's depth is the positional argument (-benchmark 100000 4)")
+		progressBarFlag  = flag.Bool("progress-bar", false, "draw a progress bar with the percentage of files scanned on stderr, measured against -max-files or the files of a -progress-estimate summary; without either, show the running file count")
+		progressEstimate = flag.String("progress-estimate", "", "with -progress-bar, a prior JSON summary of the same tree whose file count estimates the total")
+		timeout          = flag.Duration("timeout", 0, "stop scanning after this duration and report partial results (0 = no limit)")
+		deadline         = flag.String("deadline", "", "stop the scan at this time and report partial results: RFC3339 or HH:MM (next occurrence); combines with -timeout, the earlier wins")
+		walkOrder        = flag.String("walk-order", "lexical", "traversal order when -max-files/-timeout may truncate the scan: 'lexical' or 'size' (biggest-first, slower)")
+		daemonMode       = flag.Bool("daemon", false, "after the scan, keep the -json file up to date from filesystem events until interrupted (requires a build with -tags daemon)")
+		daemonInterval   = flag.Duration("daemon-interval", 10*time.Second, "with -daemon, apply pending changes and rewrite the JSON at most this often")
+		daemonRescan     = flag.Duration("daemon-rescan", 10*time.Minute, "with -daemon, how often subtrees that could not be watched (watch limit reached) are rescanned in full")
+		dirsOnly         = flag.Bool("dirs-only", false, "have each worker read and total a whole directory at a time instead of feeding single files through a channel; drops the per-file features")
+		samples          = flag.Int("samples", 0, "keep a random sample of N file paths per top-level directory and print them after the summaries")
+		seed             = flag.Uint64("seed", 0, "seed for random sampling (0 = random; use with -concurrency 1 for fully reproducible samples)")
+		dominantOwner    = flag.Bool("dominant-owner", false, "in the -user column, show the user holding the most bytes below each directory (with their share) instead of the directory's owner")
+		maxUsers         = flag.Int("max-users", 0, "track at most N distinct users; files of further users are summed into '(others)' (0 = no cap)")
+		userMapFile      = flag.String("user-map", "", "file of 'from=to' lines mapping user names or uids to a canonical user name; the files of aliased accounts are summed under it")
+		groupMapFile     = flag.String("group-map", "", "file of 'from=to' lines mapping group names or gids to a canonical group name, like -user-map")
+		parallelLookup   = flag.Bool("parallel-lookup", false, "resolve user and group names after the scan, all distinct ids side by side, instead of one at a time while the workers wait (helps with slow LDAP/NSS lookups)")
+		unknownOwner     = flag.String("unknown-owner", unknownOwnerNumeric, "name owners whose uid/gid has no user/group entry: numeric (1001), prefixed (uid:1001, gid:1001) or bucket (all together as \"(unknown)\")")
+		groupByPrimary   = flag.Bool("group-by-primary", false, "attribute files to their owner's primary group instead of the file's group in the per-group summary")
+		maxGroups        = flag.Int("max-groups", 0, "track at most N distinct groups; files of further groups are summed into '(others)' (0 = no cap)")
+		showErrors       = flag.Bool("show-errors", false, "print each path skipped because of an error (unreadable directory, failed stat) to stderr as the scan goes; repeated reasons are summarized after 10 paths")
+		statRetries      = flag.Int("stat-retries", 3, "retry a file's stat up to N times after a transient error (EINTR, EAGAIN, ESTALE on NFS) before skipping it")
+		throttle         = flag.Float64("throttle", 0, "limit the scan to N file stats per second across all workers, to reduce I/O impact (0 = unlimited)")
+		showFree         = flag.Bool("show-free", false, "print the scanned total as a share of the filesystem's size and free space (statfs) after the summaries")
+		profileLookups   = flag.Bool("profile-lookups", false, "count user/group name lookups, cache hits/misses and lookup time; print them to stderr and add them to JSON stats")
+		dfCheck          = flag.Bool("df-check", false, "compare the scanned total with the filesystem's used bytes (statfs) and flag large discrepancies")
+		normalizePaths   = flag.Bool("normalize-paths", false, "display path names in Unicode NFC in the tree and JSON (e.g. to compare macOS and Linux reports); filesystem access is unaffected")
+		encoding         = flag.String("encoding", encodingUTF8, "display encoding of the tree and listings: 'utf-8' or 'ascii' (ASCII connectors, non-ASCII path bytes shown as \\xNN); JSON output is always UTF-8")
+		rootLabel        = flag.String("root-label", "", "show this label instead of the root path in the tree and the JSON root field (e.g. 'host:/data')")
+		onWriteError     = flag.String("on-write-error", "fatal", "what to do with the results when an output file cannot be written: 'fatal', 'stdout' (print them instead) or 'tmp' (write them to a temp file)")
+		compress         = flag.String("compress", "", "compress -json and -summary-csv output: 'gzip' or 'zstd' (zstd needs a build with -tags zstd); the .gz/.zst extension is appended to file names")
+		summaryCSV       = flag.String("summary-csv", "", "write only the per-user and per-group totals as CSV to file (or '-' for stdout instead of the tree)")
+		newestFiles      = flag.Int("newest-files", 0, "list the N most recently modified files")
+		oldestFiles      = flag.Int("oldest-files", 0, "list the N least recently modified files")
+		skipMounts       = flag.Bool("skip-mounts", false, "prune mount points below the root whose filesystem type is listed in -skip-mount-types (reads /proc/self/mountinfo)")
+		skipMountTypes   = flag.String("skip-mount-types", defaultSkipMountTypes, "comma-separated filesystem types pruned by -skip-mounts ('*' = every mount below the root)")
+		includeFSType    = flag.String("include-fstype", "", "comma-separated filesystem types to scan: mount points below the root of any other type are pruned (reads /proc/self/mountinfo)")
+		excludeFSType    = flag.String("exclude-fstype", "", "comma-separated filesystem types whose mount points below the root are pruned, e.g. tmpfs,overlay,proc,sysfs (reads /proc/self/mountinfo)")
+		byDevice         = flag.Bool("by-device", false, "also total the files per backing device, shown with its mount point and filesystem type (from /proc/self/mountinfo), and add a \"devices\" array to JSON")
+		dedupBinds       = flag.Bool("dedup-binds", false, "count files on filesystems reached through several (bind) mounts below the root only once, by device and inode (reads /proc/self/mountinfo)")
+		archive          = flag.String("archive", "", "report the contents of a .tar, .tar.gz or .zip file instead of scanning a directory")
+		skipRootFiles    = flag.Bool("skip-root-files", false, "leave the files directly in the root out of every total, so the tree reflects only subdirectory content")
+		ignoreCase       = flag.Bool("ignore-case", false, "match -path-contains and -path-not-contains case-insensitively")
+		versionFlag      = flag.Bool("version", false, "show version and exit")
+	)
 
-// printTree renders the directory tree and per-user/group summaries.
-func printTree(rootAbs string, children map[string][]string, dirStats map[string]*DirStat, userStats map[string]*UserStat, groupStats map[string]*GroupStat, sizeStrMap, userSizeStr, groupSizeStr map[string]string, maxSizeWidth, maxFilesWidth int, levels int, showFiles, showUser, showGroup, bytesFlag bool, topN int, readMode bool, readOwners, readGroups map[string]string) {
-	// copy dirSizes from dirStats
-	dirSizes := make(map[string]int64, len(dirStats))
-	for k, v := range dirStats {
-		dirSizes[k] = v.Size
+	var formats, pathContains, pathNotContains stringList
+	flag.Var(&formats, "format", "output format: "+strings.Join(FormatterNames(), ", ")+" (default tree; repeatable with -output-dir)")
+	flag.Var(&pathContains, "path-contains", "count only files whose full path contains this substring (repeatable; any match)")
+	flag.Var(&pathNotContains, "path-not-contains", "skip files whose full path contains this substring (repeatable)")
+
+	// Custom usage text: show flags and emphasize that options must come before the positional root arg.
+	flag.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: %s [options] <root>\n\n", os.Args[0])
+		_, _ = fmt.Fprintln(os.Stderr, "Options:")
+		printVisibleDefaults(os.Stderr, flag.CommandLine)
+		_, _ = fmt.Fprintln(os.Stderr, "\nNote: flags (options) must be specified before the positional <root> argument.")
+		_, _ = fmt.Fprintln(os.Stderr, "Example:")
+		_, _ = fmt.Fprintf(os.Stderr, "  %s -levels 3 -files -user -group -bytes /path/to/dir\n", os.Args[0])
 	}
 
-	// sort children lists by descending total size (fallback to name)
-	for k := range children {
-		s := children[k]
-		sort.Slice(s, func(i, j int) bool {
-			si := dirSizes[s[i]]
-			sj := dirSizes[s[j]]
-			if si == sj {
-				return s[i] < s[j]
-			}
-			return si > sj
-		})
-		children[k] = s
-	}
-
-	// printing header
-	headerCols := []interface{}{}
-	headerFmt := fmt.Sprintf("%%%ds", maxSizeWidth)
-	headerCols = append(headerCols, "Size")
-	if showFiles {
-		headerFmt += " %" + strconv.Itoa(maxFilesWidth) + "s"
-		headerCols = append(headerCols, "Files")
-	}
-	if showUser {
-		headerFmt += " %-15s"
-		headerCols = append(headerCols, "User")
-	}
-	if showGroup {
-		headerFmt += " %-15s"
-		headerCols = append(headerCols, "Group")
-	}
-	headerFmt += " %s\n"
-	headerCols = append(headerCols, "Path")
-	fmt.Printf(headerFmt, headerCols...)
-
-	var printDirRec func(pathRel string, curLevel int, prefix string, isLast bool)
-	printDirRec = func(pathRel string, curLevel int, prefix string, isLast bool) {
-		stat := dirStats[pathRel]
-		// size string
-		sizeCombined := "0"
-		if val, ok := sizeStrMap[pathRel]; ok {
-			sizeCombined = val
-		} else if stat != nil {
-			if bytesFlag {
-				sizeCombined = strconv.FormatInt(stat.Size, 10)
-			} else {
-				sizeCombined = humanizeBytes(stat.Size)
-			}
-		}
-		filesStr := ""
-		if showFiles {
-			if stat != nil {
-				filesStr = strconv.FormatInt(stat.Files, 10)
-			} else {
-				filesStr = "0"
-			}
-		}
+	if err := applyEnvDefaults(flag.CommandLine, os.LookupEnv); err != nil {
+		log.Fatalf("%v", err)
+	}
+	flag.Parse()
+	if err := resetEnvUnits(flag.CommandLine); err != nil {
+		log.Fatalf("%v", err)
+	}
 
-		userStr := ""
-		groupStr := ""
-		if showUser || showGroup {
-			if readMode {
-				if showUser {
-					if v, ok := readOwners[pathRel]; ok {
-						userStr = v
-					}
-				}
-				if showGroup {
-					if v, ok := readGroups[pathRel]; ok {
-						groupStr = v
-					}
-				}
-			} else {
-				full := rootAbs
-				if pathRel != "." {
-					full = filepath.Join(rootAbs, pathRel)
-				}
-				if info, err := os.Lstat(full); err == nil {
-					if st, ok := info.Sys().(*syscall.Stat_t); ok {
-						uidStr := strconv.FormatUint(uint64(st.Uid), 10)
-						gidStr := strconv.FormatUint(uint64(st.Gid), 10)
-						if showUser {
-							if u, err := user.LookupId(uidStr); err == nil {
-								userStr = u.Username
-							} else {
-								userStr = uidStr
-							}
-						}
-						if showGroup {
-							if g, err := user.LookupGroupId(gidStr); err == nil {
-								groupStr = g.Name
-							} else {
-								groupStr = gidStr
-							}
-						}
-					}
-				}
-			}
+	// If user asked for help via -h or --help anywhere, print usage and exit.
+	for _, a := range os.Args[1:] {
+		if a == "-h" || a == "--help" {
+			flag.Usage()
+			return
 		}
+	}
 
-		var name string
-		if curLevel == 0 {
-			name = rootAbs
-		} else {
-			connector := ""
-			if isLast {
-				connector = "└── "
-			} else {
-				connector = "├── "
-			}
-			name = prefix + connector + filepath.Base(pathRel)
+	if *blockSize < 0 {
+		log.Fatalf("invalid -block-size %d", *blockSize)
+	}
+	asciiOut, err := parseEncoding(*encoding)
+	if err != nil {
+		log.Fatalf("-encoding: %v", err)
+	}
+	loc, err := parseTimezone(*timezone)
+	if err != nil {
+		log.Fatalf("-timezone: %v", err)
+	}
+	fo := FormatOptions{Bytes: *bytesFlag, Bits: *bitsFlag, HumanFiles: *humanFiles, BlockSize: *blockSize, ASCII: asciiOut, FixedUnit: *fixedUnit, Location: loc}
+	treeOpts := TreeOptions{
+		Levels:         *levels,
+		ShowFiles:      *showFiles,
+		ShowAvg:        *showAvg,
+		Concentration:  *concentration,
+		ShowUser:       *showUser,
+		ShowGroup:      *showGroup,
+		Format:         fo,
+		SizeWidth:      *sizeWidth,
+		FilesWidth:     *filesWidth,
+		SizeWidthMax:   *sizeWidthMax,
+		FilesWidthMax:  *filesWidthMax,
+		TopN:           *topN,
+		DominantOwner:  *dominantOwner,
+		RootLabel:      *rootLabel,
+		TopChildren:    *topChildren,
+		CollapseChains: *collapseChains,
+		Sort:           *sortOrder,
+		NormalizePaths: *normalizePaths,
+		Color:          *color,
+		DFCheck:        *dfCheck,
+		ShowFree:       *showFree,
+		Parents:        *parents,
+		DirCount:       *dirCount,
+		Width:          *width,
+	}
+	if treeOpts.Width == 0 {
+		treeOpts.Width = terminalWidth(os.Stdout)
+	}
+	for _, th := range []struct {
+		name string
+		val  string
+		dst  *int64
+	}{{"warn-over", *warnOver, &treeOpts.WarnOver}, {"critical-over", *criticalOver, &treeOpts.CriticalOver}, {"min-user-size", *minUserSize, &treeOpts.MinUserSize}, {"min-group-size", *minGroupSize, &treeOpts.MinGroupSize}} {
+		if th.val == "" {
+			continue
 		}
-
-		fmtStr := fmt.Sprintf("%%%ds", maxSizeWidth)
-		args := []interface{}{sizeCombined}
-		if showFiles {
-			fmtStr += " %" + strconv.Itoa(maxFilesWidth) + "s"
-			args = append(args, filesStr)
+		n, err := parseSize(th.val)
+		if err != nil {
+			log.Fatalf("-%s: %v", th.name, err)
 		}
-		if showUser {
-			fmtStr += " %-15s"
-			args = append(args, userStr)
+		*th.dst = n
+	}
+	if err := checkSortOrder(*sortOrder); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *colorScheme != "" {
+		switch {
+		case colorSchemeDefaults[*colorScheme] == "":
+			log.Fatalf("invalid -color-scheme %q (want magnitude, percent or age)", *colorScheme)
+		case treeOpts.WarnOver > 0 || treeOpts.CriticalOver > 0:
+			log.Fatalf("-color-scheme cannot be combined with -warn-over or -critical-over")
+		case *colorScheme == "age" && (*dirsOnly || *daemonMode || *archive != "" || *readJSON != "" || *fromList != ""):
+			log.Fatalf("-color-scheme age needs the file times of a scan; not available with -dirs-only, -daemon, -archive, -read-json or -from-list")
 		}
-		if showGroup {
-			fmtStr += " %-15s"
-			args = append(args, groupStr)
+		th, err := parseColorThresholds(*colorScheme, *colorThresholds)
+		if err != nil {
+			log.Fatalf("-color-thresholds: %v", err)
 		}
-		fmtStr += " %s\n"
-		args = append(args, name)
-		fmt.Printf(fmtStr, args...)
-
-		if curLevel >= levels {
-			return
+		treeOpts.ColorScheme, treeOpts.ColorThresholds = *colorScheme, th
+	} else if *colorThresholds != "" {
+		log.Fatalf("-color-thresholds needs -color-scheme")
+	}
+	var failOver int64
+	if *failOverFlag != "" {
+		n, err := parseSize(*failOverFlag)
+		if err != nil {
+			log.Fatalf("-fail-over: %v", err)
 		}
-
-		kids := children[pathRel]
-		for i, k := range kids {
-			last := i == len(kids)-1
-			childPrefix := prefix
-			if curLevel >= 0 {
-				if isLast {
-					childPrefix += "    "
-				} else {
-					childPrefix += "│   "
-				}
-			}
-			printDirRec(k, curLevel+1, childPrefix, last)
+		if *daemonMode || *compare || *largestGrowthN != 0 || *verifyJSON != "" {
+			log.Fatalf("-fail-over needs a single tree; not available with -daemon, -compare, -report-largest-growth or -verify-json")
 		}
+		failOver = n
 	}
-
-	if _, ok := dirStats["."]; !ok {
-		dirStats["."] = &DirStat{}
-	}
-
-	printDirRec(".", 0, "", true)
-
-	// per-user summary
-	fmt.Println()
-	fmt.Println("Per-user summary:")
-	userNames := make([]string, 0, len(userStats))
-	for u := range userStats {
-		userNames = append(userNames, u)
-	}
-	sort.Slice(userNames, func(i, j int) bool { return userStats[userNames[i]].Size > userStats[userNames[j]].Size })
-	if topN > 0 && topN < len(userNames) {
-		userNames = userNames[:topN]
+	var quotas []Quota
+	if *quotaFile != "" {
+		var err error
+		if quotas, err = LoadQuotas(*quotaFile); err != nil {
+			log.Fatalf("-quota: %v", err)
+		}
+		switch {
+		case *daemonMode || *fromList != "" || *compare || *largestGrowthN != 0 || *verifyJSON != "":
+			log.Fatalf("-quota needs owner totals; not available with -daemon, -from-list, -compare, -report-largest-growth or -verify-json")
+		case hasUserGroupQuota(quotas) && (*readJSON != "" || *archive != ""):
+			log.Fatalf("-quota: quotas of users within groups need a scan; not available with -read-json or -archive")
+		}
 	}
-	for _, u := range userNames {
-		s := userStats[u]
-		// combined user size string
-		sizeCombined := "0"
-		if val, ok := userSizeStr[u]; ok {
-			sizeCombined = val
-		} else if s != nil {
-			if bytesFlag {
-				sizeCombined = strconv.FormatInt(s.Size, 10)
-			} else {
-				sizeCombined = humanizeBytes(s.Size)
-			}
+	// exitOnAlarm exits with the -fail-over/-warn-over or -quota code once
+	// the output is written, when the totals call for one
+	exitOnAlarm := func(res *Result) {
+		code, msg := totalAlarm(res, failOver, treeOpts.WarnOver, fo)
+		if code != 0 {
+			log.Print(msg)
 		}
-		filesCount := int64(0)
-		if s != nil {
-			filesCount = s.Files
-		}
-		fmt.Printf("%-20s %"+strconv.Itoa(maxSizeWidth)+"s %"+strconv.Itoa(maxFilesWidth)+"d files\n", u, sizeCombined, filesCount)
-	}
-
-	// per-group summary
-	fmt.Println()
-	fmt.Println("Per-group summary:")
-	groupNames := make([]string, 0, len(groupStats))
-	for g := range groupStats {
-		groupNames = append(groupNames, g)
-	}
-	sort.Slice(groupNames, func(i, j int) bool { return groupStats[groupNames[i]].Size > groupStats[groupNames[j]].Size })
-	if topN > 0 && topN < len(groupNames) {
-		groupNames = groupNames[:topN]
-	}
-	for _, g := range groupNames {
-		s := groupStats[g]
-		sizeCombined := "0"
-		if val, ok := groupSizeStr[g]; ok {
-			sizeCombined = val
-		} else if s != nil {
-			if bytesFlag {
-				sizeCombined = strconv.FormatInt(s.Size, 10)
-			} else {
-				sizeCombined = humanizeBytes(s.Size)
+		if quotas != nil {
+			violations, err := checkQuotas(res, quotas)
+			if err != nil {
+				fatalf("-quota: %v", err)
+			}
+			printQuotaReport(os.Stderr, violations, fo)
+			if code == 0 {
+				code = quotaExit(violations)
 			}
 		}
-		filesCount := int64(0)
-		if s != nil {
-			filesCount = s.Files
+		if code != 0 {
+			exitWith(code)
 		}
-		fmt.Printf("%-20s %"+strconv.Itoa(maxSizeWidth)+"s %"+strconv.Itoa(maxFilesWidth)+"d files\n", g, sizeCombined, filesCount)
 	}
-}
-
-// buildChildrenAndSizes builds the children map and dirSizes map from dirStats.
-func buildChildrenAndSizes(dirStats map[string]*DirStat) (map[string][]string, map[string]int64) {
-	children := make(map[string][]string)
-	for p := range dirStats {
-		if p == "." {
-			children["."] = children["."] // ensure key exists
-			continue
-		}
-		parent := filepath.Dir(p)
-		if parent == "" {
-			parent = "."
-		}
-		children[parent] = append(children[parent], p)
-		if _, ok := children[p]; !ok {
-			children[p] = []string{}
+	snapFilter := SnapshotFilter{Subtree: *subtree, OnlyUser: *onlyUserFlag}
+	if *minSize != "" {
+		n, err := parseSize(*minSize)
+		if err != nil {
+			log.Fatalf("-min-size: %v", err)
 		}
+		snapFilter.MinSize = n
 	}
-	dirSizes := make(map[string]int64, len(dirStats))
-	for k, v := range dirStats {
-		dirSizes[k] = v.Size
+	if snapFilter.active() && *readJSON == "" {
+		log.Fatalf("-subtree, -only-user and -min-size apply to -read-json only")
 	}
-	return children, dirSizes
-}
-
-func main() {
-	var (
-		levels      = flag.Int("levels", 2, "number of directory levels to display (0 means only root)")
-		showUser    = flag.Bool("user", false, "show directory owner user")
-		showGroup   = flag.Bool("group", false, "show directory owner group")
-		showFiles   = flag.Bool("files", false, "show number of files per directory")
-		root        = flag.String("root", ".", "root path to analyze (can also be specified as first positional argument)")
-		concurrency = flag.Int("concurrency", runtime.NumCPU()*2, "number of concurrent directory readers")
-		bytesFlag   = flag.Bool("bytes", false, "print sizes in bytes instead of human-readable units")
-		sizeWidth   = flag.Int("size-width", 0, "override size column width (0 = auto-fit)")
-		filesWidth  = flag.Int("files-width", 0, "override files column width (0 = auto-fit)")
-		topN        = flag.Int("top", 0, "limit per-user/group lists to top N by size (0 = all)")
-		jsonOut     = flag.String("json", "", "write JSON summary to file (or '-' for stdout)")
-		readJSON    = flag.String("read-json", "", "read JSON summary from file and print human tree (skips scanning)")
-		versionFlag = flag.Bool("version", false, "show version and exit")
-	)
-
-	// Custom usage text: show flags and emphasize that options must come before the positional root arg.
-	flag.Usage = func() {
-		_, _ = fmt.Fprintf(os.Stderr, "Usage: %s [options] <root>\n\n", os.Args[0])
-		_, _ = fmt.Fprintln(os.Stderr, "Options:")
-		flag.PrintDefaults()
-		_, _ = fmt.Fprintln(os.Stderr, "\nNote: flags (options) must be specified before the positional <root> argument.")
-		_, _ = fmt.Fprintln(os.Stderr, "Example:")
-		_, _ = fmt.Fprintf(os.Stderr, "  %s -levels 3 -files -user -group -bytes /path/to/dir\n", os.Args[0])
+	if err := checkUnknownOwner(*unknownOwner); err != nil {
+		log.Fatalf("%v", err)
 	}
+	if *unknownOwner == unknownOwnerBucket && *parallelLookup {
+		log.Fatalf("-unknown-owner bucket cannot be combined with -parallel-lookup")
+	}
+	if *jsonMaxDepth < 0 {
+		log.Fatalf("invalid -json-max-depth %d (must be >= 0)", *jsonMaxDepth)
+	}
+	if *listDelimiter != "" && *fromList == "" {
+		log.Fatalf("-list-delimiter applies to -from-list only")
+	}
+	if *stripComps < 0 {
+		log.Fatalf("invalid -strip-components %d (must be >= 0)", *stripComps)
+	}
+	if *stripComps > 0 && *fromList == "" && *archive == "" {
+		log.Fatalf("-strip-components applies to -archive and -from-list only")
+	}
+	comp, err := lookupCompressor(*compress)
+	if err != nil {
+		log.Fatalf("-compress: %v", err)
+	}
+	*jsonOut = addCompressExt(*jsonOut, comp)
+	*summaryCSV = addCompressExt(*summaryCSV, comp)
 
-	flag.Parse()
-
-	// If user asked for help via -h or --help anywhere, print usage and exit.
-	for _, a := range os.Args[1:] {
-		if a == "-h" || a == "--help" {
-			flag.Usage()
-			return
+	switch *onWriteError {
+	case onWriteErrorFatal, onWriteErrorStdout, onWriteErrorTmp:
+	default:
+		log.Fatalf("invalid -on-write-error %q (want 'fatal', 'stdout' or 'tmp')", *onWriteError)
+	}
+	// reportLookups prints the -profile-lookups counters to stderr
+	reportLookups := func() {
+		if *profileLookups {
+			ls := lookupStats()
+			log.Printf("name lookups: %d calls (%s), %d cache hits, %d cache misses", ls.Calls, ls.Duration, ls.CacheHits, ls.CacheMisses)
+		}
+	}
+	// writeOutput writes an output file (or stdout for '-'), applying
+	// -on-write-error when the file cannot be written
+	writeFailed := false
+	writeOutput := func(path, what string, write func(io.Writer) error) {
+		if writeOutputFile(path, what, *onWriteError, write) {
+			writeFailed = true
 		}
 	}
 
-	// Shared variables for scanning and read-json mode
-	var (
-		rootAbs       string
-		children      map[string][]string
-		dirStats      map[string]*DirStat
-		userStats     map[string]*UserStat
-		groupStats    map[string]*GroupStat
-		dirSizes      map[string]int64
-		sizeStrMap    map[string]string
-		userSizeStr   map[string]string
-		groupSizeStr  map[string]string
-		maxSizeWidth  int
-		maxFilesWidth int
-		readMode      bool
-		readOwners    map[string]string
-		readGroups    map[string]string
-	)
+	formatCfg := FormatConfig{Tree: treeOpts, Summary: SummaryOptions{Version: version, OmitEmpty: *jsonOmitEmpty, MaxDepth: *jsonMaxDepth, OwnerBreakdown: *jsonOwners, RootLabel: *rootLabel, StatsOnly: *jsonStatsOnly, NormalizePaths: *normalizePaths, Numeric: *jsonNumeric, SkipDirOwner: *skipDirOwner, Location: loc, UnknownOwner: *unknownOwner, ProfileLookups: *profileLookups, AvgFileSize: *showAvg, TreeOrder: *jsonTreeOrder, CompactArrays: !*jsonIndentArrays, Strict: *strict, Concentration: *concentration, MinUserSize: treeOpts.MinUserSize, MinGroupSize: treeOpts.MinGroupSize}}
 
 	// If user asked for version, print and exit
 	if *versionFlag {
@@ -370,50 +419,203 @@ func main() {
 		return
 	}
 
-	// If read-json was provided, load file and prepare data structures for printing, then jump to printing
-	if *readJSON != "" {
-		// read JSON (allow '-' for stdin)
-		jo, err := LoadSummary(*readJSON)
+	loadJSON := LoadSummary
+	if *strictLoad {
+		loadJSON = LoadSummaryStrict
+	}
+
+	// If verify-json was provided, check the summary's invariants and exit
+	if *verifyJSON != "" {
+		jo, err := loadJSON(*verifyJSON)
 		if err != nil {
 			log.Fatalf("failed to load json: %v", err)
 		}
+		violations := VerifySummary(jo)
+		for _, v := range violations {
+			fmt.Println(v)
+		}
+		if len(violations) > 0 {
+			fmt.Printf("%d violation(s) found\n", len(violations))
+			os.Exit(1)
+		}
+		if jo.statsOnly() {
+			fmt.Println("OK: stats-only summary (-json-stats-only), no dirs, users or groups to check")
+			return
+		}
+		fmt.Println("OK: summary is consistent")
+		return
+	}
 
-		// build maps from jo
-		dirStats = make(map[string]*DirStat)
-		userStats = make(map[string]*UserStat)
-		groupStats = make(map[string]*GroupStat)
-		ownerByRel := make(map[string]string)
-		groupByRel := make(map[string]string)
+	// If compare was requested, render the two snapshots side by side and exit
+	if *compare {
+		if flag.NArg() != 2 {
+			log.Fatalf("-compare needs two JSON summaries: -compare old.json new.json")
+		}
+		var snaps [2]*Result
+		for i, path := range flag.Args() {
+			jo, err := loadJSON(path)
+			if err == nil && jo.statsOnly() {
+				err = fmt.Errorf("%s: %w", path, errStatsOnly)
+			}
+			if err != nil {
+				log.Fatalf("failed to load json: %v", err)
+			}
+			snaps[i] = resultFromSummary(jo)
+		}
+		if *jsonOut != "" {
+			diff := diffResults(snaps[0], snaps[1])
+			writeOutput(*jsonOut, "json diff", compressWrite(comp, func(w io.Writer) error {
+				return writeDiffJSON(w, diff, !*jsonIndentArrays)
+			}))
+			if writeFailed {
+				os.Exit(1)
+			}
+			return
+		}
+		bw := bufio.NewWriter(os.Stdout)
+		printCompareTree(bw, snaps[0], snaps[1], treeOpts)
+		if err := bw.Flush(); err != nil {
+			log.Fatalf("failed to write output: %v", err)
+		}
+		return
+	}
 
-		for _, d := range jo.Dirs {
-			rel := d.Rel
-			if rel == "" {
-				rel = "."
+	// If a growth report was requested, list the files that grew and exit
+	if *largestGrowthN != 0 {
+		if *largestGrowthN < 0 {
+			log.Fatalf("invalid -report-largest-growth %d (must be >= 0)", *largestGrowthN)
+		}
+		if flag.NArg() != 2 {
+			log.Fatalf("-report-largest-growth needs two JSON summaries: -report-largest-growth N old.json new.json")
+		}
+		var snaps [2]*Result
+		for i, path := range flag.Args() {
+			jo, err := loadJSON(path)
+			if err == nil && jo.statsOnly() {
+				err = fmt.Errorf("%s: %w", path, errStatsOnly)
 			}
-			dirStats[rel] = &DirStat{Size: d.Size, Files: d.Files}
-			ownerByRel[rel] = d.User
-			groupByRel[rel] = d.Group
+			if err != nil {
+				log.Fatalf("failed to load json: %v", err)
+			}
+			snaps[i] = resultFromSummary(jo)
+		}
+		rows, err := largestGrowth(snaps[0], snaps[1], *largestGrowthN)
+		if err != nil {
+			log.Fatalf("-report-largest-growth: %v", err)
+		}
+		bw := bufio.NewWriter(os.Stdout)
+		printLargestGrowth(bw, rows, fo)
+		if err := bw.Flush(); err != nil {
+			log.Fatalf("failed to write output: %v", err)
 		}
+		return
+	}
 
-		for _, u := range jo.Users {
-			userStats[u.Name] = &UserStat{Size: u.Size, Files: u.Files}
+	// If from-list was provided, build the tree from the listed paths and exit
+	if *fromList != "" {
+		res, err := LoadPathList(*fromList, strings.ReplaceAll(*listDelimiter, `\t`, "\t"), *stripComps)
+		if err != nil {
+			log.Fatalf("-from-list: %v", err)
 		}
-		for _, g := range jo.Grps {
-			groupStats[g.Name] = &GroupStat{Size: g.Size, Files: g.Files}
+		if err := (TreeFormatter{Opts: treeOpts}).Write(os.Stdout, res); err != nil {
+			log.Fatalf("failed to write output: %v", err)
 		}
+		exitOnAlarm(res)
+		return
+	}
 
-		if jo.Root != "" {
-			rootAbs = filepath.Clean(jo.Root)
-		} else {
-			rootAbs = "."
+	if *jsonChunkSize < 0 {
+		log.Fatalf("invalid -json-chunk-size %d (must be >= 0)", *jsonChunkSize)
+	}
+	if *jsonChunkSize > 0 && (*jsonOut == "" || *jsonOut == "-") {
+		log.Fatalf("-json-chunk-size requires -json with a file target")
+	}
+	// resolve the output backend before spending time on the scan or
+	// loading summaries
+	if len(formats) == 0 {
+		formats = stringList{"tree"}
+	}
+	if len(formats) > 1 && *outputDir == "" {
+		log.Fatalf("several -format values need -output-dir")
+	}
+	for _, name := range formats {
+		if _, err := NewFormatter(name, formatCfg); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if *outputDir != "" {
+		if *jsonOut != "" || *print0 {
+			log.Fatalf("-output-dir cannot be combined with -json or -print0; give them as -format json or -format print0")
+		}
+		if err := os.MkdirAll(*outputDir, 0755); err != nil {
+			log.Fatalf("-output-dir: %v", err)
+		}
+	}
+	outFormat := formats[0]
+	if *print0 {
+		outFormat = "print0"
+	}
+	if *jsonOut != "" {
+		outFormat = "json"
+	}
+	formatter, err := NewFormatter(outFormat, formatCfg)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	// writeResult writes res to its outputs: the -json file (split with
+	// -json-chunk-size), the -output-dir files or stdout
+	writeResult := func(res *Result) {
+		write := func(w io.Writer) error { return formatter.Write(w, res) }
+		switch {
+		case *jsonChunkSize > 0:
+			if err := WriteChunkedSummary(*jsonOut, res, formatCfg.Summary, *jsonChunkSize, comp); err != nil {
+				fatalf("failed to write chunked json: %v", err)
+			}
+		case *jsonOut != "":
+			writeOutput(*jsonOut, "json", compressWrite(comp, write))
+		case *outputDir != "":
+			files, err := outputDirFiles(*outputDir, formats, formatCfg, res, comp)
+			if err != nil {
+				fatalf("-output-dir: %v", err)
+			}
+			for _, f := range files {
+				writeOutput(f.Path, filepath.Base(f.Path), f.Write)
+			}
+		case *summaryCSV != "-":
+			if err := write(os.Stdout); err != nil {
+				fatalf("failed to write output: %v", err)
+			}
+		}
+	}
+
+	// If read-json was provided, load file and prepare data structures for printing, then jump to printing
+	if *readJSON != "" {
+		// read JSON (allow '-' for stdin); extra positional args are merged in
+		jo, err := LoadSummaries(append([]string{*readJSON}, flag.Args()...), *strictLoad)
+		if err != nil {
+			log.Fatalf("failed to load json: %v", err)
+		}
+		if *recompute {
+			jo = RecomputeSummary(jo)
 		}
 
-		children, dirSizes = buildChildrenAndSizes(dirStats)
-		sizeStrMap, userSizeStr, groupSizeStr, maxSizeWidth, maxFilesWidth = ComputeSizeMapsAndWidths(dirSizes, dirStats, userStats, groupStats, *bytesFlag, *sizeWidth, *filesWidth)
-		readMode = true
-		readOwners = ownerByRel
-		readGroups = groupByRel
-		printTree(rootAbs, children, dirStats, userStats, groupStats, sizeStrMap, userSizeStr, groupSizeStr, maxSizeWidth, maxFilesWidth, *levels, *showFiles, *showUser, *showGroup, *bytesFlag, *topN, readMode, readOwners, readGroups)
+		res := resultFromSummary(jo)
+		if err := snapFilter.Apply(res); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if *summaryCSV != "" {
+			writeOutput(*summaryCSV, "summary csv", summaryCSVWriter(res, treeOpts, comp))
+		}
+		for _, note := range loadedGaps(res, formatCfg) {
+			log.Printf("note: %s", note)
+		}
+		writeResult(res)
+		reportLookups()
+		if writeFailed {
+			os.Exit(1)
+		}
+		exitOnAlarm(res)
 		return
 	}
 
@@ -431,148 +633,437 @@ func main() {
 	}
 	rootAbs = filepath.Clean(rootAbs)
 
-	// record start time for runtime measurement
-	startedAt := time.Now()
-
-	// take initial memory snapshot to help estimate peak memory during run
-	var msStart runtime.MemStats
-	runtime.ReadMemStats(&msStart)
-
-	// channel of file paths to process and worker waitgroup
-	filesToProcess := make(chan string, *concurrency*8)
-	var workerWg sync.WaitGroup
-
-	// Stats maps with mutex
-	var mu sync.Mutex
-	dirStats = make(map[string]*DirStat) // key: relative path to root (".")
-	userStats = make(map[string]*UserStat)
-	groupStats = make(map[string]*GroupStat)
-
-	// start workers that stat files and aggregate directly
-	for i := 0; i < *concurrency; i++ {
-		workerWg.Add(1)
-		go func() {
-			defer workerWg.Done()
-			for path := range filesToProcess {
-				info, err := os.Lstat(path)
-				if err != nil {
-					continue
-				}
-				// get size and owner
-				size := info.Size()
-				var uid uint32
-				var gid uint32
-				if st, ok := info.Sys().(*syscall.Stat_t); ok {
-					uid = st.Uid
-					gid = st.Gid
-				}
-
-				// compute relative directory path
-				fileDir := filepath.Dir(path)
-				rel, err := filepath.Rel(rootAbs, fileDir)
-				if err != nil {
-					rel = fileDir
-				}
-				if rel == "" {
-					rel = "."
-				}
-
-				// aggregate into dirStats and user/group maps
-				mu.Lock()
-				p := rel
-				for {
-					if _, ok := dirStats[p]; !ok {
-						dirStats[p] = &DirStat{}
-					}
-					dirStats[p].Size += size
-					dirStats[p].Files += 1
-					if p == "." {
-						break
-					}
-					p = filepath.Dir(p)
-				}
-
-				uidStr := strconv.FormatUint(uint64(uid), 10)
-				gidStr := strconv.FormatUint(uint64(gid), 10)
-				var uname, gname string
-				if u, err := user.LookupId(uidStr); err == nil {
-					uname = u.Username
-				} else {
-					uname = uidStr
-				}
-				if g, err := user.LookupGroupId(gidStr); err == nil {
-					gname = g.Name
-				} else {
-					gname = gidStr
-				}
-				if _, ok := userStats[uname]; !ok {
-					userStats[uname] = &UserStat{}
-				}
-				userStats[uname].Size += size
-				userStats[uname].Files += 1
-				if _, ok := groupStats[gname]; !ok {
-					groupStats[gname] = &GroupStat{}
-				}
-				groupStats[gname].Size += size
-				groupStats[gname].Files += 1
-				mu.Unlock()
-			}
-		}()
+	if *walkOrder != "lexical" && *walkOrder != "size" {
+		log.Fatalf("invalid -walk-order %q (want 'lexical' or 'size')", *walkOrder)
 	}
 
-	// atomic counters for scanned items
-	var filesScanned int64
-	var dirsScanned int64
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	if *deadline != "" {
+		d, err := parseDeadline(*deadline, time.Now())
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, d)
+		defer cancel()
+	}
 
-	// Walk directory tree in main goroutine and push file paths into filesToProcess
-	err = filepath.WalkDir(rootAbs, func(path string, d fs.DirEntry, err error) error {
+	scanOpts := ScanOptions{
+		Concurrency:    *concurrency,
+		MaxFiles:       *maxFiles,
+		WalkOrder:      *walkOrder,
+		Samples:        *samples,
+		Seed:           *seed,
+		Throttle:       *throttle,
+		StatRetries:    *statRetries,
+		ByDevice:       *byDevice,
+		DirsOnly:       *dirsOnly,
+		MaxUsers:       *maxUsers,
+		MaxGroups:      *maxGroups,
+		GroupByPrimary: *groupByPrimary,
+		ParallelLookup: *parallelLookup,
+		UnknownOwner:   *unknownOwner,
+		DirOwners:      *dominantOwner || *jsonOwners,
+		FileLists:      *jsonFileLists,
+		DirNewest:      *colorScheme == "age",
+		DirCount:       *dirCount,
+		NewestFiles:    *newestFiles,
+		BlockSize:      *blockSize,
+		Filter:         PathFilter{Contains: pathContains, NotContains: pathNotContains, IgnoreCase: *ignoreCase},
+		SkipRootFiles:  *skipRootFiles,
+		OldestFiles:    *oldestFiles,
+		ExtByUser:      *extByUser,
+		HiddenReport:   *hiddenReport,
+		ExpandArchives: *expandArchives,
+		// only quotas of users within groups need the pair totals
+		UserGroupTotals: hasUserGroupQuota(quotas),
+		SnapshotName:    *snapshotName,
+		InlineBelow:     *inlineBelow,
+	}
+	if *statRetries < 0 {
+		log.Fatalf("invalid -stat-retries %d (must be >= 0)", *statRetries)
+	}
+	for _, b := range []struct {
+		name string
+		val  string
+		dst  *int64
+	}{{"file-min-size", *fileMinSize, &scanOpts.FileMinSize}, {"file-max-size", *fileMaxSize, &scanOpts.FileMaxSize}} {
+		if b.val == "" {
+			continue
+		}
+		n, err := parseSize(b.val)
 		if err != nil {
-			// skip unreadable entries
-			return nil
+			log.Fatalf("-%s: %v", b.name, err)
 		}
-		if d.IsDir() {
-			atomic.AddInt64(&dirsScanned, 1)
-			return nil
+		*b.dst = n
+	}
+	for _, om := range []struct {
+		name, path string
+		dst        **OwnerMap
+	}{{"user-map", *userMapFile, &scanOpts.UserMap}, {"group-map", *groupMapFile, &scanOpts.GroupMap}} {
+		if om.path == "" {
+			continue
 		}
-		atomic.AddInt64(&filesScanned, 1)
-		filesToProcess <- path
-		return nil
-	})
-	if err != nil {
-		log.Printf("walk error: %v", err)
+		m, err := LoadOwnerMap(om.path)
+		if err != nil {
+			log.Fatalf("-%s: %v", om.name, err)
+		}
+		*om.dst = m
+	}
+	if *changedSince != "" {
+		t, err := parseChangedSince(*changedSince, time.Now())
+		if err != nil {
+			log.Fatalf("-changed-since: %v", err)
+		}
+		scanOpts.ChangedSince = t
+	}
+	if *olderThanFile != "" {
+		t, err := referenceMtime(*olderThanFile)
+		if err != nil {
+			log.Fatalf("-older-than-file: %v", err)
+		}
+		scanOpts.ModifiedBefore = t
+	}
+	if *dirsOnly || *daemonMode {
+		// both total whole directories, without the per-file features
+		mode := "-dirs-only"
+		if *daemonMode {
+			mode = "-daemon"
+		}
+		switch {
+		case *samples > 0:
+			log.Fatalf("%s cannot be combined with -samples", mode)
+		case *newestFiles > 0 || *oldestFiles > 0:
+			log.Fatalf("%s cannot be combined with -newest-files or -oldest-files", mode)
+		case *dupes || *manifest != "":
+			log.Fatalf("%s cannot be combined with -dupes or -manifest", mode)
+		case *extByUser:
+			log.Fatalf("%s cannot be combined with -ext-by-user", mode)
+		case *hiddenReport:
+			log.Fatalf("%s cannot be combined with -hidden-report", mode)
+		case *jsonFileLists:
+			log.Fatalf("%s cannot be combined with -json-files", mode)
+		case *expandArchives:
+			log.Fatalf("%s cannot be combined with -expand-archives", mode)
+		case *byDevice || *dedupBinds:
+			log.Fatalf("%s cannot be combined with -by-device or -dedup-binds", mode)
+		case *maxMemory != "":
+			log.Fatalf("%s cannot be combined with -max-memory", mode)
+		}
+	}
+	if *daemonMode {
+		switch {
+		case runDaemon == nil:
+			log.Fatalf("-daemon support is not built in (rebuild with -tags daemon)")
+		case *jsonOut == "" || *jsonOut == "-":
+			log.Fatalf("-daemon requires -json with a file target")
+		case *dirCount:
+			log.Fatalf("-daemon cannot be combined with -dir-count")
+		case *progressBarFlag:
+			log.Fatalf("-daemon cannot be combined with -progress-bar")
+		case *archive != "" || *maxFiles > 0:
+			log.Fatalf("-daemon cannot be combined with -archive or -max-files")
+		case *jsonChunkSize > 0 || *snapshotInterval > 0:
+			log.Fatalf("-daemon cannot be combined with -json-chunk-size or -json-snapshot-interval")
+		case *daemonInterval <= 0 || *daemonRescan <= 0:
+			log.Fatalf("-daemon-interval and -daemon-rescan must be positive")
+		}
+	}
+	if *maxMemory != "" {
+		n, err := parseSize(*maxMemory)
+		if err != nil {
+			log.Fatalf("-max-memory: %v", err)
+		}
+		switch {
+		case *snapshotInterval > 0:
+			log.Fatalf("-max-memory cannot be combined with -json-snapshot-interval")
+		case *dominantOwner || *jsonOwners:
+			log.Fatalf("-max-memory cannot be combined with -dominant-owner or -json-owner-breakdown")
+		case *parents > 0:
+			log.Fatalf("-max-memory cannot be combined with -parents")
+		case *jsonChunkSize > 0:
+			log.Fatalf("-max-memory cannot be combined with -json-chunk-size")
+		case *jsonTreeOrder:
+			log.Fatalf("-max-memory cannot be combined with -json-include-tree-order")
+		case *strict:
+			log.Fatalf("-max-memory cannot be combined with -strict")
+		}
+		scanOpts.MaxMemory = n
+		scanOpts.KeepDepth = *levels
+	}
+	if _, err := lookupHash(*hashAlgo); err != nil {
+		log.Fatalf("-hash: %v", err)
+	}
+	if *dupes {
+		scanOpts.DupesHash = *hashAlgo
+	}
+	if *extByUser && *archive != "" {
+		log.Fatalf("-ext-by-user cannot be combined with -archive")
+	}
+	if *hiddenReport && *archive != "" {
+		log.Fatalf("-hidden-report cannot be combined with -archive")
+	}
+	if *expandArchives && (*archive != "" || *jsonStream) {
+		log.Fatalf("-expand-archives cannot be combined with -archive or -json-stream-from-scan")
+	}
+	if *jsonFileLists && (*archive != "" || *maxMemory != "" || *jsonStream) {
+		log.Fatalf("-json-files cannot be combined with -archive, -max-memory or -json-stream-from-scan")
+	}
+	if *manifest != "" {
+		if *archive != "" {
+			log.Fatalf("-manifest cannot be combined with -archive")
+		}
+		scanOpts.ManifestHash = *hashAlgo
+	}
+	if scanOpts.FileMaxSize > 0 && scanOpts.FileMinSize > scanOpts.FileMaxSize {
+		log.Fatalf("-file-min-size %s is larger than -file-max-size %s", *fileMinSize, *fileMaxSize)
+	}
+	if *skipMounts {
+		mounts, err := readMounts()
+		if err != nil {
+			log.Fatalf("-skip-mounts: %v", err)
+		}
+		scanOpts.SkipDirs = mountsToSkip(mounts, rootAbs, strings.Split(*skipMountTypes, ","))
+	}
+	if *includeFSType != "" || *excludeFSType != "" {
+		if *archive != "" {
+			log.Fatalf("-include-fstype and -exclude-fstype need a scan; not available with -archive")
+		}
+		mounts, err := readMounts()
+		if err != nil {
+			log.Fatalf("-include-fstype/-exclude-fstype: %v", err)
+		}
+		if scanOpts.SkipDirs == nil {
+			scanOpts.SkipDirs = make(map[string]bool)
+		}
+		for p := range mountsByFSType(mounts, rootAbs, strings.Split(*includeFSType, ","), strings.Split(*excludeFSType, ",")) {
+			scanOpts.SkipDirs[p] = true
+		}
+	}
+	if *dedupBinds {
+		mounts, err := readMounts()
+		if err != nil {
+			log.Fatalf("-dedup-binds: %v", err)
+		}
+		scanOpts.DedupDevs = make(map[uint64]bool)
+		for majMin := range bindDuplicateDevs(mounts, rootAbs) {
+			dev, err := devNumber(majMin)
+			if err != nil {
+				log.Fatalf("-dedup-binds: %v", err)
+			}
+			scanOpts.DedupDevs[dev] = true
+		}
+	}
+	if *jsonStream {
+		switch {
+		case *jsonOut == "":
+			log.Fatalf("-json-stream-from-scan requires -json")
+		case *dirsOnly || *daemonMode || *archive != "" || *maxMemory != "":
+			log.Fatalf("-json-stream-from-scan cannot be combined with -dirs-only, -daemon, -archive or -max-memory")
+		case *jsonChunkSize > 0 || *snapshotInterval > 0 || *jsonStatsOnly:
+			log.Fatalf("-json-stream-from-scan cannot be combined with -json-chunk-size, -json-snapshot-interval or -json-stats-only")
+		case *jsonTreeOrder || *strict:
+			log.Fatalf("-json-stream-from-scan cannot be combined with -json-include-tree-order or -strict")
+		}
+	}
+	if *snapshotInterval > 0 {
+		if *jsonOut == "" || *jsonOut == "-" {
+			log.Fatalf("-json-snapshot-interval requires -json with a file target")
+		}
+		scanOpts.SnapshotInterval = *snapshotInterval
+		scanOpts.OnSnapshot = snapshotWriter(*jsonOut, formatCfg.Summary, comp)
 	}
 
-	// finished enqueuing paths; close and wait for workers
-	close(filesToProcess)
-	workerWg.Wait()
+	if *verbose {
+		var outputs []string
+		target := func(path string) string {
+			if path == "-" {
+				return "stdout"
+			}
+			return path
+		}
+		switch {
+		case *jsonStream:
+			outputs = append(outputs, "json stream to "+target(*jsonOut))
+		case *jsonOut != "":
+			outputs = append(outputs, "json to "+target(*jsonOut))
+		case *outputDir != "":
+			for _, name := range formats {
+				outputs = append(outputs, name+" to "+*outputDir)
+			}
+		case *summaryCSV != "-":
+			outputs = append(outputs, outFormat+" to stdout")
+		}
+		if *summaryCSV != "" {
+			outputs = append(outputs, "summary csv to "+target(*summaryCSV))
+		}
+		if *manifest != "" {
+			outputs = append(outputs, "manifest to "+target(*manifest))
+		}
+		input := rootAbs
+		if *archive != "" {
+			input = *archive + " (archive)"
+		}
+		_, _ = fmt.Fprint(os.Stderr, newRunConfig(input, scanOpts, fo, outputs))
+	}
 
-	// Build children map for printing
-	mu.Lock()
-	children, dirSizes = buildChildrenAndSizes(dirStats)
-	mu.Unlock()
+	// If a dry run was requested, walk without statting, report and exit
+	if *dryRun {
+		if *archive != "" || *daemonMode || *benchmarkFiles != 0 {
+			log.Fatalf("-dry-run walks a directory tree; not available with -archive, -daemon or -benchmark")
+		}
+		dryOpts := scanOpts
+		dryOpts.DryRun = true
+		res := Scan(ctx, rootAbs, dryOpts)
+		printDryRun(os.Stdout, res, newRunConfig(rootAbs, scanOpts, fo, nil), scanOpts)
+		return
+	}
 
-	// compute size strings and widths using helper (testable)
-	sizeStrMap, userSizeStr, groupSizeStr, maxSizeWidth, maxFilesWidth = ComputeSizeMapsAndWidths(dirSizes, dirStats, userStats, groupStats, *bytesFlag, *sizeWidth, *filesWidth)
+	// If a benchmark was requested, scan a synthetic tree instead and exit
+	if *benchmarkFiles != 0 {
+		if *benchmarkFiles < 0 || flag.NArg() != 1 {
+			log.Fatalf("-benchmark needs a positive file count and the tree's depth: -benchmark 100000 4")
+		}
+		depth, err := strconv.Atoi(flag.Arg(0))
+		if err != nil || depth < 0 {
+			log.Fatalf("-benchmark: invalid depth %q", flag.Arg(0))
+		}
+		b, err := runBenchmark(ctx, *benchmarkFiles, depth, scanOpts)
+		if err != nil {
+			log.Fatalf("-benchmark: %v", err)
+		}
+		printBenchmark(os.Stdout, b, scanOpts.Concurrency)
+		return
+	}
 
-	// If JSON output requested, build JSON structure and write it before human output
-	if *jsonOut != "" {
-		// compute ended/ runtime now
-		endedAt := time.Now()
-		b, err := MarshalSummary(rootAbs, dirStats, userStats, groupStats, startedAt, endedAt, msStart, atomic.LoadInt64(&dirsScanned), atomic.LoadInt64(&filesScanned), version)
+	if *daemonMode {
+		dctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		err := runDaemon(dctx, DaemonConfig{
+			Root:     rootAbs,
+			Scan:     scanOpts,
+			Out:      *jsonOut,
+			Summary:  formatCfg.Summary,
+			Compress: comp,
+			Interval: *daemonInterval,
+			Rescan:   *daemonRescan,
+		})
 		if err != nil {
-			log.Fatalf("failed to build json: %v", err)
+			log.Fatalf("-daemon: %v", err)
 		}
-		if *jsonOut == "-" {
-			fmt.Println(string(b))
-		} else {
-			if err := os.WriteFile(*jsonOut, b, 0644); err != nil {
-				log.Fatalf("failed to write json file: %v", err)
+		return
+	}
+
+	var bar *progressBar
+	if *progressBarFlag {
+		if *archive != "" {
+			log.Fatalf("-progress-bar needs a scan; not available with -archive")
+		}
+		var estimate int64
+		if *progressEstimate != "" {
+			jo, err := loadJSON(*progressEstimate)
+			if err != nil {
+				log.Fatalf("-progress-estimate: %v", err)
 			}
+			estimate = jo.Stats.FilesScanned
 		}
-		return
+		width := terminalWidth(os.Stderr)
+		if width == 0 {
+			width = progressDefaultWidth
+		}
+		bar = &progressBar{w: os.Stderr, total: progressTotal(*maxFiles, estimate), width: width}
+		scanOpts.ProgressInterval, scanOpts.OnProgress = progressInterval, bar.update
+	} else if *progressEstimate != "" {
+		log.Fatalf("-progress-estimate needs -progress-bar")
 	}
 
-	// print tree and summaries
-	printTree(rootAbs, children, dirStats, userStats, groupStats, sizeStrMap, userSizeStr, groupSizeStr, maxSizeWidth, maxFilesWidth, *levels, *showFiles, *showUser, *showGroup, *bytesFlag, *topN, readMode, readOwners, readGroups)
-	return
+	var res *Result
+	if *archive != "" {
+		res, err = ScanArchive(*archive, *stripComps)
+		if err != nil {
+			log.Fatalf("failed to read archive: %v", err)
+		}
+		// the archive's files come from elsewhere, so no host is recorded
+		res.SnapshotName = *snapshotName
+	} else {
+		var errs *errorReporter
+		if *showErrors {
+			errs = newErrorReporter(os.Stderr, defaultErrorLimit)
+			scanOpts.OnError = errs.Report
+		}
+		var stream *dirStreamer
+		var closeStream func() error
+		if *jsonStream {
+			w, closeFn, err := createOutput(*jsonOut, comp)
+			if err != nil {
+				log.Fatalf("-json-stream-from-scan: %v", err)
+			}
+			stream, closeStream = newDirStreamer(w, rootAbs, formatCfg.Summary), closeFn
+			scanOpts.OnDirDone = stream.dirDone
+		}
+		res = Scan(ctx, rootAbs, scanOpts)
+		// a -max-memory spill can be large: remove it however main ends
+		spilled := res
+		onExit(func() {
+			if err := spilled.Close(); err != nil {
+				log.Printf("max-memory: removing spill: %v", err)
+			}
+		})
+		defer runAtExit()
+		if bar != nil {
+			bar.finish(res.FilesScanned)
+		}
+		if errs != nil {
+			errs.Close()
+		}
+		if stream != nil {
+			if err := stream.finish(res); err != nil {
+				fatalf("-json-stream-from-scan: %v", err)
+			}
+			if err := closeStream(); err != nil {
+				fatalf("-json-stream-from-scan: %v", err)
+			}
+		}
+	}
+	if res.Devices != nil {
+		if mounts, err := readMounts(); err != nil {
+			log.Printf("-by-device: %v", err)
+		} else {
+			res.resolveDevices(mounts)
+		}
+	}
+	if (*dfCheck || *showFree) && *archive == "" {
+		if u, err := (sysStatfs{}).Statfs(rootAbs); err != nil {
+			log.Printf("statfs %s: %v", rootAbs, err)
+		} else {
+			res.FS = &u
+		}
+	}
+
+	if *summaryCSV != "" {
+		writeOutput(*summaryCSV, "summary csv", summaryCSVWriter(res, treeOpts, comp))
+	}
+	if res.Manifest != nil {
+		writeOutput(*manifest, "manifest", func(w io.Writer) error { return WriteManifest(w, res.Manifest) })
+		if n := res.Manifest.Failed(); n > 0 {
+			log.Printf("manifest: %d file(s) could not be read; they are listed as '# error' lines", n)
+		}
+	}
+
+	// -json writes to a file (atomically) unless it is '-'; everything else
+	// goes to stdout. A -json-stream-from-scan was written during the scan.
+	if !*jsonStream {
+		writeResult(res)
+	}
+	runAtExit()
+	reportLookups()
+	if writeFailed {
+		exitWith(1)
+	}
+	exitOnAlarm(res)
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ManifestEntry is one file of -manifest: its content hash, or the error
+// that kept it from being read, and its apparent size.
+type ManifestEntry struct {
+	Path string // relative to the root
+	Size int64
+	Hash string
+	Err  error
+}
+
+// Manifest is the outcome of -manifest: every file counted by the scan,
+// hashed with Algorithm in the scan's workers.
+type Manifest struct {
+	Algorithm string
+	Entries   []ManifestEntry
+}
+
+// Failed counts the entries that could not be hashed.
+func (m *Manifest) Failed() int {
+	n := 0
+	for _, e := range m.Entries {
+		if e.Err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// manifestPath escapes a path for a manifest line the way coreutils'
+// sha256sum does: backslashes and newlines are written as \\ and \n, and
+// the line of such a path then starts with a backslash.
+func manifestPath(p string) (string, bool) {
+	if !strings.ContainsAny(p, "\\\n") {
+		return p, false
+	}
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(p), true
+}
+
+// WriteManifest writes m sorted by path as "<hash>  <path>  <size>" lines,
+// the two-space layout of sha256sum and friends with the size appended.
+// Files that could not be read follow as "# error" comment lines, so the
+// listing records them without inventing a hash.
+func WriteManifest(w io.Writer, m *Manifest) error {
+	entries := append([]ManifestEntry(nil), m.Entries...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	bw := bufio.NewWriter(w)
+	var failed []ManifestEntry
+	for _, e := range entries {
+		if e.Err != nil {
+			failed = append(failed, e)
+			continue
+		}
+		p, escaped := manifestPath(e.Path)
+		if escaped {
+			_ = bw.WriteByte('\\')
+		}
+		_, _ = fmt.Fprintf(bw, "%s  %s  %d\n", e.Hash, p, e.Size)
+	}
+	for _, e := range failed {
+		p, _ := manifestPath(e.Path)
+		_, _ = fmt.Fprintf(bw, "# error: %s: %s\n", p, errorReason(e.Err))
+	}
+	return bw.Flush()
+}
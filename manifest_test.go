@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestScanManifest(t *testing.T) {
+	root := t.TempDir()
+	writeContent(t, filepath.Join(root, "b", "y"), "hello world")
+	writeContent(t, filepath.Join(root, "a"), "abc")
+	writeContent(t, filepath.Join(root, "b", "x"), "")
+	writeContent(t, filepath.Join(root, "c"), "hello world")
+
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 4, ManifestHash: "sha256"})
+	if res.Manifest == nil || res.Manifest.Algorithm != "sha256" {
+		t.Fatalf("manifest = %+v", res.Manifest)
+	}
+	var buf bytes.Buffer
+	if err := WriteManifest(&buf, res.Manifest); err != nil {
+		t.Fatalf("WriteManifest: %v", err)
+	}
+	sum := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+	want := sum("abc") + "  a  3\n" +
+		sum("") + "  b/x  0\n" +
+		sum("hello world") + "  b/y  11\n" +
+		sum("hello world") + "  c  11\n"
+	if buf.String() != want {
+		t.Fatalf("manifest:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteManifestErrorsAndEscapes(t *testing.T) {
+	m := &Manifest{Algorithm: "md5", Entries: []ManifestEntry{
+		{Path: "z", Size: 1, Hash: "00"},
+		{Path: "locked", Size: 5, Err: &fs.PathError{Op: "open", Path: "/r/locked", Err: syscall.EACCES}},
+		{Path: "odd\nname", Size: 2, Hash: "11"},
+		{Path: `back\slash`, Size: 3, Hash: "22"},
+	}}
+	var buf bytes.Buffer
+	if err := WriteManifest(&buf, m); err != nil {
+		t.Fatalf("WriteManifest: %v", err)
+	}
+	want := `\22  back\\slash  3` + "\n" +
+		`\11  odd\nname  2` + "\n" +
+		"00  z  1\n" +
+		"# error: locked: open: permission denied\n"
+	if buf.String() != want {
+		t.Fatalf("manifest:\n%s\nwant:\n%s", buf.String(), want)
+	}
+	if n := m.Failed(); n != 1 {
+		t.Fatalf("Failed() = %d, want 1", n)
+	}
+}
+
+func TestScanManifestUnreadableFile(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read any file")
+	}
+	root := t.TempDir()
+	writeContent(t, filepath.Join(root, "ok"), "fine")
+	writeContent(t, filepath.Join(root, "secret"), "hidden")
+	if err := os.Chmod(filepath.Join(root, "secret"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, ManifestHash: "xxhash"})
+	if got := res.DirStats["."]; got.Files != 2 {
+		t.Fatalf("root = %+v, want both files counted", got)
+	}
+	var buf bytes.Buffer
+	if err := WriteManifest(&buf, res.Manifest); err != nil {
+		t.Fatalf("WriteManifest: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "  ok  4") || lines[1] != "# error: secret: open: permission denied" {
+		t.Fatalf("unexpected manifest:\n%s", buf.String())
+	}
+	for _, e := range res.Manifest.Entries {
+		if e.Path == "secret" && !errors.Is(e.Err, fs.ErrPermission) {
+			t.Fatalf("secret error = %v", e.Err)
+		}
+	}
+}
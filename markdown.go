@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// mdEscaper keeps names from breaking a Markdown table row.
+var mdEscaper = strings.NewReplacer("\\", "\\\\", "|", "\\|", "\n", " ", "\r", " ")
+
+// MarkdownFormatter writes the directories the tree shows and the per-user
+// and per-group totals as GitHub-flavored Markdown tables, for pasting into
+// issues, wikis and CI job summaries. Directories are listed by their path
+// relative to the root, in tree order; the owners as the summaries list them.
+type MarkdownFormatter struct {
+	Opts TreeOptions
+}
+
+func (f MarkdownFormatter) Write(w io.Writer, res *Result) error {
+	opts := f.Opts
+	fo := opts.Format
+	if ds := res.DirStats["."]; ds != nil {
+		fo = fo.fixUnit(ds.Size)
+	}
+	cell := func(s string) string { return mdEscaper.Replace(fo.path(s)) }
+	root := res.Root
+	if opts.RootLabel != "" {
+		root = opts.RootLabel
+	}
+
+	bw := bufio.NewWriter(w)
+	_, _ = fmt.Fprintf(bw, "# %s\n\n", cell(root))
+	_, _ = fmt.Fprintf(bw, "| %s | Files | Path |\n|---:|---:|:---|\n", fo.sizeLabel())
+	for _, rel := range treeRels(res, opts) {
+		ds := res.DirStats[rel]
+		name := rel
+		if rel == "." {
+			name = root
+		}
+		_, _ = fmt.Fprintf(bw, "| %s | %s | %s |\n", fo.size(ds.Size), fo.files(ds.Files), cell(name))
+	}
+
+	userKeys := sortedBySize(res.UserStats, func(us *UserStat) int64 { return us.Size }, opts.TopN, opts.MinUserSize)
+	userLabels := ownerLabels(userKeys, func(k string) (string, uint32) {
+		return displayName(res.UserStats[k].Name, k), res.UserStats[k].UID
+	}, "uid")
+	sortByLabel(userKeys, userLabels, opts.Sort)
+	_, _ = fmt.Fprintf(bw, "\n## Users\n\n| User | %s | Files |\n|:---|---:|---:|\n", fo.sizeLabel())
+	for _, k := range userKeys {
+		us := res.UserStats[k]
+		_, _ = fmt.Fprintf(bw, "| %s | %s | %s |\n", cell(userLabels[k]), fo.size(us.Size), fo.files(us.Files))
+	}
+
+	groupKeys := sortedBySize(res.GroupStats, func(gs *GroupStat) int64 { return gs.Size }, opts.TopN, opts.MinGroupSize)
+	groupLabels := ownerLabels(groupKeys, func(k string) (string, uint32) {
+		return displayName(res.GroupStats[k].Name, k), res.GroupStats[k].GID
+	}, "gid")
+	sortByLabel(groupKeys, groupLabels, opts.Sort)
+	_, _ = fmt.Fprintf(bw, "\n## Groups\n\n| Group | %s | Files |\n|:---|---:|---:|\n", fo.sizeLabel())
+	for _, k := range groupKeys {
+		gs := res.GroupStats[k]
+		_, _ = fmt.Fprintf(bw, "| %s | %s | %s |\n", cell(groupLabels[k]), fo.size(gs.Size), fo.files(gs.Files))
+	}
+
+	if res.Incomplete {
+		_, _ = fmt.Fprintln(bw, "\n> Scan incomplete (stopped by -max-files, -timeout or -deadline, or a -max-memory spill failed); totals are partial.")
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownFormatterEscapesAndLimits(t *testing.T) {
+	res := &Result{
+		Root: "/data",
+		DirStats: map[string]*DirStat{
+			".":        {Size: 3000, Files: 3},
+			"a|b":      {Size: 2000, Files: 2},
+			"a|b/deep": {Size: 1000, Files: 1},
+			"c":        {Size: 1000, Files: 1},
+		},
+		UserStats: map[string]*UserStat{
+			"1001": {Size: 2000, Files: 2, UID: 1001, Name: "alice"},
+			"1002": {Size: 1000, Files: 1, UID: 1002, Name: "bob"},
+		},
+		GroupStats: map[string]*GroupStat{"100": {Size: 3000, Files: 3, GID: 100, Name: "staff"}},
+		Incomplete: true,
+	}
+	var buf bytes.Buffer
+	opts := TreeOptions{Levels: 1, TopN: 1, RootLabel: "host:/data", Format: FormatOptions{Bytes: true}}
+	if err := (MarkdownFormatter{Opts: opts}).Write(&buf, res); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# host:/data\n",
+		"| 3000 | 3 | host:/data |\n| 2000 | 2 | a\\|b |\n| 1000 | 1 | c |\n",
+		"| alice | 2000 | 2 |\n\n## Groups",
+		"> Scan incomplete",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output lacks %q:\n%s", want, out)
+		}
+	}
+	// deeper than -levels, and beyond -top
+	for _, absent := range []string{"deep", "bob"} {
+		if strings.Contains(out, absent) {
+			t.Fatalf("output has %q:\n%s", absent, out)
+		}
+	}
+}
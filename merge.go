@@ -0,0 +1,263 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// MergeSummaries combines several summaries into one. When all summaries share
+// the same root, directory, user and group totals are summed directly. When the
+// roots differ, each summary's directories are placed under a prefix derived
+// from its root's base name (made unique with a numeric suffix), and a synthetic
+// "." entry holds the combined total. Scan counters are summed, the time range
+// spans all inputs and the result is incomplete if any input was.
+func MergeSummaries(jos []JsonOut) JsonOut {
+	if len(jos) == 1 {
+		return jos[0]
+	}
+	var out JsonOut
+	if len(jos) == 0 {
+		return out
+	}
+
+	sameRoot := true
+	for _, jo := range jos[1:] {
+		if filepath.Clean(jo.Root) != filepath.Clean(jos[0].Root) {
+			sameRoot = false
+			break
+		}
+	}
+	out.Root = jos[0].Root
+	if !sameRoot {
+		out.Root = "(merged)"
+	}
+	out.Stats.Version = jos[0].Stats.Version
+	// the file lists are only complete when every input has them
+	out.Stats.FileLists = true
+	for _, jo := range jos {
+		out.Stats.FileLists = out.Stats.FileLists && jo.Stats.FileLists
+	}
+
+	dirs := make(map[string]*JsonDir)
+	users := make(map[string]*JsonUser)
+	groups := make(map[string]*JsonGroup)
+	var devices map[string]*DeviceStat
+	usedPrefixes := make(map[string]bool)
+	var started, ended time.Time
+	var newest, oldest []JsonFile
+
+	for _, jo := range jos {
+		prefix := ""
+		if !sameRoot {
+			prefix = uniquePrefix(jo.Root, usedPrefixes)
+		}
+		for _, d := range jo.Dirs {
+			rel := d.Rel
+			if rel == "" {
+				rel = "."
+			}
+			rel = prefixRel(prefix, rel)
+			if cur, ok := dirs[rel]; ok {
+				cur.Size += d.Size
+				cur.Files += d.Files
+				cur.Owners = addOwnerShares(cur.Owners, d.Owners)
+				if out.Stats.FileLists {
+					cur.FileList = append(cur.FileList, d.FileList...)
+				}
+				if cur.AvgFileSize != 0 || d.AvgFileSize != 0 {
+					cur.AvgFileSize, _ = avgFileSize(cur.Size, cur.Files)
+				}
+				continue
+			}
+			nd := d
+			nd.Rel = rel
+			nd.Owners = addOwnerShares(nil, d.Owners)
+			nd.FileList = nil
+			if out.Stats.FileLists {
+				nd.FileList = append(nd.FileList, d.FileList...)
+			}
+			dirs[rel] = &nd
+		}
+		if !sameRoot {
+			root, ok := dirs["."]
+			if !ok {
+				root = &JsonDir{Rel: "."}
+				dirs["."] = root
+			}
+			for _, d := range jo.Dirs {
+				if d.Rel == "." || d.Rel == "" {
+					root.Size += d.Size
+					root.Files += d.Files
+					root.Owners = addOwnerShares(root.Owners, d.Owners)
+				}
+			}
+		}
+		for _, f := range jo.Newest {
+			f.Path = prefixRel(prefix, f.Path)
+			newest = append(newest, f)
+		}
+		for _, f := range jo.Oldest {
+			f.Path = prefixRel(prefix, f.Path)
+			oldest = append(oldest, f)
+		}
+		for _, u := range jo.Users {
+			if cur, ok := users[u.Name]; ok {
+				cur.Size += u.Size
+				cur.Files += u.Files
+				cur.Dirs += u.Dirs
+				continue
+			}
+			nu := u
+			users[u.Name] = &nu
+		}
+		for _, d := range jo.Devices {
+			if devices == nil {
+				devices = make(map[string]*DeviceStat)
+			}
+			cur, ok := devices[d.Dev]
+			if !ok {
+				cur = &DeviceStat{Mount: d.Mount, FSType: d.FSType}
+				devices[d.Dev] = cur
+			}
+			cur.Size += d.Size
+			cur.Files += d.Files
+		}
+		for _, g := range jo.Grps {
+			if cur, ok := groups[g.Name]; ok {
+				cur.Size += g.Size
+				cur.Files += g.Files
+				cur.Dirs += g.Dirs
+				continue
+			}
+			ng := g
+			groups[g.Name] = &ng
+		}
+
+		if len(jo.Stats.Sources) > 0 {
+			// an already merged input keeps its own inputs
+			for _, s := range jo.Stats.Sources {
+				if s.Prefix == "" {
+					s.Prefix = prefix
+				} else {
+					s.Prefix = prefixRel(prefix, s.Prefix)
+				}
+				out.Stats.Sources = append(out.Stats.Sources, s)
+			}
+		} else {
+			out.Stats.Sources = append(out.Stats.Sources, JsonSource{Root: jo.Root, Hostname: jo.Stats.Hostname, SnapshotName: jo.Stats.SnapshotName, Prefix: prefix})
+		}
+		out.Stats.DirsScanned += jo.Stats.DirsScanned
+		out.Stats.FilesScanned += jo.Stats.FilesScanned
+		out.Stats.Incomplete = out.Stats.Incomplete || jo.Stats.Incomplete
+		out.Stats.BindDedupFiles += jo.Stats.BindDedupFiles
+		out.Stats.BindDedupBytes += jo.Stats.BindDedupBytes
+		out.Stats.SizeFilteredFiles += jo.Stats.SizeFilteredFiles
+		out.Stats.CtimeFilteredFiles += jo.Stats.CtimeFilteredFiles
+		out.Stats.MtimeFilteredFiles += jo.Stats.MtimeFilteredFiles
+		out.Stats.StatFailedFiles += jo.Stats.StatFailedFiles
+		// users or groups left out of one input are missing from the merge
+		out.Stats.MinUserSize = max(out.Stats.MinUserSize, jo.Stats.MinUserSize)
+		out.Stats.MinGroupSize = max(out.Stats.MinGroupSize, jo.Stats.MinGroupSize)
+		if jo.Stats.Hidden != nil {
+			if out.Stats.Hidden == nil {
+				out.Stats.Hidden = &JsonHiddenSplit{}
+			}
+			out.Stats.Hidden.merge(*jo.Stats.Hidden)
+		}
+		if t, err := time.Parse(time.RFC3339, jo.Stats.StartedAt); err == nil && (started.IsZero() || t.Before(started)) {
+			started = t
+		}
+		if t, err := time.Parse(time.RFC3339, jo.Stats.EndedAt); err == nil && t.After(ended) {
+			ended = t
+		}
+	}
+	if !started.IsZero() {
+		out.Stats.StartedAt = started.Format(time.RFC3339)
+	}
+	if !ended.IsZero() {
+		out.Stats.EndedAt = ended.Format(time.RFC3339)
+	}
+
+	out.Newest = mergeFileLists(jos, newest, func(jo JsonOut) int { return len(jo.Newest) }, newestFirst)
+	out.Oldest = mergeFileLists(jos, oldest, func(jo JsonOut) int { return len(jo.Oldest) }, oldestFirst)
+
+	for _, d := range dirs {
+		sortFileList(d.FileList)
+		out.Dirs = append(out.Dirs, *d)
+	}
+	if devices != nil {
+		out.Devices = jsonDevices(devices)
+	}
+	for _, u := range users {
+		out.Users = append(out.Users, *u)
+	}
+	for _, g := range groups {
+		out.Grps = append(out.Grps, *g)
+	}
+	sortDirs(out.Dirs)
+	sort.Slice(out.Users, func(i, j int) bool { return out.Users[i].Name < out.Users[j].Name })
+	sort.Slice(out.Grps, func(i, j int) bool { return out.Grps[i].Name < out.Grps[j].Name })
+	return out
+}
+
+// uniquePrefix returns the base name of root, suffixed with -2, -3, ... if it
+// is already taken, and records it in used.
+func uniquePrefix(root string, used map[string]bool) string {
+	base := filepath.Base(filepath.Clean(root))
+	if base == "." || base == "/" || base == "" {
+		base = "root"
+	}
+	name := base
+	for i := 2; used[name]; i++ {
+		name = base + "-" + strconv.Itoa(i)
+	}
+	used[name] = true
+	return name
+}
+
+// addOwnerShares adds src's per-user shares into dst, allocating dst if needed,
+// and returns it. A nil src leaves dst unchanged.
+func addOwnerShares(dst, src map[string]JsonOwnerShare) map[string]JsonOwnerShare {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]JsonOwnerShare, len(src))
+	}
+	for name, sh := range src {
+		cur := dst[name]
+		cur.Size += sh.Size
+		cur.Files += sh.Files
+		cur.UID = sh.UID
+		dst[name] = cur
+	}
+	return dst
+}
+
+// prefixRel places rel under prefix; an empty prefix leaves it unchanged.
+func prefixRel(prefix, rel string) string {
+	switch {
+	case prefix == "":
+		return rel
+	case rel == ".":
+		return prefix
+	}
+	return prefix + "/" + rel
+}
+
+// mergeFileLists re-ranks the combined file listings of all summaries with
+// better, keeping as many entries as the longest input listing. It returns nil
+// when no input carries a non-empty listing.
+func mergeFileLists(jos []JsonOut, files []JsonFile, count func(JsonOut) int, better func(a, b FileEntry) bool) []JsonFile {
+	n := 0
+	for _, jo := range jos {
+		n = max(n, count(jo))
+	}
+	if n == 0 {
+		return nil
+	}
+	sorted := topFilesFromJSON(files, better).Sorted()
+	return jsonFiles(sorted[:min(n, len(sorted))], nil)
+}
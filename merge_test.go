@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSummaryFixture(t *testing.T, path string, jo JsonOut, gz bool) {
+	t.Helper()
+	b, err := json.Marshal(jo)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if gz {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(b)
+		_ = zw.Close()
+		b = buf.Bytes()
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func nodeSummary(root string, dataSize int64, user string) JsonOut {
+	return JsonOut{
+		Root:  root,
+		Stats: JsonStats{FilesScanned: 2, DirsScanned: 2, StartedAt: "2024-01-01T00:00:00Z", EndedAt: "2024-01-01T00:01:00Z"},
+		Dirs: []JsonDir{
+			{Rel: ".", Size: dataSize + 10, Files: 2},
+			{Rel: "data", Size: dataSize, Files: 1},
+		},
+		Users: []JsonUser{{Name: user, Size: dataSize, Files: 1}, {Name: "root", Size: 10, Files: 1}},
+		Grps:  []JsonGroup{{Name: "staff", Size: dataSize + 10, Files: 2}},
+	}
+}
+
+func TestLoadSummariesSameRoot(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.json")
+	b := filepath.Join(dir, "b.json.gz")
+	writeSummaryFixture(t, a, nodeSummary("/srv", 100, "alice"), false)
+	writeSummaryFixture(t, b, nodeSummary("/srv", 300, "bob"), true)
+
+	jo, err := LoadSummaries([]string{a, b}, false)
+	if err != nil {
+		t.Fatalf("LoadSummaries: %v", err)
+	}
+	users := map[string]int64{}
+	for _, u := range jo.Users {
+		users[u.Name] = u.Size
+	}
+	if users["alice"] != 100 || users["bob"] != 300 || users["root"] != 20 {
+		t.Fatalf("unexpected merged user totals: %v", users)
+	}
+	dirs := map[string]JsonDir{}
+	for _, d := range jo.Dirs {
+		dirs[d.Rel] = d
+	}
+	if dirs["."].Size != 420 || dirs["data"].Size != 400 || dirs["data"].Files != 2 {
+		t.Fatalf("unexpected merged dirs: %+v", jo.Dirs)
+	}
+	if jo.Stats.FilesScanned != 4 {
+		t.Fatalf("expected summed files_scanned 4, got %d", jo.Stats.FilesScanned)
+	}
+	if vs := VerifySummary(jo); len(vs) != 0 {
+		t.Fatalf("merged summary is inconsistent: %v", vs)
+	}
+}
+
+func TestLoadSummariesDifferentRoots(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.json")
+	b := filepath.Join(dir, "b.json")
+	writeSummaryFixture(t, a, nodeSummary("/nodes/n1", 100, "alice"), false)
+	writeSummaryFixture(t, b, nodeSummary("/other/n1", 300, "alice"), false)
+
+	jo, err := LoadSummaries([]string{a, b}, false)
+	if err != nil {
+		t.Fatalf("LoadSummaries: %v", err)
+	}
+	if len(jo.Users) != 2 || jo.Users[0].Name != "alice" || jo.Users[0].Size != 400 {
+		t.Fatalf("unexpected merged users: %+v", jo.Users)
+	}
+	if vs := VerifySummary(jo); len(vs) != 0 {
+		t.Fatalf("merged summary is inconsistent: %v", vs)
+	}
+
+	var buf bytes.Buffer
+	if err := (TreeFormatter{Opts: TreeOptions{Levels: 2}}).Write(&buf, resultFromSummary(jo)); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"420B (merged)", "310B     ├── n1-2", "110B     └── n1", "300B     │   └── data", "100B         └── data", "alice                400B"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("merged tree missing %q:\n%s", want, out)
+		}
+	}
+}
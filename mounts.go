@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Mount is one entry of the mount table.
+type Mount struct {
+	Point  string // mount point, unescaped
+	FSType string
+	Dev    string // "major:minor" of the backing device
+	Root   string // path within the filesystem that is mounted at Point ("/" unless bound)
+}
+
+// defaultSkipMountTypes are the virtual/pseudo filesystem types pruned by
+// -skip-mounts unless -skip-mount-types says otherwise.
+const defaultSkipMountTypes = "proc,sysfs,devtmpfs,devpts,tmpfs,cgroup,cgroup2,securityfs,debugfs,tracefs,pstore,bpf,mqueue,hugetlbfs,configfs,fusectl,autofs,binfmt_misc,efivarfs,rpc_pipefs,nsfs"
+
+// ParseMountInfo parses the contents of /proc/self/mountinfo. Each line looks like
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+//
+// where the fifth field is the mount point and the filesystem type follows the
+// "-" separator. Malformed lines are reported as errors.
+func ParseMountInfo(data string) ([]Mount, error) {
+	var mounts []Mount
+	sc := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep < 0 || sep+1 >= len(fields) {
+			return nil, fmt.Errorf("mountinfo line %d: malformed: %q", n, line)
+		}
+		mounts = append(mounts, Mount{
+			Point:  unescapeMountPath(fields[4]),
+			FSType: fields[sep+1],
+			Dev:    fields[2],
+			Root:   unescapeMountPath(fields[3]),
+		})
+	}
+	return mounts, sc.Err()
+}
+
+// unescapeMountPath decodes the octal escapes (\040 for space, \011 for tab,
+// \012 for newline, \134 for backslash) the kernel uses in mount paths.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// within reports whether p is dir or below it; both must be clean absolute paths.
+func within(p, dir string) bool {
+	return p == dir || dir == "/" || strings.HasPrefix(p, dir+"/")
+}
+
+// containingMount returns the mount whose point is the longest prefix of p.
+func containingMount(mounts []Mount, p string) (Mount, bool) {
+	var best Mount
+	found := false
+	for _, m := range mounts {
+		mp := filepath.Clean(m.Point)
+		if within(p, mp) && (!found || len(mp) > len(filepath.Clean(best.Point))) {
+			best, found = m, true
+		}
+	}
+	return best, found
+}
+
+// bindDuplicateDevs returns the devices (as "major:minor") that a scan of
+// rootAbs reaches through more than one mount, i.e. through bind mounts below
+// the root, so the same files would be counted once per path.
+func bindDuplicateDevs(mounts []Mount, rootAbs string) map[string]bool {
+	views := make(map[string]int)
+	if m, ok := containingMount(mounts, rootAbs); ok {
+		views[m.Dev]++
+	}
+	for _, m := range mounts {
+		mp := filepath.Clean(m.Point)
+		if mp != rootAbs && within(mp, rootAbs) {
+			views[m.Dev]++
+		}
+	}
+	dup := make(map[string]bool)
+	for dev, n := range views {
+		if n > 1 {
+			dup[dev] = true
+		}
+	}
+	return dup
+}
+
+// devNumber converts a mountinfo "major:minor" to the st_dev value Linux
+// reports for files on that device (the glibc makedev encoding).
+func devNumber(majMin string) (uint64, error) {
+	majS, minS, ok := strings.Cut(majMin, ":")
+	if !ok {
+		return 0, fmt.Errorf("malformed device %q", majMin)
+	}
+	maj, err := strconv.ParseUint(majS, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("malformed device %q: %w", majMin, err)
+	}
+	mnr, err := strconv.ParseUint(minS, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("malformed device %q: %w", majMin, err)
+	}
+	return (mnr & 0xff) | ((maj & 0xfff) << 8) | ((mnr &^ 0xff) << 12) | ((maj &^ 0xfff) << 32), nil
+}
+
+// readMounts reads the mount table of the current process.
+func readMounts() ([]Mount, error) {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	return ParseMountInfo(string(data))
+}
+
+// mountsToSkip returns the set of mount points strictly below rootAbs whose
+// type is listed in types; the type "*" matches every mount. The root itself
+// is never skipped, even when it is a mount point.
+func mountsToSkip(mounts []Mount, rootAbs string, types []string) map[string]bool {
+	want := fsTypeSet(types)
+	return mountsBelow(mounts, rootAbs, func(m Mount) bool { return want["*"] || want[m.FSType] })
+}
+
+// mountsByFSType returns the set of mount points strictly below rootAbs that
+// -include-fstype/-exclude-fstype prune: those whose type is in exclude and,
+// when include is not empty, those whose type is not in it. Like
+// mountsToSkip, it never prunes the root.
+func mountsByFSType(mounts []Mount, rootAbs string, include, exclude []string) map[string]bool {
+	in, out := fsTypeSet(include), fsTypeSet(exclude)
+	return mountsBelow(mounts, rootAbs, func(m Mount) bool { return out[m.FSType] || len(in) > 0 && !in[m.FSType] })
+}
+
+// fsTypeSet returns the non-empty filesystem types of a comma-split list.
+func fsTypeSet(types []string) map[string]bool {
+	set := make(map[string]bool, len(types))
+	for _, t := range types {
+		if t = strings.TrimSpace(t); t != "" {
+			set[t] = true
+		}
+	}
+	return set
+}
+
+// mountsBelow returns the set of mount points strictly below rootAbs for
+// which prune is true.
+func mountsBelow(mounts []Mount, rootAbs string, prune func(Mount) bool) map[string]bool {
+	skip := make(map[string]bool)
+	for _, m := range mounts {
+		if !prune(m) {
+			continue
+		}
+		p := filepath.Clean(m.Point)
+		rel, err := filepath.Rel(rootAbs, p)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+		skip[p] = true
+	}
+	return skip
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+const testMountInfo = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+23 22 0:21 / /proc rw,nosuid,nodev,noexec,relatime shared:12 - proc proc rw
+24 22 0:22 / /sys rw,nosuid,nodev,noexec,relatime shared:7 - sysfs sysfs rw
+25 22 0:5 / /dev rw,nosuid shared:2 - devtmpfs udev rw,size=8G
+26 25 0:23 / /dev/pts rw,nosuid,noexec,relatime shared:3 - devpts devpts rw,gid=5
+40 22 8:17 / /mnt/my\040disk rw,relatime shared:30 master:4 - ext4 /dev/sdb1 rw
+41 22 0:45 / /run rw,nosuid,nodev - tmpfs tmpfs rw,mode=755
+`
+
+func TestParseMountInfo(t *testing.T) {
+	mounts, err := ParseMountInfo(testMountInfo)
+	if err != nil {
+		t.Fatalf("ParseMountInfo: %v", err)
+	}
+	if len(mounts) != 7 {
+		t.Fatalf("expected 7 mounts, got %d: %v", len(mounts), mounts)
+	}
+	if m := mounts[1]; m.Point != "/proc" || m.FSType != "proc" {
+		t.Fatalf("unexpected /proc entry: %+v", m)
+	}
+	if m := mounts[5]; m.Point != "/mnt/my disk" || m.FSType != "ext4" {
+		t.Fatalf("escaped mount point not decoded (optional fields before '-'): %+v", m)
+	}
+
+	if _, err := ParseMountInfo("1 2 3\n"); err == nil {
+		t.Fatalf("expected error for malformed line")
+	}
+}
+
+func TestMountsToSkip(t *testing.T) {
+	mounts, err := ParseMountInfo(testMountInfo)
+	if err != nil {
+		t.Fatalf("ParseMountInfo: %v", err)
+	}
+
+	skip := mountsToSkip(mounts, "/", []string{"proc", "sysfs", "devtmpfs", "devpts", "tmpfs"})
+	for _, p := range []string{"/proc", "/sys", "/dev", "/dev/pts", "/run"} {
+		if !skip[p] {
+			t.Errorf("expected %s to be skipped", p)
+		}
+	}
+	if skip["/"] || skip["/mnt/my disk"] {
+		t.Errorf("root or real disk skipped: %v", skip)
+	}
+
+	// "*" skips every mount below the root, but never the root itself or mounts outside it
+	skip = mountsToSkip(mounts, "/dev", []string{"*"})
+	if len(skip) != 1 || !skip["/dev/pts"] {
+		t.Fatalf("unexpected skip set below /dev: %v", skip)
+	}
+}
+
+func TestScanPrunesMountsByFSType(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "f"), 1)
+	writeFile(t, filepath.Join(root, "shm", "f"), 1000)
+	writeFile(t, filepath.Join(root, "data", "f"), 10)
+	writeFile(t, filepath.Join(root, "ovl", "f"), 100)
+	// the root on ext4 with tmpfs, ext4 and overlay mounts below it
+	mounts, err := ParseMountInfo(fmt.Sprintf(`22 1 8:1 / / rw - ext4 /dev/sda1 rw
+50 22 0:50 / %[1]s/shm rw - tmpfs tmpfs rw
+51 22 8:17 / %[1]s/data rw - ext4 /dev/sdb1 rw
+52 22 0:52 / %[1]s/ovl rw - overlay overlay rw
+53 22 0:53 / /elsewhere rw - tmpfs tmpfs rw
+`, root))
+	if err != nil {
+		t.Fatalf("ParseMountInfo: %v", err)
+	}
+
+	for _, c := range []struct {
+		name             string
+		include, exclude string
+		size             int64
+		pruned           []string
+	}{
+		{"exclude tmpfs", "", "tmpfs,proc", 111, []string{"shm"}},
+		{"exclude tmpfs and overlay", "", "tmpfs, overlay", 11, []string{"shm", "ovl"}},
+		{"include ext4", "ext4", "", 11, []string{"shm", "ovl"}},
+		{"include minus exclude", "ext4,tmpfs", "tmpfs", 11, []string{"shm", "ovl"}},
+		// the root is scanned whatever its own type
+		{"include xfs", "xfs", "", 1, []string{"shm", "data", "ovl"}},
+	} {
+		skip := mountsByFSType(mounts, root, strings.Split(c.include, ","), strings.Split(c.exclude, ","))
+		if len(skip) != len(c.pruned) {
+			t.Fatalf("%s: pruned %v; want %v", c.name, skip, c.pruned)
+		}
+		res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, SkipDirs: skip})
+		for _, rel := range c.pruned {
+			if _, ok := res.DirStats[rel]; ok || !skip[filepath.Join(root, rel)] {
+				t.Fatalf("%s: %s not pruned (skip set %v)", c.name, rel, skip)
+			}
+		}
+		if got := res.DirStats["."].Size; got != c.size {
+			t.Fatalf("%s: root size = %d; want %d", c.name, got, c.size)
+		}
+	}
+}
+
+func TestScanSkipDirs(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "keep", "f"), 10)
+	writeFile(t, filepath.Join(root, "virt", "f"), 1000)
+	if err := os.MkdirAll(filepath.Join(root, "virt", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, SkipDirs: map[string]bool{filepath.Join(root, "virt"): true}})
+	if _, ok := res.DirStats["virt"]; ok {
+		t.Fatalf("pruned directory recorded: %v", res.DirStats)
+	}
+	if got := res.DirStats["."].Size; got != 10 {
+		t.Fatalf("root size = %d, want 10", got)
+	}
+}
+
+const testBindMountInfo = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+30 22 8:17 / /data rw,relatime shared:20 - ext4 /dev/sdb1 rw
+31 22 8:17 /www /srv/www rw,relatime shared:20 - ext4 /dev/sdb1 rw
+32 22 0:45 / /run rw,nosuid,nodev - tmpfs tmpfs rw
+`
+
+func TestBindDuplicateDevs(t *testing.T) {
+	mounts, err := ParseMountInfo(testBindMountInfo)
+	if err != nil {
+		t.Fatalf("ParseMountInfo: %v", err)
+	}
+	if m := mounts[2]; m.Dev != "8:17" || m.Root != "/www" {
+		t.Fatalf("unexpected bind entry: %+v", m)
+	}
+
+	cases := map[string][]string{
+		"/":     {"8:17"}, // /data and /srv/www both visible
+		"/data": nil,      // only one view of 8:17
+		"/srv":  nil,      // the bind mount alone is not a duplicate
+	}
+	for root, want := range cases {
+		got := bindDuplicateDevs(mounts, root)
+		if len(got) != len(want) {
+			t.Errorf("root %s: got %v, want %v", root, got, want)
+			continue
+		}
+		for _, d := range want {
+			if !got[d] {
+				t.Errorf("root %s: missing %s in %v", root, d, got)
+			}
+		}
+	}
+}
+
+func TestDevNumber(t *testing.T) {
+	cases := map[string]uint64{"8:1": 0x801, "0:45": 45, "259:3": 259<<8 | 3, "8:300": 300&0xff | 8<<8 | (300&^0xff)<<12}
+	for in, want := range cases {
+		if got, err := devNumber(in); err != nil || got != want {
+			t.Errorf("devNumber(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	if _, err := devNumber("8"); err == nil {
+		t.Errorf("expected error for malformed device")
+	}
+}
+
+func TestScanDedupDevs(t *testing.T) {
+	root := t.TempDir()
+	orig := filepath.Join(root, "data", "f")
+	writeFile(t, orig, 100)
+	// a hard link stands in for the same inode reached through a bind mount
+	if err := os.MkdirAll(filepath.Join(root, "bind"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(orig, filepath.Join(root, "bind", "f")); err != nil {
+		t.Skipf("hard links not supported: %v", err)
+	}
+	info, err := os.Stat(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev := uint64(info.Sys().(*syscall.Stat_t).Dev)
+
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2})
+	if got := res.DirStats["."].Size; got != 200 {
+		t.Fatalf("without dedup root size = %d, want 200", got)
+	}
+
+	res = Scan(context.Background(), root, ScanOptions{Concurrency: 2, DedupDevs: map[uint64]bool{dev: true}})
+	if got := res.DirStats["."]; got.Size != 100 || got.Files != 1 || res.FilesScanned != 1 {
+		t.Fatalf("with dedup root = %+v (scanned %d), want one copy", got, res.FilesScanned)
+	}
+	if res.BindDupFiles != 1 || res.BindDupBytes != 100 {
+		t.Fatalf("dedup counters = %d/%d, want 1/100", res.BindDupFiles, res.BindDupBytes)
+	}
+}
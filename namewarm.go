@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+)
+
+// warmNames resolves each distinct id in ids exactly once, with up to
+// workers lookups in flight at a time, and returns the names by id. On
+// directory services such as LDAP every lookup is a round trip, so running
+// them side by side bounds the wait by the slowest rather than their sum.
+func warmNames(ids []uint32, resolve func(uint32) string, workers int) map[uint32]string {
+	names := make(map[uint32]string, len(ids))
+	todo := make(chan uint32)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < max(workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range todo {
+				name := resolve(id)
+				mu.Lock()
+				names[id] = name
+				mu.Unlock()
+			}
+		}()
+	}
+	seen := make(map[uint32]bool, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			todo <- id
+		}
+	}
+	close(todo)
+	wg.Wait()
+	return names
+}
+
+// resolveDeferredNames fills in the user and group names a scan with
+// ScanOptions.ParallelLookup left out of addOwnerTotals: the distinct ids
+// are resolved by warmNames, outside the scan's lock and side by side.
+func (r *Result) resolveDeferredNames(workers int) {
+	var uids, gids []uint32
+	for k, us := range r.UserStats {
+		if us.HasID && us.Name == "" && k != othersKey {
+			uids = append(uids, us.UID)
+		}
+	}
+	for k, gs := range r.GroupStats {
+		if gs.HasID && gs.Name == "" && k != othersKey {
+			gids = append(gids, gs.GID)
+		}
+	}
+	if len(uids) == 0 && len(gids) == 0 {
+		return
+	}
+
+	var unames, gnames map[uint32]string
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); unames = warmNames(uids, userName, workers) }()
+	go func() { defer wg.Done(); gnames = warmNames(gids, groupName, workers) }()
+	wg.Wait()
+	// the bucket policy cannot be deferred, as it re-keys the totals
+	if r.unknownOwner == unknownOwnerPrefixed {
+		for id, name := range unames {
+			if name == strconv.FormatUint(uint64(id), 10) {
+				unames[id] = unknownOwnerName(r.unknownOwner, "uid", id)
+			}
+		}
+		for id, name := range gnames {
+			if name == strconv.FormatUint(uint64(id), 10) {
+				gnames[id] = unknownOwnerName(r.unknownOwner, "gid", id)
+			}
+		}
+	}
+
+	for _, us := range r.UserStats {
+		if name, ok := unames[us.UID]; ok && us.HasID && us.Name == "" {
+			us.Name = name
+		}
+	}
+	for _, byUser := range r.DirUsers {
+		for _, du := range byUser {
+			if name, ok := unames[du.UID]; ok && du.HasID && du.Name == "" {
+				du.Name = name
+			}
+		}
+	}
+	for _, gs := range r.GroupStats {
+		if name, ok := gnames[gs.GID]; ok && gs.HasID && gs.Name == "" {
+			gs.Name = name
+		}
+	}
+}
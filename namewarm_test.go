@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestWarmNamesResolvesEachIDOnce(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[uint32]int{}
+	resolve := func(id uint32) string {
+		mu.Lock()
+		calls[id]++
+		mu.Unlock()
+		return "u" + strconv.FormatUint(uint64(id), 10)
+	}
+	ids := []uint32{5, 7, 5, 9, 7, 7, 0, 5}
+	names := warmNames(ids, resolve, 3)
+	want := map[uint32]string{0: "u0", 5: "u5", 7: "u7", 9: "u9"}
+	if len(names) != len(want) {
+		t.Fatalf("names = %v, want %v", names, want)
+	}
+	for id, n := range want {
+		if names[id] != n {
+			t.Fatalf("names[%d] = %q, want %q", id, names[id], n)
+		}
+		if calls[id] != 1 {
+			t.Fatalf("id %d resolved %d times, want once", id, calls[id])
+		}
+	}
+	if got := warmNames(nil, resolve, 0); len(got) != 0 {
+		t.Fatalf("no ids gave %v", got)
+	}
+}
+
+func TestScanParallelLookupFillsNames(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a"), 10)
+	writeFile(t, filepath.Join(root, "sub", "b"), 20)
+	uid, gid := uint32(os.Getuid()), uint32(os.Getgid())
+
+	var mu sync.Mutex
+	calls := 0
+	stubOwnerNames(t, nil, nil)
+	userName = func(id uint32) string {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		return "user" + strconv.FormatUint(uint64(id), 10)
+	}
+	groupName = func(id uint32) string { return "group" + strconv.FormatUint(uint64(id), 10) }
+
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 4, ParallelLookup: true, DirOwners: true})
+	key := strconv.FormatUint(uint64(uid), 10)
+	if us := res.UserStats[key]; us == nil || us.Name != "user"+key || us.Size != 30 {
+		t.Fatalf("user stats = %+v", res.UserStats)
+	}
+	if gs := res.GroupStats[strconv.FormatUint(uint64(gid), 10)]; gs == nil || gs.Name != "group"+strconv.FormatUint(uint64(gid), 10) {
+		t.Fatalf("group stats = %+v", res.GroupStats)
+	}
+	if du := res.DirUsers["sub"][key]; du == nil || du.Name != "user"+key {
+		t.Fatalf("dir users of sub = %+v", res.DirUsers["sub"])
+	}
+	if calls != 1 {
+		t.Fatalf("user name resolved %d times, want once", calls)
+	}
+	if res.deferNames {
+		t.Fatalf("names still deferred after the scan")
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Formatter renders a Result in one output format.
+type Formatter interface {
+	Write(w io.Writer, result *Result) error
+}
+
+// FormatConfig carries the user's output options to formatter constructors.
+type FormatConfig struct {
+	Tree    TreeOptions
+	Summary SummaryOptions
+}
+
+// FormatterFactory builds a Formatter for the given configuration.
+type FormatterFactory func(cfg FormatConfig) Formatter
+
+var formatters = map[string]FormatterFactory{}
+
+// RegisterFormatter makes a formatter available under name for -format.
+// Registering a name twice replaces the earlier factory.
+func RegisterFormatter(name string, f FormatterFactory) {
+	formatters[name] = f
+}
+
+// NewFormatter returns the formatter registered under name.
+func NewFormatter(name string, cfg FormatConfig) (Formatter, error) {
+	f, ok := formatters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q (available: %s)", name, strings.Join(FormatterNames(), ", "))
+	}
+	return f(cfg), nil
+}
+
+// FormatterNames lists the registered format names in sorted order.
+func FormatterNames() []string {
+	names := make([]string, 0, len(formatters))
+	for n := range formatters {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterFormatter("tree", func(cfg FormatConfig) Formatter { return TreeFormatter{Opts: cfg.Tree} })
+	RegisterFormatter("json", func(cfg FormatConfig) Formatter { return JSONFormatter{Opts: cfg.Summary} })
+	RegisterFormatter("print0", func(cfg FormatConfig) Formatter { return Print0Formatter{Opts: cfg.Tree} })
+	RegisterFormatter("csv", func(cfg FormatConfig) Formatter { return CSVFormatter{Opts: cfg.Tree} })
+	RegisterFormatter("markdown", func(cfg FormatConfig) Formatter { return MarkdownFormatter{Opts: cfg.Tree} })
+}
+
+// loadedGaps lists the output options cfg asks for that the loaded result
+// res cannot honor because its summary was written without the detail they
+// need; the outputs are written without it.
+func loadedGaps(res *Result, cfg FormatConfig) []string {
+	var gaps []string
+	if res.DirUsers == nil {
+		if cfg.Summary.OwnerBreakdown {
+			gaps = append(gaps, "the summary has no per-directory owners (written without -json-owner-breakdown); the JSON dirs are written without them")
+		}
+		if cfg.Tree.ShowUser && cfg.Tree.DominantOwner {
+			gaps = append(gaps, "the summary has no per-directory owners (written without -json-owner-breakdown); -dominant-owner leaves the user column empty")
+		}
+	}
+	return gaps
+}
+
+// formatExtensions maps format names to the file extension -output-dir
+// gives them; formats not listed use their name.
+var formatExtensions = map[string]string{
+	"tree":     "txt",
+	"print0":   "lst",
+	"markdown": "md",
+}
+
+// outputFile is one file of -output-dir and the function writing it.
+type outputFile struct {
+	Path  string
+	Write func(w io.Writer) error
+}
+
+// outputDirFiles returns the files -output-dir writes for res: one
+// "summary.<ext>" in dir per format name, compressed with c (nil =
+// uncompressed) and named with its extension.
+func outputDirFiles(dir string, names []string, cfg FormatConfig, res *Result, c *compressor) ([]outputFile, error) {
+	files := make([]outputFile, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		f, err := NewFormatter(name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		ext := formatExtensions[name]
+		if ext == "" {
+			ext = name
+		}
+		files = append(files, outputFile{
+			Path:  addCompressExt(filepath.Join(dir, "summary."+ext), c),
+			Write: compressWrite(c, func(w io.Writer) error { return f.Write(w, res) }),
+		})
+	}
+	return files, nil
+}
+
+// TreeFormatter renders the human-readable tree, summaries and any optional
+// report sections (samples, df-check/show-free, incomplete-scan note).
+type TreeFormatter struct {
+	Opts TreeOptions
+}
+
+func (f TreeFormatter) Write(w io.Writer, res *Result) error {
+	bw := bufio.NewWriter(w)
+	printTree(bw, res, f.Opts)
+	if f.Opts.Parents > 0 {
+		printLargestLeaves(bw, res, f.Opts.Parents, f.Opts)
+	}
+	if res.Samples != nil {
+		printSamples(bw, res.Samples, f.Opts.Format)
+	}
+	if res.Newest != nil {
+		printTopFiles(bw, "Newest files", res.Newest.Sorted(), f.Opts.Format)
+	}
+	if res.Oldest != nil {
+		printTopFiles(bw, "Oldest files", res.Oldest.Sorted(), f.Opts.Format)
+	}
+	if res.Devices != nil {
+		printDevices(bw, res.Devices, f.Opts.Format)
+	}
+	if res.ExtByUser != nil {
+		printExtByUser(bw, res.ExtByUser, f.Opts.TopN, f.Opts.Format)
+	}
+	if res.Duplicates != nil {
+		printDuplicates(bw, res.Duplicates, f.Opts.Format)
+	}
+	if res.Hidden != nil {
+		printHiddenReport(bw, *res.Hidden, f.Opts.Format)
+	}
+	if res.FS != nil && (f.Opts.DFCheck || f.Opts.ShowFree) {
+		var scanned int64
+		if ds, ok := res.DirStats["."]; ok {
+			scanned = ds.Size
+		}
+		_, _ = fmt.Fprintln(bw)
+		if f.Opts.ShowFree {
+			_, _ = fmt.Fprintln(bw, capacityLine(*res.FS, scanned))
+		}
+		if f.Opts.DFCheck {
+			lines, _ := dfCheckReport(*res.FS, scanned)
+			for _, l := range lines {
+				_, _ = fmt.Fprintln(bw, l)
+			}
+		}
+	}
+	if res.BindDupFiles > 0 {
+		_, _ = fmt.Fprintln(bw)
+		_, _ = fmt.Fprintf(bw, "Note: %d files (%s) reached again through bind mounts were counted once.\n", res.BindDupFiles, f.Opts.Format.size(res.BindDupBytes))
+	}
+	printSources(bw, res)
+	if res.Incomplete {
+		_, _ = fmt.Fprintln(bw)
+		_, _ = fmt.Fprintln(bw, "Note: scan incomplete (stopped by -max-files, -timeout or -deadline, or a -max-memory spill failed); totals are partial.")
+	}
+	return bw.Flush()
+}
+
+// JSONFormatter writes the JSON summary via StreamSummary.
+type JSONFormatter struct {
+	Opts SummaryOptions
+}
+
+func (f JSONFormatter) Write(w io.Writer, res *Result) error {
+	return StreamSummary(w, res, f.Opts)
+}
+
+// CSVFormatter writes the per-user and per-group totals via WriteSummaryCSV.
+type CSVFormatter struct {
+	Opts TreeOptions
+}
+
+func (f CSVFormatter) Write(w io.Writer, res *Result) error {
+	return WriteSummaryCSV(w, res, f.Opts)
+}
+
+// Policies for -on-write-error.
+const (
+	onWriteErrorFatal  = "fatal"
+	onWriteErrorStdout = "stdout"
+	onWriteErrorTmp    = "tmp"
+)
+
+// writeOutputFile writes an output file (or stdout for "-"), applying the
+// -on-write-error policy when the file cannot be written. It reports whether
+// the results were written elsewhere instead; a write the policy cannot save
+// is fatal.
+func writeOutputFile(path, what, policy string, write func(io.Writer) error) (fellBack bool) {
+	if path == "-" {
+		if err := write(os.Stdout); err != nil {
+			fatalf("failed to write %s: %v", what, err)
+		}
+		return false
+	}
+	where, err := writeFileWithFallback(path, policy, os.Stdout, write)
+	if err == nil {
+		return false
+	}
+	if where == "" {
+		fatalf("failed to write %s: %v", what, err)
+		return false
+	}
+	log.Printf("failed to write %s to %s: %v; results were written to %s instead", what, path, err, where)
+	return true
+}
+
+// writeFileWithFallback writes path atomically via write. If that fails, the
+// policy decides what happens to the results: "fatal" returns the error,
+// "stdout" writes them to stdout instead, and "tmp" writes them to a new file
+// in the system temp directory. It returns where the output ended up, so
+// expensive results are not lost to a permission or disk-full error.
+func writeFileWithFallback(path, policy string, stdout io.Writer, write func(w io.Writer) error) (string, error) {
+	err := writeFileAtomic(path, write)
+	if err == nil {
+		return path, nil
+	}
+	switch policy {
+	case onWriteErrorStdout:
+		if ferr := write(stdout); ferr != nil {
+			return "", fmt.Errorf("%v; fallback to stdout failed: %w", err, ferr)
+		}
+		return "stdout", err
+	case onWriteErrorTmp:
+		tmp, terr := os.CreateTemp("", "diskusage-*-"+filepath.Base(path))
+		if terr != nil {
+			return "", fmt.Errorf("%v; fallback to temp file failed: %w", err, terr)
+		}
+		ferr := write(tmp)
+		if cerr := tmp.Close(); ferr == nil {
+			ferr = cerr
+		}
+		if ferr != nil {
+			_ = os.Remove(tmp.Name())
+			return "", fmt.Errorf("%v; fallback to temp file failed: %w", err, ferr)
+		}
+		return tmp.Name(), err
+	}
+	return "", err
+}
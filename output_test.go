@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testResult() *Result {
+	return &Result{
+		Root: "/data",
+		DirStats: map[string]*DirStat{
+			".":   {Size: 3072, Files: 3},
+			"a":   {Size: 2048, Files: 2},
+			"a/b": {Size: 1024, Files: 1},
+		},
+		UserStats:  map[string]*UserStat{"alice": {Size: 3072, Files: 3}},
+		GroupStats: map[string]*GroupStat{"staff": {Size: 3072, Files: 3}},
+		DirOwners:  map[string]string{},
+		DirGroups:  map[string]string{},
+	}
+}
+
+func TestFormatterRegistry(t *testing.T) {
+	builtins := []string{"csv", "json", "tree"}
+	for _, name := range builtins {
+		f, err := NewFormatter(name, FormatConfig{Tree: TreeOptions{Levels: 2}})
+		if err != nil {
+			t.Fatalf("built-in format %q not reachable: %v", name, err)
+		}
+		var buf bytes.Buffer
+		if err := f.Write(&buf, testResult()); err != nil {
+			t.Fatalf("%s Write error: %v", name, err)
+		}
+		if buf.Len() == 0 {
+			t.Fatalf("%s wrote no output", name)
+		}
+	}
+	names := FormatterNames()
+	for _, name := range builtins {
+		found := false
+		for _, n := range names {
+			found = found || n == name
+		}
+		if !found {
+			t.Fatalf("FormatterNames() = %v; missing %q", names, name)
+		}
+	}
+	if _, err := NewFormatter("nope", FormatConfig{}); err == nil {
+		t.Fatalf("expected error for unknown format")
+	}
+}
+
+type upperFormatter struct{}
+
+func (upperFormatter) Write(w io.Writer, res *Result) error {
+	_, err := io.WriteString(w, strings.ToUpper(res.Root))
+	return err
+}
+
+func TestRegisterCustomFormatter(t *testing.T) {
+	RegisterFormatter("upper", func(FormatConfig) Formatter { return upperFormatter{} })
+	defer delete(formatters, "upper")
+
+	f, err := NewFormatter("upper", FormatConfig{})
+	if err != nil {
+		t.Fatalf("custom formatter not reachable: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := f.Write(&buf, testResult()); err != nil || buf.String() != "/DATA" {
+		t.Fatalf("custom formatter output %q, err %v", buf.String(), err)
+	}
+}
+
+func TestJSONFormatterParses(t *testing.T) {
+	f, _ := NewFormatter("json", FormatConfig{Summary: SummaryOptions{Version: "vX"}})
+	var buf bytes.Buffer
+	if err := f.Write(&buf, testResult()); err != nil {
+		t.Fatalf("json Write error: %v", err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+		t.Fatalf("json output does not parse: %v", err)
+	}
+	if jo.Root != "/data" || jo.Stats.Version != "vX" || len(jo.Dirs) != 3 {
+		t.Fatalf("unexpected json summary: %+v", jo)
+	}
+}
+
+func TestTreeFormatterIncompleteNote(t *testing.T) {
+	res := testResult()
+	res.Incomplete = true
+	var buf bytes.Buffer
+	if err := (TreeFormatter{Opts: TreeOptions{Levels: 1}}).Write(&buf, res); err != nil {
+		t.Fatalf("tree Write error: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "/data") || !strings.Contains(out, "└── a") {
+		t.Fatalf("unexpected tree output:\n%s", out)
+	}
+	if strings.Contains(out, "── b") {
+		t.Fatalf("levels=1 should hide a/b:\n%s", out)
+	}
+	if !strings.Contains(out, "scan incomplete") {
+		t.Fatalf("missing incomplete note:\n%s", out)
+	}
+}
+
+func TestRootLabel(t *testing.T) {
+	const label = "prod-nfs-1:/data"
+	cfg := FormatConfig{Tree: TreeOptions{Levels: 1, RootLabel: label}, Summary: SummaryOptions{RootLabel: label}}
+
+	tf, _ := NewFormatter("tree", cfg)
+	var buf bytes.Buffer
+	if err := tf.Write(&buf, testResult()); err != nil {
+		t.Fatalf("tree Write: %v", err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if len(lines) < 2 || !strings.HasSuffix(lines[1], " "+label) {
+		t.Fatalf("root line does not carry the label:\n%s", buf.String())
+	}
+
+	jf, _ := NewFormatter("json", cfg)
+	buf.Reset()
+	if err := jf.Write(&buf, testResult()); err != nil {
+		t.Fatalf("json Write: %v", err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if jo.Root != label {
+		t.Fatalf("json root = %q, want %q", jo.Root, label)
+	}
+	for _, d := range jo.Dirs {
+		if !strings.HasPrefix(d.Path, "/data") {
+			t.Fatalf("label leaked into directory paths: %+v", d)
+		}
+	}
+}
+
+func TestWriteFileWithFallback(t *testing.T) {
+	unwritable := filepath.Join(t.TempDir(), "missing-dir", "out.json")
+	write := func(w io.Writer) error {
+		_, err := io.WriteString(w, "results\n")
+		return err
+	}
+
+	// fatal keeps the old behaviour: the error is returned, nothing is written elsewhere
+	var stdout bytes.Buffer
+	if where, err := writeFileWithFallback(unwritable, onWriteErrorFatal, &stdout, write); err == nil || where != "" || stdout.Len() != 0 {
+		t.Fatalf("fatal: where=%q err=%v stdout=%q", where, err, stdout.String())
+	}
+
+	if where, err := writeFileWithFallback(unwritable, onWriteErrorStdout, &stdout, write); err == nil || where != "stdout" || stdout.String() != "results\n" {
+		t.Fatalf("stdout: where=%q err=%v stdout=%q", where, err, stdout.String())
+	}
+
+	where, err := writeFileWithFallback(unwritable, onWriteErrorTmp, &stdout, write)
+	if err == nil || where == "" || where == unwritable {
+		t.Fatalf("tmp: where=%q err=%v", where, err)
+	}
+	t.Cleanup(func() { _ = os.Remove(where) })
+	if b, rerr := os.ReadFile(where); rerr != nil || string(b) != "results\n" {
+		t.Fatalf("tmp fallback %s holds %q (%v)", where, b, rerr)
+	}
+
+	// a writable target is written directly
+	ok := filepath.Join(t.TempDir(), "out.json")
+	if where, err := writeFileWithFallback(ok, onWriteErrorTmp, &stdout, write); err != nil || where != ok {
+		t.Fatalf("writable target: where=%q err=%v", where, err)
+	}
+}
+
+func TestOutputDirWritesEachFormat(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "x"), 100)
+	writeFile(t, filepath.Join(root, "b"), 20)
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2})
+	stubOwnerNames(t, nil, nil)
+
+	dir := t.TempDir()
+	gz, err := lookupCompressor("gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := FormatConfig{Tree: TreeOptions{Levels: 1, Format: FormatOptions{Bytes: true}}}
+	files, err := outputDirFiles(dir, []string{"json", "csv", "json"}, cfg, res, gz)
+	if err != nil {
+		t.Fatalf("outputDirFiles: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want one per distinct format", len(files))
+	}
+	for _, f := range files {
+		if err := writeFileAtomic(f.Path, f.Write); err != nil {
+			t.Fatalf("write %s: %v", f.Path, err)
+		}
+	}
+
+	jo, err := LoadSummary(filepath.Join(dir, "summary.json.gz"))
+	if err != nil {
+		t.Fatalf("summary.json.gz does not parse: %v", err)
+	}
+	if got := resultFromSummary(jo).DirStats["."].Size; got != 120 {
+		t.Fatalf("json root size = %d, want 120", got)
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, "summary.csv.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := decompress(raw)
+	if err != nil {
+		t.Fatalf("decompress csv: %v", err)
+	}
+	users := strings.SplitN(string(plain), "\n\n", 2)[0]
+	rows, err := csv.NewReader(strings.NewReader(users)).ReadAll()
+	if err != nil {
+		t.Fatalf("summary.csv.gz does not parse: %v", err)
+	}
+	if len(rows) != 2 || rows[0][0] != "name" || rows[1][1] != "120" {
+		t.Fatalf("csv users = %v", rows)
+	}
+
+	if _, err := outputDirFiles(dir, []string{"html"}, cfg, res, nil); err == nil {
+		t.Fatalf("expected an error for an unknown format")
+	}
+	files, _ = outputDirFiles(dir, []string{"tree", "print0"}, cfg, res, nil)
+	if files[0].Path != filepath.Join(dir, "summary.txt") || files[1].Path != filepath.Join(dir, "summary.lst") {
+		t.Fatalf("paths = %s, %s", files[0].Path, files[1].Path)
+	}
+}
+
+func TestLoadedSummaryTranscodes(t *testing.T) {
+	// a snapshot taken elsewhere: none of its paths exist here
+	fixture := JsonOut{
+		Root:  "/nonexistent/data",
+		Stats: JsonStats{StartedAt: "2024-01-01T00:00:00Z", EndedAt: "2024-01-01T00:00:01Z", DirsScanned: 2, FilesScanned: 3},
+		Dirs: []JsonDir{
+			{Path: "/nonexistent/data", Rel: ".", Size: 300, Files: 3, UID: 1001, User: "alice", GID: 100, Group: "staff"},
+			{Path: "/nonexistent/data/a", Rel: "a", Size: 200, Files: 2, UID: 1002, User: "bob", GID: 100, Group: "staff"},
+		},
+		Users: []JsonUser{{Name: "bob", Size: 200, Files: 2, UID: 1002}, {Name: "alice", Size: 100, Files: 1, UID: 1001}},
+		Grps:  []JsonGroup{{Name: "staff", Size: 300, Files: 3, GID: 100}},
+	}
+	b, err := json.Marshal(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "snap.json")
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	jo, err := LoadSummary(path)
+	if err != nil {
+		t.Fatalf("LoadSummary: %v", err)
+	}
+	res := resultFromSummary(jo)
+	cfg := FormatConfig{Tree: TreeOptions{Levels: 1, Format: FormatOptions{Bytes: true}}}
+	transcode := func(name string) string {
+		t.Helper()
+		f, err := NewFormatter(name, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := f.Write(&buf, res); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return buf.String()
+	}
+
+	wantCSV := "name,size,files,uid\nbob,200,2,1002\nalice,100,1,1001\n\nname,size,files,gid\nstaff,300,3,100\n"
+	if got := transcode("csv"); got != wantCSV {
+		t.Fatalf("csv =\n%s\nwant\n%s", got, wantCSV)
+	}
+
+	// the directories keep the owners recorded in the snapshot
+	var again JsonOut
+	if err := json.Unmarshal([]byte(transcode("json")), &again); err != nil {
+		t.Fatalf("unmarshal json: %v", err)
+	}
+	if !reflect.DeepEqual(again.Dirs, fixture.Dirs) {
+		t.Fatalf("json dirs = %+v, want %+v", again.Dirs, fixture.Dirs)
+	}
+
+	if got, want := transcode("print0"), "/nonexistent/data\x00/nonexistent/data/a\x00"; got != want {
+		t.Fatalf("print0 = %q, want %q", got, want)
+	}
+
+	wantMarkdown := "# /nonexistent/data\n\n" +
+		"| Size | Files | Path |\n|---:|---:|:---|\n" +
+		"| 300 | 3 | /nonexistent/data |\n" +
+		"| 200 | 2 | a |\n" +
+		"\n## Users\n\n| User | Size | Files |\n|:---|---:|---:|\n" +
+		"| bob | 200 | 2 |\n" +
+		"| alice | 100 | 1 |\n" +
+		"\n## Groups\n\n| Group | Size | Files |\n|:---|---:|---:|\n" +
+		"| staff | 300 | 3 |\n"
+	if got := transcode("markdown"); got != wantMarkdown {
+		t.Fatalf("markdown =\n%s\nwant\n%s", got, wantMarkdown)
+	}
+
+	// options needing detail the snapshot lacks are noted, not fatal
+	cfg.Summary.OwnerBreakdown = true
+	if gaps := loadedGaps(res, cfg); len(gaps) != 1 || !strings.Contains(gaps[0], "-json-owner-breakdown") {
+		t.Fatalf("gaps = %q, want the missing owner breakdown", gaps)
+	}
+	if got := transcode("json"); strings.Contains(got, `"owners"`) {
+		t.Fatalf("json has owners the snapshot lacks:\n%s", got)
+	}
+}
+
+func TestMinOwnerSizeHidesSmallOwners(t *testing.T) {
+	res := testResult()
+	res.UserStats = map[string]*UserStat{"alice": {Size: 3000, Files: 2}, "bob": {Size: 72, Files: 1}}
+	res.GroupStats = map[string]*GroupStat{"staff": {Size: 3000, Files: 2}, "guests": {Size: 72, Files: 1}}
+	opts := TreeOptions{Levels: 1, MinUserSize: 100, MinGroupSize: 100, Format: FormatOptions{Bytes: true}}
+
+	var out bytes.Buffer
+	if err := (TreeFormatter{Opts: opts}).Write(&out, res); err != nil {
+		t.Fatal(err)
+	}
+	sections := strings.Split(out.String(), "\n\n")
+	// bob's bytes still count in the root's total
+	if root := strings.Split(sections[0], "\n")[1]; !strings.HasPrefix(strings.TrimSpace(root), "3072 ") {
+		t.Fatalf("root line = %q, want the full 3072 bytes", root)
+	}
+	if !strings.Contains(sections[1], "alice") || strings.Contains(sections[1], "bob") {
+		t.Fatalf("per-user summary should list alice only:\n%s", sections[1])
+	}
+	if !strings.Contains(sections[2], "staff") || strings.Contains(sections[2], "guests") {
+		t.Fatalf("per-group summary should list staff only:\n%s", sections[2])
+	}
+
+	out.Reset()
+	if err := WriteSummaryCSV(&out, res, opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := "name,size,files,uid\nalice,3000,2,0\n\nname,size,files,gid\nstaff,3000,2,0\n"; out.String() != want {
+		t.Fatalf("csv =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	// JSON leaves them out too and records why the arrays fall short
+	out.Reset()
+	if err := StreamSummary(&out, res, SummaryOptions{SkipDirOwner: true, MinUserSize: 100, MinGroupSize: 100}); err != nil {
+		t.Fatal(err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(out.Bytes(), &jo); err != nil {
+		t.Fatal(err)
+	}
+	if len(jo.Users) != 1 || jo.Users[0].Name != "alice" || len(jo.Grps) != 1 || jo.Grps[0].Name != "staff" {
+		t.Fatalf("users %+v, groups %+v; want alice and staff only", jo.Users, jo.Grps)
+	}
+	if jo.Stats.MinUserSize != 100 || jo.Stats.MinGroupSize != 100 {
+		t.Fatalf("stats min sizes = %d/%d, want 100/100", jo.Stats.MinUserSize, jo.Stats.MinGroupSize)
+	}
+	jo.Stats.FilesScanned = 3
+	if v := VerifySummary(jo); len(v) != 0 {
+		t.Fatalf("violations %v; the filtered arrays should verify", v)
+	}
+	jo.Stats.MinUserSize = 0
+	if v := VerifySummary(jo); len(v) != 1 || v[0].Check != "user-totals" {
+		t.Fatalf("violations %v; want user-totals without the recorded threshold", v)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// OwnerMap maps user or group names, or numeric ids, to a canonical name so
+// the files of aliased accounts are summed together (-user-map/-group-map).
+type OwnerMap struct {
+	to      map[string]string // source name or id -> canonical name
+	targets map[string]bool   // the canonical names
+}
+
+// ParseOwnerMap reads an owner map with one "from=to" mapping per line; blank
+// lines and lines starting with "#" are ignored.
+func ParseOwnerMap(r io.Reader) (*OwnerMap, error) {
+	m := &OwnerMap{to: make(map[string]string), targets: make(map[string]bool)}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		from, to, ok := strings.Cut(line, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("line %d: want from=to, got %q", n, line)
+		}
+		if prev, dup := m.to[from]; dup && prev != to {
+			return nil, fmt.Errorf("line %d: %q is already mapped to %q", n, from, prev)
+		}
+		m.to[from] = to
+		m.targets[to] = true
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoadOwnerMap reads an owner map file.
+func LoadOwnerMap(path string) (*OwnerMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	m, err := ParseOwnerMap(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// canonical returns the name an owner with the given resolved name and
+// numeric id is aggregated under. A mapped name (checked first) or id maps to
+// its target, and a target maps to itself so the canonical account combines
+// with its aliases.
+func (m *OwnerMap) canonical(name, id string) (string, bool) {
+	if to, ok := m.to[name]; ok {
+		return to, true
+	}
+	if to, ok := m.to[id]; ok {
+		return to, true
+	}
+	if m.targets[name] {
+		return name, true
+	}
+	return "", false
+}
+
+// mappedOwner is the UserStats/GroupStats key and name one id aggregates under.
+type mappedOwner struct {
+	key, name string
+}
+
+// ownerMapper applies an OwnerMap during a scan, resolving each id once.
+type ownerMapper struct {
+	m      *OwnerMap
+	lookup func(uint32) string
+	ids    map[uint32]mappedOwner
+}
+
+// newOwnerMapper returns nil for a nil map, so callers can skip mapping.
+func newOwnerMapper(m *OwnerMap, lookup func(uint32) string) *ownerMapper {
+	if m == nil {
+		return nil
+	}
+	return &ownerMapper{m: m, lookup: lookup, ids: make(map[uint32]mappedOwner)}
+}
+
+// owner returns the key and name id is aggregated under: its canonical name
+// for both when mapped, otherwise the numeric id and the looked-up name.
+func (o *ownerMapper) owner(id uint32) mappedOwner {
+	if mo, ok := o.ids[id]; ok {
+		return mo
+	}
+	idKey := strconv.FormatUint(uint64(id), 10)
+	mo := mappedOwner{key: idKey, name: o.lookup(id)}
+	if c, ok := o.m.canonical(mo.name, idKey); ok {
+		mo = mappedOwner{key: c, name: c}
+	}
+	o.ids[id] = mo
+	return mo
+}
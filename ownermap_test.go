@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseOwnerMap(t *testing.T) {
+	m, err := ParseOwnerMap(strings.NewReader("# aliases\njsmith = john\n\n1002=john\nops=admins\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name, id, want string
+		ok             bool
+	}{
+		{"jsmith", "1001", "john", true},
+		{"j.smith", "1002", "john", true}, // by uid
+		{"john", "1000", "john", true},    // a target maps to itself
+		{"alice", "1003", "", false},
+	} {
+		if got, ok := m.canonical(tc.name, tc.id); got != tc.want || ok != tc.ok {
+			t.Errorf("canonical(%q, %q) = %q, %v; want %q, %v", tc.name, tc.id, got, ok, tc.want, tc.ok)
+		}
+	}
+	for _, bad := range []string{"novalue", "=x", "a=", "a=b\na=c"} {
+		if _, err := ParseOwnerMap(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseOwnerMap(%q) should fail", bad)
+		}
+	}
+	if _, err := ParseOwnerMap(strings.NewReader("a=b\na=b")); err != nil {
+		t.Errorf("a repeated identical mapping is fine: %v", err)
+	}
+}
+
+func TestAddFileUserMap(t *testing.T) {
+	stubOwnerNames(t, map[uint32]string{1001: "jsmith", 1002: "j.smith", 1003: "alice"}, map[uint32]string{100: "dev", 101: "devs"})
+	path := filepath.Join(t.TempDir(), "users.map")
+	if err := os.WriteFile(path, []byte("jsmith=john\nj.smith=john\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	um, err := LoadOwnerMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gm, _ := ParseOwnerMap(strings.NewReader("101=dev\n"))
+
+	res := newTestResult()
+	res.userMap = newOwnerMapper(um, userName)
+	res.groupMap = newOwnerMapper(gm, groupName)
+	res.addFile("a", 100, 1001, 100)
+	res.addFile("b", 300, 1002, 101)
+	res.addFile("b", 5, 1003, 100)
+
+	if len(res.UserStats) != 2 {
+		t.Fatalf("expected john and alice, got %v", res.UserStats)
+	}
+	if us := res.UserStats["john"]; us == nil || us.Size != 400 || us.Files != 2 || us.Name != "john" {
+		t.Fatalf("john = %+v, want both aliases summed (400 bytes, 2 files)", us)
+	}
+	if us := res.UserStats["1003"]; us == nil || us.Size != 5 || us.Name != "alice" {
+		t.Fatalf("unmapped alice = %+v", us)
+	}
+	if gs := res.GroupStats["dev"]; gs == nil || gs.Size != 405 || gs.Files != 3 || len(res.GroupStats) != 1 {
+		t.Fatalf("groups = %v, want dev and gid 101 combined", res.GroupStats)
+	}
+
+	// the tree summary and the JSON users carry the combined totals
+	var out bytes.Buffer
+	printTree(&out, res, TreeOptions{Format: FormatOptions{Bytes: true}})
+	if !strings.Contains(out.String(), "john") || strings.Contains(out.String(), "jsmith") {
+		t.Fatalf("per-user summary:\n%s", out.String())
+	}
+	out.Reset()
+	if err := StreamSummary(&out, res, SummaryOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(out.Bytes(), &jo); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, u := range jo.Users {
+		if u.Name == "john" {
+			found = u.Size == 400 && u.Files == 2
+		}
+		if u.Name == "jsmith" || u.Name == "j.smith" {
+			t.Fatalf("alias %q left in JSON users", u.Name)
+		}
+	}
+	if !found {
+		t.Fatalf("JSON users = %+v, want john with 400 bytes in 2 files", jo.Users)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// LookupStats counts user/group name resolutions for -profile-lookups.
+type LookupStats struct {
+	Calls       int64         // os/user lookups performed
+	CacheHits   int64         // resolutions answered from an already resolved id
+	CacheMisses int64         // resolutions that needed a lookup
+	Duration    time.Duration // time spent in lookups
+}
+
+// lookupCounters accumulates LookupStats across the process.
+var lookupCounters struct {
+	calls, hits, misses, nanos atomic.Int64
+}
+
+// timedLookup runs one os/user lookup and records its cost.
+func timedLookup[T any](fn func(string) (T, error), arg string) (T, error) {
+	start := time.Now()
+	v, err := fn(arg)
+	lookupCounters.nanos.Add(int64(time.Since(start)))
+	lookupCounters.calls.Add(1)
+	return v, err
+}
+
+// countLookupCache records whether a name was found among the already
+// resolved ids (hit) or had to be looked up (miss).
+func countLookupCache(hit bool) {
+	if hit {
+		lookupCounters.hits.Add(1)
+	} else {
+		lookupCounters.misses.Add(1)
+	}
+}
+
+// lookupStats returns the counters accumulated so far.
+func lookupStats() LookupStats {
+	return LookupStats{
+		Calls:       lookupCounters.calls.Load(),
+		CacheHits:   lookupCounters.hits.Load(),
+		CacheMisses: lookupCounters.misses.Load(),
+		Duration:    time.Duration(lookupCounters.nanos.Load()),
+	}
+}
+
+// Instrumented wrappers around the os/user lookups.
+func lookupUserID(id string) (*user.User, error)   { return timedLookup(user.LookupId, id) }
+func lookupUser(name string) (*user.User, error)   { return timedLookup(user.Lookup, name) }
+func lookupGroupID(id string) (*user.Group, error) { return timedLookup(user.LookupGroupId, id) }
+func lookupGroup(name string) (*user.Group, error) { return timedLookup(user.LookupGroup, name) }
+
+// userName resolves a uid to a user name, falling back to the numeric id.
+// It is a variable so tests can stub name resolution.
+var userName = func(uid uint32) string {
+	id := strconv.FormatUint(uint64(uid), 10)
+	if u, err := lookupUserID(id); err == nil {
+		return u.Username
+	}
+	return id
+}
+
+// groupName resolves a gid to a group name, falling back to the numeric id.
+var groupName = func(gid uint32) string {
+	id := strconv.FormatUint(uint64(gid), 10)
+	if g, err := lookupGroupID(id); err == nil {
+		return g.Name
+	}
+	return id
+}
+
+// -unknown-owner policies: how an owner whose id has no entry in the user or
+// group database is named.
+const (
+	unknownOwnerNumeric  = "numeric"  // by the bare id, "1001"
+	unknownOwnerPrefixed = "prefixed" // by the id with its kind, "uid:1001"
+	unknownOwnerBucket   = "bucket"   // all of them together, as unknownKey
+)
+
+// unknownKey is the user/group stats entry collecting the unresolved ids
+// with the bucket policy.
+const unknownKey = "(unknown)"
+
+// checkUnknownOwner validates an -unknown-owner value; "" means numeric.
+func checkUnknownOwner(policy string) error {
+	switch policy {
+	case "", unknownOwnerNumeric, unknownOwnerPrefixed, unknownOwnerBucket:
+		return nil
+	}
+	return fmt.Errorf("invalid -unknown-owner %q (want numeric, prefixed or bucket)", policy)
+}
+
+// unknownOwnerName is the name policy gives an unresolved id of kind ("uid"
+// or "gid"); "" for numeric, which leaves the caller's own fallback.
+func unknownOwnerName(policy, kind string, id uint32) string {
+	switch policy {
+	case unknownOwnerPrefixed:
+		return kind + ":" + strconv.FormatUint(uint64(id), 10)
+	case unknownOwnerBucket:
+		return unknownKey
+	}
+	return ""
+}
+
+// dirOwnerNames returns the names for a directory owned by uid and gid, as
+// resolved through the caches, with policy naming the ids that do not
+// resolve (left blank with numeric).
+func dirOwnerNames(unames, gnames map[uint32]string, uid, gid uint32, policy string) (string, string) {
+	user := cachedName(unames, uid, lookupUserName)
+	if user == "" {
+		user = unknownOwnerName(policy, "uid", uid)
+	}
+	group := cachedName(gnames, gid, lookupGroupName)
+	if group == "" {
+		group = unknownOwnerName(policy, "gid", gid)
+	}
+	return user, group
+}
+
+// unresolvedName reports whether name is what a scan names an id of kind
+// that did not resolve, under any -unknown-owner policy.
+func unresolvedName(name, kind string, id uint32) bool {
+	n := strconv.FormatUint(uint64(id), 10)
+	return name == n || name == kind+":"+n || name == unknownKey
+}
+
+// primaryGID returns the primary group of uid from the user database, or
+// false when the user is unknown. It is a variable so tests can stub it.
+var primaryGID = func(uid uint32) (uint32, bool) {
+	u, err := lookupUserID(strconv.FormatUint(uint64(uid), 10))
+	if err != nil {
+		return 0, false
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(gid), true
+}
+
+// lookupUserName and lookupGroupName resolve an id to its name, or "" when
+// the id is unknown.
+func lookupUserName(uid uint32) string {
+	if u, err := lookupUserID(strconv.FormatUint(uint64(uid), 10)); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+func lookupGroupName(gid uint32) string {
+	if g, err := lookupGroupID(strconv.FormatUint(uint64(gid), 10)); err == nil {
+		return g.Name
+	}
+	return ""
+}
+
+// cachedName returns lookup(id), consulting and filling cache so every id is
+// resolved at most once.
+func cachedName(cache map[uint32]string, id uint32, lookup func(uint32) string) string {
+	name, ok := cache[id]
+	countLookupCache(ok)
+	if !ok {
+		name = lookup(id)
+		cache[id] = name
+	}
+	return name
+}
+
+// displayName returns a stat's resolved name, or its map key when no name is known.
+func displayName(name, key string) string {
+	if name != "" {
+		return name
+	}
+	return key
+}
+
+// ownerLabels returns the display label for each stats key. lookup yields the
+// key's display name and numeric id; names shared by several ids are
+// disambiguated with the id, e.g. "alice (uid 1001)".
+func ownerLabels(keys []string, lookup func(key string) (string, uint32), kind string) map[string]string {
+	count := make(map[string]int, len(keys))
+	for _, k := range keys {
+		n, _ := lookup(k)
+		count[n]++
+	}
+	labels := make(map[string]string, len(keys))
+	for _, k := range keys {
+		n, id := lookup(k)
+		if count[n] > 1 {
+			n += " (" + kind + " " + strconv.FormatUint(uint64(id), 10) + ")"
+		}
+		labels[k] = n
+	}
+	return labels
+}
+
+// dominantOwner returns the display label of the user holding the most bytes
+// in the subtree of rel, with their share of the directory's size, e.g.
+// "alice 90%". It returns "" when no per-directory owner data is available.
+func dominantOwner(res *Result, rel string) string {
+	byUser := res.DirUsers[rel]
+	var bestKey string
+	var best *UserStat
+	var total int64
+	for k, us := range byUser {
+		total += us.Size
+		if best == nil || us.Size > best.Size || (us.Size == best.Size && k < bestKey) {
+			bestKey, best = k, us
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	pct := 100
+	if total > 0 {
+		pct = int(best.Size * 100 / total)
+	}
+	return displayName(best.Name, bestKey) + " " + strconv.Itoa(pct) + "%"
+}
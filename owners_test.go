@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// stubOwnerNames replaces name resolution for the duration of a test.
+func stubOwnerNames(t *testing.T, users map[uint32]string, groups map[uint32]string) {
+	t.Helper()
+	oldUser, oldGroup := userName, groupName
+	userName = func(uid uint32) string { return users[uid] }
+	groupName = func(gid uint32) string { return groups[gid] }
+	t.Cleanup(func() { userName, groupName = oldUser, oldGroup })
+}
+
+func newTestResult() *Result {
+	return &Result{
+		Root:       "/r",
+		DirStats:   map[string]*DirStat{},
+		UserStats:  map[string]*UserStat{},
+		GroupStats: map[string]*GroupStat{},
+	}
+}
+
+func TestAddFileKeysOwnersByID(t *testing.T) {
+	// two uids that resolve to the same name (e.g. duplicate LDAP/local entries)
+	stubOwnerNames(t, map[uint32]string{1001: "alice", 1002: "alice"}, map[uint32]string{100: "staff"})
+
+	res := newTestResult()
+	res.addFile(".", 100, 1001, 100)
+	res.addFile("a", 300, 1002, 100)
+	res.addFile("a", 1, 1001, 100)
+
+	if len(res.UserStats) != 2 {
+		t.Fatalf("expected 2 distinct users, got %d: %v", len(res.UserStats), res.UserStats)
+	}
+	if us := res.UserStats["1001"]; us == nil || us.Size != 101 || us.Files != 2 || us.Name != "alice" || us.UID != 1001 {
+		t.Fatalf("unexpected uid 1001 stats: %+v", us)
+	}
+	if us := res.UserStats["1002"]; us == nil || us.Size != 300 || us.Files != 1 || us.UID != 1002 {
+		t.Fatalf("unexpected uid 1002 stats: %+v", us)
+	}
+	if gs := res.GroupStats["100"]; gs == nil || gs.Size != 401 || gs.Name != "staff" {
+		t.Fatalf("unexpected group stats: %+v", gs)
+	}
+	if ds := res.DirStats["."]; ds.Size != 401 || ds.Files != 3 {
+		t.Fatalf("unexpected root totals: %+v", ds)
+	}
+
+	// JSON keeps them apart with their own uids
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(jo.Users) != 2 || jo.Users[0].UID != 1001 || jo.Users[1].UID != 1002 || jo.Users[1].Size != 300 {
+		t.Fatalf("unexpected json users: %+v", jo.Users)
+	}
+
+	// the tree summary disambiguates the shared name
+	var out bytes.Buffer
+	printTree(&out, res, TreeOptions{})
+	if !strings.Contains(out.String(), "alice (uid 1002)") || !strings.Contains(out.String(), "alice (uid 1001)") {
+		t.Fatalf("expected disambiguated labels:\n%s", out.String())
+	}
+
+	// and loading the JSON back does not merge them either
+	loaded := resultFromSummary(jo)
+	if len(loaded.UserStats) != 2 {
+		t.Fatalf("loaded summary merged users: %v", loaded.UserStats)
+	}
+}
+
+func TestAddFileNumericNameDoesNotCollide(t *testing.T) {
+	// uid 1001 is unresolvable (falls back to "1001"); uid 5 is a user literally named "1001"
+	stubOwnerNames(t, map[uint32]string{1001: "1001", 5: "1001"}, map[uint32]string{})
+
+	res := newTestResult()
+	res.addFile(".", 10, 1001, 0)
+	res.addFile(".", 20, 5, 0)
+	if len(res.UserStats) != 2 || res.UserStats["5"].Size != 20 || res.UserStats["1001"].Size != 10 {
+		t.Fatalf("numeric fallback collided with a real name: %v", res.UserStats)
+	}
+}
+
+func TestAddFileMaxUsersOverflow(t *testing.T) {
+	stubOwnerNames(t, map[uint32]string{1: "a", 2: "b", 3: "c", 4: "d"}, map[uint32]string{1: "g1", 2: "g2"})
+
+	res := newTestResult()
+	res.maxUsers = 2
+	res.maxGroups = 1
+	res.addFile(".", 10, 1, 1)
+	res.addFile(".", 20, 2, 2)
+	res.addFile(".", 30, 3, 1)
+	res.addFile(".", 40, 4, 2)
+	res.addFile(".", 5, 1, 1) // already tracked users keep aggregating
+
+	if len(res.UserStats) != 3 {
+		t.Fatalf("expected 2 users plus (others), got %v", res.UserStats)
+	}
+	if us := res.UserStats["1"]; us.Size != 15 || us.Files != 2 {
+		t.Fatalf("unexpected tracked user: %+v", us)
+	}
+	if o := res.UserStats[othersKey]; o == nil || o.Size != 70 || o.Files != 2 || o.Name != othersKey {
+		t.Fatalf("unexpected (others) user bucket: %+v", o)
+	}
+	if o := res.GroupStats[othersKey]; o == nil || o.Size != 60 || o.Files != 2 {
+		t.Fatalf("unexpected (others) group bucket: %+v", o)
+	}
+
+	// the buckets still add up to the root total
+	var users, groups int64
+	for _, us := range res.UserStats {
+		users += us.Size
+	}
+	for _, gs := range res.GroupStats {
+		groups += gs.Size
+	}
+	if total := res.DirStats["."].Size; users != total || groups != total {
+		t.Fatalf("users=%d groups=%d root=%d", users, groups, total)
+	}
+}
+
+func TestDominantOwnerColumn(t *testing.T) {
+	stubOwnerNames(t, map[uint32]string{1001: "alice", 1002: "bob"}, map[uint32]string{})
+
+	res := newTestResult()
+	res.Root = t.TempDir()
+	res.DirUsers = map[string]map[string]*UserStat{}
+	res.DirStats["a"] = &DirStat{}
+	res.addFile("a", 900, 1001, 0)
+	res.addFile("a", 100, 1002, 0)
+	res.addFile(".", 1000, 1002, 0)
+
+	if got := dominantOwner(res, "a"); got != "alice 90%" {
+		t.Fatalf("dominantOwner(a) = %q", got)
+	}
+	if got := dominantOwner(res, "."); got != "bob 55%" {
+		t.Fatalf("dominantOwner(.) = %q", got)
+	}
+
+	var out bytes.Buffer
+	printTree(&out, res, TreeOptions{Levels: 1, ShowUser: true, DominantOwner: true})
+	if !strings.Contains(out.String(), "alice 90%") {
+		t.Fatalf("expected dominant owner in tree:\n%s", out.String())
+	}
+	out.Reset()
+	printTree(&out, res, TreeOptions{Levels: 1, ShowUser: true})
+	if strings.Contains(out.String(), "90%") {
+		t.Fatalf("dominant owner shown without the option:\n%s", out.String())
+	}
+}
+
+func TestLookupCounters(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to create files with distinct owners")
+	}
+	root := t.TempDir()
+	for i, uid := range []int{1001, 1001, 1002, 1003} {
+		p := filepath.Join(root, "d", strconv.Itoa(i))
+		writeFile(t, p, 10)
+		if err := os.Lchown(p, uid, 0); err != nil {
+			t.Fatalf("chown: %v", err)
+		}
+	}
+
+	before := lookupStats()
+	Scan(context.Background(), root, ScanOptions{Concurrency: 1})
+	after := lookupStats()
+	// three distinct uids and one gid are each looked up once; the other
+	// files reuse the resolved names
+	if got := after.Calls - before.Calls; got != 4 {
+		t.Errorf("lookup calls = %d, want 4", got)
+	}
+	if got := after.CacheMisses - before.CacheMisses; got != 4 {
+		t.Errorf("cache misses = %d, want 4", got)
+	}
+	if got := after.CacheHits - before.CacheHits; got != 4 {
+		t.Errorf("cache hits = %d, want 4 (1 user + 3 group)", got)
+	}
+	if after.Duration < before.Duration {
+		t.Errorf("lookup duration went backwards: %v -> %v", before.Duration, after.Duration)
+	}
+
+	cache := make(map[uint32]string)
+	before = lookupStats()
+	for _, id := range []uint32{1001, 1001, 1002} {
+		cachedName(cache, id, lookupUserName)
+	}
+	after = lookupStats()
+	if after.Calls-before.Calls != 2 || after.CacheHits-before.CacheHits != 1 || after.CacheMisses-before.CacheMisses != 2 {
+		t.Errorf("cachedName counters: %+v -> %+v", before, after)
+	}
+}
+
+func TestAddFileGroupByPrimary(t *testing.T) {
+	stubOwnerNames(t, map[uint32]string{1001: "alice", 1002: "bob"}, map[uint32]string{100: "staff", 200: "dev", 50: "shared"})
+	old := primaryGID
+	lookups := 0
+	primaryGID = func(uid uint32) (uint32, bool) {
+		lookups++
+		switch uid {
+		case 1001:
+			return 100, true
+		case 1002:
+			return 200, true
+		}
+		return 0, false
+	}
+	t.Cleanup(func() { primaryGID = old })
+
+	res := newTestResult()
+	res.primaryGroups = map[uint32]primaryGroup{}
+	res.addFile(".", 10, 1001, 50) // gid differs from alice's primary group
+	res.addFile("a", 20, 1001, 100)
+	res.addFile("a", 30, 1002, 50)
+	res.addFile("b", 40, 1003, 50) // unknown user keeps the file's gid
+
+	if gs := res.GroupStats["100"]; gs == nil || gs.Size != 30 || gs.Files != 2 || gs.Name != "staff" {
+		t.Fatalf("unexpected primary group of alice: %+v", gs)
+	}
+	if gs := res.GroupStats["200"]; gs == nil || gs.Size != 30 || gs.Files != 1 {
+		t.Fatalf("unexpected primary group of bob: %+v", gs)
+	}
+	if gs := res.GroupStats["50"]; gs == nil || gs.Size != 40 || gs.Files != 1 {
+		t.Fatalf("unexpected file group of unknown user: %+v", gs)
+	}
+	if lookups != 3 {
+		t.Fatalf("expected one lookup per uid, got %d", lookups)
+	}
+}
+
+func TestStreamSummaryEmitsScannedIDs(t *testing.T) {
+	// names that do not resolve must not be looked up again by their key,
+	// which could match a different account named like the id
+	stubOwnerNames(t, map[uint32]string{}, map[uint32]string{})
+
+	res := newTestResult()
+	res.addFile(".", 10, 1001, 2002)
+	res.addFile("a", 20, 1001, 2002)
+
+	before := lookupStats().Calls
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+	if calls := lookupStats().Calls - before; calls != 0 {
+		t.Fatalf("expected no lookups while exporting, got %d", calls)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(jo.Users) != 1 || jo.Users[0].UID != 1001 || jo.Users[0].Name != "1001" || jo.Users[0].Size != 30 {
+		t.Fatalf("unexpected users: %+v", jo.Users)
+	}
+	if len(jo.Grps) != 1 || jo.Grps[0].GID != 2002 || jo.Grps[0].Name != "2002" {
+		t.Fatalf("unexpected groups: %+v", jo.Grps)
+	}
+}
+
+func TestUnknownOwnerPolicies(t *testing.T) {
+	// like the real lookups, unresolved ids come back as the bare id
+	stubOwnerNames(t, map[uint32]string{1000: "alice", 4242: "4242", 4343: "4343"}, map[uint32]string{100: "staff", 4242: "4242"})
+
+	for _, tc := range []struct {
+		policy         string
+		users          map[string]string // key -> name
+		group, dirUser string
+	}{
+		{unknownOwnerNumeric, map[string]string{"1000": "alice", "4242": "4242", "4343": "4343"}, "4242", ""},
+		{unknownOwnerPrefixed, map[string]string{"1000": "alice", "4242": "uid:4242", "4343": "uid:4343"}, "gid:4242", "uid:4242"},
+		{unknownOwnerBucket, map[string]string{"1000": "alice", unknownKey: unknownKey}, unknownKey, unknownKey},
+	} {
+		res := newResult("/r", ScanOptions{UnknownOwner: tc.policy})
+		res.addFile(".", 1, 1000, 100)
+		res.addFile(".", 10, 4242, 4242)
+		res.addFile(".", 100, 4343, 4242)
+		res.addFile(".", 1000, 4242, 4242)
+
+		got := map[string]string{}
+		for k, us := range res.UserStats {
+			got[k] = us.Name
+		}
+		if !reflect.DeepEqual(got, tc.users) {
+			t.Errorf("%s: users = %v, want %v", tc.policy, got, tc.users)
+		}
+		if us := res.UserStats[unknownKey]; tc.policy == unknownOwnerBucket && (us == nil || us.Size != 1110 || us.Files != 3) {
+			t.Errorf("%s: bucket = %+v, want 1110 bytes in 3 files", tc.policy, us)
+		}
+		gkey := "4242"
+		if tc.policy == unknownOwnerBucket {
+			gkey = unknownKey
+		}
+		if gs := res.GroupStats[gkey]; gs == nil || gs.Name != tc.group || gs.Size != 1110 {
+			t.Errorf("%s: group = %+v, want %q with 1110 bytes", tc.policy, gs, tc.group)
+		}
+
+		// a directory owned by the unresolved uid (which the real lookup
+		// does not know either) is named in JSON the same way
+		res.DirStats["."].UID, res.DirStats["."].GID, res.DirStats["."].HasOwner = 4242, 4242, true
+		var buf bytes.Buffer
+		if err := StreamSummary(&buf, res, SummaryOptions{UnknownOwner: tc.policy}); err != nil {
+			t.Fatalf("StreamSummary: %v", err)
+		}
+		var jo JsonOut
+		if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if len(jo.Dirs) != 1 || jo.Dirs[0].User != tc.dirUser {
+			t.Errorf("%s: json dirs = %+v, want user %q", tc.policy, jo.Dirs, tc.dirUser)
+		}
+	}
+
+	if err := checkUnknownOwner("drop"); err == nil {
+		t.Error("checkUnknownOwner should reject an unknown policy")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// listEntry is one "<size> <path>" line of a -from-list file.
+type listEntry struct {
+	size int64
+	path string
+}
+
+// ParsePathList builds a result from a list of sized paths, one
+// "<size><delim><path>" line each, as written by e.g.
+// find -printf '%s\t%p\n'. Each line counts as a file of its size in the
+// directory holding it and in all that directory's ancestors; the root is the
+// deepest directory all of them share. With an empty delim the size ends at
+// the first blank and the path is the rest of the line after the blanks, so
+// it may contain spaces (but not start with one). Sizes are byte counts or
+// suffixed like 500M or 1.5G. Blank lines and lines starting with "#" are
+// ignored. strip > 0 drops that many leading components of every path (after
+// a leading "/"), leaving relative paths; lines with nothing left are skipped,
+// as -strip-components does.
+func ParsePathList(r io.Reader, delim string, strip int) (*Result, error) {
+	var entries []listEntry
+	var abs *bool // whether the paths are absolute, once known
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var sizeStr, path string
+		var ok bool
+		if delim == "" {
+			trimmed := strings.TrimLeftFunc(line, unicode.IsSpace)
+			if i := strings.IndexFunc(trimmed, unicode.IsSpace); i >= 0 {
+				sizeStr, path, ok = trimmed[:i], strings.TrimLeftFunc(trimmed[i:], unicode.IsSpace), true
+			}
+		} else {
+			sizeStr, path, ok = strings.Cut(line, delim)
+		}
+		if !ok || path == "" {
+			return nil, fmt.Errorf("line %d: want <size> <path>, got %q", n, line)
+		}
+		size, err := parseSize(sizeStr)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		path = filepath.Clean(path)
+		if isAbs := filepath.IsAbs(path); abs == nil {
+			abs = &isAbs
+		} else if isAbs != *abs {
+			return nil, fmt.Errorf("line %d: %q mixes relative and absolute paths", n, path)
+		}
+		if strip > 0 {
+			rel := stripComponents(strings.TrimLeft(filepath.ToSlash(path), "/"), strip)
+			if rel == "" {
+				continue
+			}
+			path = filepath.FromSlash(rel)
+		}
+		entries = append(entries, listEntry{size: size, path: path})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no paths in the list")
+	}
+
+	root := filepath.Dir(entries[0].path)
+	for _, e := range entries[1:] {
+		root = commonDir(root, filepath.Dir(e.path))
+	}
+	res := newResult(root, ScanOptions{})
+	res.DirStats["."] = &DirStat{}
+	for _, e := range entries {
+		rel, err := filepath.Rel(root, filepath.Dir(e.path))
+		if err != nil {
+			return nil, err
+		}
+		for p := rel; ; p = filepath.Dir(p) {
+			ds := res.DirStats[p]
+			if ds == nil {
+				ds = &DirStat{}
+				res.DirStats[p] = ds
+			}
+			ds.Size += e.size
+			ds.Files++
+			if p == "." {
+				break
+			}
+		}
+	}
+	res.FilesScanned = int64(len(entries))
+	res.DirsScanned = int64(len(res.DirStats))
+	res.EndedAt = res.StartedAt
+	return res, nil
+}
+
+// commonDir returns the deepest directory that both a and b, clean paths
+// that are both absolute or both relative, are or are below.
+func commonDir(a, b string) string {
+	for a != b {
+		if len(a) < len(b) {
+			a, b = b, a
+		}
+		if strings.HasPrefix(a, b+string(filepath.Separator)) || (b == string(filepath.Separator) && strings.HasPrefix(a, b)) {
+			return b
+		}
+		parent := filepath.Dir(a)
+		if parent == a {
+			return parent
+		}
+		a = parent
+	}
+	return a
+}
+
+// LoadPathList reads a -from-list file; "-" reads stdin.
+func LoadPathList(path, delim string, strip int) (*Result, error) {
+	if path == "-" {
+		return ParsePathList(os.Stdin, delim, strip)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	res, err := ParsePathList(f, delim, strip)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return res, nil
+}
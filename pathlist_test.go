@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParsePathList(t *testing.T) {
+	list := "# size path\n" +
+		"100 /data/a/x.txt\n" +
+		"1K   /data/a/b/my file.bin\n" +
+		"\n" +
+		"50\t/data/c/y\n"
+	res, err := ParsePathList(strings.NewReader(list), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Root != "/data" || res.FilesScanned != 3 {
+		t.Fatalf("root %q, %d files; want /data, 3", res.Root, res.FilesScanned)
+	}
+	want := map[string]DirStat{
+		".":   {Size: 1174, Files: 3},
+		"a":   {Size: 1124, Files: 2},
+		"a/b": {Size: 1024, Files: 1},
+		"c":   {Size: 50, Files: 1},
+	}
+	if len(res.DirStats) != len(want) {
+		t.Fatalf("dirs = %v, want %v", res.DirStats, want)
+	}
+	for rel, w := range want {
+		if ds := res.DirStats[rel]; ds == nil || *ds != w {
+			t.Errorf("dir %q = %+v, want %+v", rel, ds, w)
+		}
+	}
+
+	var out bytes.Buffer
+	printTree(&out, res, TreeOptions{Levels: 2, Format: FormatOptions{Bytes: true, ASCII: true}})
+	for _, line := range []string{"1174 /data", "1124     |-- a", "1024     |   `-- b", "  50     `-- c"} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("tree lacks %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestParsePathListDelimiter(t *testing.T) {
+	// a comma delimiter keeps a path with leading and inner blanks intact
+	res, err := ParsePathList(strings.NewReader("10,logs/ day 1/a\n20,logs/b\n"), ",", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Root != "logs" || res.DirStats["."].Size != 30 || res.DirStats[" day 1"].Size != 10 {
+		t.Fatalf("root %q, dirs %v", res.Root, res.DirStats)
+	}
+
+	for _, bad := range []string{"", "100\n", "x /a\n", "1 /a\n2 b\n"} {
+		if _, err := ParsePathList(strings.NewReader(bad), "", 0); err == nil {
+			t.Errorf("ParsePathList(%q) should fail", bad)
+		}
+	}
+}
+
+func TestCommonDir(t *testing.T) {
+	for _, tc := range []struct{ a, b, want string }{
+		{"/data/a", "/data/b", "/data"},
+		{"/data/a", "/data/a/b", "/data/a"},
+		{"/data", "/database", "/"},
+		{"/", "/x", "/"},
+		{"a/b", "c", "."},
+		{"a", "a", "a"},
+	} {
+		if got := commonDir(tc.a, tc.b); got != tc.want {
+			t.Errorf("commonDir(%q, %q) = %q, want %q", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestParsePathListStripComponents(t *testing.T) {
+	list := "100 /backup/2024/home/alice/a\n" +
+		"200 /backup/2024/home/bob/b\n" +
+		"50 /backup/2024/top\n" + // the root's own file: kept
+		"7 /backup/stray\n" // only 2 components: skipped
+	res, err := ParsePathList(strings.NewReader(list), "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Root != "." {
+		t.Fatalf("root = %q; want .", res.Root)
+	}
+	want := map[string]DirStat{
+		".":          {Size: 350, Files: 3},
+		"home":       {Size: 300, Files: 2},
+		"home/alice": {Size: 100, Files: 1},
+		"home/bob":   {Size: 200, Files: 1},
+	}
+	if len(res.DirStats) != len(want) {
+		t.Fatalf("dirs = %v; want %v", res.DirStats, want)
+	}
+	for rel, w := range want {
+		if ds := res.DirStats[rel]; ds == nil || *ds != w {
+			t.Fatalf("dir %q = %+v; want %+v", rel, ds, w)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package main
+
+import "golang.org/x/text/unicode/norm"
+
+// normalizePath returns s in Unicode normalization form C, so names written
+// decomposed (NFD, as macOS stores them) display and compare like their
+// precomposed Linux equivalents. It is used for display only; filesystem
+// access always uses the raw bytes.
+func normalizePath(s string) string {
+	return norm.NFC.String(s)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNormalizePathsNFDToNFC(t *testing.T) {
+	const nfd = "cafe\u0301" // "e" + combining acute accent, as macOS stores it
+	const nfc = "caf\u00e9"
+	if got := normalizePath("docs/" + nfd); got != "docs/"+nfc {
+		t.Fatalf("normalizePath = %q, want %q", got, "docs/"+nfc)
+	}
+
+	res := &Result{
+		Root:       "/data/" + nfd,
+		DirStats:   map[string]*DirStat{".": {Size: 10, Files: 1}, nfd: {Size: 10, Files: 1}},
+		UserStats:  map[string]*UserStat{},
+		GroupStats: map[string]*GroupStat{},
+		DirOwners:  map[string]string{},
+	}
+
+	var out bytes.Buffer
+	printTree(&out, res, TreeOptions{Levels: 1, NormalizePaths: true})
+	if !strings.Contains(out.String(), "└── "+nfc) || strings.Contains(out.String(), nfd) {
+		t.Fatalf("tree not normalized:\n%q", out.String())
+	}
+
+	out.Reset()
+	if err := StreamSummary(&out, res, SummaryOptions{NormalizePaths: true}); err != nil {
+		t.Fatal(err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(out.Bytes(), &jo); err != nil {
+		t.Fatal(err)
+	}
+	if jo.Root != "/data/"+nfc {
+		t.Fatalf("json root = %q", jo.Root)
+	}
+	for _, d := range jo.Dirs {
+		if d.Rel != "." && (d.Rel != nfc || d.Path != "/data/"+nfc+"/"+nfc) {
+			t.Fatalf("json dir not normalized: %+v", d)
+		}
+	}
+
+	// off by default
+	out.Reset()
+	printTree(&out, res, TreeOptions{Levels: 1})
+	if !strings.Contains(out.String(), nfd) {
+		t.Fatalf("raw name should be kept without the option:\n%q", out.String())
+	}
+}
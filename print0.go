@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"path/filepath"
+)
+
+// Print0Formatter writes bare full paths, each terminated by a NUL byte, so
+// results can be piped to xargs -0 and similar tools whatever characters the
+// names contain.
+type Print0Formatter struct {
+	Opts TreeOptions
+}
+
+func (f Print0Formatter) Write(w io.Writer, res *Result) error {
+	bw := bufio.NewWriter(w)
+	for _, p := range print0Paths(res, f.Opts) {
+		_, _ = bw.WriteString(p)
+		_ = bw.WriteByte(0)
+	}
+	return bw.Flush()
+}
+
+// print0Paths lists the paths -print0 writes: those of the -parents,
+// -newest-files and -oldest-files listings when any is requested, otherwise
+// the directories the tree shows, in its order. Paths are raw (never
+// normalized or escaped) so they can be passed back to the filesystem.
+func print0Paths(res *Result, opts TreeOptions) []string {
+	abs := func(rel string) string {
+		if rel == "." {
+			return res.Root
+		}
+		return filepath.Join(res.Root, rel)
+	}
+	var paths []string
+	listing := false
+	if opts.Parents > 0 {
+		listing = true
+		for _, rel := range largestLeaves(res.DirStats, opts.Parents) {
+			paths = append(paths, abs(rel))
+		}
+	}
+	for _, top := range []*TopFiles{res.Newest, res.Oldest} {
+		if top == nil {
+			continue
+		}
+		listing = true
+		for _, f := range top.Sorted() {
+			paths = append(paths, abs(f.Path))
+		}
+	}
+	if listing {
+		return paths
+	}
+
+	for _, rel := range treeRels(res, opts) {
+		paths = append(paths, abs(rel))
+	}
+	return paths
+}
+
+// treeRels returns the directories the tree shows, by rel path in its order:
+// down to opts.Levels, children in opts.Sort order and limited to
+// opts.TopChildren.
+func treeRels(res *Result, opts TreeOptions) []string {
+	children, dirSizes := buildChildrenAndSizes(res.DirStats)
+	sortChildren(children, dirSizes, opts.Sort)
+	var rels []string
+	var walk func(rel string, level int)
+	walk = func(rel string, level int) {
+		rels = append(rels, rel)
+		if level >= opts.Levels {
+			return
+		}
+		kids, _ := largestChildren(children[rel], opts.TopChildren, dirSizes, opts.Sort)
+		for _, k := range kids {
+			walk(k, level+1)
+		}
+	}
+	walk(".", 0)
+	return rels
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrint0Paths(t *testing.T) {
+	root := t.TempDir()
+	odd := "new\nline dir"
+	writeFile(t, filepath.Join(root, odd, "f"), 300)
+	writeFile(t, filepath.Join(root, "with space", "deep", "g"), 200)
+	writeFile(t, filepath.Join(root, "small", "h"), 10)
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, NewestFiles: 2})
+
+	split := func(opts TreeOptions) []string {
+		var out bytes.Buffer
+		if err := (Print0Formatter{Opts: opts}).Write(&out, res); err != nil {
+			t.Fatal(err)
+		}
+		s := out.String()
+		if !strings.HasSuffix(s, "\x00") {
+			t.Fatalf("output not NUL-terminated: %q", s)
+		}
+		return strings.Split(strings.TrimSuffix(s, "\x00"), "\x00")
+	}
+
+	// the newest-files listing takes precedence over the tree
+	got := split(TreeOptions{Levels: 1})
+	if len(got) != 2 {
+		t.Fatalf("newest files = %q", got)
+	}
+	files := map[string]bool{
+		filepath.Join(root, odd, "f"):                  true,
+		filepath.Join(root, "with space", "deep", "g"): true,
+		filepath.Join(root, "small", "h"):              true,
+	}
+	for _, p := range got {
+		if !files[p] {
+			t.Fatalf("unexpected path %q", p)
+		}
+	}
+
+	// without listings: the tree's directories, largest first, newline kept
+	res.Newest = nil
+	want := []string{root, filepath.Join(root, odd), filepath.Join(root, "with space"), filepath.Join(root, "small")}
+	if got := split(TreeOptions{Levels: 1}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("paths = %q, want %q", got, want)
+	}
+	want = []string{root, filepath.Join(root, odd), filepath.Join(root, "with space"), filepath.Join(root, "with space", "deep")}
+	if got := split(TreeOptions{Levels: 2, TopChildren: 2}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("paths with -top-children = %q, want %q", got, want)
+	}
+	want = []string{filepath.Join(root, odd), filepath.Join(root, "with space", "deep")}
+	if got := split(TreeOptions{Parents: 2}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("largest leaves = %q, want %q", got, want)
+	}
+
+	// registered as a -format
+	f, err := NewFormatter("print0", FormatConfig{Tree: TreeOptions{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	res.Newest = NewTopFiles(1, newestFirst)
+	res.Newest.Add(FileEntry{Path: odd + "/f", ModTime: time.Now()})
+	if err := f.Write(&out, res); err != nil || out.String() != filepath.Join(root, odd, "f")+"\x00" {
+		t.Fatalf("print0 formatter wrote %q, %v", out.String(), err)
+	}
+}
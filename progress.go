@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// progressInterval is how often -progress-bar redraws.
+	progressInterval = 200 * time.Millisecond
+	// progressDefaultWidth is the line width used when stderr is not a terminal.
+	progressDefaultWidth = 80
+	// the bar between the brackets is kept between these widths
+	minProgressBarWidth = 10
+	maxProgressBarWidth = 50
+)
+
+// progressTotal returns the number of files -progress-bar measures against:
+// the -max-files cap, or the files of a prior summary when that is smaller
+// or there is no cap; 0 when neither is known.
+func progressTotal(maxFiles, estimate int64) int64 {
+	if maxFiles > 0 && (estimate <= 0 || maxFiles < estimate) {
+		return maxFiles
+	}
+	return max(estimate, 0)
+}
+
+// renderProgress renders one -progress-bar line fitting width columns:
+// "[=====>    ] 42% (12345/29000 files)" when the total is known, just the
+// count "12345 files" when it is not (total <= 0). An estimated total the
+// scan outgrows shows as a full bar.
+func renderProgress(cur, total int64, width int) string {
+	if total <= 0 {
+		return fmt.Sprintf("%d files", cur)
+	}
+	done := min(cur, total)
+	suffix := fmt.Sprintf(" %d%% (%d/%d files)", done*100/total, cur, total)
+	barWidth := min(max(width-len(suffix)-2, minProgressBarWidth), maxProgressBarWidth)
+	filled := int(done * int64(barWidth) / total)
+	bar := strings.Repeat("=", filled)
+	if filled < barWidth {
+		bar += ">" + strings.Repeat(" ", barWidth-filled-1)
+	}
+	return "[" + bar + "]" + suffix
+}
+
+// progressBar redraws the -progress-bar line in place on w, a terminal.
+// update is called from the scan's progress ticker, finish once the scan
+// has returned, so the two never run at once.
+type progressBar struct {
+	w     io.Writer
+	total int64
+	width int
+	last  string
+}
+
+// update redraws the line for cur files, unless it would not change.
+func (p *progressBar) update(cur int64) {
+	line := renderProgress(cur, p.total, p.width)
+	if line == p.last {
+		return
+	}
+	// blank out the rest of a longer previous line
+	pad := max(len(p.last)-len(line), 0)
+	_, _ = fmt.Fprintf(p.w, "\r%s%s", line, strings.Repeat(" ", pad))
+	p.last = line
+}
+
+// finish draws the final count and ends the line.
+func (p *progressBar) finish(cur int64) {
+	p.update(cur)
+	_, _ = fmt.Fprintln(p.w)
+}
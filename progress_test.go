@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRenderProgress(t *testing.T) {
+	cases := []struct {
+		name       string
+		cur, total int64
+		width      int
+		want       string
+	}{
+		{"partial", 12180, 29000, 36, "[====>     ] 42% (12180/29000 files)"},
+		{"start", 0, 200, 80, "[>" + spaces(49) + "] 0% (0/200 files)"},
+		{"done", 200, 200, 30, "[==========] 100% (200/200 files)"},
+		{"past the estimate", 250, 200, 30, "[==========] 100% (250/200 files)"},
+		{"wide terminal", 50, 100, 200, "[=========================>" + spaces(24) + "] 50% (50/100 files)"},
+		{"no total", 12345, 0, 80, "12345 files"},
+	}
+	for _, c := range cases {
+		if got := renderProgress(c.cur, c.total, c.width); got != c.want {
+			t.Errorf("%s: renderProgress(%d, %d, %d) = %q; want %q", c.name, c.cur, c.total, c.width, got, c.want)
+		}
+	}
+}
+
+func spaces(n int) string {
+	return string(bytes.Repeat([]byte{' '}, n))
+}
+
+func TestProgressTotal(t *testing.T) {
+	for _, c := range []struct{ maxFiles, estimate, want int64 }{
+		{0, 0, 0},
+		{1000, 0, 1000},
+		{0, 5000, 5000},
+		{1000, 5000, 1000},
+		{9000, 5000, 5000},
+	} {
+		if got := progressTotal(c.maxFiles, c.estimate); got != c.want {
+			t.Errorf("progressTotal(%d, %d) = %d; want %d", c.maxFiles, c.estimate, got, c.want)
+		}
+	}
+}
+
+func TestProgressBarRedrawsInPlace(t *testing.T) {
+	var buf bytes.Buffer
+	p := &progressBar{w: &buf, width: 80}
+	p.update(1000)
+	p.update(1000) // unchanged, not redrawn
+	p.update(5)
+	p.finish(7)
+	if want := "\r1000 files\r5 files   \r7 files\n"; buf.String() != want {
+		t.Fatalf("output = %q; want %q", buf.String(), want)
+	}
+}
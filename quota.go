@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Exit codes of -quota: a user or group quota was exceeded, or only quotas
+// of users within groups were.
+const (
+	exitQuota          = 4
+	exitUserGroupQuota = 5
+)
+
+// userGroupKey identifies the files of one user within one group by their
+// UserStats and GroupStats keys.
+type userGroupKey struct {
+	User, Group string
+}
+
+// UserGroupStat aggregates the files of one user within one group.
+type UserGroupStat struct {
+	Size  int64
+	Files int64
+}
+
+// Quota is one limit of a -quota file: on the bytes of a user, of a group,
+// or of a user within one group (both set). Names may be numeric ids.
+type Quota struct {
+	User, Group string
+	Limit       int64
+}
+
+// userGroup reports whether q limits a user within a group.
+func (q Quota) userGroup() bool {
+	return q.User != "" && q.Group != ""
+}
+
+func (q Quota) String() string {
+	switch {
+	case q.userGroup():
+		return "user " + q.User + " in group " + q.Group
+	case q.User != "":
+		return "user " + q.User
+	}
+	return "group " + q.Group
+}
+
+// ParseQuotas reads a -quota file. Each line sets one limit (a size like 100G
+// or a byte count):
+//
+//	user alice 100G
+//	group staff 1T
+//	user alice group proj 50G
+//
+// Blank lines and lines starting with '#' are ignored.
+func ParseQuotas(r io.Reader) ([]Quota, error) {
+	var quotas []Quota
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		var q Quota
+		switch {
+		case len(f) == 3 && f[0] == "user":
+			q.User = f[1]
+		case len(f) == 3 && f[0] == "group":
+			q.Group = f[1]
+		case len(f) == 5 && f[0] == "user" && f[2] == "group":
+			q.User, q.Group = f[1], f[3]
+		default:
+			return nil, fmt.Errorf("quota line %d: want \"user NAME LIMIT\", \"group NAME LIMIT\" or \"user NAME group NAME LIMIT\", got %q", n, line)
+		}
+		limit, err := parseSize(f[len(f)-1])
+		if err != nil {
+			return nil, fmt.Errorf("quota line %d: %v", n, err)
+		}
+		q.Limit = limit
+		quotas = append(quotas, q)
+	}
+	return quotas, sc.Err()
+}
+
+// LoadQuotas reads the -quota file at path.
+func LoadQuotas(path string) ([]Quota, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return ParseQuotas(f)
+}
+
+// hasUserGroupQuota reports whether any of quotas limits a user within a
+// group, which needs the user-in-group totals built during the walk.
+func hasUserGroupQuota(quotas []Quota) bool {
+	for _, q := range quotas {
+		if q.userGroup() {
+			return true
+		}
+	}
+	return false
+}
+
+// quotaViolation is an exceeded quota and the bytes used against it.
+type quotaViolation struct {
+	Quota
+	Used int64
+}
+
+// checkQuotas returns the quotas res exceeds, in the order given. A name
+// matches a user or group by its name or numeric id; entries sharing a name
+// are summed. User-in-group quotas need res.UserGroups (ScanOptions.UserGroupTotals).
+// A quota matching no entry is an error when res has an othersKey entry it
+// may have been folded into.
+func checkQuotas(res *Result, quotas []Quota) ([]quotaViolation, error) {
+	userIs := func(key, name string) bool {
+		us := res.UserStats[key]
+		return key == name || us != nil && us.Name == name
+	}
+	groupIs := func(key, name string) bool {
+		gs := res.GroupStats[key]
+		return key == name || gs != nil && gs.Name == name
+	}
+	_, userOthers := res.UserStats[othersKey]
+	_, groupOthers := res.GroupStats[othersKey]
+	var out []quotaViolation
+	for _, q := range quotas {
+		var used int64
+		// folded is set when the quota matched nothing while ids past
+		// -max-users/-max-groups were summed into (others): its usage may be
+		// in there, so passing it would be a guess
+		matched, folded := false, false
+		switch {
+		case q.userGroup():
+			if res.UserGroups == nil {
+				return nil, fmt.Errorf("%s: the totals of users within groups are only built by a scan", q)
+			}
+			for k, ug := range res.UserGroups {
+				if userIs(k.User, q.User) && groupIs(k.Group, q.Group) {
+					used += ug.Size
+					matched = true
+				}
+			}
+			folded = userOthers || groupOthers
+		case q.User != "":
+			for k, us := range res.UserStats {
+				if userIs(k, q.User) {
+					used += us.Size
+					matched = true
+				}
+			}
+			folded = userOthers
+		default:
+			for k, gs := range res.GroupStats {
+				if groupIs(k, q.Group) {
+					used += gs.Size
+					matched = true
+				}
+			}
+			folded = groupOthers
+		}
+		if !matched && folded {
+			return nil, fmt.Errorf("%s: not found, and owners past -max-users/-max-groups were summed into %s; its usage is unknown", q, othersKey)
+		}
+		if used > q.Limit {
+			out = append(out, quotaViolation{Quota: q, Used: used})
+		}
+	}
+	return out, nil
+}
+
+// quotaExit returns the exit code the violations call for: exitQuota when a
+// user or group quota is exceeded, exitUserGroupQuota when only quotas of
+// users within groups are, 0 for none.
+func quotaExit(violations []quotaViolation) int {
+	code := 0
+	for _, v := range violations {
+		if !v.userGroup() {
+			return exitQuota
+		}
+		code = exitUserGroupQuota
+	}
+	return code
+}
+
+// printQuotaReport writes the exceeded quotas, the user and group ones apart
+// from those of users within groups.
+func printQuotaReport(w io.Writer, violations []quotaViolation, fo FormatOptions) {
+	for _, section := range []struct {
+		title     string
+		userGroup bool
+	}{{"Quotas exceeded:", false}, {"Quotas of users within groups exceeded:", true}} {
+		header := false
+		for _, v := range violations {
+			if v.userGroup() != section.userGroup {
+				continue
+			}
+			if !header {
+				_, _ = fmt.Fprintln(w, section.title)
+				header = true
+			}
+			_, _ = fmt.Fprintf(w, "  %s: %s of %s\n", v.Quota, fo.size(v.Used), fo.size(v.Limit))
+		}
+	}
+}
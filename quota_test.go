@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseQuotas(t *testing.T) {
+	qs, err := ParseQuotas(strings.NewReader("# limits\nuser alice 100G\n\ngroup 2001 1T\nuser alice group proj 512\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Quota{{User: "alice", Limit: 100 << 30}, {Group: "2001", Limit: 1 << 40}, {User: "alice", Group: "proj", Limit: 512}}
+	if len(qs) != len(want) {
+		t.Fatalf("quotas = %+v; want %+v", qs, want)
+	}
+	for i := range want {
+		if qs[i] != want[i] {
+			t.Fatalf("quota %d = %+v; want %+v", i, qs[i], want[i])
+		}
+	}
+	if !hasUserGroupQuota(qs) || hasUserGroupQuota(qs[:2]) {
+		t.Fatalf("hasUserGroupQuota wrong for %+v", qs)
+	}
+
+	for _, bad := range []string{"user alice\n", "owner alice 1G\n", "user alice group 1G\n", "group staff lots\n"} {
+		if _, err := ParseQuotas(strings.NewReader(bad)); err == nil || !strings.Contains(err.Error(), "quota line 1") {
+			t.Errorf("ParseQuotas(%q) err = %v; want a line 1 error", bad, err)
+		}
+	}
+}
+
+func TestUserGroupQuotaExceededWithinTotal(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("needs root to chown")
+	}
+	stubOwnerNames(t, map[uint32]string{1001: "alice"}, map[uint32]string{2001: "proj", 2002: "staff"})
+	root := t.TempDir()
+	for _, f := range []struct {
+		name string
+		size int
+		gid  int
+	}{{"proj/a", 300, 2001}, {"home/b", 700, 2002}} {
+		p := filepath.Join(root, f.name)
+		writeFile(t, p, f.size)
+		if err := os.Chown(p, 1001, f.gid); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	quotas := []Quota{
+		{User: "alice", Limit: 2000},                // 1000 in total: within
+		{User: "alice", Group: "proj", Limit: 200},  // 300 in proj: exceeded
+		{User: "1001", Group: "staff", Limit: 1000}, // 700 in staff: within
+		{Group: "staff", Limit: 1024},               // within
+	}
+	for _, dirsOnly := range []bool{false, true} {
+		res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, DirsOnly: dirsOnly, UserGroupTotals: true})
+		v, err := checkQuotas(res, quotas)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(v) != 1 || v[0].Quota != quotas[1] || v[0].Used != 300 {
+			t.Fatalf("dirsOnly=%v: violations = %+v; want alice in proj at 300 bytes", dirsOnly, v)
+		}
+		if code := quotaExit(v); code != exitUserGroupQuota {
+			t.Fatalf("exit code = %d; want %d", code, exitUserGroupQuota)
+		}
+	}
+
+	// a plain quota exceeded as well takes the plain exit code, reported apart
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, UserGroupTotals: true})
+	v, _ := checkQuotas(res, append(quotas, Quota{User: "alice", Limit: 900}))
+	if code := quotaExit(v); code != exitQuota {
+		t.Fatalf("exit code = %d; want %d", code, exitQuota)
+	}
+	var out bytes.Buffer
+	printQuotaReport(&out, v, FormatOptions{Bytes: true})
+	want := "Quotas exceeded:\n  user alice: 1000 of 900\nQuotas of users within groups exceeded:\n  user alice in group proj: 300 of 200\n"
+	if out.String() != want {
+		t.Fatalf("report =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	// without the pair totals the user-in-group quotas cannot be checked
+	if _, err := checkQuotas(Scan(context.Background(), root, ScanOptions{Concurrency: 2}), quotas); err == nil {
+		t.Fatalf("user-in-group quota checked without UserGroupTotals")
+	}
+}
+
+func TestQuotaOnFoldedOwnerFails(t *testing.T) {
+	stubOwnerNames(t, map[uint32]string{1001: "alice", 1002: "bob"}, map[uint32]string{2001: "proj"})
+	res := newResult("/r", ScanOptions{MaxUsers: 1, UserGroupTotals: true})
+	res.addFile(".", 100, 1001, 2001)
+	res.addFile(".", 5000, 1002, 2001) // bob is past the cap: counted in (others)
+	if res.UserStats[othersKey] == nil {
+		t.Fatalf("bob not folded into %s: %v", othersKey, res.UserStats)
+	}
+
+	for _, q := range []Quota{
+		{User: "bob", Limit: 1000},
+		{User: "bob", Group: "proj", Limit: 1000},
+	} {
+		if _, err := checkQuotas(res, []Quota{q}); err == nil || !strings.Contains(err.Error(), othersKey) {
+			t.Fatalf("%s: err = %v; want the quota reported as folded into %s", q, err, othersKey)
+		}
+	}
+
+	// owners tracked on their own are still checked
+	v, err := checkQuotas(res, []Quota{{User: "alice", Limit: 50}, {Group: "proj", Limit: 10000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 1 || v[0].User != "alice" || v[0].Used != 100 {
+		t.Fatalf("violations = %+v; want alice at 100 bytes", v)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// RecomputeSummary rebuilds the derived parts of a loaded summary from its
+// dirs array, ignoring the stored users and groups:
+//   - a directory's own bytes and files are what its stored totals exceed the
+//     sums of its subdirectories' by (never negative), and every total is
+//     re-summed from those, so parents cover their children again; missing
+//     intermediate directories are recreated
+//   - per-user totals come from the root's "owners" breakdown when present,
+//     otherwise each directory's own bytes count for the directory's owner
+//   - per-group totals count each directory's own bytes for its group
+//   - stats.files_scanned is set to the root's file count
+//
+// Owner data is per directory, not per file, so without a breakdown the
+// user and group totals are an approximation.
+func RecomputeSummary(jo JsonOut) JsonOut {
+	dirs := make(map[string]*JsonDir, len(jo.Dirs))
+	for _, d := range jo.Dirs {
+		rel := d.Rel
+		if rel == "" {
+			rel = "."
+		}
+		if _, dup := dirs[rel]; dup {
+			continue
+		}
+		nd := d
+		nd.Rel = rel
+		dirs[rel] = &nd
+	}
+	if _, ok := dirs["."]; !ok {
+		dirs["."] = &JsonDir{Path: jo.Root, Rel: "."}
+	}
+	for rel := range dirs {
+		for p := rel; p != "."; {
+			p = filepath.Dir(p)
+			if _, ok := dirs[p]; ok {
+				break
+			}
+			dirs[p] = &JsonDir{Path: filepath.Join(jo.Root, p), Rel: p}
+		}
+	}
+
+	// own totals: stored totals minus the direct children's
+	ownSize := make(map[string]int64, len(dirs))
+	ownFiles := make(map[string]int64, len(dirs))
+	ownShares := make(map[string]map[string]JsonOwnerShare, len(dirs))
+	for rel, d := range dirs {
+		ownSize[rel] += d.Size
+		ownFiles[rel] += d.Files
+		ownShares[rel] = addOwnerShares(ownShares[rel], d.Owners)
+		if rel == "." {
+			continue
+		}
+		parent := filepath.Dir(rel)
+		ownSize[parent] -= d.Size
+		ownFiles[parent] -= d.Files
+		for name, sh := range d.Owners {
+			cur := ownShares[parent][name]
+			cur.Size -= sh.Size
+			cur.Files -= sh.Files
+			cur.UID = sh.UID
+			if ownShares[parent] == nil {
+				ownShares[parent] = make(map[string]JsonOwnerShare)
+			}
+			ownShares[parent][name] = cur
+		}
+	}
+
+	// re-sum every directory's subtree from the own totals
+	hasOwners := len(dirs["."].Owners) > 0
+	for _, d := range dirs {
+		d.Size, d.Files = 0, 0
+		if d.Owners != nil {
+			d.Owners = make(map[string]JsonOwnerShare, len(d.Owners))
+		}
+	}
+	users := make(map[string]*JsonUser)
+	groups := make(map[string]*JsonGroup)
+	for rel, d := range dirs {
+		size, files := max(ownSize[rel], 0), max(ownFiles[rel], 0)
+		for p := rel; ; p = filepath.Dir(p) {
+			a := dirs[p]
+			a.Size += size
+			a.Files += files
+			for name, sh := range ownShares[rel] {
+				if sh.Size <= 0 && sh.Files <= 0 {
+					continue
+				}
+				if a.Owners == nil {
+					a.Owners = make(map[string]JsonOwnerShare)
+				}
+				cur := a.Owners[name]
+				cur.Size += max(sh.Size, 0)
+				cur.Files += max(sh.Files, 0)
+				cur.UID = sh.UID
+				a.Owners[name] = cur
+			}
+			if p == "." {
+				break
+			}
+		}
+		if size == 0 && files == 0 {
+			continue
+		}
+		if !hasOwners {
+			name := ownerOr(d.User, d.UID)
+			u := users[summaryOwnerKey(name, d.UID)]
+			if u == nil {
+				u = &JsonUser{Name: name, UID: d.UID}
+				users[summaryOwnerKey(name, d.UID)] = u
+			}
+			u.Size += size
+			u.Files += files
+		}
+		name := ownerOr(d.Group, d.GID)
+		g := groups[summaryOwnerKey(name, d.GID)]
+		if g == nil {
+			g = &JsonGroup{Name: name, GID: d.GID}
+			groups[summaryOwnerKey(name, d.GID)] = g
+		}
+		g.Size += size
+		g.Files += files
+	}
+	if hasOwners {
+		for name, sh := range dirs["."].Owners {
+			users[summaryOwnerKey(name, sh.UID)] = &JsonUser{Name: name, Size: sh.Size, Files: sh.Files, UID: sh.UID}
+		}
+	}
+
+	out := jo
+	out.Dirs = make([]JsonDir, 0, len(dirs))
+	for _, d := range dirs {
+		out.Dirs = append(out.Dirs, *d)
+	}
+	out.Users = make([]JsonUser, 0, len(users))
+	for _, u := range users {
+		out.Users = append(out.Users, *u)
+	}
+	out.Grps = make([]JsonGroup, 0, len(groups))
+	for _, g := range groups {
+		out.Grps = append(out.Grps, *g)
+	}
+	sort.Slice(out.Dirs, func(i, j int) bool { return out.Dirs[i].Rel < out.Dirs[j].Rel })
+	sort.Slice(out.Users, func(i, j int) bool {
+		if out.Users[i].Name == out.Users[j].Name {
+			return out.Users[i].UID < out.Users[j].UID
+		}
+		return out.Users[i].Name < out.Users[j].Name
+	})
+	sort.Slice(out.Grps, func(i, j int) bool {
+		if out.Grps[i].Name == out.Grps[j].Name {
+			return out.Grps[i].GID < out.Grps[j].GID
+		}
+		return out.Grps[i].Name < out.Grps[j].Name
+	})
+	out.Stats.FilesScanned = dirs["."].Files
+	return out
+}
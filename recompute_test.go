@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRecomputeSummaryFixesTotals(t *testing.T) {
+	jo := JsonOut{
+		Root: "/data",
+		Stats: JsonStats{
+			FilesScanned: 99,
+		},
+		Dirs: []JsonDir{
+			// the root's totals were not updated after a/b was edited
+			{Path: "/data", Rel: ".", Size: 100, Files: 2, UID: 1001, User: "alice", GID: 100, Group: "staff"},
+			{Path: "/data/a", Rel: "a", Size: 60, Files: 1, UID: 1002, User: "bob", GID: 100, Group: "staff"},
+			{Path: "/data/a/b", Rel: "a/b", Size: 500, Files: 5, UID: 1002, User: "bob", GID: 200, Group: "dev"},
+			// parent "c" is missing
+			{Path: "/data/c/d", Rel: "c/d", Size: 40, Files: 1, UID: 1001, User: "alice", GID: 100, Group: "staff"},
+		},
+		Users: []JsonUser{{Name: "alice", Size: 1, Files: 1, UID: 1001}},
+		Grps:  []JsonGroup{{Name: "staff", Size: 1, Files: 1, GID: 100}},
+	}
+	if len(VerifySummary(jo)) == 0 {
+		t.Fatal("fixture should be inconsistent")
+	}
+
+	out := RecomputeSummary(jo)
+	if v := VerifySummary(out); len(v) != 0 {
+		t.Fatalf("recomputed summary has violations: %v", v)
+	}
+	sizes := map[string][2]int64{}
+	for _, d := range out.Dirs {
+		sizes[d.Rel] = [2]int64{d.Size, d.Files}
+	}
+	want := map[string][2]int64{
+		// own: "." 100-60-0=40 (files 2-1=1), "a" 0 (60<500), "a/b" 500, "c" 0, "c/d" 40
+		".":   {580, 7},
+		"a":   {500, 5},
+		"a/b": {500, 5},
+		"c":   {40, 1},
+		"c/d": {40, 1},
+	}
+	if !reflect.DeepEqual(sizes, want) {
+		t.Fatalf("dir totals = %v, want %v", sizes, want)
+	}
+	wantUsers := []JsonUser{{Name: "alice", Size: 80, Files: 2, UID: 1001}, {Name: "bob", Size: 500, Files: 5, UID: 1002}}
+	if !reflect.DeepEqual(out.Users, wantUsers) {
+		t.Fatalf("users = %+v, want %+v", out.Users, wantUsers)
+	}
+	wantGroups := []JsonGroup{{Name: "dev", Size: 500, Files: 5, GID: 200}, {Name: "staff", Size: 80, Files: 2, GID: 100}}
+	if !reflect.DeepEqual(out.Grps, wantGroups) {
+		t.Fatalf("groups = %+v, want %+v", out.Grps, wantGroups)
+	}
+	if out.Stats.FilesScanned != 7 {
+		t.Fatalf("files_scanned = %d, want 7", out.Stats.FilesScanned)
+	}
+}
+
+func TestRecomputeSummaryUsesOwnerBreakdown(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "f"), 300)
+	writeFile(t, filepath.Join(root, "a", "b", "g"), 200)
+	writeFile(t, filepath.Join(root, "h"), 50)
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 1, DirOwners: true})
+	orig := summaryFor(res, SummaryOptions{OwnerBreakdown: true})
+
+	stale := orig
+	stale.Users = []JsonUser{{Name: "nobody", Size: 1, Files: 1, UID: 65534}}
+	stale.Grps = nil
+	out := RecomputeSummary(stale)
+	if !reflect.DeepEqual(out.Users, orig.Users) {
+		t.Fatalf("users = %+v, want %+v", out.Users, orig.Users)
+	}
+	if !reflect.DeepEqual(out.Dirs, orig.Dirs) {
+		t.Fatalf("consistent dirs should be unchanged:\n%+v\nwant\n%+v", out.Dirs, orig.Dirs)
+	}
+	if v := VerifySummary(out); len(v) != 0 {
+		t.Fatalf("violations: %v", v)
+	}
+}
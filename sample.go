@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"sort"
+	"strings"
+)
+
+// Reservoir keeps a uniform random sample of at most n strings out of an
+// arbitrarily long stream (Algorithm R), so memory stays bounded by n no
+// matter how many items are offered. It is not safe for concurrent use.
+type Reservoir struct {
+	n     int
+	seen  int64
+	items []string
+	rng   *rand.Rand
+}
+
+// NewReservoir returns a reservoir of capacity n drawing from rng.
+func NewReservoir(n int, rng *rand.Rand) *Reservoir {
+	return &Reservoir{n: n, items: make([]string, 0, n), rng: rng}
+}
+
+// Add offers s to the sample.
+func (r *Reservoir) Add(s string) {
+	r.seen++
+	if len(r.items) < r.n {
+		r.items = append(r.items, s)
+		return
+	}
+	if j := r.rng.Int64N(r.seen); j < int64(r.n) {
+		r.items[j] = s
+	}
+}
+
+// Items returns the current sample (at most n items).
+func (r *Reservoir) Items() []string { return r.items }
+
+// Seen returns how many items have been offered in total.
+func (r *Reservoir) Seen() int64 { return r.seen }
+
+// newSampleRNG returns the generator used for -samples; seed 0 picks a random seed.
+func newSampleRNG(seed uint64) *rand.Rand {
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	return rand.New(rand.NewPCG(seed, seed))
+}
+
+// topLevelKey returns the first component of a file's rel path, or "." for
+// files directly in the root.
+func topLevelKey(relFile string) string {
+	i := strings.IndexByte(relFile, '/')
+	if i < 0 {
+		return "."
+	}
+	return relFile[:i]
+}
+
+// printSamples writes the sampled file paths grouped by top-level directory.
+func printSamples(w io.Writer, samples map[string]*Reservoir, fo FormatOptions) {
+	keys := make([]string, 0, len(samples))
+	for k := range samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, "Sample files per top-level directory:")
+	for _, k := range keys {
+		r := samples[k]
+		items := append([]string(nil), r.Items()...)
+		sort.Strings(items)
+		_, _ = fmt.Fprintf(w, "%s (%d of %d files)\n", fo.path(k), len(items), r.Seen())
+		for _, p := range items {
+			_, _ = fmt.Fprintf(w, "    %s\n", fo.path(p))
+		}
+	}
+}
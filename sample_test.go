@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReservoirDeterministicAndSized(t *testing.T) {
+	fill := func(seed uint64) *Reservoir {
+		r := NewReservoir(5, newSampleRNG(seed))
+		for i := 0; i < 1000; i++ {
+			r.Add("f" + strconv.Itoa(i))
+		}
+		return r
+	}
+	a, b := fill(42), fill(42)
+	if len(a.Items()) != 5 {
+		t.Fatalf("expected 5 samples, got %d", len(a.Items()))
+	}
+	if a.Seen() != 1000 {
+		t.Fatalf("expected 1000 seen, got %d", a.Seen())
+	}
+	if !reflect.DeepEqual(a.Items(), b.Items()) {
+		t.Fatalf("same seed produced different samples: %v vs %v", a.Items(), b.Items())
+	}
+	if c := fill(7); reflect.DeepEqual(a.Items(), c.Items()) {
+		t.Fatalf("different seeds unexpectedly produced identical samples: %v", a.Items())
+	}
+}
+
+func TestReservoirFewerItemsThanCapacity(t *testing.T) {
+	r := NewReservoir(10, newSampleRNG(1))
+	r.Add("a")
+	r.Add("b")
+	if !reflect.DeepEqual(r.Items(), []string{"a", "b"}) {
+		t.Fatalf("expected all items kept, got %v", r.Items())
+	}
+}
+
+func TestScanSamples(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 20; i++ {
+		writeFile(t, filepath.Join(root, "big", strconv.Itoa(i)), 1)
+	}
+	writeFile(t, filepath.Join(root, "top.txt"), 1)
+
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 1, Samples: 3, Seed: 9})
+	if got := len(res.Samples["big"].Items()); got != 3 {
+		t.Fatalf("expected 3 samples for big, got %d", got)
+	}
+	if got := res.Samples["."].Items(); !reflect.DeepEqual(got, []string{"top.txt"}) {
+		t.Fatalf("unexpected root samples: %v", got)
+	}
+
+	var buf bytes.Buffer
+	printSamples(&buf, res.Samples, FormatOptions{})
+	if !strings.Contains(buf.String(), "big (3 of 20 files)") {
+		t.Fatalf("unexpected sample output:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,1073 @@
+package main
+
+import (
+	"context"
+	"hash"
+	"io/fs"
+	"log"
+	"math/rand/v2"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ScanOptions controls how Scan walks and aggregates a directory tree.
+type ScanOptions struct {
+	Concurrency int
+	// MaxFiles stops the walk after this many files have been enqueued (0 = unlimited).
+	MaxFiles int64
+	// WalkOrder selects the traversal strategy: "lexical" (default) or "size".
+	// The size order only takes effect when the scan can be truncated.
+	WalkOrder string
+	// SnapshotInterval, when > 0, makes Scan call OnSnapshot with a copy of the
+	// partial result as soon as the scan starts and then on every tick.
+	SnapshotInterval time.Duration
+	OnSnapshot       func(*Result)
+	// ProgressInterval, when > 0, makes Scan call OnProgress with the number
+	// of files counted so far on every tick (-progress-bar). It only reads
+	// the file counter, so it is cheap enough to tick often.
+	ProgressInterval time.Duration
+	OnProgress       func(files int64)
+	// Samples, when > 0, keeps a reservoir sample of that many file paths per
+	// top-level directory, drawn with a generator seeded from Seed (0 = random).
+	Samples int
+	Seed    uint64
+	// MaxUsers/MaxGroups cap how many distinct users/groups are tracked; files
+	// of any further ids are aggregated into an "(others)" entry (0 = no cap).
+	MaxUsers  int
+	MaxGroups int
+	// GroupByPrimary attributes every file to its owner's primary group
+	// instead of the file's own group (-group-by-primary).
+	GroupByPrimary bool
+	// ParallelLookup leaves the user and group names out while the files
+	// are aggregated and resolves the distinct ids side by side once the
+	// scan is done (-parallel-lookup), instead of one at a time, each on
+	// first sight, under the lock every worker waits for. Snapshots taken
+	// during the scan show numeric ids.
+	ParallelLookup bool
+	// UnknownOwner names the owners whose id does not resolve
+	// (-unknown-owner): numeric ("" too) by the id, prefixed as "uid:1001"
+	// or "gid:1001", bucket all together as "(unknown)". Bucket cannot be
+	// combined with ParallelLookup.
+	UnknownOwner string
+	// UserMap/GroupMap, when set, sum the files of aliased accounts under
+	// their canonical name (-user-map/-group-map).
+	UserMap  *OwnerMap
+	GroupMap *OwnerMap
+	// DirOwners builds the per-directory per-user aggregation (Result.DirUsers)
+	// needed by -dominant-owner and -json-owner-breakdown; it costs memory
+	// proportional to dirs x users.
+	DirOwners bool
+	// FileLists records every file's name and size per directory
+	// (Result.DirFiles, -json-files); it costs memory proportional to the
+	// number of files.
+	FileLists bool
+	// DirNewest records the newest file modification time per directory
+	// (Result.DirNewest) for -color-scheme age.
+	DirNewest bool
+	// UserGroupTotals builds Result.UserGroups, the totals of every user
+	// within every group (-quota with user:group keys).
+	UserGroupTotals bool
+	// HiddenReport splits the totals between hidden and visible files
+	// (Result.Hidden, -hidden-report).
+	HiddenReport bool
+	// DirCount counts every directory for its owner and group
+	// (UserStat.Dirs, GroupStat.Dirs; -dir-count).
+	DirCount bool
+	// NewestFiles/OldestFiles, when > 0, keep that many most recently modified /
+	// stalest files (Result.Newest/Oldest).
+	NewestFiles int
+	OldestFiles int
+	// Filter limits which files are counted; files it rejects are skipped
+	// before they are statted and do not count towards MaxFiles.
+	Filter PathFilter
+	// SkipRootFiles leaves the files directly in the root out of every
+	// total, like Filter does (-skip-root-files).
+	SkipRootFiles bool
+	// DedupDevs lists devices (st_dev) reachable through several mounts; files on
+	// them are counted once per (device, inode) (-dedup-binds).
+	DedupDevs map[uint64]bool
+	// BlockSize, when > 0, counts each file as its allocated size (st_blocks,
+	// or the apparent size where unavailable) rounded up to whole blocks of
+	// this many bytes, like du -B; 0 counts apparent sizes.
+	BlockSize int64
+	// SkipDirs holds absolute directory paths that are pruned from the walk
+	// (e.g. virtual mount points found by -skip-mounts).
+	SkipDirs map[string]bool
+	// DryRun only walks the tree: directories and the files passing Filter,
+	// SkipRootFiles, SkipDirs and MaxFiles are counted in DirsScanned and
+	// FilesScanned, but nothing is statted or aggregated (-dry-run). The
+	// filters needing a file's stat (sizes, times) are not applied.
+	DryRun bool
+	// Throttle caps how many files per second are statted across all workers (0 = unlimited).
+	Throttle float64
+	// FileMinSize/FileMaxSize, when > 0, leave files whose apparent size is
+	// below/above them out of every total (-file-min-size/-file-max-size).
+	FileMinSize int64
+	FileMaxSize int64
+	// ByDevice aggregates the files per device (st_dev) into Result.Devices.
+	ByDevice bool
+	// StatRetries is how many times a file's stat is retried after a transient
+	// error (EINTR, EAGAIN, ESTALE) before the file is skipped.
+	StatRetries int
+	// ChangedSince, when set, leaves files whose inode change time (ctime) is
+	// before it out of every total (-changed-since).
+	ChangedSince time.Time
+	// ModifiedBefore, when set, leaves files modified (mtime) after it out
+	// of every total (-older-than-file).
+	ModifiedBefore time.Time
+	// InlineBelow, when > 0, stats and aggregates the first this many files
+	// in the walking goroutine and starts the worker pool only for the
+	// files after them, so small trees never start it (-inline-below).
+	InlineBelow int
+	// ExpandArchives counts the entries of .tar, .tar.gz, .tgz and .zip
+	// files in place of the archives, below a directory named after the
+	// archive (-expand-archives). Not supported with DirsOnly or OnDirDone.
+	ExpandArchives bool
+	// SnapshotName labels the summaries of the scan (-snapshot-name).
+	SnapshotName string
+	// ExtByUser tallies the bytes and files of every extension per user
+	// (Result.ExtByUser, -ext-by-user).
+	ExtByUser bool
+	// DupesHash, when set, names the -hash algorithm used to find files with
+	// identical content after the walk (Result.Duplicates); "" = off.
+	DupesHash string
+	// ManifestHash, when set, names the -hash algorithm every counted file
+	// is hashed with by the workers for -manifest (Result.Manifest); "" = off.
+	ManifestHash string
+	// MaxMemory, when > 0, spills the per-directory aggregation to temporary
+	// files whenever the heap approaches this many bytes (-max-memory). If it
+	// did, only directories up to KeepDepth stay in Result.DirStats after the
+	// scan; the rest are read back from the spill when exporting JSON.
+	MaxMemory int64
+	KeepDepth int
+	// OnError, when set, is called with each path skipped because of an
+	// error (unreadable directory, failed stat), possibly from several
+	// goroutines at once (-show-errors).
+	OnError func(path string, err error)
+	// OnDirDone, when set, is called with each directory's totals (and its
+	// per-user split when DirOwners is set) as soon as the walk has left
+	// it and every file below it is aggregated, so children are reported
+	// before their parent and the root last (-json-stream-from-scan). It is
+	// called under the scan's lock. It does not support DirsOnly or
+	// MaxMemory.
+	OnDirDone func(rel string, ds DirStat, byUser map[string]*UserStat)
+	// DirsOnly reads and totals one directory at a time instead of feeding
+	// single files to the workers (-dirs-only). It does not support the
+	// per-file features: Samples, NewestFiles/OldestFiles, DedupDevs,
+	// ByDevice, DupesHash, ManifestHash and MaxMemory.
+	DirsOnly bool
+}
+
+// Result holds the aggregated data of a scan (or of a loaded summary) along
+// with the counters and timing needed to render or export it.
+type Result struct {
+	Root         string
+	DirStats     map[string]*DirStat
+	UserStats    map[string]*UserStat
+	GroupStats   map[string]*GroupStat
+	DirsScanned  int64
+	FilesScanned int64
+	// Incomplete is set when the walk stopped early (file cap or timeout)
+	// or a -max-memory spill could not be read back.
+	Incomplete bool
+	// DirOwners/DirGroups hold directory owner names for results loaded from
+	// JSON; they are nil for live scans, where owners are looked up on disk.
+	DirOwners map[string]string
+	DirGroups map[string]string
+	// ThrottleRate is the -throttle limit the scan ran under (0 = unlimited).
+	ThrottleRate float64
+	// FS holds the capacity of the filesystem backing Root when requested (-df-check).
+	FS *FSUsage
+	// DirUsers holds, per directory rel, the bytes and files of its subtree per
+	// user (keyed like UserStats). Only built when ScanOptions.DirOwners is set.
+	DirUsers map[string]map[string]*UserStat
+	// DirFiles holds, per directory rel, the files directly inside it, sorted
+	// by name. Only built when ScanOptions.FileLists is set.
+	DirFiles map[string][]JsonDirFile
+	// DirNewest holds, per directory rel, the modification time of the
+	// newest file below it. Only built when ScanOptions.DirNewest is set.
+	DirNewest map[string]time.Time
+	// maxUsers/maxGroups mirror ScanOptions.MaxUsers/MaxGroups for addFile.
+	maxUsers  int
+	maxGroups int
+	// countDirs mirrors ScanOptions.DirCount.
+	countDirs bool
+	// primaryGroups caches each uid's primary gid (or the file's gid when
+	// the user is unknown) for ScanOptions.GroupByPrimary; nil when off.
+	primaryGroups map[uint32]primaryGroup
+	// deferNames leaves names unresolved in addOwnerTotals until
+	// resolveDeferredNames (ScanOptions.ParallelLookup).
+	deferNames bool
+	// unknownOwner mirrors ScanOptions.UnknownOwner; with the bucket policy
+	// unknownUIDs/unknownGIDs hold the ids already found unresolved.
+	unknownOwner             string
+	unknownUIDs, unknownGIDs map[uint32]bool
+	// userMap/groupMap apply ScanOptions.UserMap/GroupMap in addFile.
+	userMap  *ownerMapper
+	groupMap *ownerMapper
+	// Samples holds the sampled file paths (rel to root) per top-level directory.
+	Samples map[string]*Reservoir
+	// BindDupFiles/BindDupBytes count the files skipped by -dedup-binds because
+	// the same inode was already counted through another mount.
+	BindDupFiles int64
+	BindDupBytes int64
+	// BlockSize is the -block-size the sizes were counted in (0 = apparent bytes).
+	BlockSize int64
+	// FileMinSize/FileMaxSize mirror the ScanOptions size filter (0 = off);
+	// SizeFilteredFiles counts the files it left out.
+	FileMinSize       int64
+	FileMaxSize       int64
+	SizeFilteredFiles int64
+	// ChangedSince mirrors the ScanOptions ctime filter (zero = off);
+	// CtimeFilteredFiles counts the files it left out.
+	ChangedSince       time.Time
+	CtimeFilteredFiles int64
+	// ModifiedBefore mirrors the ScanOptions mtime filter (zero = off);
+	// MtimeFilteredFiles counts the files it left out.
+	ModifiedBefore     time.Time
+	MtimeFilteredFiles int64
+	// StatFailedFiles counts the files skipped because they could not be
+	// statted (after any retries).
+	StatFailedFiles int64
+	// Devices holds the totals per backing device, keyed "major:minor"
+	// (-by-device); nil when not requested.
+	Devices map[string]*DeviceStat
+	// Duplicates holds the groups of identical files found by -dupes.
+	Duplicates *Duplicates
+	// Hostname and SnapshotName record where the scan ran and its label;
+	// Sources lists the inputs of a merged summary.
+	Hostname     string
+	SnapshotName string
+	Sources      []JsonSource
+	// loaded is set for results read back from a summary.
+	loaded bool
+	// minUserSize/minGroupSize are the thresholds a loaded summary's users
+	// and groups were already filtered by.
+	minUserSize, minGroupSize int64
+	// UserGroups holds the bytes and files of every user within every group,
+	// keyed like UserStats and GroupStats, for the user:group keys of
+	// -quota; nil when not requested.
+	UserGroups map[userGroupKey]*UserGroupStat
+	// Hidden splits the totals between hidden and visible files
+	// (-hidden-report); nil when not requested.
+	Hidden *JsonHiddenSplit
+	// ExtByUser holds the bytes and files per extension and user name
+	// (-ext-by-user); nil when not requested.
+	ExtByUser map[string]map[string]*ExtUserStat
+	// Manifest holds the content hash of every file for -manifest.
+	Manifest *Manifest
+	// spill holds the directories moved to disk by -max-memory; nil if the
+	// aggregation stayed in memory.
+	spill *dirSpill
+	// Newest/Oldest rank files by modification time (-newest-files/-oldest-files).
+	Newest    *TopFiles
+	Oldest    *TopFiles
+	StartedAt time.Time
+	EndedAt   time.Time
+	MemStart  runtime.MemStats
+}
+
+// newResult returns the empty Result of a scan of rootAbs with opts.
+func newResult(rootAbs string, opts ScanOptions) *Result {
+	res := &Result{
+		Root:           rootAbs,
+		DirStats:       make(map[string]*DirStat), // key: relative path to root (".")
+		UserStats:      make(map[string]*UserStat),
+		GroupStats:     make(map[string]*GroupStat),
+		StartedAt:      time.Now(),
+		ThrottleRate:   opts.Throttle,
+		BlockSize:      opts.BlockSize,
+		FileMinSize:    opts.FileMinSize,
+		FileMaxSize:    opts.FileMaxSize,
+		ChangedSince:   opts.ChangedSince,
+		ModifiedBefore: opts.ModifiedBefore,
+		Hostname:       scanHostname(),
+		SnapshotName:   opts.SnapshotName,
+		maxUsers:       opts.MaxUsers,
+		countDirs:      opts.DirCount,
+		maxGroups:      opts.MaxGroups,
+		userMap:        newOwnerMapper(opts.UserMap, userName),
+		groupMap:       newOwnerMapper(opts.GroupMap, groupName),
+	}
+	if opts.GroupByPrimary {
+		res.primaryGroups = make(map[uint32]primaryGroup)
+	}
+	if opts.UserGroupTotals {
+		res.UserGroups = make(map[userGroupKey]*UserGroupStat)
+	}
+	if opts.HiddenReport {
+		res.Hidden = &JsonHiddenSplit{}
+	}
+	res.unknownOwner = opts.UnknownOwner
+	if opts.UnknownOwner == unknownOwnerBucket {
+		res.unknownUIDs, res.unknownGIDs = make(map[uint32]bool), make(map[uint32]bool)
+	}
+	return res
+}
+
+// Scan walks rootAbs, statting files in a pool of workers and aggregating sizes
+// per directory (including all ancestors), per user and per group. The walk is
+// stopped early when ctx is done or opts.MaxFiles is reached; in that case the
+// partial result is returned with Incomplete set.
+func Scan(ctx context.Context, rootAbs string, opts ScanOptions) *Result {
+	res := newResult(rootAbs, opts)
+	res.deferNames = opts.ParallelLookup
+	// take initial memory snapshot to help estimate peak memory during run
+	runtime.ReadMemStats(&res.MemStart)
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	// channel of file paths to process and worker waitgroup
+	filesToProcess := make(chan string, concurrency*8)
+	var workerWg sync.WaitGroup
+
+	// Stats maps with mutex
+	var mu sync.Mutex
+	if opts.DirOwners {
+		res.DirUsers = make(map[string]map[string]*UserStat)
+	}
+	if opts.FileLists {
+		res.DirFiles = make(map[string][]JsonDirFile)
+	}
+	if opts.DirNewest {
+		res.DirNewest = make(map[string]time.Time)
+	}
+	var sampleRNG *rand.Rand
+	if opts.Samples > 0 {
+		res.Samples = make(map[string]*Reservoir)
+		sampleRNG = newSampleRNG(opts.Seed)
+	}
+
+	seenInodes := make(map[devIno]struct{})
+	if opts.NewestFiles > 0 {
+		res.Newest = NewTopFiles(opts.NewestFiles, newestFirst)
+	}
+	if opts.OldestFiles > 0 {
+		res.Oldest = NewTopFiles(opts.OldestFiles, oldestFirst)
+	}
+
+	// -max-memory: spill once the heap reaches 90% of the cap
+	var spill *dirSpill
+	spillAt := uint64(opts.MaxMemory) / 10 * 9
+	var sinceCheck int
+	if opts.MaxMemory > 0 {
+		var err error
+		if spill, err = newDirSpill(); err != nil {
+			log.Printf("max-memory: %v; aggregating in memory", err)
+		}
+	}
+
+	// devStats caches the Result.Devices entry of each st_dev seen
+	var devStats map[uint64]*DeviceStat
+	if opts.ByDevice {
+		res.Devices = make(map[string]*DeviceStat)
+		devStats = make(map[uint64]*DeviceStat)
+	}
+
+	var dups *dupCandidates
+	if opts.DupesHash != "" {
+		dups = newDupCandidates()
+	}
+	var extUsers extUserTally
+	if opts.ExtByUser {
+		extUsers = make(extUserTally)
+	}
+
+	var manifestHash func() hash.Hash
+	if opts.ManifestHash != "" {
+		if newHash, err := lookupHash(opts.ManifestHash); err != nil {
+			log.Printf("manifest: %v", err)
+		} else {
+			manifestHash = newHash
+			res.Manifest = &Manifest{Algorithm: opts.ManifestHash}
+		}
+	}
+
+	var limiter *RateLimiter
+	if opts.Throttle > 0 {
+		limiter = NewRateLimiter(opts.Throttle)
+	}
+
+	// dirRel returns the directory of path relative to the root
+	dirRel := func(path string) string {
+		dir := filepath.Dir(path)
+		rel, err := filepath.Rel(rootAbs, dir)
+		if err != nil {
+			return dir
+		}
+		return rel
+	}
+
+	// -json-stream-from-scan: report each directory once its subtree is final
+	var tracker *dirTracker
+	var position walkPosition
+	if opts.OnDirDone != nil {
+		tracker = newDirTracker(func(rel string) {
+			if ds := res.DirStats[rel]; ds != nil {
+				opts.OnDirDone(rel, *ds, res.DirUsers[rel])
+			}
+		})
+	}
+
+	// processFile stats one file and aggregates it; it runs in the workers,
+	// or inline in the walk for small trees
+	processFile := func(path string) {
+		rel := dirRel(path)
+		f, ok := res.statFile(path, &opts, limiter)
+		if !ok {
+			if tracker != nil {
+				mu.Lock()
+				tracker.release(rel)
+				mu.Unlock()
+			}
+			return
+		}
+		info, size, apparent, uid, gid, id := f.info, f.size, f.apparent, f.uid, f.gid, f.id
+
+		// hash for -manifest here, in parallel, before taking the lock
+		var entry ManifestEntry
+		if manifestHash != nil {
+			entry = ManifestEntry{Path: filepath.Join(rel, filepath.Base(path)), Size: apparent}
+			entry.Hash, entry.Err = hashFile(path, manifestHash)
+		}
+
+		// read an archive's entries for -expand-archives here too; one that
+		// cannot be read counts as the file it is
+		var expanded *archiveTotals
+		if opts.ExpandArchives && isExpandable(filepath.Base(path)) {
+			expanded, _ = readArchiveTotals(path)
+		}
+
+		// aggregate into dirStats and user/group maps
+		mu.Lock()
+		if opts.DedupDevs[id.dev] {
+			if _, dup := seenInodes[id]; dup {
+				res.BindDupFiles++
+				res.BindDupBytes += size
+				atomic.AddInt64(&res.FilesScanned, -1)
+				if tracker != nil {
+					tracker.release(rel)
+				}
+				mu.Unlock()
+				return
+			}
+			seenInodes[id] = struct{}{}
+		}
+		addSize, addFiles := size, int64(1)
+		if expanded != nil {
+			res.addArchiveTotals(filepath.Join(rel, filepath.Base(path)), expanded, uid, gid)
+			addSize, addFiles = expanded.size, expanded.files
+			atomic.AddInt64(&res.FilesScanned, expanded.files-1)
+		} else {
+			res.addFile(rel, size, uid, gid)
+		}
+		if devStats != nil {
+			ds, ok := devStats[id.dev]
+			if !ok {
+				key := devKey(id.dev)
+				if ds = res.Devices[key]; ds == nil {
+					ds = &DeviceStat{}
+					res.Devices[key] = ds
+				}
+				devStats[id.dev] = ds
+			}
+			ds.Size += addSize
+			ds.Files += addFiles
+		}
+		if res.Hidden != nil {
+			res.Hidden.add(isHidden(rel, filepath.Base(path)), addSize, addFiles)
+		}
+
+		if spill != nil {
+			if sinceCheck++; sinceCheck >= spillCheckEvery {
+				sinceCheck = 0
+				if heapAlloc() >= spillAt {
+					if err := spill.write(res.DirStats); err != nil {
+						log.Printf("max-memory: spill: %v", err)
+					} else {
+						res.DirStats = make(map[string]*DirStat)
+						runtime.GC()
+					}
+				}
+			}
+		}
+		if manifestHash != nil {
+			res.Manifest.Entries = append(res.Manifest.Entries, entry)
+		}
+		if extUsers != nil {
+			extUsers.add(filepath.Base(path), uid, size)
+		}
+		if res.DirNewest != nil {
+			res.noteNewest(rel, info.ModTime())
+		}
+		if res.DirFiles != nil {
+			res.DirFiles[rel] = append(res.DirFiles[rel], JsonDirFile{Name: filepath.Base(path), Size: size})
+		}
+		if dups != nil {
+			dups.add(filepath.Join(rel, filepath.Base(path)), apparent, id)
+		}
+		if sampleRNG != nil {
+			relFile := filepath.Join(rel, filepath.Base(path))
+			key := topLevelKey(relFile)
+			if _, ok := res.Samples[key]; !ok {
+				res.Samples[key] = NewReservoir(opts.Samples, sampleRNG)
+			}
+			res.Samples[key].Add(relFile)
+		}
+		if res.Newest != nil || res.Oldest != nil {
+			e := FileEntry{Path: filepath.Join(rel, filepath.Base(path)), Size: size, ModTime: info.ModTime()}
+			if res.Newest != nil {
+				res.Newest.Add(e)
+			}
+			if res.Oldest != nil {
+				res.Oldest.Add(e)
+			}
+		}
+		if tracker != nil {
+			tracker.release(rel)
+		}
+		mu.Unlock()
+	}
+
+	// workers stat files and aggregate directly; -dirs-only runs its own
+	// per-directory workers. With InlineBelow the walk stats the first files
+	// itself and only starts the workers once the tree turns out bigger.
+	workersStarted := false
+	startWorkers := func() {
+		workersStarted = true
+		for i := 0; i < concurrency; i++ {
+			workerWg.Add(1)
+			go func() {
+				defer workerWg.Done()
+				for path := range filesToProcess {
+					processFile(path)
+				}
+			}()
+		}
+	}
+	if !opts.DirsOnly && opts.InlineBelow <= 0 {
+		startWorkers()
+	}
+	var inlined int
+
+	// periodic snapshots of the partial aggregation, copied under the mutex
+	stopSnapshots := make(chan struct{})
+	var snapshotWg sync.WaitGroup
+	if opts.SnapshotInterval > 0 && opts.OnSnapshot != nil {
+		snapshotWg.Add(1)
+		go func() {
+			defer snapshotWg.Done()
+			ticker := time.NewTicker(opts.SnapshotInterval)
+			defer ticker.Stop()
+			for {
+				mu.Lock()
+				snap := res.snapshot()
+				mu.Unlock()
+				opts.OnSnapshot(snap)
+				select {
+				case <-stopSnapshots:
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+	if opts.ProgressInterval > 0 && opts.OnProgress != nil {
+		snapshotWg.Add(1)
+		go func() {
+			defer snapshotWg.Done()
+			ticker := time.NewTicker(opts.ProgressInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stopSnapshots:
+					return
+				case <-ticker.C:
+					opts.OnProgress(atomic.LoadInt64(&res.FilesScanned))
+				}
+			}
+		}()
+	}
+
+	// truncation is possible when a file cap is set or ctx can be cancelled;
+	// only then is the (more expensive) size-first order worth using.
+	truncating := opts.MaxFiles > 0 || ctx.Done() != nil
+	walk := filepath.WalkDir
+	if opts.WalkOrder == "size" && truncating {
+		walk = walkDirBySize
+	}
+
+	filtering := opts.Filter.active()
+
+	// Walk directory tree in calling goroutine and push file paths into filesToProcess
+	visit := func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			res.Incomplete = true
+			return filepath.SkipAll
+		}
+		if err != nil {
+			// skip unreadable entries
+			if opts.OnError != nil {
+				opts.OnError(path, err)
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if opts.SkipDirs[path] {
+				return filepath.SkipDir
+			}
+			atomic.AddInt64(&res.DirsScanned, 1)
+			if opts.DryRun {
+				return nil
+			}
+			// record every directory, so empty ones show up with zero totals,
+			// along with its owner
+			if rel, err := filepath.Rel(rootAbs, path); err == nil {
+				var st *syscall.Stat_t
+				if info, err := d.Info(); err == nil {
+					st, _ = info.Sys().(*syscall.Stat_t)
+				}
+				mu.Lock()
+				ds, ok := res.DirStats[rel]
+				if !ok {
+					ds = &DirStat{}
+					res.DirStats[rel] = ds
+				}
+				if st != nil {
+					if res.countDirs && !ds.HasOwner {
+						res.addOwnerDir(st.Uid, st.Gid)
+					}
+					ds.UID, ds.GID, ds.HasOwner = st.Uid, st.Gid, true
+				}
+				if tracker != nil {
+					if rel != "." {
+						position.leave(filepath.Dir(rel), tracker.release)
+					}
+					tracker.enter(rel)
+					position.open = append(position.open, rel)
+				}
+				mu.Unlock()
+			}
+			return nil
+		}
+		if filtering && !opts.Filter.Match(path) {
+			return nil
+		}
+		if opts.SkipRootFiles && filepath.Dir(path) == rootAbs {
+			return nil
+		}
+		if opts.MaxFiles > 0 && atomic.LoadInt64(&res.FilesScanned) >= opts.MaxFiles {
+			res.Incomplete = true
+			return filepath.SkipAll
+		}
+		atomic.AddInt64(&res.FilesScanned, 1)
+		if opts.DryRun {
+			return nil
+		}
+		if tracker != nil {
+			rel := dirRel(path)
+			mu.Lock()
+			position.leave(rel, tracker.release)
+			tracker.queue(rel)
+			mu.Unlock()
+		}
+		if inlined < opts.InlineBelow {
+			inlined++
+			processFile(path)
+			return nil
+		}
+		if !workersStarted {
+			startWorkers()
+		}
+		filesToProcess <- path
+		return nil
+	}
+	var err error
+	if opts.DirsOnly && !opts.DryRun {
+		err = res.scanDirs(ctx, rootAbs, &opts, &mu, concurrency, limiter)
+	} else {
+		err = walk(rootAbs, visit)
+	}
+	if err != nil {
+		log.Printf("walk error: %v", err)
+	}
+	if tracker != nil {
+		mu.Lock()
+		position.leaveAll(tracker.release)
+		mu.Unlock()
+	}
+
+	// finished enqueuing paths; close and wait for workers
+	close(filesToProcess)
+	workerWg.Wait()
+	close(stopSnapshots)
+	snapshotWg.Wait()
+	if res.deferNames {
+		res.resolveDeferredNames(concurrency)
+		res.deferNames = false
+	}
+	for _, files := range res.DirFiles {
+		sortFileList(files)
+	}
+	if extUsers != nil {
+		res.ExtByUser = extUsers.byName(res)
+	}
+
+	if spill != nil {
+		if len(spill.chunks) == 0 {
+			_ = spill.Close()
+		} else {
+			res.spill = spill
+			if err := res.finishSpill(opts.KeepDepth); err != nil {
+				// DirStats may be reloaded only in part: never pass the
+				// totals off as complete
+				log.Printf("max-memory: %v; totals are partial", err)
+				res.Incomplete = true
+			}
+		}
+	}
+	if dups != nil {
+		if newHash, err := lookupHash(opts.DupesHash); err != nil {
+			log.Printf("dupes: %v", err)
+		} else {
+			res.Duplicates = findDuplicates(rootAbs, dups, opts.DupesHash, newHash)
+		}
+	}
+
+	res.EndedAt = time.Now()
+	return res
+}
+
+// devIno identifies a file independently of the path it was reached through.
+type devIno struct {
+	dev, ino uint64
+}
+
+// othersKey is the user/group stats entry collecting ids beyond -max-users/-max-groups.
+const othersKey = "(others)"
+
+// overCap reports whether a map holding n entries (one of which may be the
+// others bucket) has reached the cap of distinct ids.
+func overCap(n, limit int, hasOthers bool) bool {
+	if limit <= 0 {
+		return false
+	}
+	if hasOthers {
+		n--
+	}
+	return n >= limit
+}
+
+// addFile adds one file of the given size to the directory rel and all its
+// ancestors, and to the totals of its owning uid and gid. User and group
+// stats are keyed by numeric id, so distinct ids never merge even if they
+// resolve to the same name; the name is resolved once, when an id is first seen.
+// Callers must hold the mutex guarding the maps.
+func (r *Result) addFile(rel string, size int64, uid, gid uint32) {
+	r.addDirTotals(rel, size, 1)
+	r.addOwnerTotals(rel, size, 1, uid, gid)
+}
+
+// addDirTotals adds size bytes in files files to directory rel and all its
+// ancestors. Callers must hold the mutex guarding the maps.
+func (r *Result) addDirTotals(rel string, size, files int64) {
+	p := rel
+	for {
+		if _, ok := r.DirStats[p]; !ok {
+			r.DirStats[p] = &DirStat{}
+		}
+		r.DirStats[p].Size += size
+		r.DirStats[p].Files += files
+		if p == "." {
+			break
+		}
+		p = filepath.Dir(p)
+	}
+}
+
+// addOwnerTotals adds size bytes in files files, all in directory rel, to
+// the totals of uid and gid (and to DirUsers when it is built). Callers must
+// hold the mutex guarding the maps.
+func (r *Result) addOwnerTotals(rel string, size, files int64, uid, gid uint32) {
+	uidKey, gidKey, us, gs := r.ownerStats(uid, gid)
+	us.Size += size
+	us.Files += files
+	gs.Size += size
+	gs.Files += files
+	if r.UserGroups != nil {
+		k := userGroupKey{User: uidKey, Group: gidKey}
+		ug := r.UserGroups[k]
+		if ug == nil {
+			ug = &UserGroupStat{}
+			r.UserGroups[k] = ug
+		}
+		ug.Size += size
+		ug.Files += files
+	}
+
+	if r.DirUsers != nil {
+		for p := rel; ; p = filepath.Dir(p) {
+			byUser, ok := r.DirUsers[p]
+			if !ok {
+				byUser = make(map[string]*UserStat)
+				r.DirUsers[p] = byUser
+			}
+			du, ok := byUser[uidKey]
+			if !ok {
+				du = &UserStat{UID: us.UID, Name: us.Name, HasID: us.HasID}
+				byUser[uidKey] = du
+			}
+			du.Size += size
+			du.Files += files
+			if p == "." {
+				break
+			}
+		}
+	}
+}
+
+// addOwnerDir counts a directory owned by uid and gid in their totals
+// (-dir-count). Callers must hold the mutex guarding the maps.
+func (r *Result) addOwnerDir(uid, gid uint32) {
+	_, _, us, gs := r.ownerStats(uid, gid)
+	us.Dirs++
+	gs.Dirs++
+}
+
+// ownerStats returns the totals uid and gid are counted in, creating them
+// (and resolving their names) on first sight, and their keys. Callers must
+// hold the mutex guarding the maps.
+func (r *Result) ownerStats(uid, gid uint32) (uidKey, gidKey string, us *UserStat, gs *GroupStat) {
+	uidKey, uname := strconv.FormatUint(uint64(uid), 10), ""
+	if r.userMap != nil {
+		mo := r.userMap.owner(uid)
+		uidKey, uname = mo.key, mo.name
+	}
+	if r.unknownUIDs[uid] {
+		uidKey = unknownKey
+	}
+	us, ok := r.UserStats[uidKey]
+	if !ok && overCap(len(r.UserStats), r.maxUsers, r.UserStats[othersKey] != nil) {
+		uidKey = othersKey
+		us, ok = r.UserStats[othersKey]
+		if !ok {
+			us = &UserStat{Name: othersKey}
+			r.UserStats[othersKey] = us
+		}
+	} else if !ok {
+		countLookupCache(false)
+		if uname == "" && !r.deferNames {
+			uname = userName(uid)
+		}
+		us = &UserStat{UID: uid, Name: uname, HasID: true}
+		if uname == uidKey && uidKey == strconv.FormatUint(uint64(uid), 10) {
+			uidKey, us = r.unknownUser(uid, us)
+		}
+		r.UserStats[uidKey] = us
+	} else {
+		countLookupCache(true)
+	}
+
+	if r.primaryGroups != nil {
+		gid = r.primaryGroup(uid, gid)
+	}
+	gidKey, gname := strconv.FormatUint(uint64(gid), 10), ""
+	if r.groupMap != nil {
+		mo := r.groupMap.owner(gid)
+		gidKey, gname = mo.key, mo.name
+	}
+	if r.unknownGIDs[gid] {
+		gidKey = unknownKey
+	}
+	gs, ok = r.GroupStats[gidKey]
+	if !ok && overCap(len(r.GroupStats), r.maxGroups, r.GroupStats[othersKey] != nil) {
+		gidKey = othersKey
+		gs, ok = r.GroupStats[othersKey]
+		if !ok {
+			gs = &GroupStat{Name: othersKey}
+			r.GroupStats[othersKey] = gs
+		}
+	} else if !ok {
+		countLookupCache(false)
+		if gname == "" && !r.deferNames {
+			gname = groupName(gid)
+		}
+		gs = &GroupStat{GID: gid, Name: gname, HasID: true}
+		if gname == gidKey && gidKey == strconv.FormatUint(uint64(gid), 10) {
+			gidKey, gs = r.unknownGroup(gid, gs)
+		}
+		r.GroupStats[gidKey] = gs
+	} else {
+		countLookupCache(true)
+	}
+	return uidKey, gidKey, us, gs
+}
+
+// unknownUser applies the -unknown-owner policy to us, the new entry of uid,
+// which did not resolve to a name, and returns the key and entry to add to.
+func (r *Result) unknownUser(uid uint32, us *UserStat) (string, *UserStat) {
+	key := strconv.FormatUint(uint64(uid), 10)
+	switch r.unknownOwner {
+	case unknownOwnerPrefixed:
+		us.Name = unknownOwnerName(r.unknownOwner, "uid", uid)
+	case unknownOwnerBucket:
+		r.unknownUIDs[uid] = true
+		key, us = unknownKey, r.UserStats[unknownKey]
+		if us == nil {
+			us = &UserStat{Name: unknownKey}
+		}
+	}
+	return key, us
+}
+
+// unknownGroup is unknownUser for groups.
+func (r *Result) unknownGroup(gid uint32, gs *GroupStat) (string, *GroupStat) {
+	key := strconv.FormatUint(uint64(gid), 10)
+	switch r.unknownOwner {
+	case unknownOwnerPrefixed:
+		gs.Name = unknownOwnerName(r.unknownOwner, "gid", gid)
+	case unknownOwnerBucket:
+		r.unknownGIDs[gid] = true
+		key, gs = unknownKey, r.GroupStats[unknownKey]
+		if gs == nil {
+			gs = &GroupStat{Name: unknownKey}
+		}
+	}
+	return key, gs
+}
+
+// scannedFile is a file statted by statFile.
+type scannedFile struct {
+	info fs.FileInfo
+	// size is the counted size (block-rounded with -block-size), apparent
+	// the size as reported by stat.
+	size, apparent int64
+	uid, gid       uint32
+	id             devIno
+}
+
+// statFile stats path after waiting for the throttle, retrying transient
+// errors. Files that cannot be statted or that the size or ctime filters
+// leave out are taken back out of FilesScanned, counted under their reason,
+// and reported as not ok.
+func (r *Result) statFile(path string, opts *ScanOptions, limiter *RateLimiter) (scannedFile, bool) {
+	if limiter != nil {
+		limiter.Wait()
+	}
+	info, err := lstatRetry(path, opts.StatRetries)
+	if err != nil {
+		if opts.OnError != nil {
+			opts.OnError(path, err)
+		}
+		atomic.AddInt64(&r.StatFailedFiles, 1)
+		atomic.AddInt64(&r.FilesScanned, -1)
+		return scannedFile{}, false
+	}
+	f := scannedFile{info: info, size: info.Size(), apparent: info.Size()}
+	if (opts.FileMinSize > 0 && f.size < opts.FileMinSize) || (opts.FileMaxSize > 0 && f.size > opts.FileMaxSize) {
+		atomic.AddInt64(&r.SizeFilteredFiles, 1)
+		atomic.AddInt64(&r.FilesScanned, -1)
+		return scannedFile{}, false
+	}
+	st, _ := info.Sys().(*syscall.Stat_t)
+	if !opts.ChangedSince.IsZero() && st != nil && statCtime(st).Before(opts.ChangedSince) {
+		atomic.AddInt64(&r.CtimeFilteredFiles, 1)
+		atomic.AddInt64(&r.FilesScanned, -1)
+		return scannedFile{}, false
+	}
+	if !opts.ModifiedBefore.IsZero() && info.ModTime().After(opts.ModifiedBefore) {
+		atomic.AddInt64(&r.MtimeFilteredFiles, 1)
+		atomic.AddInt64(&r.FilesScanned, -1)
+		return scannedFile{}, false
+	}
+	alloc := f.size
+	if st != nil {
+		f.uid, f.gid = st.Uid, st.Gid
+		f.id = devIno{dev: uint64(st.Dev), ino: st.Ino}
+		alloc = int64(st.Blocks) * 512
+	}
+	if opts.BlockSize > 0 {
+		f.size = blockRoundUp(alloc, opts.BlockSize)
+	}
+	return f, true
+}
+
+// primaryGroup is a cached primaryGID result.
+type primaryGroup struct {
+	gid   uint32
+	known bool
+}
+
+// primaryGroup returns uid's primary group, resolved once per uid, or gid
+// when the user is not in the user database.
+func (r *Result) primaryGroup(uid, gid uint32) uint32 {
+	pg, ok := r.primaryGroups[uid]
+	countLookupCache(ok)
+	if !ok {
+		pg.gid, pg.known = primaryGID(uid)
+		r.primaryGroups[uid] = pg
+	}
+	if !pg.known {
+		return gid
+	}
+	return pg.gid
+}
+
+// snapshot returns a copy of the aggregation maps and counters of a running
+// scan; the caller must hold the mutex guarding the maps.
+func (r *Result) snapshot() *Result {
+	snap := &Result{
+		Root:               r.Root,
+		DirStats:           make(map[string]*DirStat, len(r.DirStats)),
+		UserStats:          make(map[string]*UserStat, len(r.UserStats)),
+		GroupStats:         make(map[string]*GroupStat, len(r.GroupStats)),
+		DirsScanned:        atomic.LoadInt64(&r.DirsScanned),
+		FilesScanned:       atomic.LoadInt64(&r.FilesScanned),
+		StartedAt:          r.StartedAt,
+		EndedAt:            time.Now(),
+		MemStart:           r.MemStart,
+		BlockSize:          r.BlockSize,
+		BindDupFiles:       r.BindDupFiles,
+		BindDupBytes:       r.BindDupBytes,
+		FileMinSize:        r.FileMinSize,
+		FileMaxSize:        r.FileMaxSize,
+		SizeFilteredFiles:  atomic.LoadInt64(&r.SizeFilteredFiles),
+		ChangedSince:       r.ChangedSince,
+		CtimeFilteredFiles: atomic.LoadInt64(&r.CtimeFilteredFiles),
+		ModifiedBefore:     r.ModifiedBefore,
+		MtimeFilteredFiles: atomic.LoadInt64(&r.MtimeFilteredFiles),
+		StatFailedFiles:    atomic.LoadInt64(&r.StatFailedFiles),
+	}
+	for k, v := range r.DirStats {
+		c := *v
+		snap.DirStats[k] = &c
+	}
+	for k, v := range r.UserStats {
+		c := *v
+		snap.UserStats[k] = &c
+	}
+	for k, v := range r.GroupStats {
+		c := *v
+		snap.GroupStats[k] = &c
+	}
+	if r.DirUsers != nil {
+		snap.DirUsers = make(map[string]map[string]*UserStat, len(r.DirUsers))
+		for rel, byUser := range r.DirUsers {
+			cp := make(map[string]*UserStat, len(byUser))
+			for k, v := range byUser {
+				c := *v
+				cp[k] = &c
+			}
+			snap.DirUsers[rel] = cp
+		}
+	}
+	return snap
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile creates a file of the given size (and any missing parent dirs).
+func writeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestScanBasic(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a.txt"), 100)
+	writeFile(t, filepath.Join(root, "sub", "b.txt"), 200)
+	writeFile(t, filepath.Join(root, "sub", "deep", "c.txt"), 300)
+
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2})
+	if res.Incomplete {
+		t.Fatalf("unexpected incomplete scan")
+	}
+	if res.FilesScanned != 3 || res.DirsScanned != 3 {
+		t.Fatalf("scanned counters: files=%d dirs=%d", res.FilesScanned, res.DirsScanned)
+	}
+	want := map[string]DirStat{
+		".":        {Size: 600, Files: 3},
+		"sub":      {Size: 500, Files: 2},
+		"sub/deep": {Size: 300, Files: 1},
+	}
+	for rel, w := range want {
+		// the walk records each directory's owner as well
+		w.UID, w.GID, w.HasOwner = uint32(os.Getuid()), uint32(os.Getgid()), true
+		got, ok := res.DirStats[rel]
+		if !ok || *got != w {
+			t.Fatalf("dirStats[%q] = %+v; want %+v", rel, got, w)
+		}
+	}
+}
+
+func TestScanMaxFilesWalkOrder(t *testing.T) {
+	root := t.TempDir()
+	// alphabetically-early subtree with small files, late subtree with the bulk of the data
+	writeFile(t, filepath.Join(root, "aaa", "1"), 10)
+	writeFile(t, filepath.Join(root, "aaa", "2"), 10)
+	writeFile(t, filepath.Join(root, "zzz", "big"), 100000)
+
+	lex := Scan(context.Background(), root, ScanOptions{Concurrency: 1, MaxFiles: 1, WalkOrder: "lexical"})
+	if !lex.Incomplete {
+		t.Fatalf("expected lexical scan to be truncated")
+	}
+	if _, ok := lex.DirStats["zzz"]; ok {
+		t.Fatalf("lexical order should reach aaa first, got %v", lex.DirStats)
+	}
+
+	bySize := Scan(context.Background(), root, ScanOptions{Concurrency: 1, MaxFiles: 1, WalkOrder: "size"})
+	if !bySize.Incomplete {
+		t.Fatalf("expected size-ordered scan to be truncated")
+	}
+	if bySize.FilesScanned != 1 {
+		t.Fatalf("expected exactly 1 file, got %d", bySize.FilesScanned)
+	}
+	if ds, ok := bySize.DirStats["zzz"]; !ok || ds.Size != 100000 {
+		t.Fatalf("size order should capture the largest subtree first, got %v", bySize.DirStats)
+	}
+}
+
+func TestScanCancelledContext(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a"), 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res := Scan(ctx, root, ScanOptions{Concurrency: 1})
+	if !res.Incomplete {
+		t.Fatalf("expected incomplete scan on cancelled context")
+	}
+	if res.FilesScanned != 0 {
+		t.Fatalf("expected no files scanned, got %d", res.FilesScanned)
+	}
+}
+
+func TestScanFileSizeBounds(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "lock"), 1)           // below the minimum
+	writeFile(t, filepath.Join(root, "a", "min"), 10)      // on the minimum: counted
+	writeFile(t, filepath.Join(root, "a", "mid"), 500)     // counted
+	writeFile(t, filepath.Join(root, "a", "max"), 1000)    // on the maximum: counted
+	writeFile(t, filepath.Join(root, "b", "core"), 5000)   // above the maximum
+	writeFile(t, filepath.Join(root, "b", "keep.log"), 20) // counted unless path-filtered
+
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, FileMinSize: 10, FileMaxSize: 1000})
+	if got := res.DirStats["."]; got.Size != 1530 || got.Files != 4 {
+		t.Fatalf("root = %+v, want only the 4 in-range files (1530 bytes)", got)
+	}
+	if got := res.DirStats["b"]; got.Size != 20 || got.Files != 1 {
+		t.Fatalf("b = %+v, want the core dump left out", got)
+	}
+	if res.FilesScanned != 4 || res.SizeFilteredFiles != 2 {
+		t.Fatalf("scanned %d, size-filtered %d; want 4 and 2", res.FilesScanned, res.SizeFilteredFiles)
+	}
+	var userTotal int64
+	for _, us := range res.UserStats {
+		userTotal += us.Size
+	}
+	if userTotal != 1530 {
+		t.Fatalf("user totals = %d, want 1530", userTotal)
+	}
+	jo := summaryFor(res, SummaryOptions{})
+	if jo.Stats.FileMinSize != 10 || jo.Stats.FileMaxSize != 1000 || jo.Stats.SizeFilteredFiles != 2 {
+		t.Fatalf("stats = %+v, want the active filter recorded", jo.Stats)
+	}
+
+	// size and path filters intersect
+	res = Scan(context.Background(), root, ScanOptions{Concurrency: 2, FileMinSize: 10, FileMaxSize: 1000, Filter: PathFilter{NotContains: []string{".log"}}})
+	if got := res.DirStats["."]; got.Size != 1510 || got.Files != 3 {
+		t.Fatalf("root = %+v, want 3 files (1510 bytes) with both filters", got)
+	}
+}
+
+func TestScanInlineMatchesWorkers(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a.txt"), 100)
+	writeFile(t, filepath.Join(root, "sub", "b.txt"), 200)
+	writeFile(t, filepath.Join(root, "sub", "deep", "c.txt"), 300)
+
+	pooled := Scan(context.Background(), root, ScanOptions{Concurrency: 2})
+	// 2 files inline, the third through the workers started late
+	inline := Scan(context.Background(), root, ScanOptions{Concurrency: 2, InlineBelow: 2})
+	if inline.FilesScanned != pooled.FilesScanned || inline.DirsScanned != pooled.DirsScanned {
+		t.Fatalf("inline scanned files=%d dirs=%d; workers files=%d dirs=%d",
+			inline.FilesScanned, inline.DirsScanned, pooled.FilesScanned, pooled.DirsScanned)
+	}
+	if len(inline.DirStats) != len(pooled.DirStats) {
+		t.Fatalf("inline has %d dirs, workers %d", len(inline.DirStats), len(pooled.DirStats))
+	}
+	for rel, want := range pooled.DirStats {
+		if got := inline.DirStats[rel]; got == nil || *got != *want {
+			t.Fatalf("inline dirStats[%q] = %+v; want %+v", rel, got, want)
+		}
+	}
+	for id, want := range pooled.UserStats {
+		if got := inline.UserStats[id]; got == nil || got.Size != want.Size || got.Files != want.Files {
+			t.Fatalf("inline userStats[%s] = %+v; want %+v", id, got, want)
+		}
+	}
+}
+
+// BenchmarkScanSmallTree compares the worker pool with the inline path
+// (-inline-below) on a tree of 3 directories holding 20 files each.
+func BenchmarkScanSmallTree(b *testing.B) {
+	root := b.TempDir()
+	for _, d := range []string{"a", "b", "c"} {
+		dir := filepath.Join(root, d)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			b.Fatal(err)
+		}
+		for i := 0; i < 20; i++ {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d", i)), make([]byte, 100), 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	for _, bc := range []struct {
+		name        string
+		inlineBelow int
+	}{{"workers", 0}, {"inline", 1000}} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Scan(context.Background(), root, ScanOptions{Concurrency: 16, InlineBelow: bc.inlineBelow})
+			}
+		})
+	}
+}
+
+func TestScanDirCountAttributesDirectoryOwners(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("needs root to chown")
+	}
+	stubOwnerNames(t, map[uint32]string{0: "root", 1001: "alice"}, map[uint32]string{0: "root", 2001: "staff"})
+	root := t.TempDir()
+	// alice owns the directory, root the file inside it
+	writeFile(t, filepath.Join(root, "shared", "f"), 100)
+	writeFile(t, filepath.Join(root, "mine", "g"), 10)
+	if err := os.Chown(filepath.Join(root, "shared"), 1001, 2001); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(root, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dirsOnly := range []bool{false, true} {
+		res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, DirsOnly: dirsOnly, DirCount: true})
+		alice, rootUser := res.UserStats["1001"], res.UserStats["0"]
+		if alice == nil || alice.Dirs != 1 || alice.Files != 0 || alice.Size != 0 {
+			t.Fatalf("dirsOnly=%v: alice = %+v; want 1 dir and no files", dirsOnly, alice)
+		}
+		if rootUser == nil || rootUser.Dirs != 2 || rootUser.Files != 2 {
+			t.Fatalf("dirsOnly=%v: root = %+v; want 2 dirs (the root and mine) and 2 files", dirsOnly, rootUser)
+		}
+		if staff := res.GroupStats["2001"]; staff == nil || staff.Dirs != 1 || staff.Files != 0 {
+			t.Fatalf("dirsOnly=%v: staff = %+v; want 1 dir", dirsOnly, staff)
+		}
+
+		var out bytes.Buffer
+		printTree(&out, res, TreeOptions{Format: FormatOptions{Bytes: true}, DirCount: true})
+		if !strings.Contains(out.String(), "0 files 1 dirs") || !strings.Contains(out.String(), "2 files 2 dirs") {
+			t.Fatalf("dirsOnly=%v: summaries lack the dirs column:\n%s", dirsOnly, out.String())
+		}
+	}
+
+	// without -dir-count nothing is attributed for directories
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2})
+	if res.UserStats["1001"] != nil || res.UserStats["0"].Dirs != 0 {
+		t.Fatalf("dirs counted without DirCount: %+v", res.UserStats)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SnapshotFilter re-slices a summary loaded by -read-json without a rescan:
+// Subtree re-roots it at a directory, OnlyUser keeps one user's share and
+// MinSize drops the smaller directories.
+type SnapshotFilter struct {
+	// Subtree is the directory, relative to the snapshot root, that becomes
+	// the new root (-subtree); "" or "." keeps the root.
+	Subtree string
+	// OnlyUser is a user name or uid whose bytes and files replace the
+	// directory totals (-only-user); it needs the per-directory owner
+	// breakdown of a snapshot written with -json-owner-breakdown.
+	OnlyUser string
+	// MinSize drops directories below this size, after the other filters
+	// (-min-size); 0 keeps all. The root is always kept.
+	MinSize int64
+}
+
+// active reports whether the filter changes anything.
+func (f SnapshotFilter) active() bool {
+	return (f.Subtree != "" && f.Subtree != ".") || f.OnlyUser != "" || f.MinSize > 0
+}
+
+// Apply filters res in place: first Subtree, then OnlyUser, then MinSize.
+func (f SnapshotFilter) Apply(res *Result) error {
+	if f.Subtree != "" && filepath.Clean(f.Subtree) != "." {
+		if err := reroot(res, filepath.Clean(f.Subtree)); err != nil {
+			return err
+		}
+	}
+	if f.OnlyUser != "" {
+		if err := onlyUser(res, f.OnlyUser); err != nil {
+			return err
+		}
+	}
+	if f.MinSize > 0 {
+		// a directory is never larger than its parent, so the kept ones
+		// still hang from kept parents
+		for rel, ds := range res.DirStats {
+			if rel != "." && ds.Size < f.MinSize {
+				delete(res.DirStats, rel)
+				delete(res.DirOwners, rel)
+				delete(res.DirGroups, rel)
+				delete(res.DirUsers, rel)
+				delete(res.DirFiles, rel)
+			}
+		}
+	}
+	return nil
+}
+
+// underSubtree returns rel relative to sub when it is sub or below it.
+func underSubtree(rel, sub string) (string, bool) {
+	if rel == sub {
+		return ".", true
+	}
+	if rest, ok := strings.CutPrefix(rel, sub+string(filepath.Separator)); ok {
+		return rest, true
+	}
+	return "", false
+}
+
+// rerootMap keeps the entries of m under sub, keyed relative to it.
+func rerootMap[T any](m map[string]T, sub string) map[string]T {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]T)
+	for rel, v := range m {
+		if r, ok := underSubtree(rel, sub); ok {
+			out[r] = v
+		}
+	}
+	return out
+}
+
+// reroot makes directory sub of res its root, with every path relative to
+// it. The per-user totals become those of the subtree when the snapshot has
+// the owner breakdown and are left out otherwise; the group totals, devices
+// and samples only exist for the whole snapshot and are left out too.
+func reroot(res *Result, sub string) error {
+	root, ok := res.DirStats[sub]
+	if !ok {
+		return fmt.Errorf("-subtree: %s is not a directory of the snapshot", sub)
+	}
+	res.Root = filepath.Join(res.Root, sub)
+	res.DirStats = rerootMap(res.DirStats, sub)
+	res.DirOwners = rerootMap(res.DirOwners, sub)
+	res.DirGroups = rerootMap(res.DirGroups, sub)
+	res.UserStats = make(map[string]*UserStat)
+	for k, us := range res.DirUsers[sub] {
+		res.UserStats[k] = us
+	}
+	res.DirUsers = rerootMap(res.DirUsers, sub)
+	res.DirFiles = rerootMap(res.DirFiles, sub)
+	res.GroupStats = make(map[string]*GroupStat)
+	res.DirsScanned = int64(len(res.DirStats))
+	res.FilesScanned = root.Files
+	res.Devices, res.Samples = nil, nil
+
+	rerootFiles := func(t *TopFiles, better func(a, b FileEntry) bool) *TopFiles {
+		if t == nil {
+			return nil
+		}
+		out := NewTopFiles(t.n, better)
+		for _, e := range t.Sorted() {
+			if r, ok := underSubtree(e.Path, sub); ok {
+				e.Path = r
+				out.Add(e)
+			}
+		}
+		return out
+	}
+	res.Newest = rerootFiles(res.Newest, newestFirst)
+	res.Oldest = rerootFiles(res.Oldest, oldestFirst)
+	if res.Duplicates != nil {
+		d := &Duplicates{Algorithm: res.Duplicates.Algorithm, Groups: []DupGroup{}}
+		for _, g := range res.Duplicates.Groups {
+			var paths []string
+			for _, p := range g.Paths {
+				if r, ok := underSubtree(p, sub); ok {
+					paths = append(paths, r)
+				}
+			}
+			if len(paths) > 1 {
+				d.Groups = append(d.Groups, DupGroup{Size: g.Size, Hash: g.Hash, Paths: paths})
+			}
+		}
+		res.Duplicates = d
+	}
+	return nil
+}
+
+// onlyUser replaces every directory's totals by the share of user (a name
+// or uid) from res.DirUsers. What cannot be attributed to the user, the
+// group totals and the file listings, is left out.
+func onlyUser(res *Result, user string) error {
+	if res.DirUsers == nil {
+		return fmt.Errorf("-only-user needs a snapshot written with -json-owner-breakdown")
+	}
+	matches := func(k string, us *UserStat) bool {
+		return us.Name == user || k == user || (us.UID != 0 && strconv.FormatUint(uint64(us.UID), 10) == user)
+	}
+	// the root's breakdown lists every user with files in the snapshot
+	key, found := "", (*UserStat)(nil)
+	for k, us := range res.DirUsers["."] {
+		if matches(k, us) {
+			key, found = k, us
+			break
+		}
+	}
+	if found == nil {
+		return fmt.Errorf("-only-user: no files of %s in the snapshot", user)
+	}
+
+	for rel, ds := range res.DirStats {
+		ds.Size, ds.Files = 0, 0
+		byUser := res.DirUsers[rel]
+		if us := byUser[key]; us != nil {
+			ds.Size, ds.Files = us.Size, us.Files
+			res.DirUsers[rel] = map[string]*UserStat{key: us}
+		} else if byUser != nil {
+			res.DirUsers[rel] = map[string]*UserStat{}
+		}
+	}
+	res.UserStats = map[string]*UserStat{key: found}
+	res.FilesScanned = found.Files
+	res.GroupStats = make(map[string]*GroupStat)
+	res.Newest, res.Oldest, res.Duplicates, res.Devices, res.Samples = nil, nil, nil, nil, nil
+	return nil
+}
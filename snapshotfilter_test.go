@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// snapshotFixture is a loaded summary with the per-directory owner breakdown.
+func snapshotFixture() *Result {
+	share := func(aliceSize, aliceFiles, bobSize, bobFiles int64) map[string]JsonOwnerShare {
+		m := map[string]JsonOwnerShare{}
+		if aliceFiles > 0 {
+			m["alice"] = JsonOwnerShare{Size: aliceSize, Files: aliceFiles, UID: 1000}
+		}
+		if bobFiles > 0 {
+			m["bob"] = JsonOwnerShare{Size: bobSize, Files: bobFiles, UID: 1001}
+		}
+		return m
+	}
+	return resultFromSummary(JsonOut{
+		Root: "/data",
+		Dirs: []JsonDir{
+			{Rel: ".", Size: 7000, Files: 7, Owners: share(5000, 4, 2000, 3)},
+			{Rel: "projects", Size: 6000, Files: 5, Owners: share(4500, 3, 1500, 2)},
+			{Rel: "projects/web", Size: 4000, Files: 2, Owners: share(4000, 2, 0, 0)},
+			{Rel: "projects/web/assets", Size: 500, Files: 1, Owners: share(500, 1, 0, 0)},
+			{Rel: "projects/api", Size: 1500, Files: 2, Owners: share(0, 0, 1500, 2)},
+			{Rel: "tmp", Size: 1000, Files: 2, Owners: share(500, 1, 500, 1)},
+		},
+		Users: []JsonUser{{Name: "alice", UID: 1000, Size: 5000, Files: 4}, {Name: "bob", UID: 1001, Size: 2000, Files: 3}},
+		Grps:  []JsonGroup{{Name: "staff", GID: 50, Size: 7000, Files: 7}},
+	})
+}
+
+func snapshotDirSizes(res *Result) map[string]int64 {
+	m := make(map[string]int64, len(res.DirStats))
+	for rel, ds := range res.DirStats {
+		m[rel] = ds.Size
+	}
+	return m
+}
+
+func TestSnapshotFilterSubtree(t *testing.T) {
+	res := snapshotFixture()
+	if err := (SnapshotFilter{Subtree: "projects/"}).Apply(res); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	want := map[string]int64{".": 6000, "web": 4000, "web/assets": 500, "api": 1500}
+	if got := snapshotDirSizes(res); !reflect.DeepEqual(got, want) {
+		t.Fatalf("dirs = %v, want %v", got, want)
+	}
+	if res.Root != "/data/projects" || res.FilesScanned != 5 {
+		t.Fatalf("root = %q, files = %d", res.Root, res.FilesScanned)
+	}
+	if us := res.UserStats[summaryOwnerKey("bob", 1001)]; us == nil || us.Size != 1500 || len(res.GroupStats) != 0 {
+		t.Fatalf("users = %v, groups = %v; want the subtree's users and no groups", res.UserStats, res.GroupStats)
+	}
+
+	var out bytes.Buffer
+	printTree(&out, res, TreeOptions{Levels: 2, Format: FormatOptions{Bytes: true, ASCII: true}})
+	for _, line := range []string{"6000 /data/projects", "|-- web", "|   `-- assets", "`-- api"} {
+		if !strings.Contains(out.String(), line) {
+			t.Fatalf("tree lacks %q:\n%s", line, out.String())
+		}
+	}
+
+	if err := (SnapshotFilter{Subtree: "nope"}).Apply(snapshotFixture()); err == nil {
+		t.Fatalf("expected an error for a missing subtree")
+	}
+}
+
+func TestSnapshotFilterOnlyUser(t *testing.T) {
+	for _, user := range []string{"bob", "1001"} {
+		res := snapshotFixture()
+		if err := (SnapshotFilter{OnlyUser: user}).Apply(res); err != nil {
+			t.Fatalf("Apply(%s): %v", user, err)
+		}
+		want := map[string]int64{".": 2000, "projects": 1500, "projects/web": 0, "projects/web/assets": 0, "projects/api": 1500, "tmp": 500}
+		if got := snapshotDirSizes(res); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: dirs = %v, want %v", user, got, want)
+		}
+		if len(res.UserStats) != 1 || res.FilesScanned != 3 {
+			t.Fatalf("%s: users = %v, files = %d", user, res.UserStats, res.FilesScanned)
+		}
+	}
+
+	if err := (SnapshotFilter{OnlyUser: "carol"}).Apply(snapshotFixture()); err == nil {
+		t.Fatalf("expected an error for an unknown user")
+	}
+	plain := resultFromSummary(JsonOut{Root: "/data", Dirs: []JsonDir{{Rel: ".", Size: 1, Files: 1}}})
+	if err := (SnapshotFilter{OnlyUser: "bob"}).Apply(plain); err == nil || !strings.Contains(err.Error(), "-json-owner-breakdown") {
+		t.Fatalf("expected an error naming -json-owner-breakdown, got %v", err)
+	}
+}
+
+func TestSnapshotFilterMinSize(t *testing.T) {
+	res := snapshotFixture()
+	if err := (SnapshotFilter{MinSize: 1500}).Apply(res); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	want := map[string]int64{".": 7000, "projects": 6000, "projects/web": 4000, "projects/api": 1500}
+	if got := snapshotDirSizes(res); !reflect.DeepEqual(got, want) {
+		t.Fatalf("dirs = %v, want %v", got, want)
+	}
+
+	// combined, the size bound applies to the re-rooted user share
+	res = snapshotFixture()
+	if err := (SnapshotFilter{Subtree: "projects", OnlyUser: "alice", MinSize: 1000}).Apply(res); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if got, want := snapshotDirSizes(res), map[string]int64{".": 4500, "web": 4000}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("dirs = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The orders of -sort for the tree's children and the per-user and
+// per-group summaries.
+const (
+	sortSize    = "size"    // largest first, ties by name
+	sortName    = "name"    // byte-wise by name
+	sortNatural = "natural" // by name, runs of digits by their value
+)
+
+// checkSortOrder validates a -sort value.
+func checkSortOrder(s string) error {
+	switch s {
+	case sortSize, sortName, sortNatural:
+		return nil
+	}
+	return fmt.Errorf("invalid -sort %q (want size, name or natural)", s)
+}
+
+// naturalCompare compares a and b like strings.Compare, except that runs of
+// digits compare by their numeric value, so "item2" sorts before "item10"
+// and "v1.9" before "v1.10". Runs of equal value compare equal whatever
+// their leading zeros; those only break a tie of the whole strings, fewer
+// zeros first, so the order stays total.
+func naturalCompare(a, b string) int {
+	tie := 0
+	for a != "" && b != "" {
+		da, db := digitRun(a), digitRun(b)
+		if da == 0 || db == 0 {
+			if a[0] != b[0] {
+				return cmp.Compare(a[0], b[0])
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		na, nb := trimZeros(a[:da]), trimZeros(b[:db])
+		if len(na) != len(nb) {
+			return cmp.Compare(len(na), len(nb))
+		}
+		if c := strings.Compare(na, nb); c != 0 {
+			return c
+		}
+		if tie == 0 {
+			tie = cmp.Compare(da, db)
+		}
+		a, b = a[da:], b[db:]
+	}
+	if len(a) != len(b) {
+		return cmp.Compare(len(a), len(b))
+	}
+	return tie
+}
+
+// digitRun returns the length of the ASCII digits s starts with.
+func digitRun(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// trimZeros drops the leading zeros of a run of digits, keeping one of "0...0".
+func trimZeros(d string) string {
+	for len(d) > 1 && d[0] == '0' {
+		d = d[1:]
+	}
+	return d
+}
+
+// nameLess returns the name comparison of a -sort order: natural for
+// sortNatural, byte-wise otherwise.
+func nameLess(order string) func(a, b string) bool {
+	if order == sortNatural {
+		return func(a, b string) bool { return naturalCompare(a, b) < 0 }
+	}
+	return func(a, b string) bool { return a < b }
+}
+
+// sortByLabel reorders the summary keys by their labels for the name orders
+// of -sort; for sortSize they stay in the size order they are in.
+func sortByLabel(keys []string, labels map[string]string, order string) {
+	if order != sortName && order != sortNatural {
+		return
+	}
+	less := nameLess(order)
+	sort.SliceStable(keys, func(i, j int) bool { return less(labels[keys[i]], labels[keys[j]]) })
+}
+
+// largestChildren splits kids, in the order of sortChildren, into the n
+// largest and the rest, as -top-children shows them: both keep the order
+// of kids, so with a name order the largest are still listed by name.
+func largestChildren(kids []string, n int, dirSizes map[string]int64, order string) (shown, rest []string) {
+	if n <= 0 || len(kids) <= n {
+		return kids, nil
+	}
+	if order == sortSize || order == "" {
+		return kids[:n], kids[n:]
+	}
+	bySize := append([]string(nil), kids...)
+	sort.SliceStable(bySize, func(i, j int) bool { return dirSizes[bySize[i]] > dirSizes[bySize[j]] })
+	top := make(map[string]bool, n)
+	for _, k := range bySize[:n] {
+		top[k] = true
+	}
+	for _, k := range kids {
+		if top[k] {
+			shown = append(shown, k)
+		} else {
+			rest = append(rest, k)
+		}
+	}
+	return shown, rest
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestNaturalCompare(t *testing.T) {
+	names := []string{"item20", "item1", "item10", "item2"}
+	natural := append([]string(nil), names...)
+	sort.Slice(natural, func(i, j int) bool { return naturalCompare(natural[i], natural[j]) < 0 })
+	if want := []string{"item1", "item2", "item10", "item20"}; !reflect.DeepEqual(natural, want) {
+		t.Fatalf("natural order = %v, want %v", natural, want)
+	}
+	lexical := append([]string(nil), names...)
+	sort.Strings(lexical)
+	if want := []string{"item1", "item10", "item2", "item20"}; !reflect.DeepEqual(lexical, want) {
+		t.Fatalf("lexical order = %v, want %v", lexical, want)
+	}
+
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"v1.9", "v1.10", -1},
+		{"2024-1-31", "2024-10-1", -1},
+		{"a", "a1", -1},
+		{"x10y", "x10z", -1},
+		{"007", "7", 1}, // equal values; fewer zeros first
+		{"a01b", "a1c", -1},
+		{"same", "same", 0},
+	} {
+		if got := naturalCompare(tc.a, tc.b); got != tc.want {
+			t.Errorf("naturalCompare(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+		if got := naturalCompare(tc.b, tc.a); got != -tc.want {
+			t.Errorf("naturalCompare(%q, %q) = %d, want %d", tc.b, tc.a, got, -tc.want)
+		}
+	}
+}
+
+func TestPrintTreeSortOrders(t *testing.T) {
+	res := &Result{
+		Root: "/data",
+		DirStats: map[string]*DirStat{
+			".":      {Size: 100, Files: 4},
+			"item1":  {Size: 10, Files: 1},
+			"item2":  {Size: 40, Files: 1},
+			"item10": {Size: 20, Files: 1},
+			"item20": {Size: 30, Files: 1},
+		},
+		UserStats: map[string]*UserStat{
+			"1": {Name: "user10", Size: 70, HasID: true},
+			"2": {Name: "user9", Size: 30, HasID: true},
+		},
+		GroupStats: map[string]*GroupStat{},
+		DirOwners:  map[string]string{},
+	}
+	order := func(sortBy string) (dirs, users []string) {
+		var out bytes.Buffer
+		printTree(&out, res, TreeOptions{Levels: 1, Sort: sortBy})
+		sections := strings.Split(out.String(), "\n\n")
+		for _, l := range strings.Split(strings.TrimSpace(sections[0]), "\n")[2:] {
+			f := strings.Fields(l)
+			dirs = append(dirs, f[len(f)-1])
+		}
+		for _, l := range strings.Split(strings.TrimSpace(sections[1]), "\n")[1:] {
+			users = append(users, strings.Fields(l)[0])
+		}
+		return dirs, users
+	}
+	for _, tc := range []struct {
+		sort        string
+		dirs, users []string
+	}{
+		{sortSize, []string{"item2", "item20", "item10", "item1"}, []string{"user10", "user9"}},
+		{sortName, []string{"item1", "item10", "item2", "item20"}, []string{"user10", "user9"}},
+		{sortNatural, []string{"item1", "item2", "item10", "item20"}, []string{"user9", "user10"}},
+	} {
+		dirs, users := order(tc.sort)
+		if !reflect.DeepEqual(dirs, tc.dirs) || !reflect.DeepEqual(users, tc.users) {
+			t.Errorf("-sort %s: dirs %v, users %v; want %v, %v", tc.sort, dirs, users, tc.dirs, tc.users)
+		}
+	}
+}
+
+func TestLargestChildrenKeepsNameOrder(t *testing.T) {
+	sizes := map[string]int64{"a1": 5, "a2": 50, "a10": 30, "a20": 1}
+	shown, rest := largestChildren([]string{"a1", "a2", "a10", "a20"}, 2, sizes, sortNatural)
+	if !reflect.DeepEqual(shown, []string{"a2", "a10"}) || !reflect.DeepEqual(rest, []string{"a1", "a20"}) {
+		t.Fatalf("shown %v, rest %v; want the two largest in name order", shown, rest)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// JsonSource attributes part of a merged summary to the snapshot it came
+// from: the scanned root, the host and the -snapshot-name label, and the
+// prefix its directories were placed under ("" when the roots matched).
+type JsonSource struct {
+	Root         string `json:"root"`
+	Hostname     string `json:"hostname,omitempty"`
+	SnapshotName string `json:"snapshot_name,omitempty"`
+	Prefix       string `json:"prefix,omitempty"`
+}
+
+// scanHostname is the host recorded in the summaries of a scan; "" when the
+// system does not tell.
+func scanHostname() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return h
+}
+
+// snapshotLabel describes where a snapshot came from: "nightly (host nfs1)",
+// "nightly", "host nfs1" or "".
+func snapshotLabel(name, host string) string {
+	switch {
+	case name != "" && host != "":
+		return name + " (host " + host + ")"
+	case host != "":
+		return "host " + host
+	}
+	return name
+}
+
+// printSources writes below a tree rendered from snapshots where they came
+// from: one line for a single snapshot, one per input for a merged one. It
+// is a no-op for fresh scans.
+func printSources(w io.Writer, res *Result) {
+	if !res.loaded {
+		return
+	}
+	if len(res.Sources) == 0 {
+		if label := snapshotLabel(res.SnapshotName, res.Hostname); label != "" {
+			_, _ = fmt.Fprintln(w)
+			_, _ = fmt.Fprintf(w, "Snapshot: %s\n", label)
+		}
+		return
+	}
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, "Sources:")
+	for _, s := range res.Sources {
+		where := s.Root
+		if s.Prefix != "" {
+			where = s.Prefix + " = " + s.Root
+		}
+		if label := snapshotLabel(s.SnapshotName, s.Hostname); label != "" {
+			where += ": " + label
+		}
+		_, _ = fmt.Fprintf(w, "  %s\n", where)
+	}
+}
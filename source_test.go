@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanRecordsHostnameAndSnapshotName(t *testing.T) {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		t.Skipf("no hostname: %v", err)
+	}
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "f"), 10)
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 1, SnapshotName: "nightly"})
+
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if jo.Stats.Hostname != host || jo.Stats.SnapshotName != "nightly" {
+		t.Fatalf("stats hostname %q, snapshot_name %q; want %q, nightly", jo.Stats.Hostname, jo.Stats.SnapshotName, host)
+	}
+
+	// a fresh scan's tree stays as it was; the same data read back names its source
+	var out bytes.Buffer
+	if err := (TreeFormatter{}).Write(&out, res); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "Snapshot:") {
+		t.Fatalf("fresh scan should not print its source:\n%s", out.String())
+	}
+	out.Reset()
+	if err := (TreeFormatter{}).Write(&out, resultFromSummary(jo)); err != nil {
+		t.Fatal(err)
+	}
+	if want := "\nSnapshot: nightly (host " + host + ")\n"; !strings.Contains(out.String(), want) {
+		t.Fatalf("tree lacks %q:\n%s", want, out.String())
+	}
+}
+
+func TestMergeAndCompareSurfaceSources(t *testing.T) {
+	a := nodeSummary("/nodes/n1", 100, "alice")
+	a.Stats.Hostname, a.Stats.SnapshotName = "n1", "monday"
+	b := nodeSummary("/nodes/n2", 300, "bob")
+	b.Stats.Hostname = "n2"
+
+	merged := MergeSummaries([]JsonOut{a, b})
+	want := []JsonSource{
+		{Root: "/nodes/n1", Hostname: "n1", SnapshotName: "monday", Prefix: "n1"},
+		{Root: "/nodes/n2", Hostname: "n2", Prefix: "n2"},
+	}
+	if !reflect.DeepEqual(merged.Stats.Sources, want) {
+		t.Fatalf("sources = %+v, want %+v", merged.Stats.Sources, want)
+	}
+
+	// merging a merged summary keeps its inputs, under the new prefix
+	c := nodeSummary("/srv", 10, "carol")
+	again := MergeSummaries([]JsonOut{merged, c})
+	if len(again.Stats.Sources) != 3 || again.Stats.Sources[0].Prefix != "(merged)/n1" || again.Stats.Sources[2].Prefix != "srv" {
+		t.Fatalf("re-merged sources = %+v", again.Stats.Sources)
+	}
+
+	var out bytes.Buffer
+	if err := (TreeFormatter{Opts: TreeOptions{Levels: 1}}).Write(&out, resultFromSummary(merged)); err != nil {
+		t.Fatal(err)
+	}
+	if want := "\nSources:\n  n1 = /nodes/n1: monday (host n1)\n  n2 = /nodes/n2: host n2\n"; !strings.Contains(out.String(), want) {
+		t.Fatalf("merged tree lacks %q:\n%s", want, out.String())
+	}
+
+	out.Reset()
+	printCompareTree(&out, resultFromSummary(a), resultFromSummary(c), TreeOptions{Format: FormatOptions{Bytes: true}})
+	if want := "\nOld: monday (host n1)\nNew: -\n"; !strings.HasSuffix(out.String(), want) {
+		t.Fatalf("compare output lacks %q:\n%s", want, out.String())
+	}
+}
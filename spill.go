@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// spillCheckEvery is how many files the workers aggregate between two checks
+// of the heap size against ScanOptions.MaxMemory.
+var spillCheckEvery = 4096
+
+// heapAlloc reports the bytes of allocated heap objects; a variable so tests
+// can simulate memory pressure.
+var heapAlloc = func() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.HeapAlloc
+}
+
+// dirSpill is the on-disk overflow of a scan's per-directory aggregation
+// (-max-memory). Each spill writes the in-memory DirStats, sorted by rel, to a
+// chunk file; the chunks hold partial sums that each merges back, adding up
+// the entries of the same directory.
+type dirSpill struct {
+	dir    string // temporary directory holding the chunks
+	chunks []string
+}
+
+func newDirSpill() (*dirSpill, error) {
+	dir, err := os.MkdirTemp("", "diskusage-spill-")
+	if err != nil {
+		return nil, err
+	}
+	return &dirSpill{dir: dir}, nil
+}
+
+// spillLess orders rel paths as the JSON dirs array does (by absolute path):
+// the root first, then byte-wise.
+func spillLess(a, b string) bool {
+	if a == "." || b == "." {
+		return a == "." && b != "."
+	}
+	return a < b
+}
+
+// write appends the entries of m to the spill as a new sorted chunk. A chunk
+// record is the uvarint length of rel and rel, then size and files as varints,
+// uid and gid as uvarints and a HasOwner byte.
+func (s *dirSpill) write(m map[string]*DirStat) error {
+	rels := make([]string, 0, len(m))
+	for rel := range m {
+		rels = append(rels, rel)
+	}
+	sort.Slice(rels, func(i, j int) bool { return spillLess(rels[i], rels[j]) })
+
+	path := filepath.Join(s.dir, fmt.Sprintf("chunk-%06d", len(s.chunks)))
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	var buf [binary.MaxVarintLen64]byte
+	for _, rel := range rels {
+		ds := m[rel]
+		_, _ = bw.Write(buf[:binary.PutUvarint(buf[:], uint64(len(rel)))])
+		_, _ = bw.WriteString(rel)
+		_, _ = bw.Write(buf[:binary.PutVarint(buf[:], ds.Size)])
+		_, _ = bw.Write(buf[:binary.PutVarint(buf[:], ds.Files)])
+		_, _ = bw.Write(buf[:binary.PutUvarint(buf[:], uint64(ds.UID))])
+		_, _ = bw.Write(buf[:binary.PutUvarint(buf[:], uint64(ds.GID))])
+		owner := byte(0)
+		if ds.HasOwner {
+			owner = 1
+		}
+		_ = bw.WriteByte(owner)
+	}
+	if err := bw.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.chunks = append(s.chunks, path)
+	return nil
+}
+
+// chunkReader reads the records of one chunk in order.
+type chunkReader struct {
+	br  *bufio.Reader
+	f   *os.File
+	rel string
+	ds  DirStat
+}
+
+// next loads the following record; it returns io.EOF after the last one.
+func (c *chunkReader) next() error {
+	n, err := binary.ReadUvarint(c.br)
+	if err != nil {
+		return err
+	}
+	rel := make([]byte, n)
+	if _, err := io.ReadFull(c.br, rel); err != nil {
+		return spillEOF(err)
+	}
+	var ds DirStat
+	if ds.Size, err = binary.ReadVarint(c.br); err != nil {
+		return spillEOF(err)
+	}
+	if ds.Files, err = binary.ReadVarint(c.br); err != nil {
+		return spillEOF(err)
+	}
+	uid, err := binary.ReadUvarint(c.br)
+	if err != nil {
+		return spillEOF(err)
+	}
+	gid, err := binary.ReadUvarint(c.br)
+	if err != nil {
+		return spillEOF(err)
+	}
+	owner, err := c.br.ReadByte()
+	if err != nil {
+		return spillEOF(err)
+	}
+	ds.UID, ds.GID, ds.HasOwner = uint32(uid), uint32(gid), owner == 1
+	c.rel, c.ds = string(rel), ds
+	return nil
+}
+
+// spillEOF reports a chunk that ends inside a record as corrupt.
+func spillEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// chunkHeap orders the chunk readers by their current record.
+type chunkHeap []*chunkReader
+
+func (h chunkHeap) Len() int           { return len(h) }
+func (h chunkHeap) Less(i, j int) bool { return spillLess(h[i].rel, h[j].rel) }
+func (h chunkHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *chunkHeap) Push(x any)        { *h = append(*h, x.(*chunkReader)) }
+func (h *chunkHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// each calls fn for every directory in the spill, in spillLess order, with the
+// sums of all its partial entries; only one entry per chunk is held in memory.
+func (s *dirSpill) each(fn func(rel string, ds DirStat) error) error {
+	h := make(chunkHeap, 0, len(s.chunks))
+	defer func() {
+		for _, c := range h {
+			_ = c.f.Close()
+		}
+	}()
+	for _, path := range s.chunks {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		c := &chunkReader{br: bufio.NewReader(f), f: f}
+		if err := c.next(); err != nil {
+			_ = f.Close()
+			if err == io.EOF {
+				continue
+			}
+			return fmt.Errorf("spill %s: %w", path, err)
+		}
+		h = append(h, c)
+	}
+	heap.Init(&h)
+	for h.Len() > 0 {
+		rel := h[0].rel
+		var sum DirStat
+		for h.Len() > 0 && h[0].rel == rel {
+			c := h[0]
+			sum.Size += c.ds.Size
+			sum.Files += c.ds.Files
+			if c.ds.HasOwner {
+				sum.UID, sum.GID, sum.HasOwner = c.ds.UID, c.ds.GID, true
+			}
+			switch err := c.next(); err {
+			case nil:
+				heap.Fix(&h, 0)
+			case io.EOF:
+				_ = c.f.Close()
+				heap.Pop(&h)
+			default:
+				return fmt.Errorf("spill %s: %w", c.f.Name(), err)
+			}
+		}
+		if err := fn(rel, sum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close removes the spill's chunk files.
+func (s *dirSpill) Close() error {
+	return os.RemoveAll(s.dir)
+}
+
+// relDepth is the number of path elements of rel ("." has depth 0).
+func relDepth(rel string) int {
+	if rel == "." {
+		return 0
+	}
+	return strings.Count(rel, "/") + 1
+}
+
+// finishSpill moves the rest of the in-memory aggregation to the spill and
+// reloads only the directories up to keepDepth (with their complete totals)
+// into r.DirStats, for the tree; the JSON export streams every directory from
+// the spill instead.
+func (r *Result) finishSpill(keepDepth int) error {
+	if err := r.spill.write(r.DirStats); err != nil {
+		return err
+	}
+	r.DirStats = make(map[string]*DirStat)
+	return r.spill.each(func(rel string, ds DirStat) error {
+		if relDepth(rel) <= keepDepth {
+			r.DirStats[rel] = &ds
+		}
+		return nil
+	})
+}
+
+// Close releases the on-disk spill of a -max-memory scan, if any.
+func (r *Result) Close() error {
+	if r.spill == nil {
+		return nil
+	}
+	return r.spill.Close()
+}
+
+// spilledDirs returns a dirStream yielding the JSON entry of every directory
+// of a spilled scan, with the options buildSummary and summaryFor apply to
+// in-memory directories.
+func spilledDirs(res *Result, opts SummaryOptions) func(yield func(JsonDir) error) error {
+	return func(yield func(JsonDir) error) error {
+		unames := make(map[uint32]string)
+		gnames := make(map[uint32]string)
+		return res.spill.each(func(rel string, ds DirStat) error {
+			if (opts.OmitEmpty && ds.Size == 0 && ds.Files == 0) || (opts.MaxDepth > 0 && relDepth(rel) > opts.MaxDepth) {
+				return nil
+			}
+			d := JsonDir{Path: res.Root, Rel: rel, Size: ds.Size, Files: ds.Files}
+			if rel != "." {
+				d.Path = filepath.Join(res.Root, rel)
+			}
+			if ds.HasOwner && !opts.SkipDirOwner {
+				d.UID, d.GID = ds.UID, ds.GID
+				if !opts.Numeric {
+					d.User, d.Group = dirOwnerNames(unames, gnames, ds.UID, ds.GID, opts.UnknownOwner)
+				}
+			}
+			if opts.AvgFileSize {
+				d.AvgFileSize, _ = avgFileSize(d.Size, d.Files)
+			}
+			if opts.NormalizePaths {
+				d.Path, d.Rel = normalizePath(d.Path), normalizePath(d.Rel)
+			}
+			return yield(d)
+		})
+	}
+}
+
+// streamDirs writes the dirs member from a dirStream, laid out like
+// streamArray does for a slice.
+func streamDirs(bw *bufio.Writer, stream func(yield func(JsonDir) error) error, last, compact bool) error {
+	_, _ = bw.WriteString("  \"dirs\": [")
+	n := 0
+	err := stream(func(d JsonDir) error {
+		b, err := marshalEntry(d, compact)
+		if err != nil {
+			return fmt.Errorf("marshal dirs entry: %w", err)
+		}
+		if n > 0 {
+			_ = bw.WriteByte(',')
+		}
+		_, _ = bw.WriteString("\n    ")
+		_, _ = bw.Write(b)
+		n++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		_, _ = bw.WriteString("\n  ")
+	}
+	_ = bw.WriteByte(']')
+	if !last {
+		_ = bw.WriteByte(',')
+	}
+	return bw.WriteByte('\n')
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestScanMaxMemorySpills(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 20; i++ {
+		writeFile(t, filepath.Join(root, "top"+strconv.Itoa(i%3), "mid"+strconv.Itoa(i%5), "leaf"+strconv.Itoa(i), "f"), 100+i)
+	}
+	writeFile(t, filepath.Join(root, "rootfile"), 7)
+	if err := os.MkdirAll(filepath.Join(root, "empty", "deeper"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ref := Scan(context.Background(), root, ScanOptions{Concurrency: 2})
+
+	// a tiny cap checked after every file spills constantly
+	oldEvery := spillCheckEvery
+	spillCheckEvery = 1
+	t.Cleanup(func() { spillCheckEvery = oldEvery })
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, MaxMemory: 1, KeepDepth: 1})
+	if res.spill == nil || len(res.spill.chunks) < 2 {
+		t.Fatalf("expected several spill chunks, got %+v", res.spill)
+	}
+	spillDir := res.spill.dir
+	t.Cleanup(func() { _ = res.Close() })
+
+	// only the shallow directories stay in memory, with complete totals
+	for rel, ds := range res.DirStats {
+		if relDepth(rel) > 1 {
+			t.Fatalf("directory %q deeper than KeepDepth kept in memory", rel)
+		}
+		if *ds != *ref.DirStats[rel] {
+			t.Fatalf("dirStats[%q] = %+v, want %+v", rel, ds, ref.DirStats[rel])
+		}
+	}
+	if len(res.DirStats) != 5 { // ".", top0-2, empty
+		t.Fatalf("kept %d directories, want 5: %v", len(res.DirStats), res.DirStats)
+	}
+	if res.FilesScanned != ref.FilesScanned || !reflect.DeepEqual(res.UserStats, ref.UserStats) {
+		t.Fatalf("counters differ from the in-memory scan")
+	}
+
+	// the JSON export streams every directory from the spill
+	decode := func(r *Result, opts SummaryOptions) JsonOut {
+		var buf bytes.Buffer
+		if err := StreamSummary(&buf, r, opts); err != nil {
+			t.Fatalf("StreamSummary: %v", err)
+		}
+		var jo JsonOut
+		if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+			t.Fatalf("unmarshal: %v\n%s", err, buf.String())
+		}
+		return jo
+	}
+	for _, opts := range []SummaryOptions{{}, {OmitEmpty: true}, {Numeric: true}} {
+		got, want := decode(res, opts), decode(ref, opts)
+		if !reflect.DeepEqual(got.Dirs, want.Dirs) {
+			t.Fatalf("%+v: spilled dirs differ:\n%+v\nwant\n%+v", opts, got.Dirs, want.Dirs)
+		}
+	}
+
+	if err := res.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(spillDir); !os.IsNotExist(err) {
+		t.Fatalf("spill directory should be removed, stat: %v", err)
+	}
+}
+
+func TestScanMaxMemoryNotReached(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", "b", "f"), 10)
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 1, MaxMemory: 1 << 50, KeepDepth: 0})
+	if res.spill != nil {
+		t.Fatal("no spill expected below the cap")
+	}
+	if _, ok := res.DirStats["a/b"]; !ok {
+		t.Fatal("without a spill every directory stays in memory")
+	}
+}
+
+func TestSpillRemovedAfterFailedWrite(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 10; i++ {
+		writeFile(t, filepath.Join(root, "d"+strconv.Itoa(i), "f"), 100)
+	}
+	oldEvery := spillCheckEvery
+	spillCheckEvery = 1
+	t.Cleanup(func() { spillCheckEvery = oldEvery })
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, MaxMemory: 1, KeepDepth: 1})
+	if res.spill == nil {
+		t.Fatal("expected a spill")
+	}
+	spillDir := res.spill.dir
+	t.Cleanup(func() { _ = os.RemoveAll(spillDir) })
+	onExit(func() { _ = res.Close() })
+	t.Cleanup(runAtExit)
+
+	// stop the fatal path where it would end the process
+	type exited struct{ code int }
+	oldExit := exit
+	exit = func(code int) { panic(exited{code}) }
+	t.Cleanup(func() { exit = oldExit })
+
+	code := -1
+	func() {
+		defer func() {
+			e, ok := recover().(exited)
+			if !ok {
+				t.Fatalf("write did not fail fatally")
+			}
+			code = e.code
+		}()
+		// the output's directory does not exist and -on-write-error=fatal
+		path := filepath.Join(t.TempDir(), "missing", "out.json")
+		writeOutputFile(path, "json", onWriteErrorFatal, func(w io.Writer) error {
+			return StreamSummary(w, res, SummaryOptions{})
+		})
+	}()
+	if code != 1 {
+		t.Fatalf("exit code = %d, want 1", code)
+	}
+	if _, err := os.Stat(spillDir); !os.IsNotExist(err) {
+		t.Fatalf("spill directory left behind after a failed write, stat: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// FSUsage holds the capacity figures of the filesystem backing a path, in bytes.
+// Free is the space available to unprivileged users (like df's "Avail"), so
+// Used+Free can be less than Total when blocks are reserved for root.
+type FSUsage struct {
+	Total uint64
+	Free  uint64
+	Used  uint64
+}
+
+// statfser reports filesystem usage for a path; it exists so tests can stub statfs.
+type statfser interface {
+	Statfs(path string) (FSUsage, error)
+}
+
+// sysStatfs implements statfser with syscall.Statfs.
+type sysStatfs struct{}
+
+func (sysStatfs) Statfs(path string) (FSUsage, error) {
+	var s syscall.Statfs_t
+	if err := syscall.Statfs(path, &s); err != nil {
+		return FSUsage{}, err
+	}
+	bsize := uint64(s.Bsize)
+	return FSUsage{
+		Total: s.Blocks * bsize,
+		Free:  s.Bavail * bsize,
+		Used:  (s.Blocks - s.Bfree) * bsize,
+	}, nil
+}
+
+// dfDiscrepancyRatio is the relative difference between the scanned total and
+// the filesystem's used bytes above which -df-check flags a discrepancy.
+const dfDiscrepancyRatio = 0.10
+
+// dfCheckReport compares the scanned total with the filesystem's used bytes and
+// returns the lines to print; the second result reports whether the difference
+// exceeds dfDiscrepancyRatio.
+func dfCheckReport(u FSUsage, scanned int64) ([]string, bool) {
+	lines := []string{
+		fmt.Sprintf("Filesystem: %s total, %s used, %s free", humanizeBytes(int64(u.Total)), humanizeBytes(int64(u.Used)), humanizeBytes(int64(u.Free))),
+		fmt.Sprintf("Scanned:    %s", humanizeBytes(scanned)),
+	}
+	if u.Used == 0 {
+		return lines, false
+	}
+	diff := int64(u.Used) - scanned
+	ratio := float64(diff) / float64(u.Used)
+	if ratio < 0 {
+		ratio = -ratio
+	}
+	if ratio <= dfDiscrepancyRatio {
+		return lines, false
+	}
+	direction := "less"
+	if diff < 0 {
+		direction = "more"
+		diff = -diff
+	}
+	lines = append(lines,
+		fmt.Sprintf("Discrepancy: scanned %s %s than the filesystem reports as used (%.1f%%).", humanizeBytes(diff), direction, ratio*100),
+		"  Common causes: the root is not the mount point or other data shares the filesystem,",
+		"  hard links counted once per path, sparse files (apparent size vs allocated blocks),",
+		"  and directories skipped because they could not be read.",
+	)
+	return lines, true
+}
+
+// capacityLine puts the scanned total in the context of the filesystem's size
+// for -show-free, e.g. "Scanned 12.0GB (12.0%) of 100.0GB total (40.0GB free)".
+func capacityLine(u FSUsage, scanned int64) string {
+	pct := 0.0
+	if u.Total > 0 {
+		pct = float64(scanned) / float64(u.Total) * 100
+	}
+	return fmt.Sprintf("Scanned %s (%.1f%%) of %s total (%s free)", humanizeBytes(scanned), pct, humanizeBytes(int64(u.Total)), humanizeBytes(int64(u.Free)))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type stubStatfs struct{ u FSUsage }
+
+func (s stubStatfs) Statfs(string) (FSUsage, error) { return s.u, nil }
+
+func TestDFCheckReport(t *testing.T) {
+	var fs statfser = stubStatfs{u: FSUsage{Total: 100 << 30, Free: 40 << 30, Used: 50 << 30}}
+	u, err := fs.Statfs("/x")
+	if err != nil {
+		t.Fatalf("stub statfs: %v", err)
+	}
+
+	// within tolerance: no discrepancy flagged
+	lines, flagged := dfCheckReport(u, 48<<30)
+	if flagged {
+		t.Fatalf("unexpected discrepancy: %v", lines)
+	}
+	if !strings.Contains(lines[0], "100.0GB total") || !strings.Contains(lines[0], "50.0GB used") || !strings.Contains(lines[0], "40.0GB free") {
+		t.Fatalf("unexpected filesystem line: %q", lines[0])
+	}
+
+	// scanned far less than used
+	lines, flagged = dfCheckReport(u, 20<<30)
+	if !flagged {
+		t.Fatalf("expected discrepancy to be flagged")
+	}
+	if !strings.Contains(lines[2], "30.0GB less") || !strings.Contains(lines[2], "60.0%") {
+		t.Fatalf("unexpected discrepancy line: %q", lines[2])
+	}
+
+	// scanned more than used (e.g. hard links counted per path)
+	lines, flagged = dfCheckReport(u, 80<<30)
+	if !flagged || !strings.Contains(lines[2], "30.0GB more") {
+		t.Fatalf("expected 'more' discrepancy, got %v", lines)
+	}
+}
+
+func TestSysStatfs(t *testing.T) {
+	u, err := (sysStatfs{}).Statfs(t.TempDir())
+	if err != nil {
+		t.Skipf("statfs unavailable: %v", err)
+	}
+	if u.Total == 0 || u.Used > u.Total {
+		t.Fatalf("implausible statfs figures: %+v", u)
+	}
+	if _, err := (sysStatfs{}).Statfs("/nonexistent/path/for/statfs"); err == nil {
+		t.Fatalf("expected error for missing path")
+	}
+}
+
+func TestShowFreeCapacity(t *testing.T) {
+	var fs statfser = stubStatfs{u: FSUsage{Total: 100 << 30, Free: 40 << 30, Used: 55 << 30}}
+	u, err := fs.Statfs("/x")
+	if err != nil {
+		t.Fatalf("stub statfs: %v", err)
+	}
+	if got, want := capacityLine(u, 12<<30), "Scanned 12.0GB (12.0%) of 100.0GB total (40.0GB free)"; got != want {
+		t.Fatalf("capacityLine = %q, want %q", got, want)
+	}
+	if got := capacityLine(FSUsage{}, 10); !strings.Contains(got, "(0.0%)") {
+		t.Fatalf("zero-sized filesystem should report 0%%, got %q", got)
+	}
+
+	res := &Result{
+		Root:       "/x",
+		DirStats:   map[string]*DirStat{".": {Size: 25 << 30, Files: 1}},
+		UserStats:  map[string]*UserStat{},
+		GroupStats: map[string]*GroupStat{},
+		DirOwners:  map[string]string{},
+		FS:         &u,
+	}
+	var out bytes.Buffer
+	if err := (TreeFormatter{Opts: TreeOptions{ShowFree: true}}).Write(&out, res); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if !strings.Contains(out.String(), "Scanned 25.0GB (25.0%) of 100.0GB total (40.0GB free)") {
+		t.Fatalf("missing capacity line:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "Filesystem:") {
+		t.Fatalf("-show-free alone should not print the df-check report:\n%s", out.String())
+	}
+
+	jo := summaryFor(res, SummaryOptions{})
+	if jo.Stats.FSTotalBytes != 100<<30 || jo.Stats.FSFreeBytes != 40<<30 || jo.Stats.FSUsedBytes != 55<<30 {
+		t.Fatalf("unexpected fs stats: %+v", jo.Stats)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// lstat is the stat call used by the scan workers; tests replace it to
+// simulate transient failures.
+var lstat = os.Lstat
+
+// statRetryBackoff is the pause before the first retry; it doubles with each
+// further attempt.
+var statRetryBackoff = time.Millisecond
+
+// retryableStatErr reports whether a stat failure may be transient and worth
+// retrying: an interrupted call (EINTR), a temporarily unavailable resource
+// (EAGAIN) or a stale NFS file handle (ESTALE).
+func retryableStatErr(err error) bool {
+	return errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.ESTALE)
+}
+
+// lstatRetry stats path, retrying up to retries more times with a short,
+// doubling backoff while the error is retryable. It returns the last error
+// when every attempt failed.
+func lstatRetry(path string, retries int) (os.FileInfo, error) {
+	backoff := statRetryBackoff
+	for attempt := 0; ; attempt++ {
+		info, err := lstat(path)
+		if err == nil || attempt >= retries || !retryableStatErr(err) {
+			return info, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
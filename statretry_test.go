@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestRetryableStatErr(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&fs.PathError{Op: "lstat", Path: "/x", Err: syscall.EINTR}, true},
+		{&fs.PathError{Op: "lstat", Path: "/x", Err: syscall.EAGAIN}, true},
+		{&fs.PathError{Op: "lstat", Path: "/x", Err: syscall.ESTALE}, true},
+		{fmt.Errorf("wrapped: %w", syscall.ESTALE), true},
+		{&fs.PathError{Op: "lstat", Path: "/x", Err: syscall.ENOENT}, false},
+		{&fs.PathError{Op: "lstat", Path: "/x", Err: syscall.EACCES}, false},
+	} {
+		if got := retryableStatErr(tc.err); got != tc.want {
+			t.Errorf("retryableStatErr(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+// stubLstat makes the first failures[path] stats of path fail with errno.
+func stubLstat(t *testing.T, failures map[string]int, errno syscall.Errno) *map[string]int {
+	t.Helper()
+	oldLstat, oldBackoff := lstat, statRetryBackoff
+	statRetryBackoff = 0
+	var mu sync.Mutex
+	calls := map[string]int{}
+	lstat = func(path string) (os.FileInfo, error) {
+		mu.Lock()
+		calls[path]++
+		n := calls[path]
+		mu.Unlock()
+		if n <= failures[path] {
+			return nil, &fs.PathError{Op: "lstat", Path: path, Err: errno}
+		}
+		return os.Lstat(path)
+	}
+	t.Cleanup(func() { lstat, statRetryBackoff = oldLstat, oldBackoff })
+	return &calls
+}
+
+func TestLstatRetry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f")
+	writeFile(t, path, 10)
+
+	calls := stubLstat(t, map[string]int{path: 2}, syscall.ESTALE)
+	info, err := lstatRetry(path, 3)
+	if err != nil || info.Size() != 10 || (*calls)[path] != 3 {
+		t.Fatalf("lstatRetry = %v, %v after %d calls; want success on the 3rd", info, err, (*calls)[path])
+	}
+
+	calls = stubLstat(t, map[string]int{path: 5}, syscall.EINTR)
+	if _, err := lstatRetry(path, 2); !retryableStatErr(err) || (*calls)[path] != 3 {
+		t.Fatalf("lstatRetry = %v after %d calls; want the EINTR after 3 attempts", err, (*calls)[path])
+	}
+
+	calls = stubLstat(t, map[string]int{path: 1}, syscall.EACCES)
+	if _, err := lstatRetry(path, 3); err == nil || (*calls)[path] != 1 {
+		t.Fatalf("permanent error retried: %v after %d calls", err, (*calls)[path])
+	}
+}
+
+func TestScanStatRetries(t *testing.T) {
+	root := t.TempDir()
+	flaky := filepath.Join(root, "nfs", "flaky")
+	gone := filepath.Join(root, "nfs", "gone")
+	writeFile(t, flaky, 100)
+	writeFile(t, gone, 50)
+	writeFile(t, filepath.Join(root, "ok"), 1)
+	stubLstat(t, map[string]int{flaky: 2, gone: 100}, syscall.ESTALE)
+
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, StatRetries: 3})
+	if got := res.DirStats["."]; got.Size != 101 || got.Files != 2 {
+		t.Fatalf("root = %+v, want the flaky file recovered and the gone one skipped", got)
+	}
+	if res.FilesScanned != 2 || res.StatFailedFiles != 1 {
+		t.Fatalf("scanned %d, stat-failed %d; want 2 and 1", res.FilesScanned, res.StatFailedFiles)
+	}
+	if jo := summaryFor(res, SummaryOptions{}); jo.Stats.StatFailedFiles != 1 {
+		t.Fatalf("stat_failed_files = %d, want 1", jo.Stats.StatFailedFiles)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket shared by the scan workers to cap how many
+// files per second are statted (-throttle). The bucket holds at most one
+// second's worth of tokens, so short bursts are allowed but the long-run rate
+// never exceeds the configured one. It is safe for concurrent use.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter allowing perSec events per second.
+func NewRateLimiter(perSec float64) *RateLimiter {
+	burst := perSec
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{rate: perSec, burst: burst, tokens: 1, last: time.Now()}
+}
+
+// Wait blocks until the caller may proceed.
+func (l *RateLimiter) Wait() {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	// take a token, going into debt if none is available; the debt is paid by sleeping
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterCapsThroughput(t *testing.T) {
+	const rate = 200.0
+	const n = 60
+	l := NewRateLimiter(rate)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n/4; i++ {
+				l.Wait()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// the first token is free, the remaining n-1 are paced at rate/sec
+	minElapsed := time.Duration(float64(n-1) / rate * float64(time.Second))
+	if elapsed < minElapsed*8/10 {
+		t.Fatalf("%d waits at %v/s finished in %v; expected at least ~%v", n, rate, elapsed, minElapsed)
+	}
+	if elapsed > 5*minElapsed {
+		t.Fatalf("%d waits at %v/s took %v; far slower than expected", n, rate, elapsed)
+	}
+}
+
+func TestScanThrottleRecordedInJSON(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 5; i++ {
+		writeFile(t, filepath.Join(root, strconv.Itoa(i)), 1)
+	}
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, Throttle: 50})
+	if elapsed := res.EndedAt.Sub(res.StartedAt); elapsed < 60*time.Millisecond {
+		t.Fatalf("5 files at 50/s finished in %v; throttle not applied", elapsed)
+	}
+
+	var buf bytes.Buffer
+	if err := StreamSummary(&buf, res, SummaryOptions{}); err != nil {
+		t.Fatalf("StreamSummary: %v", err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if jo.Stats.ThrottleFilesPerSec != 50 {
+		t.Fatalf("throttle_files_per_sec = %v; want 50", jo.Stats.ThrottleFilesPerSec)
+	}
+	if r := jo.Stats.EffectiveFilesPerSec; r <= 0 || r > 100 {
+		t.Fatalf("effective_files_per_sec = %v; expected (0, 100] (first file is not delayed)", r)
+	}
+}
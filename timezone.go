@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// parseTimezone resolves a -timezone value: "local" (the host's zone),
+// "utc", or an IANA name such as "Europe/Copenhagen".
+func parseTimezone(s string) (*time.Location, error) {
+	switch strings.ToLower(s) {
+	case "", "local":
+		return time.Local, nil
+	case "utc":
+		return time.UTC, nil
+	}
+	return time.LoadLocation(s)
+}
+
+// inZone returns t in loc for display; a nil loc leaves t as it is.
+func inZone(t time.Time, loc *time.Location) time.Time {
+	if loc == nil {
+		return t
+	}
+	return t.In(loc)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimezoneFormatsStatsAndFiles(t *testing.T) {
+	kolkata, err := parseTimezone("Asia/Kolkata")
+	if err != nil {
+		t.Skipf("no zoneinfo: %v", err)
+	}
+	utc, err := parseTimezone("UTC")
+	if err != nil || utc != time.UTC {
+		t.Fatalf("parseTimezone(UTC) = %v, %v", utc, err)
+	}
+	if loc, err := parseTimezone("local"); err != nil || loc != time.Local {
+		t.Fatalf("parseTimezone(local) = %v, %v", loc, err)
+	}
+	if _, err := parseTimezone("Nowhere/Special"); err == nil {
+		t.Fatal("unknown zone should fail")
+	}
+
+	instant := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	res := newTestResult()
+	res.DirStats["."] = &DirStat{}
+	res.StartedAt, res.EndedAt = instant, instant.Add(time.Minute)
+	res.Newest = NewTopFiles(1, newestFirst)
+	res.Newest.Add(FileEntry{Path: "f", Size: 1, ModTime: instant})
+
+	for _, tc := range []struct {
+		loc                       *time.Location
+		started, ended, f, offset string
+	}{
+		{utc, "2026-03-01T12:00:00Z", "2026-03-01T12:01:00Z", "2026-03-01T12:00:00Z", "Z"},
+		{kolkata, "2026-03-01T17:30:00+05:30", "2026-03-01T17:31:00+05:30", "2026-03-01T17:30:00+05:30", "+05:30"},
+	} {
+		var buf bytes.Buffer
+		if err := StreamSummary(&buf, res, SummaryOptions{Location: tc.loc}); err != nil {
+			t.Fatal(err)
+		}
+		var jo JsonOut
+		if err := json.Unmarshal(buf.Bytes(), &jo); err != nil {
+			t.Fatal(err)
+		}
+		if jo.Stats.StartedAt != tc.started || jo.Stats.EndedAt != tc.ended || len(jo.Newest) != 1 || jo.Newest[0].MTime != tc.f {
+			t.Fatalf("%s: started %s, ended %s, newest %+v; want %s, %s, %s", tc.loc, jo.Stats.StartedAt, jo.Stats.EndedAt, jo.Newest, tc.started, tc.ended, tc.f)
+		}
+		if jo.Stats.LastGC != "" && !strings.HasSuffix(jo.Stats.LastGC, tc.offset) {
+			t.Fatalf("%s: last_gc %s not in the zone", tc.loc, jo.Stats.LastGC)
+		}
+	}
+
+	// the tree's file listings follow the same zone
+	var out bytes.Buffer
+	printTopFiles(&out, "Newest files", res.Newest.Sorted(), FormatOptions{Location: kolkata})
+	if !strings.Contains(out.String(), "2026-03-01 17:30:00") {
+		t.Fatalf("listing not in Asia/Kolkata:\n%s", out.String())
+	}
+}
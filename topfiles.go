@@ -0,0 +1,96 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// FileEntry is one file kept by a TopFiles ranking; Path is relative to the root.
+type FileEntry struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// TopFiles keeps the n highest-ranked files out of an arbitrarily long stream
+// in a bounded min-heap: the lowest-ranked kept entry sits at the top and is
+// evicted when a better one arrives, so memory stays bounded by n. It is not
+// safe for concurrent use.
+type TopFiles struct {
+	n int
+	h fileHeap
+}
+
+// NewTopFiles returns a ranking of capacity n; better reports whether a ranks above b.
+func NewTopFiles(n int, better func(a, b FileEntry) bool) *TopFiles {
+	return &TopFiles{n: n, h: fileHeap{items: make([]FileEntry, 0, n), better: better}}
+}
+
+// newestFirst ranks files by modification time, most recent first (ties by path).
+func newestFirst(a, b FileEntry) bool {
+	if a.ModTime.Equal(b.ModTime) {
+		return a.Path < b.Path
+	}
+	return a.ModTime.After(b.ModTime)
+}
+
+// oldestFirst ranks files by modification time, stalest first (ties by path).
+func oldestFirst(a, b FileEntry) bool {
+	if a.ModTime.Equal(b.ModTime) {
+		return a.Path < b.Path
+	}
+	return a.ModTime.Before(b.ModTime)
+}
+
+// Add offers e to the ranking.
+func (t *TopFiles) Add(e FileEntry) {
+	if t.n <= 0 {
+		return
+	}
+	if len(t.h.items) < t.n {
+		heap.Push(&t.h, e)
+		return
+	}
+	if t.h.better(e, t.h.items[0]) {
+		t.h.items[0] = e
+		heap.Fix(&t.h, 0)
+	}
+}
+
+// Len returns how many entries are kept (at most n).
+func (t *TopFiles) Len() int { return len(t.h.items) }
+
+// Sorted returns the kept entries, best first.
+func (t *TopFiles) Sorted() []FileEntry {
+	out := append([]FileEntry(nil), t.h.items...)
+	sort.Slice(out, func(i, j int) bool { return t.h.better(out[i], out[j]) })
+	return out
+}
+
+// fileHeap implements heap.Interface with the worst kept entry at index 0.
+type fileHeap struct {
+	items  []FileEntry
+	better func(a, b FileEntry) bool
+}
+
+func (h fileHeap) Len() int           { return len(h.items) }
+func (h fileHeap) Less(i, j int) bool { return h.better(h.items[j], h.items[i]) }
+func (h fileHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *fileHeap) Push(x any)        { h.items = append(h.items, x.(FileEntry)) }
+func (h *fileHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+// printTopFiles writes a titled listing of files with their modification time and size.
+func printTopFiles(w io.Writer, title string, files []FileEntry, fo FormatOptions) {
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintf(w, "%s:\n", title)
+	for _, f := range files {
+		_, _ = fmt.Fprintf(w, "%s %10s  %s\n", fo.localTime(f.ModTime).Format("2006-01-02 15:04:05"), fo.size(f.Size), fo.path(f.Path))
+	}
+}
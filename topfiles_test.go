@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTopFilesKeepsNByMTime(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newest := NewTopFiles(3, newestFirst)
+	oldest := NewTopFiles(3, oldestFirst)
+	// offer days in a scrambled order
+	for _, day := range []int{5, 1, 9, 3, 7, 2, 8, 6, 4} {
+		e := FileEntry{Path: "f" + string(rune('0'+day)), ModTime: base.AddDate(0, 0, day)}
+		newest.Add(e)
+		oldest.Add(e)
+	}
+	if newest.Len() != 3 || oldest.Len() != 3 {
+		t.Fatalf("expected 3 entries each, got %d and %d", newest.Len(), oldest.Len())
+	}
+	check := func(name string, got []FileEntry, want ...string) {
+		t.Helper()
+		var paths []string
+		for _, e := range got {
+			paths = append(paths, e.Path)
+		}
+		if strings.Join(paths, ",") != strings.Join(want, ",") {
+			t.Fatalf("%s = %v, want %v", name, paths, want)
+		}
+	}
+	check("newest", newest.Sorted(), "f9", "f8", "f7")
+	check("oldest", oldest.Sorted(), "f1", "f2", "f3")
+}
+
+func TestScanNewestOldestFiles(t *testing.T) {
+	root := t.TempDir()
+	base := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	for i, name := range []string{"a/old", "b/mid", "new", "a/older"} {
+		p := filepath.Join(root, name)
+		writeFile(t, p, i+1)
+		mt := base.Add(time.Duration([]int{-2, 0, 5, -3}[i]) * time.Hour)
+		if err := os.Chtimes(p, mt, mt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res := Scan(context.Background(), root, ScanOptions{Concurrency: 2, NewestFiles: 2, OldestFiles: 1})
+	if got := res.Newest.Sorted(); len(got) != 2 || got[0].Path != "new" || got[1].Path != filepath.Join("b", "mid") {
+		t.Fatalf("unexpected newest: %+v", got)
+	}
+	if got := res.Oldest.Sorted(); len(got) != 1 || got[0].Path != filepath.Join("a", "older") || got[0].Size != 4 {
+		t.Fatalf("unexpected oldest: %+v", got)
+	}
+
+	var out bytes.Buffer
+	if err := (TreeFormatter{Opts: TreeOptions{Format: FormatOptions{Bytes: true}}}).Write(&out, res); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Newest files:") || !strings.Contains(out.String(), "Oldest files:") {
+		t.Fatalf("missing listings:\n%s", out.String())
+	}
+
+	// JSON carries the listings and -read-json restores them
+	out.Reset()
+	if err := StreamSummary(&out, res, SummaryOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var jo JsonOut
+	if err := json.Unmarshal(out.Bytes(), &jo); err != nil {
+		t.Fatalf("unmarshal: %v\n%s", err, out.String())
+	}
+	if len(jo.Newest) != 2 || len(jo.Oldest) != 1 || jo.Newest[0].MTime != base.Add(5*time.Hour).Format(time.RFC3339) {
+		t.Fatalf("unexpected json listings: %+v %+v", jo.Newest, jo.Oldest)
+	}
+	if loaded := resultFromSummary(jo); loaded.Newest.Len() != 2 || loaded.Oldest.Sorted()[0].Path != jo.Oldest[0].Path {
+		t.Fatalf("listings lost on reload")
+	}
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+)
+
+// TreeOptions controls the human-readable tree and summary rendering.
+type TreeOptions struct {
+	Levels     int // number of directory levels to display (0 = only root)
+	ShowFiles  bool
+	ShowUser   bool
+	ShowGroup  bool
+	Format     FormatOptions
+	SizeWidth  int // size column width override (0 = auto-fit)
+	FilesWidth int // files column width override (0 = auto-fit)
+	// SizeWidthMax/FilesWidthMax cap the auto-fit widths (0 = no cap); wider
+	// values are ellipsized. Explicit widths take precedence.
+	SizeWidthMax  int
+	FilesWidthMax int
+	TopN          int // limit per-user/group summaries to top N (0 = all)
+	// MinUserSize/MinGroupSize leave the users/groups holding fewer bytes
+	// out of the summaries (0 = off); TopN ranks the rest.
+	MinUserSize  int64
+	MinGroupSize int64
+	// TopChildren limits each directory to its N largest children; the rest
+	// are summed into one "(others)" line (0 = all).
+	TopChildren int
+	// RootLabel, when set, replaces the root path on the tree's first line.
+	RootLabel string
+	// NormalizePaths displays path names in Unicode NFC.
+	NormalizePaths bool
+	// DominantOwner shows, in the user column, the user holding the most bytes
+	// below each directory (from res.DirUsers) instead of the directory's owner.
+	DominantOwner bool
+	// WarnOver/CriticalOver mark directories whose size exceeds them (0 = off):
+	// in color with Color, otherwise with a "*" (warn) or "!" (critical) in
+	// front of the path.
+	WarnOver     int64
+	CriticalOver int64
+	Color        bool
+	// ColorScheme colors every directory name green, yellow or red by its
+	// size ("magnitude"), its percent of the parent ("percent") or the age of
+	// its newest file ("age", from res.DirNewest), against ColorThresholds
+	// (see colorCode); "" = off.
+	ColorScheme     string
+	ColorThresholds [2]float64
+	// DFCheck and ShowFree select which res.FS report follows the summaries:
+	// the -df-check comparison and/or the -show-free capacity line.
+	DFCheck  bool
+	ShowFree bool
+	// ShowAvg adds an average file size (Size/Files) column after Files.
+	ShowAvg bool
+	// Width, when > 0, shortens directory names in the middle so that tree
+	// lines fit in that many columns (-width); the other columns are kept.
+	Width int
+	// Concentration follows the per-user summary with the share of bytes
+	// held by the top users and their Gini coefficient.
+	Concentration bool
+	// DirCount adds the number of directories owned to the per-user and
+	// per-group summaries.
+	DirCount bool
+	// Parents lists the full paths of the N largest leaf directories after the
+	// tree (0 = off).
+	Parents int
+	// Sort orders each directory's children and the per-user and per-group
+	// summaries: sortSize (or ""), sortName or sortNatural (-sort).
+	// -top-children and -top still keep the largest.
+	Sort string
+	// CollapseChains prints a directory holding nothing but one subdirectory
+	// on the line of that subdirectory, as "a/b/c" (-collapse-chains).
+	CollapseChains bool
+}
+
+// minNameWidth is the fewest characters a name is cut to for Width, however
+// deep the tree; such lines overflow instead of losing the name entirely.
+const minNameWidth = 8
+
+const (
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+	ansiRed    = "\033[31m"
+	ansiReset  = "\033[0m"
+)
+
+// treeConnectors are the line-drawing pieces of the tree's path column.
+type treeConnectors struct {
+	tee, last, pipe string
+}
+
+var (
+	utf8Connectors  = treeConnectors{tee: "├── ", last: "└── ", pipe: "│   "}
+	asciiConnectors = treeConnectors{tee: "|-- ", last: "`-- ", pipe: "|   "}
+)
+
+// markPath builds the path column entry from the tree connectors in prefix and
+// the name of a directory of the given size, according to WarnOver/CriticalOver.
+// Color highlights only the name; in plain mode every entry gets a two-character
+// marker column (blank when under both thresholds) so the tree stays aligned.
+func (o TreeOptions) markPath(prefix, name string, size int64) string {
+	if o.WarnOver <= 0 && o.CriticalOver <= 0 {
+		return prefix + name
+	}
+	level := 0
+	switch {
+	case o.CriticalOver > 0 && size > o.CriticalOver:
+		level = 2
+	case o.WarnOver > 0 && size > o.WarnOver:
+		level = 1
+	}
+	if o.Color {
+		switch level {
+		case 2:
+			return prefix + ansiRed + name + ansiReset
+		case 1:
+			return prefix + ansiYellow + name + ansiReset
+		}
+		return prefix + name
+	}
+	return [...]string{"  ", "* ", "! "}[level] + prefix + name
+}
+
+// printTree renders the directory tree and per-user/group summaries of res to w.
+// Directory owners come from res.DirOwners/DirGroups when the result was loaded
+// from JSON, and are looked up on disk otherwise.
+func printTree(w io.Writer, res *Result, opts TreeOptions) {
+	dirStats := res.DirStats
+	userStats := res.UserStats
+	groupStats := res.GroupStats
+	rootAbs := res.Root
+	fo := opts.Format
+	readMode := res.DirOwners != nil || res.DirGroups != nil
+	conn := utf8Connectors
+	if fo.ASCII {
+		conn = asciiConnectors
+	}
+
+	if _, ok := dirStats["."]; !ok {
+		dirStats["."] = &DirStat{}
+	}
+
+	children, dirSizes := buildChildrenAndSizes(dirStats)
+	fo = fo.fixUnit(largestSize(dirSizes, userStats, groupStats))
+	sizeStrMap, userSizeStr, groupSizeStr, maxSizeWidth, maxFilesWidth := ComputeSizeMapsAndWidths(dirSizes, dirStats, userStats, groupStats, fo, opts.SizeWidth, opts.FilesWidth, opts.SizeWidthMax, opts.FilesWidthMax)
+	// file counts are formatted per line; cut them to a capped column too
+	formatFiles := fo.files
+	if opts.FilesWidthMax > 0 && opts.FilesWidth <= 0 {
+		formatFiles = func(n int64) string { return ellipsize(fo.files(n), maxFilesWidth) }
+	}
+
+	sortChildren(children, dirSizes, opts.Sort)
+
+	// the average column fits the widest average of any directory
+	avgWidth := len("Avg")
+	if opts.ShowAvg {
+		for _, ds := range dirStats {
+			avgWidth = max(avgWidth, len(fo.avg(ds.Size, ds.Files)))
+		}
+	}
+
+	// printing header
+	headerCols := []interface{}{}
+	headerFmt := fmt.Sprintf("%%%ds", maxSizeWidth)
+	headerCols = append(headerCols, fo.sizeLabel())
+	if opts.ShowFiles {
+		headerFmt += " %" + strconv.Itoa(maxFilesWidth) + "s"
+		headerCols = append(headerCols, "Files")
+	}
+	if opts.ShowAvg {
+		headerFmt += " %" + strconv.Itoa(avgWidth) + "s"
+		headerCols = append(headerCols, "Avg")
+	}
+	if opts.ShowUser {
+		headerFmt += " %s"
+		headerCols = append(headerCols, padDisplay("User", ownerColumnWidth))
+	}
+	if opts.ShowGroup {
+		headerFmt += " %s"
+		headerCols = append(headerCols, padDisplay("Group", ownerColumnWidth))
+	}
+	headerFmt += " %s\n"
+	headerCols = append(headerCols, opts.markPath("", "Path", -1))
+	_, _ = fmt.Fprintf(w, headerFmt, headerCols...)
+
+	// with a Width, names are cut in the middle so every row fits
+	ellipsis := "…"
+	if fo.ASCII {
+		ellipsis = "..."
+	}
+	markerWidth := 0
+	if (opts.WarnOver > 0 || opts.CriticalOver > 0) && !opts.Color {
+		markerWidth = 2
+	}
+
+	printRow := func(sizeStr, filesStr, avgStr, userStr, groupStr, lead, name, rel string, size int64) {
+		fmtStr := fmt.Sprintf("%%%ds", maxSizeWidth)
+		args := []interface{}{sizeStr}
+		if opts.ShowFiles {
+			fmtStr += " %" + strconv.Itoa(maxFilesWidth) + "s"
+			args = append(args, filesStr)
+		}
+		if opts.ShowAvg {
+			fmtStr += " %" + strconv.Itoa(avgWidth) + "s"
+			args = append(args, avgStr)
+		}
+		if opts.ShowUser {
+			fmtStr += " %s"
+			args = append(args, padDisplay(userStr, ownerColumnWidth))
+		}
+		if opts.ShowGroup {
+			fmtStr += " %s"
+			args = append(args, padDisplay(groupStr, ownerColumnWidth))
+		}
+		cols := fmt.Sprintf(fmtStr, args...)
+		if opts.Width > 0 {
+			avail := opts.Width - displayWidth(cols) - 1 - markerWidth - utf8.RuneCountInString(lead)
+			name = ellipsizeMiddle(name, max(avail, minNameWidth), ellipsis)
+		}
+		path := opts.markPath(lead, name, size)
+		// the "(others)" line has no directory of its own
+		if v, ok := opts.schemeValue(res, dirSizes, rel, size); ok && rel != "" {
+			path = lead + colorCode(v, opts.ColorThresholds) + name + ansiReset
+		}
+		_, _ = fmt.Fprintf(w, "%s %s\n", cols, path)
+	}
+
+	// onlyChild returns the single subdirectory of rel when rel holds no
+	// files of its own, so its totals are those of that subdirectory
+	onlyChild := func(rel string) (string, bool) {
+		kids := children[rel]
+		if len(kids) != 1 {
+			return "", false
+		}
+		ds, cs := dirStats[rel], dirStats[kids[0]]
+		if ds == nil || cs == nil || ds.Files != cs.Files || dirSizes[rel] != dirSizes[kids[0]] {
+			return "", false
+		}
+		return kids[0], true
+	}
+
+	var printDirRec func(pathRel string, curLevel int, prefix string, isLast bool)
+	printDirRec = func(pathRel string, curLevel int, prefix string, isLast bool) {
+		// with CollapseChains, a chain of such directories shares the line of
+		// the innermost one, whose row it shows; each still counts as a level
+		names := []string{filepath.Base(pathRel)}
+		for opts.CollapseChains && curLevel > 0 && curLevel < opts.Levels {
+			next, ok := onlyChild(pathRel)
+			if !ok {
+				break
+			}
+			pathRel = next
+			curLevel++
+			names = append(names, filepath.Base(next))
+		}
+		stat := dirStats[pathRel]
+		// size string
+		sizeCombined := "0"
+		if val, ok := sizeStrMap[pathRel]; ok {
+			sizeCombined = val
+		} else if stat != nil {
+			sizeCombined = fo.size(stat.Size)
+		}
+		filesStr := ""
+		if opts.ShowFiles {
+			if stat != nil {
+				filesStr = formatFiles(stat.Files)
+			} else {
+				filesStr = "0"
+			}
+		}
+		avgStr := ""
+		if opts.ShowAvg {
+			if stat != nil {
+				avgStr = fo.avg(stat.Size, stat.Files)
+			} else {
+				avgStr = "-"
+			}
+		}
+
+		userStr := ""
+		groupStr := ""
+		showDirUser := opts.ShowUser && !opts.DominantOwner
+		if opts.ShowUser && opts.DominantOwner {
+			userStr = dominantOwner(res, pathRel)
+		}
+		if showDirUser || opts.ShowGroup {
+			if readMode {
+				if showDirUser {
+					if v, ok := res.DirOwners[pathRel]; ok {
+						userStr = v
+					}
+				}
+				if opts.ShowGroup {
+					if v, ok := res.DirGroups[pathRel]; ok {
+						groupStr = v
+					}
+				}
+			} else {
+				uid, gid, known := uint32(0), uint32(0), false
+				if stat != nil && stat.HasOwner {
+					uid, gid, known = stat.UID, stat.GID, true
+				} else {
+					full := rootAbs
+					if pathRel != "." {
+						full = filepath.Join(rootAbs, pathRel)
+					}
+					if info, err := os.Lstat(full); err == nil {
+						if st, ok := info.Sys().(*syscall.Stat_t); ok {
+							uid, gid, known = st.Uid, st.Gid, true
+						}
+					}
+				}
+				if known {
+					uidStr := strconv.FormatUint(uint64(uid), 10)
+					gidStr := strconv.FormatUint(uint64(gid), 10)
+					if showDirUser {
+						if u, err := lookupUserID(uidStr); err == nil {
+							userStr = u.Username
+						} else {
+							userStr = uidStr
+						}
+					}
+					if opts.ShowGroup {
+						if g, err := lookupGroupID(gidStr); err == nil {
+							groupStr = g.Name
+						} else {
+							groupStr = gidStr
+						}
+					}
+				}
+			}
+		}
+
+		var lead, name string
+		if curLevel == 0 {
+			name = rootAbs
+			if opts.NormalizePaths {
+				name = normalizePath(name)
+			}
+			if opts.RootLabel != "" {
+				name = opts.RootLabel
+			}
+		} else {
+			connector := conn.tee
+			if isLast {
+				connector = conn.last
+			}
+			name = strings.Join(names, "/")
+			if opts.NormalizePaths {
+				name = normalizePath(name)
+			}
+			lead = prefix + connector
+		}
+		name = fo.path(name)
+
+		printRow(sizeCombined, filesStr, avgStr, userStr, groupStr, lead, name, pathRel, dirSizes[pathRel])
+
+		if curLevel >= opts.Levels {
+			return
+		}
+
+		childPrefix := prefix
+		if curLevel >= 0 {
+			if isLast {
+				childPrefix += "    "
+			} else {
+				childPrefix += conn.pipe
+			}
+		}
+		kids, rest := largestChildren(children[pathRel], opts.TopChildren, dirSizes, opts.Sort)
+		for i, k := range kids {
+			last := i == len(kids)-1 && len(rest) == 0
+			printDirRec(k, curLevel+1, childPrefix, last)
+		}
+		if len(rest) > 0 {
+			// children beyond -top-children are summed into one line
+			var size, files int64
+			for _, k := range rest {
+				size += dirSizes[k]
+				if ds := dirStats[k]; ds != nil {
+					files += ds.Files
+				}
+			}
+			othersFiles := ""
+			if opts.ShowFiles {
+				othersFiles = formatFiles(files)
+			}
+			othersAvg := ""
+			if opts.ShowAvg {
+				othersAvg = fo.avg(size, files)
+			}
+			printRow(fo.size(size), othersFiles, othersAvg, "", "", childPrefix+conn.last, othersKey, "", -1)
+		}
+	}
+
+	printDirRec(".", 0, "", true)
+
+	// with DirCount, the owners' directory counts follow their file counts
+	dirsCol := func(int64) string { return "" }
+	if opts.DirCount {
+		dirsWidth := 0
+		for _, s := range userStats {
+			dirsWidth = max(dirsWidth, len(formatFiles(s.Dirs)))
+		}
+		for _, s := range groupStats {
+			dirsWidth = max(dirsWidth, len(formatFiles(s.Dirs)))
+		}
+		dirsCol = func(n int64) string { return fmt.Sprintf(" %*s dirs", dirsWidth, formatFiles(n)) }
+	}
+
+	// per-user summary
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, "Per-user summary:")
+	userNames := make([]string, 0, len(userStats))
+	for u, s := range userStats {
+		if s.Size >= opts.MinUserSize {
+			userNames = append(userNames, u)
+		}
+	}
+	sort.Slice(userNames, func(i, j int) bool { return userStats[userNames[i]].Size > userStats[userNames[j]].Size })
+	if opts.TopN > 0 && opts.TopN < len(userNames) {
+		userNames = userNames[:opts.TopN]
+	}
+	userLabels := ownerLabels(userNames, func(k string) (string, uint32) {
+		return displayName(userStats[k].Name, k), userStats[k].UID
+	}, "uid")
+	sortByLabel(userNames, userLabels, opts.Sort)
+	for _, u := range userNames {
+		s := userStats[u]
+		// combined user size string
+		sizeCombined := "0"
+		if val, ok := userSizeStr[u]; ok {
+			sizeCombined = val
+		} else if s != nil {
+			sizeCombined = fo.size(s.Size)
+		}
+		filesCount, dirsCount := int64(0), int64(0)
+		if s != nil {
+			filesCount, dirsCount = s.Files, s.Dirs
+		}
+		_, _ = fmt.Fprintf(w, "%-20s %"+strconv.Itoa(maxSizeWidth)+"s %"+strconv.Itoa(maxFilesWidth)+"s files%s\n", userLabels[u], sizeCombined, formatFiles(filesCount), dirsCol(dirsCount))
+	}
+	if opts.Concentration {
+		printConcentration(w, userConcentration(userStats))
+	}
+
+	// per-group summary
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, "Per-group summary:")
+	groupNames := make([]string, 0, len(groupStats))
+	for g, s := range groupStats {
+		if s.Size >= opts.MinGroupSize {
+			groupNames = append(groupNames, g)
+		}
+	}
+	sort.Slice(groupNames, func(i, j int) bool { return groupStats[groupNames[i]].Size > groupStats[groupNames[j]].Size })
+	if opts.TopN > 0 && opts.TopN < len(groupNames) {
+		groupNames = groupNames[:opts.TopN]
+	}
+	groupLabels := ownerLabels(groupNames, func(k string) (string, uint32) {
+		return displayName(groupStats[k].Name, k), groupStats[k].GID
+	}, "gid")
+	sortByLabel(groupNames, groupLabels, opts.Sort)
+	for _, g := range groupNames {
+		s := groupStats[g]
+		sizeCombined := "0"
+		if val, ok := groupSizeStr[g]; ok {
+			sizeCombined = val
+		} else if s != nil {
+			sizeCombined = fo.size(s.Size)
+		}
+		filesCount, dirsCount := int64(0), int64(0)
+		if s != nil {
+			filesCount, dirsCount = s.Files, s.Dirs
+		}
+		_, _ = fmt.Fprintf(w, "%-20s %"+strconv.Itoa(maxSizeWidth)+"s %"+strconv.Itoa(maxFilesWidth)+"s files%s\n", groupLabels[g], sizeCombined, formatFiles(filesCount), dirsCol(dirsCount))
+	}
+}
+
+// sortChildren sorts every children list in a -sort order, the order
+// printTree displays them in: by descending total size (fallback to name)
+// for sortSize or "", otherwise by name.
+func sortChildren(children map[string][]string, dirSizes map[string]int64, order string) {
+	less := nameLess(order)
+	for k := range children {
+		s := children[k]
+		sort.Slice(s, func(i, j int) bool {
+			if order == sortName || order == sortNatural {
+				return less(s[i], s[j])
+			}
+			si := dirSizes[s[i]]
+			sj := dirSizes[s[j]]
+			if si == sj {
+				return s[i] < s[j]
+			}
+			return si > sj
+		})
+		children[k] = s
+	}
+}
+
+// buildChildrenAndSizes builds the children map and dirSizes map from dirStats.
+func buildChildrenAndSizes(dirStats map[string]*DirStat) (map[string][]string, map[string]int64) {
+	children := make(map[string][]string)
+	for p := range dirStats {
+		if p == "." {
+			children["."] = children["."] // ensure key exists
+			continue
+		}
+		parent := filepath.Dir(p)
+		if parent == "" {
+			parent = "."
+		}
+		children[parent] = append(children[parent], p)
+		if _, ok := children[p]; !ok {
+			children[p] = []string{}
+		}
+	}
+	dirSizes := make(map[string]int64, len(dirStats))
+	for k, v := range dirStats {
+		dirSizes[k] = v.Size
+	}
+	return children, dirSizes
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPrintTreeTopChildren(t *testing.T) {
+	res := &Result{
+		Root:       "/data",
+		DirStats:   map[string]*DirStat{},
+		UserStats:  map[string]*UserStat{},
+		GroupStats: map[string]*GroupStat{},
+		DirOwners:  map[string]string{},
+	}
+	var total int64
+	for i := 1; i <= 10; i++ {
+		res.DirStats[fmt.Sprintf("d%02d", i)] = &DirStat{Size: int64(i * 100), Files: int64(i)}
+		total += int64(i * 100)
+	}
+	res.DirStats["."] = &DirStat{Size: total, Files: 55}
+
+	var out bytes.Buffer
+	printTree(&out, res, TreeOptions{Levels: 1, ShowFiles: true, TopChildren: 3, Format: FormatOptions{Bytes: true}})
+	tree := strings.SplitN(out.String(), "\n\n", 2)[0]
+	lines := strings.Split(strings.TrimSpace(tree), "\n")
+
+	// header, root, 3 children, others
+	if len(lines) != 6 {
+		t.Fatalf("expected 6 lines, got %d:\n%s", len(lines), tree)
+	}
+	for i, name := range []string{"├── d10", "├── d09", "├── d08"} {
+		if !strings.HasSuffix(lines[2+i], name) {
+			t.Fatalf("line %d = %q, want suffix %q", 2+i, lines[2+i], name)
+		}
+	}
+	// the remaining 7 children hold 2800 bytes in 28 files
+	if f := strings.Fields(lines[5]); len(f) != 4 || f[0] != "2800" || f[1] != "28" || f[3] != othersKey {
+		t.Fatalf("unexpected others line %q", lines[5])
+	}
+
+	// without the option every child is listed
+	out.Reset()
+	printTree(&out, res, TreeOptions{Levels: 1})
+	if strings.Contains(out.String(), othersKey) || !strings.Contains(out.String(), "d01") {
+		t.Fatalf("expected all children:\n%s", out.String())
+	}
+}
+
+func TestPrintTreeThresholdMarkers(t *testing.T) {
+	res := &Result{
+		Root: "/data",
+		DirStats: map[string]*DirStat{
+			".":     {Size: 3100},
+			"big":   {Size: 2000},
+			"mid":   {Size: 1000},
+			"small": {Size: 100},
+		},
+		UserStats:  map[string]*UserStat{},
+		GroupStats: map[string]*GroupStat{},
+		DirOwners:  map[string]string{},
+	}
+	render := func(opts TreeOptions) []string {
+		var out bytes.Buffer
+		opts.Levels = 1
+		opts.Format = FormatOptions{Bytes: true}
+		printTree(&out, res, opts)
+		tree := strings.SplitN(out.String(), "\n\n", 2)[0]
+		return strings.Split(strings.TrimSpace(tree), "\n")
+	}
+
+	lines := render(TreeOptions{WarnOver: 500, CriticalOver: 1500})
+	want := []string{
+		"Size   Path",
+		"3100 ! /data",
+		"2000 !     ├── big",
+		"1000 *     ├── mid",
+		" 100       └── small",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("plain markers:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+
+	lines = render(TreeOptions{WarnOver: 500, CriticalOver: 1500, Color: true})
+	if !strings.HasSuffix(lines[3], "├── "+ansiYellow+"mid"+ansiReset) || !strings.HasSuffix(lines[2], "├── "+ansiRed+"big"+ansiReset) {
+		t.Fatalf("expected colored big/mid lines, got %q", lines)
+	}
+	if strings.Contains(lines[4], "\033") {
+		t.Fatalf("line under both thresholds should not be colored: %q", lines[4])
+	}
+
+	// without thresholds the path column is unchanged
+	if lines := render(TreeOptions{}); lines[2] != "2000     ├── big" {
+		t.Fatalf("unexpected unmarked line %q", lines[2])
+	}
+}
+
+func TestPrintTreeAverageFileSize(t *testing.T) {
+	res := &Result{
+		Root: "/data",
+		DirStats: map[string]*DirStat{
+			".":     {Size: 3_000_100, Files: 1003},
+			"tiny":  {Size: 100, Files: 1000},
+			"big":   {Size: 3_000_000, Files: 3},
+			"empty": {},
+		},
+		UserStats:  map[string]*UserStat{},
+		GroupStats: map[string]*GroupStat{},
+		DirOwners:  map[string]string{},
+	}
+	var out bytes.Buffer
+	printTree(&out, res, TreeOptions{Levels: 1, ShowFiles: true, ShowAvg: true, Format: FormatOptions{Bytes: true}})
+	tree := strings.SplitN(out.String(), "\n\n", 2)[0]
+	want := []string{
+		"   Size Files     Avg Path",
+		"3000100 1003    2991 /data",
+		"3000000    3 1000000     ├── big",
+		"    100 1000       0     ├── tiny",
+		"      0    0       -     └── empty",
+	}
+	if got := strings.Split(strings.TrimRight(tree, "\n"), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("tree:\n%s\nwant:\n%s", tree, strings.Join(want, "\n"))
+	}
+
+	// humanized averages
+	out.Reset()
+	printTree(&out, res, TreeOptions{Levels: 1, ShowAvg: true})
+	if !strings.Contains(out.String(), " "+humanizeBytes(1_000_000)+"     ├── big") {
+		t.Fatalf("expected a humanized average for big:\n%s", out.String())
+	}
+}
+
+func TestPrintTreeWidthEllipsizesNames(t *testing.T) {
+	long := "a-very-long-directory-name-that-does-not-fit-anywhere"
+	res := &Result{
+		Root: "/data",
+		DirStats: map[string]*DirStat{
+			".":             {Size: 300, Files: 3},
+			long:            {Size: 200, Files: 2},
+			long + "/inner": {Size: 200, Files: 2},
+			"short":         {Size: 100, Files: 1},
+		},
+		UserStats:  map[string]*UserStat{},
+		GroupStats: map[string]*GroupStat{},
+		DirOwners:  map[string]string{},
+	}
+	opts := TreeOptions{Levels: 2, ShowFiles: true, Width: 40, Format: FormatOptions{Bytes: true}}
+	var out bytes.Buffer
+	printTree(&out, res, opts)
+	lines := strings.Split(strings.SplitN(out.String(), "\n\n", 2)[0], "\n")
+	want := []string{
+		"Size Files Path",
+		" 300   3 /data",
+		" 200   2     ├── a-very-long…it-anywhere",
+		" 200   2     │   └── inner",
+		" 100   1     └── short",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("tree:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+	for _, l := range lines {
+		if n := len([]rune(l)); n > 40 || (strings.Contains(l, "…") && n != 40) {
+			t.Fatalf("line %q is %d columns wide", l, n)
+		}
+	}
+
+	// ASCII output cuts with "..." and no width keeps the full name
+	out.Reset()
+	opts.Format.ASCII = true
+	printTree(&out, res, opts)
+	if !strings.Contains(out.String(), "|-- a-very-lon...t-anywhere\n") {
+		t.Fatalf("ascii tree:\n%s", out.String())
+	}
+	out.Reset()
+	opts.Width = 0
+	printTree(&out, res, opts)
+	if !strings.Contains(out.String(), long+"\n") {
+		t.Fatalf("name shortened without a width:\n%s", out.String())
+	}
+}
+
+func TestEllipsizeMiddle(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		w    int
+		want string
+	}{
+		{"abcdefghij", 10, "abcdefghij"},
+		{"abcdefghij", 0, "abcdefghij"},
+		{"abcdefghij", 7, "abc…hij"},
+		{"abcdefghij", 6, "abc…ij"},
+		{"abcdefghij", 1, "…"},
+	} {
+		if got := ellipsizeMiddle(tc.in, tc.w, "…"); got != tc.want {
+			t.Errorf("ellipsizeMiddle(%q, %d) = %q, want %q", tc.in, tc.w, got, tc.want)
+		}
+	}
+}
+
+func TestPrintTreeFixedUnit(t *testing.T) {
+	const gib, kib = 1 << 30, 1 << 10
+	res := &Result{
+		Root: "/data",
+		DirStats: map[string]*DirStat{
+			".":     {Size: 3 * gib, Files: 3},
+			"big":   {Size: 3*gib/2 + 1536*kib, Files: 2},
+			"small": {Size: 1536 * kib, Files: 1},
+		},
+		UserStats:  map[string]*UserStat{},
+		GroupStats: map[string]*GroupStat{},
+		DirOwners:  map[string]string{},
+	}
+
+	var out bytes.Buffer
+	printTree(&out, res, TreeOptions{Levels: 1, Format: FormatOptions{FixedUnit: true}})
+	tree := strings.SplitN(out.String(), "\n\n", 2)[0]
+	lines := strings.Split(strings.TrimSpace(tree), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %d:\n%s", len(lines), tree)
+	}
+	want := []string{"3.0GB", "1.5GB", "0.0GB"}
+	for i, line := range lines[1:] {
+		if !strings.HasPrefix(line, want[i]+" ") {
+			t.Fatalf("line %d = %q, want it to start with %q", i+1, line, want[i])
+		}
+	}
+
+	// the summary sizes use the tree's unit too
+	sizes, users, _, width, _ := ComputeSizeMapsAndWidths(map[string]int64{".": 3 * gib, "a": 512}, res.DirStats, map[string]*UserStat{"u": {Size: 2048}}, nil, FormatOptions{FixedUnit: true}, 0, 0, 0, 0)
+	if sizes["a"] != "0.0GB" || users["u"] != "0.0GB" || width != len("3.0GB") {
+		t.Fatalf("sizes = %v, users = %v, width %d; want all in GB", sizes, users, width)
+	}
+
+	// raw numbers are left alone, and small trees stay in bytes
+	if fo := (FormatOptions{FixedUnit: true, Bytes: true}).fixUnit(3 * gib); fo.size(1536) != "1536" {
+		t.Fatalf("fixUnit with -bytes printed %q", fo.size(1536))
+	}
+	if fo := (FormatOptions{FixedUnit: true}).fixUnit(800); fo.size(10) != "10B" {
+		t.Fatalf("fixUnit(800).size(10) = %q, want 10B", fo.size(10))
+	}
+}
+
+func TestPrintTreeCollapseChains(t *testing.T) {
+	res := &Result{
+		Root: "/data",
+		DirStats: map[string]*DirStat{
+			".":               {Size: 190, Files: 6},
+			"src":             {Size: 130, Files: 3},
+			"src/main":        {Size: 130, Files: 3},
+			"src/main/java":   {Size: 130, Files: 3},
+			"src/main/java/a": {Size: 100, Files: 2},
+			"src/main/java/b": {Size: 30, Files: 1},
+			// lib holds a file of its own, so it is not collapsed into lib/x
+			"lib":   {Size: 60, Files: 3},
+			"lib/x": {Size: 40, Files: 2},
+		},
+		UserStats:  map[string]*UserStat{},
+		GroupStats: map[string]*GroupStat{},
+		DirOwners:  map[string]string{},
+	}
+	render := func(levels int) []string {
+		var out bytes.Buffer
+		printTree(&out, res, TreeOptions{Levels: levels, ShowFiles: true, CollapseChains: true, Format: FormatOptions{Bytes: true}})
+		tree := strings.SplitN(out.String(), "\n\n", 2)[0]
+		return strings.Split(strings.TrimSpace(tree), "\n")[1:]
+	}
+
+	want := []string{
+		" 190   6 /data",
+		" 130   3     ├── src/main/java",
+		" 100   2     │   ├── a",
+		"  30   1     │   └── b",
+		"  60   3     └── lib",
+		"  40   2         └── x",
+	}
+	if got := render(5); !reflect.DeepEqual(got, want) {
+		t.Fatalf("tree =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// a chain stops at -levels like the directories it is made of
+	want = []string{
+		" 190   6 /data",
+		" 130   3     ├── src/main",
+		"  60   3     └── lib",
+		"  40   2         └── x",
+	}
+	if got := render(2); !reflect.DeepEqual(got, want) {
+		t.Fatalf("tree =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
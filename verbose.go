@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RunConfig is the effective configuration of a scan as -verbose reports it
+// on stderr before scanning: what the flags resolved to, so differing numbers
+// between two runs can be traced to their settings.
+type RunConfig struct {
+	Root        string
+	Concurrency int
+	Filters     []string // one description per active filter
+	SizeMode    string   // how file sizes are counted
+	Units       string   // how sizes are displayed
+	Outputs     []string // "<format> to <target>"
+}
+
+// newRunConfig describes a scan of root with opts, displayed with fo and
+// written to outputs.
+func newRunConfig(root string, opts ScanOptions, fo FormatOptions, outputs []string) RunConfig {
+	c := RunConfig{Root: root, Concurrency: max(opts.Concurrency, 1), Outputs: outputs}
+
+	fold := ""
+	if opts.Filter.IgnoreCase {
+		fold = " (ignoring case)"
+	}
+	for _, s := range opts.Filter.Contains {
+		c.Filters = append(c.Filters, fmt.Sprintf("path contains %q%s", s, fold))
+	}
+	for _, s := range opts.Filter.NotContains {
+		c.Filters = append(c.Filters, fmt.Sprintf("path does not contain %q%s", s, fold))
+	}
+	if opts.FileMinSize > 0 {
+		c.Filters = append(c.Filters, fmt.Sprintf("files of at least %d bytes", opts.FileMinSize))
+	}
+	if opts.FileMaxSize > 0 {
+		c.Filters = append(c.Filters, fmt.Sprintf("files of at most %d bytes", opts.FileMaxSize))
+	}
+	if !opts.ChangedSince.IsZero() {
+		c.Filters = append(c.Filters, "files changed since "+fo.localTime(opts.ChangedSince).Format(time.RFC3339))
+	}
+	if !opts.ModifiedBefore.IsZero() {
+		c.Filters = append(c.Filters, "files not modified after "+fo.localTime(opts.ModifiedBefore).Format(time.RFC3339Nano))
+	}
+	if opts.SkipRootFiles {
+		c.Filters = append(c.Filters, "files directly in the root skipped")
+	}
+	if len(opts.SkipDirs) > 0 {
+		c.Filters = append(c.Filters, fmt.Sprintf("%d mount point(s) skipped", len(opts.SkipDirs)))
+	}
+	if len(opts.DedupDevs) > 0 {
+		c.Filters = append(c.Filters, fmt.Sprintf("bind mounts deduplicated on %d device(s)", len(opts.DedupDevs)))
+	}
+	if opts.MaxFiles > 0 {
+		c.Filters = append(c.Filters, fmt.Sprintf("stop after %d files", opts.MaxFiles))
+	}
+
+	c.SizeMode = "apparent size"
+	if opts.BlockSize > 0 {
+		c.SizeMode = fmt.Sprintf("allocated size, rounded up to blocks of %d bytes", opts.BlockSize)
+	}
+
+	switch {
+	case fo.BlockSize > 0:
+		c.Units = fmt.Sprintf("blocks of %d bytes", fo.BlockSize)
+	case fo.Bits && fo.Bytes:
+		c.Units = "bits, raw numbers"
+	case fo.Bytes:
+		c.Units = "bytes, raw numbers"
+	case fo.Bits:
+		c.Units = "bits, decimal (1 Kb = 1000 b)"
+	default:
+		c.Units = "bytes, binary (1 KB = 1024 B)"
+	}
+	if fo.FixedUnit && !fo.Bytes && fo.BlockSize == 0 {
+		c.Units += ", one fixed unit"
+	}
+	return c
+}
+
+// String renders c as aligned "name: value" lines.
+func (c RunConfig) String() string {
+	none := func(list []string) string {
+		if len(list) == 0 {
+			return "none"
+		}
+		return strings.Join(list, ", ")
+	}
+	var b strings.Builder
+	for _, l := range [][2]string{
+		{"root", c.Root},
+		{"concurrency", strconv.Itoa(c.Concurrency)},
+		{"filters", none(c.Filters)},
+		{"size mode", c.SizeMode},
+		{"units", c.Units},
+		{"output", none(c.Outputs)},
+	} {
+		fmt.Fprintf(&b, "%-12s %s\n", l[0]+":", l[1])
+	}
+	return b.String()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunConfigString(t *testing.T) {
+	opts := ScanOptions{
+		Concurrency:  8,
+		Filter:       PathFilter{Contains: []string{"logs"}, IgnoreCase: true},
+		FileMinSize:  1024,
+		ChangedSince: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		BlockSize:    4096,
+	}
+	got := newRunConfig("/data", opts, FormatOptions{Bits: true}, []string{"json to out.json"}).String()
+	for _, want := range []string{
+		"root:        /data\n",
+		"concurrency: 8\n",
+		`filters:     path contains "logs" (ignoring case), files of at least 1024 bytes, files changed since 2024-01-02T03:04:05Z` + "\n",
+		"size mode:   allocated size, rounded up to blocks of 4096 bytes\n",
+		"units:       bits, decimal (1 Kb = 1000 b)\n",
+		"output:      json to out.json\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("verbose output lacks %q:\n%s", want, got)
+		}
+	}
+
+	got = newRunConfig("/data", ScanOptions{}, FormatOptions{}, nil).String()
+	for _, want := range []string{"concurrency: 1\n", "filters:     none\n", "size mode:   apparent size\n", "units:       bytes, binary (1 KB = 1024 B)\n", "output:      none\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("default verbose output lacks %q:\n%s", want, got)
+		}
+	}
+}
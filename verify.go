@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// Violation describes one broken invariant found by VerifySummary.
+type Violation struct {
+	Check   string // short identifier of the invariant, e.g. "dir-size"
+	Path    string // directory rel path the violation refers to (empty for global checks)
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Path != "" {
+		return fmt.Sprintf("%s: %s: %s", v.Check, v.Path, v.Message)
+	}
+	return fmt.Sprintf("%s: %s", v.Check, v.Message)
+}
+
+// VerifySummary checks the internal consistency of a loaded summary:
+//   - every directory's size and file count are >= the sums over its direct children
+//   - per-user and per-group totals add up to the root directory's totals
+//     (at most to them when -min-user-size/-min-group-size left some out)
+//   - stats.files_scanned matches the root directory's file count
+//   - root_total, when present, matches the root directory and stats.dirs_scanned
+//
+// A stats-only summary (-json-stats-only) has none of the arrays the checks
+// compare against and passes as is.
+//
+// Violations are returned in a deterministic order; an empty slice means the summary is consistent.
+func VerifySummary(jo JsonOut) []Violation {
+	if jo.statsOnly() {
+		return nil
+	}
+	var out []Violation
+
+	dirs := make(map[string]JsonDir, len(jo.Dirs))
+	for _, d := range jo.Dirs {
+		rel := d.Rel
+		if rel == "" {
+			rel = "."
+		}
+		if _, dup := dirs[rel]; dup {
+			out = append(out, Violation{Check: "dir-duplicate", Path: rel, Message: "directory listed more than once"})
+			continue
+		}
+		dirs[rel] = d
+	}
+
+	// sum direct children per parent
+	childSize := make(map[string]int64)
+	childFiles := make(map[string]int64)
+	for rel, d := range dirs {
+		if rel == "." {
+			continue
+		}
+		parent := filepath.Dir(rel)
+		childSize[parent] += d.Size
+		childFiles[parent] += d.Files
+	}
+
+	rels := make([]string, 0, len(dirs))
+	for rel := range dirs {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	for _, rel := range rels {
+		d := dirs[rel]
+		if cs := childSize[rel]; d.Size < cs {
+			out = append(out, Violation{Check: "dir-size", Path: rel, Message: fmt.Sprintf("size %d is less than the sum of its children's sizes %d", d.Size, cs)})
+		}
+		if cf := childFiles[rel]; d.Files < cf {
+			out = append(out, Violation{Check: "dir-files", Path: rel, Message: fmt.Sprintf("files %d is less than the sum of its children's files %d", d.Files, cf)})
+		}
+		if rel != "." {
+			if _, ok := dirs[filepath.Dir(rel)]; !ok {
+				out = append(out, Violation{Check: "dir-parent", Path: rel, Message: fmt.Sprintf("parent %q is missing", filepath.Dir(rel))})
+			}
+		}
+	}
+
+	root := dirs["."]
+
+	var userSize, userFiles int64
+	for _, u := range jo.Users {
+		userSize += u.Size
+		userFiles += u.Files
+	}
+	if !sumMatches(userSize, userFiles, root, jo.Stats.MinUserSize > 0) {
+		out = append(out, Violation{Check: "user-totals", Message: fmt.Sprintf("users sum to %d bytes / %d files, root has %d bytes / %d files", userSize, userFiles, root.Size, root.Files)})
+	}
+
+	var groupSize, groupFiles int64
+	for _, g := range jo.Grps {
+		groupSize += g.Size
+		groupFiles += g.Files
+	}
+	if !sumMatches(groupSize, groupFiles, root, jo.Stats.MinGroupSize > 0) {
+		out = append(out, Violation{Check: "group-totals", Message: fmt.Sprintf("groups sum to %d bytes / %d files, root has %d bytes / %d files", groupSize, groupFiles, root.Size, root.Files)})
+	}
+
+	if jo.Stats.FilesScanned != root.Files {
+		out = append(out, Violation{Check: "files-scanned", Message: fmt.Sprintf("stats.files_scanned is %d, root has %d files", jo.Stats.FilesScanned, root.Files)})
+	}
+
+	if t := jo.RootTotal; t != nil && (t.Size != root.Size || t.Files != root.Files || t.Dirs != jo.Stats.DirsScanned) {
+		out = append(out, Violation{Check: "root-total", Message: fmt.Sprintf("root_total is %d bytes / %d files / %d dirs, root has %d bytes / %d files and stats.dirs_scanned is %d", t.Size, t.Files, t.Dirs, root.Size, root.Files, jo.Stats.DirsScanned)})
+	}
+
+	return out
+}
+
+// sumMatches reports whether the per-user or per-group sums agree with the
+// root: equal, or at most its totals when partial (some were left out by
+// -min-user-size/-min-group-size).
+func sumMatches(size, files int64, root JsonDir, partial bool) bool {
+	if partial {
+		return size <= root.Size && files <= root.Files
+	}
+	return size == root.Size && files == root.Files
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func consistentFixture() JsonOut {
+	return JsonOut{
+		Root:  "/r",
+		Stats: JsonStats{FilesScanned: 3, DirsScanned: 3},
+		Dirs: []JsonDir{
+			{Rel: ".", Size: 600, Files: 3},
+			{Rel: "a", Size: 500, Files: 2},
+			{Rel: "a/b", Size: 300, Files: 1},
+		},
+		Users: []JsonUser{{Name: "u1", Size: 400, Files: 2}, {Name: "u2", Size: 200, Files: 1}},
+		Grps:  []JsonGroup{{Name: "g1", Size: 600, Files: 3}},
+	}
+}
+
+func TestVerifySummaryConsistent(t *testing.T) {
+	if vs := VerifySummary(consistentFixture()); len(vs) != 0 {
+		t.Fatalf("expected no violations, got %v", vs)
+	}
+}
+
+func TestVerifySummaryInconsistent(t *testing.T) {
+	jo := consistentFixture()
+	jo.Dirs[1].Size = 100                                             // a smaller than its child a/b
+	jo.Users[0].Size = 1                                              // users no longer sum to root
+	jo.Stats.FilesScanned = 7                                         // counter disagrees with root
+	jo.Dirs = append(jo.Dirs, JsonDir{Rel: "x/y", Size: 1, Files: 0}) // orphan
+
+	vs := VerifySummary(jo)
+	checks := map[string]Violation{}
+	for _, v := range vs {
+		checks[v.Check] = v
+	}
+	for _, want := range []string{"dir-size", "user-totals", "files-scanned", "dir-parent"} {
+		if _, ok := checks[want]; !ok {
+			t.Fatalf("expected %s violation, got %v", want, vs)
+		}
+	}
+	if _, ok := checks["group-totals"]; ok {
+		t.Fatalf("group totals are consistent, got %v", vs)
+	}
+	if v := checks["dir-size"]; v.Path != "a" || !strings.Contains(v.Message, "300") {
+		t.Fatalf("dir-size violation lacks specifics: %v", v)
+	}
+	if s := checks["user-totals"].String(); !strings.Contains(s, "201 bytes") {
+		t.Fatalf("user-totals message lacks specifics: %s", s)
+	}
+}
+
+func TestVerifySummaryStatsOnly(t *testing.T) {
+	res := &Result{
+		Root:         "/data",
+		DirStats:     map[string]*DirStat{".": {Size: 30, Files: 7}},
+		UserStats:    map[string]*UserStat{"1": {Size: 30, Files: 7, UID: 1, Name: "u"}},
+		GroupStats:   map[string]*GroupStat{"1": {Size: 30, Files: 7, GID: 1, Name: "g"}},
+		DirsScanned:  1,
+		FilesScanned: 7,
+	}
+	path := filepath.Join(t.TempDir(), "stats.json")
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		return StreamSummary(w, res, SummaryOptions{StatsOnly: true})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jo, err := LoadSummary(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !jo.statsOnly() {
+		t.Fatalf("summary not recognized as stats-only: %+v", jo)
+	}
+	if vs := VerifySummary(jo); len(vs) != 0 {
+		t.Fatalf("stats-only summary should verify, got %v", vs)
+	}
+	// a full summary always lists the root, so it is never taken for one
+	if consistentFixture().statsOnly() {
+		t.Fatal("full summary taken for stats-only")
+	}
+	if _, err := LoadSummaries([]string{path}, false); !errors.Is(err, errStatsOnly) {
+		t.Fatalf("loading stats-only summary for a tree: err = %v, want errStatsOnly", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// walkDirBySize walks the tree rooted at root like filepath.WalkDir, but visits
+// the entries of each directory biggest-first instead of in lexical order.
+// Files are weighed by their own size and subdirectories by a shallow estimate
+// (the sum of the files directly inside them), so a scan that gets truncated
+// by -max-files or -timeout has already covered the most significant data.
+//
+// The price is an extra ReadDir per directory and an Lstat per entry before
+// the entries are visited, which is why lexical order stays the default.
+func walkDirBySize(root string, fn fs.WalkDirFunc) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkBySize(root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func walkBySize(path string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		// report the read error on the directory, as filepath.WalkDir does
+		if err = fn(path, d, err); err != nil {
+			if err == filepath.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	weights := make(map[string]int64, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			weights[e.Name()] = shallowDirSize(filepath.Join(path, e.Name()))
+		} else if fi, err := e.Info(); err == nil {
+			weights[e.Name()] = fi.Size()
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return weights[entries[i].Name()] > weights[entries[j].Name()]
+	})
+
+	for _, e := range entries {
+		if err := walkBySize(filepath.Join(path, e.Name()), e, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// shallowDirSize sums the sizes of the non-directory entries directly inside dir.
+// Unreadable directories and entries count as zero.
+func shallowDirSize(dir string) int64 {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	var total int64
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if fi, err := e.Info(); err == nil {
+			total += fi.Size()
+		}
+	}
+	return total
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"sync"
+)
+
+// errorReporter streams the paths a scan skips because of an error to w as
+// they happen (-show-errors). Only the first limit paths of each reason
+// (e.g. "permission denied") are printed; the rest are counted and
+// summarized by Close.
+type errorReporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	limit  int
+	counts map[string]int
+}
+
+// defaultErrorLimit is how many errors of one reason -show-errors prints.
+const defaultErrorLimit = 10
+
+func newErrorReporter(w io.Writer, limit int) *errorReporter {
+	return &errorReporter{w: w, limit: limit, counts: make(map[string]int)}
+}
+
+// errorReason returns the part of err shared by all paths failing the same
+// way: the underlying error of a *fs.PathError, or err itself.
+func errorReason(err error) string {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return pe.Op + ": " + pe.Err.Error()
+	}
+	return err.Error()
+}
+
+// Report records that path was skipped because of err. It is safe for
+// concurrent use.
+func (e *errorReporter) Report(path string, err error) {
+	reason := errorReason(err)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.counts[reason]++
+	if n := e.counts[reason]; n <= e.limit {
+		fmt.Fprintf(e.w, "skipped %s: %s\n", path, reason)
+		if n == e.limit {
+			fmt.Fprintf(e.w, "further %q errors are suppressed\n", reason)
+		}
+	}
+}
+
+// Close prints how many errors of each reason were suppressed.
+func (e *errorReporter) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	reasons := make([]string, 0, len(e.counts))
+	for r, n := range e.counts {
+		if n > e.limit {
+			reasons = append(reasons, r)
+		}
+	}
+	sort.Strings(reasons)
+	for _, r := range reasons {
+		fmt.Fprintf(e.w, "%d more %q errors suppressed\n", e.counts[r]-e.limit, r)
+	}
+}
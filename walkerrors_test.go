@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestScanShowErrorsUnreadableDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read any directory")
+	}
+	root := t.TempDir()
+	locked := filepath.Join(root, "locked")
+	writeFile(t, filepath.Join(locked, "secret"), 10)
+	writeFile(t, filepath.Join(root, "ok"), 1)
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0755) })
+
+	for _, dirsOnly := range []bool{false, true} {
+		var stderr bytes.Buffer
+		errs := newErrorReporter(&stderr, defaultErrorLimit)
+		Scan(context.Background(), root, ScanOptions{Concurrency: 2, DirsOnly: dirsOnly, OnError: errs.Report})
+		errs.Close()
+		if want := "skipped " + locked + ": open: permission denied\n"; stderr.String() != want {
+			t.Fatalf("dirs-only=%v: stderr = %q, want %q", dirsOnly, stderr.String(), want)
+		}
+	}
+}
+
+func TestScanShowErrorsSuppressesRepeats(t *testing.T) {
+	root := t.TempDir()
+	failures := map[string]int{}
+	for i := 0; i < 5; i++ {
+		path := filepath.Join(root, fmt.Sprintf("f%d", i))
+		writeFile(t, path, 1)
+		failures[path] = 1
+	}
+	gone := filepath.Join(root, "gone")
+	writeFile(t, gone, 1)
+	stubLstat(t, failures, syscall.EACCES)
+	failures[gone] = 1 // a different reason is reported on its own
+
+	var stderr bytes.Buffer
+	errs := newErrorReporter(&stderr, 2)
+	Scan(context.Background(), root, ScanOptions{Concurrency: 1, OnError: func(path string, err error) {
+		if path == gone {
+			err = &os.PathError{Op: "lstat", Path: path, Err: syscall.ENOENT}
+		}
+		errs.Report(path, err)
+	}})
+	errs.Close()
+
+	out := stderr.String()
+	if n := strings.Count(out, ": lstat: permission denied\n"); n != 2 {
+		t.Fatalf("expected 2 permission denied lines, got %d:\n%s", n, out)
+	}
+	for _, want := range []string{
+		"skipped " + gone + ": lstat: no such file or directory\n",
+		"further \"lstat: permission denied\" errors are suppressed\n",
+		"3 more \"lstat: permission denied\" errors suppressed\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "no such file or directory\" errors") {
+		t.Fatalf("reason below the limit was summarized:\n%s", out)
+	}
+}
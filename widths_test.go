@@ -21,7 +21,7 @@ func TestComputeSizeMapsAndWidths_AutoFitHuman(t *testing.T) {
 	}
 	groups := map[string]*GroupStat{}
 
-	sizeMap, _, _, sw, fw := ComputeSizeMapsAndWidths(dirs, dirstats, users, groups, false, 0, 0)
+	sizeMap, _, _, sw, fw := ComputeSizeMapsAndWidths(dirs, dirstats, users, groups, FormatOptions{}, 0, 0, 0, 0)
 	// expect size strings like "2.0MB", "1.5KB", "512B"
 	if sizeMap["."] != "2.0MB" || sizeMap["a"] != "1.5KB" || sizeMap["b"] != "512B" {
 		t.Fatalf("unexpected sizeMap values: %v", sizeMap)
@@ -42,7 +42,7 @@ func TestComputeSizeMapsAndWidths_BytesOverride(t *testing.T) {
 	users := map[string]*UserStat{"u": {Size: 2777066, Files: 13}}
 	groups := map[string]*GroupStat{}
 
-	_, _, _, sw, fw := ComputeSizeMapsAndWidths(dirs, dirstats, users, groups, true, 0, 0)
+	_, _, _, sw, fw := ComputeSizeMapsAndWidths(dirs, dirstats, users, groups, FormatOptions{Bytes: true}, 0, 0, 0, 0)
 	// bytes length should be at least len("2777066") == 7
 	if sw < 7 {
 		t.Fatalf("expected size width >=7, got %d", sw)
@@ -58,7 +58,7 @@ func TestComputeSizeMapsAndWidths_OverridesAndTop(t *testing.T) {
 	users := map[string]*UserStat{}
 	groups := map[string]*GroupStat{}
 
-	_, _, _, sw, fw := ComputeSizeMapsAndWidths(dirs, dirstats, users, groups, false, 10, 6)
+	_, _, _, sw, fw := ComputeSizeMapsAndWidths(dirs, dirstats, users, groups, FormatOptions{}, 10, 6, 0, 0)
 	if sw != 10 {
 		t.Fatalf("expected size width override 10, got %d", sw)
 	}
@@ -66,3 +66,57 @@ func TestComputeSizeMapsAndWidths_OverridesAndTop(t *testing.T) {
 		t.Fatalf("expected files width override 6, got %d", fw)
 	}
 }
+
+func TestComputeSizeMapsAndWidths_BitsAndHumanFiles(t *testing.T) {
+	dirs := map[string]int64{".": 1000000}
+	dirstats := map[string]*DirStat{".": {Size: 1000000, Files: 1234567}}
+	users := map[string]*UserStat{}
+	groups := map[string]*GroupStat{}
+
+	sizeMap, _, _, sw, fw := ComputeSizeMapsAndWidths(dirs, dirstats, users, groups, FormatOptions{Bits: true, Bytes: true, HumanFiles: true}, 0, 0, 0, 0)
+	if sizeMap["."] != "8000000" {
+		t.Fatalf("expected raw bit count, got %q", sizeMap["."])
+	}
+	if sw != 7 {
+		t.Fatalf("expected size width 7, got %d", sw)
+	}
+	// "1.2M" rather than "1234567"
+	if fw != 4 {
+		t.Fatalf("expected files width 4 for humanized count, got %d", fw)
+	}
+}
+
+func TestComputeSizeMapsAndWidths_Caps(t *testing.T) {
+	dirs := map[string]int64{".": 123456789012, "a": 12}
+	dirstats := map[string]*DirStat{".": {Size: dirs["."], Files: 1234567}, "a": {Size: 12, Files: 1}}
+	users := map[string]*UserStat{"u": {Size: dirs["."], Files: 1234567}}
+	groups := map[string]*GroupStat{}
+	fo := FormatOptions{Bytes: true}
+
+	// the cap bounds the auto-fit width and ellipsizes wider values
+	sizeMap, userMap, _, sw, fw := ComputeSizeMapsAndWidths(dirs, dirstats, users, groups, fo, 0, 0, 8, 5)
+	if sw != 8 || fw != 5 {
+		t.Fatalf("expected capped widths 8/5, got %d/%d", sw, fw)
+	}
+	if sizeMap["."] != "1234567…" || userMap["u"] != "1234567…" || sizeMap["a"] != "12" {
+		t.Fatalf("unexpected capped values: %v %v", sizeMap, userMap)
+	}
+
+	// a cap below the minimum widths yields the minimum
+	_, _, _, sw, fw = ComputeSizeMapsAndWidths(dirs, dirstats, users, groups, fo, 0, 0, 2, 1)
+	if sw != 4 || fw != 3 {
+		t.Fatalf("expected floor 4/3 to win over caps, got %d/%d", sw, fw)
+	}
+
+	// explicit overrides win over caps and leave values untouched
+	sizeMap, _, _, sw, fw = ComputeSizeMapsAndWidths(dirs, dirstats, users, groups, fo, 20, 9, 8, 5)
+	if sw != 20 || fw != 9 || sizeMap["."] != "123456789012" {
+		t.Fatalf("expected overrides 20/9 with full values, got %d/%d %v", sw, fw, sizeMap)
+	}
+
+	// a cap wider than the content does not widen the column
+	_, _, _, sw, _ = ComputeSizeMapsAndWidths(map[string]int64{".": 5}, map[string]*DirStat{".": {Size: 5}}, nil, nil, fo, 0, 0, 30, 0)
+	if sw != 4 {
+		t.Fatalf("expected auto-fit width 4 under a wide cap, got %d", sw)
+	}
+}